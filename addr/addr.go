@@ -31,7 +31,11 @@ func ReadIPv4Mask(buf []byte, offset int) net.IPMask {
 	return net.IPv4Mask(buf[offset], buf[offset+1], buf[offset+2], buf[offset+3])
 }
 
+// WriteIPv4(): ipaddr may be either in 4-byte or 16-byte form
 func WriteIPv4(buf []byte, offset int, ipaddr net.IP) {
+	if ip4 := ipaddr.To4(); ip4 != nil {
+		ipaddr = ip4
+	}
 	buf[offset] = ipaddr[0]
 	buf[offset+1] = ipaddr[1]
 	buf[offset+2] = ipaddr[2]
@@ -25,3 +25,42 @@ func test(t *testing.T, n1, n2 *net.IPNet, expected bool) {
 		t.Errorf("intersect(%v,%v)=%v expected=%v", n1, n2, result, expected)
 	}
 }
+
+func TestWriteIPv4(t *testing.T) {
+	buf := make([]byte, 4)
+	WriteIPv4(buf, 0, ReadIPv4([]byte{192, 168, 1, 0}, 0)) // 16-byte form
+	if got := net.IP(buf); !got.Equal(net.IPv4(192, 168, 1, 0)) {
+		t.Errorf("WriteIPv4: want 192.168.1.0, got %v", got)
+	}
+}
+
+func TestParseAsn(t *testing.T) {
+	for _, c := range []struct {
+		s   string
+		asn uint32
+		ok  bool
+	}{
+		{"1", 1, true},
+		{"65535", 65535, true},
+		{"65536", 65536, true},
+		{"4294967295", 4294967295, true},
+		{"1.0", 65536, true},
+		{"1.10", 65546, true},
+		{"0.65535", 65535, true},
+		{"65535.65535", 4294967295, true},
+		{"0", 0, false},
+		{"0.0", 0, false},
+		{"4294967296", 0, false},
+		{"65536.0", 0, false},
+		{"1.", 0, false},
+		{".1", 0, false},
+		{"1.2.3", 0, false},
+		{"-1", 0, false},
+		{"as1", 0, false},
+	} {
+		asn, err := ParseAsn(c.s)
+		if (err == nil) != c.ok || asn != c.asn {
+			t.Errorf("ParseAsn(%q): want asn=%d ok=%v got asn=%d err=%v", c.s, c.asn, c.ok, asn, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package addr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ParseAsn(): RFC5396 4-octet AS number.
+Accepts asplain (65536) and asdot (1.0) notations.
+*/
+func ParseAsn(s string) (uint32, error) {
+	var asn uint64
+
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		high, errHigh := strconv.ParseUint(s[:dot], 10, 16)
+		if errHigh != nil {
+			return 0, fmt.Errorf("bad asdot AS number: '%s': %v", s, errHigh)
+		}
+		low, errLow := strconv.ParseUint(s[dot+1:], 10, 16)
+		if errLow != nil {
+			return 0, fmt.Errorf("bad asdot AS number: '%s': %v", s, errLow)
+		}
+		asn = high<<16 | low
+	} else {
+		var err error
+		if asn, err = strconv.ParseUint(s, 10, 32); err != nil {
+			return 0, fmt.Errorf("bad AS number: '%s': %v", s, err)
+		}
+	}
+
+	if asn == 0 {
+		return 0, fmt.Errorf("AS number out of range 1-4294967295: %s", s)
+	}
+
+	return uint32(asn), nil
+}
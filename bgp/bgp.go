@@ -4,11 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	//"net"
+	"net"
 	"strconv"
-	//"strings"
+	"strings"
 	"time"
 
+	"github.com/udhos/nexthop/addr"
+	"github.com/udhos/nexthop/bgpwire"
 	"github.com/udhos/nexthop/cli"
 	"github.com/udhos/nexthop/command"
 	"github.com/udhos/nexthop/fwd"
@@ -25,7 +27,8 @@ type Bgp struct {
 
 	hardware fwd.Dataplane
 
-	//router *BgpRouter
+	router   *BgpRouter
+	routerId net.IP // configured router-id, if any
 }
 
 func (r Bgp) CmdRoot() *command.CmdNode {
@@ -156,14 +159,36 @@ func installCommands(root *command.CmdNode) {
 	cmdConf := command.CMD_CONF
 
 	command.CmdInstall(root, cmdConf, "hostname (HOSTNAME)", command.CONF, command.HelperHostname, command.ApplyBogus, "Hostname")
+	command.CmdInstall(root, cmdNone, "show ip bgp", command.EXEC, cmdShowBgp, nil, "Show BGP routes")
+	command.CmdInstall(root, cmdNone, "show ip bgp {NETWORK}", command.EXEC, cmdShowBgpNetwork, nil, "Show BGP paths for network")
+	command.CmdInstall(root, cmdNone, "show ip bgp ipv6 unicast", command.EXEC, cmdShowBgp, nil, "Show BGP IPv6 unicast routes")
+	command.CmdInstall(root, cmdNone, "show ip bgp ipv6 unicast {NETWORK}", command.EXEC, cmdShowBgpNetwork, nil, "Show BGP paths for IPv6 network")
+	command.CmdInstall(root, cmdNone, "show ip bgp neighbors", command.EXEC, cmdShowBgpNeighbors, nil, "Show BGP neighbors")
 	command.CmdInstall(root, cmdNone, "show version", command.EXEC, cmdVersion, nil, "Show version")
 	//command.CmdInstall(root, cmdConf, "router bgp {ASN}", command.CONF, cmdBgp, applyBgp, "Enable BGP protocol")
+	command.CmdInstall(root, cmdConf, "router bgp {ASN} neighbor {IPADDR} address-family ipv6 unicast", command.CONF, cmdNeighFamily, applyNeighFamily, "Exchange IPv6 unicast routes with BGP neighbor")
 	command.CmdInstall(root, cmdConf, "router bgp {ASN} neighbor {IPADDR} description {ANY}", command.CONF, cmdNeighDesc, command.ApplyBogus, "BGP neighbor description")
 	command.CmdInstall(root, cmdConf, "router bgp {ASN} neighbor {IPADDR} remote-as (ASN)", command.CONF, cmdNeighAsn, applyNeighAsn, "BGP neighbor ASN")
+	command.CmdInstall(root, cmdConf, "router bgp {ASN} neighbor {IPADDR} weight (WEIGHT)", command.CONF, cmdNeighWeight, applyNeighWeight, "BGP neighbor weight")
+	command.CmdInstall(root, cmdConf, "router bgp {ASN} router-id (IPADDR)", command.CONF, cmdRouterId, applyRouterId, "BGP router identifier")
 
 	// Node description is used for pretty display in command help.
 	// It is not strictly required, but its lack is reported by the command command.MissingDescription().
 	command.DescInstall(root, "hostname", "Assign hostname")
+	command.DescInstall(root, "router", "Configure routing")
+	command.DescInstall(root, "router bgp", "BGP protocol")
+	command.DescInstall(root, "router bgp {ASN}", "BGP autonomous system number")
+	command.DescInstall(root, "router bgp {ASN} neighbor", "Specify a BGP neighbor")
+	command.DescInstall(root, "router bgp {ASN} neighbor {IPADDR}", "BGP neighbor address")
+	command.DescInstall(root, "router bgp {ASN} neighbor {IPADDR} address-family", "BGP neighbor address family")
+	command.DescInstall(root, "router bgp {ASN} neighbor {IPADDR} address-family ipv6", "BGP neighbor IPv6 address family")
+	command.DescInstall(root, "router bgp {ASN} neighbor {IPADDR} description", "BGP neighbor description")
+	command.DescInstall(root, "router bgp {ASN} neighbor {IPADDR} remote-as", "BGP neighbor ASN")
+	command.DescInstall(root, "router bgp {ASN} neighbor {IPADDR} weight", "Preference for routes from BGP neighbor")
+	command.DescInstall(root, "router bgp {ASN} router-id", "BGP router identifier")
+	command.DescInstall(root, "show ip", "Show IP information")
+	command.DescInstall(root, "show ip bgp", "Show BGP information")
+	command.DescInstall(root, "show ip bgp ipv6", "Show BGP IPv6 information")
 
 	command.MissingDescription(root)
 }
@@ -213,9 +238,314 @@ func applyNeighAsn(ctx command.ConfContext, node *command.CmdNode, action comman
 		return nil
 	}
 
+	// router bgp ASN neighbor IPADDR remote-as ASN
+	f := strings.Fields(action.Cmd)
+	asnStr := f[2]
+	nbrStr := f[4]
+	remoteAsStr := f[6]
+
+	nbr := net.ParseIP(nbrStr)
+	if nbr == nil {
+		return fmt.Errorf("applyNeighAsn: bad neighbor address: '%s'", nbrStr)
+	}
+	remoteAsn, err := addr.ParseAsn(remoteAsStr)
+	if err != nil {
+		return fmt.Errorf("applyNeighAsn: %v", err)
+	}
+	remoteAs := int(remoteAsn)
+
+	if action.Enable {
+		router, errEnable := enableBgp(bgp, asnStr, true) // try to enable bgp
+		if errEnable != nil {
+			return errEnable
+		}
+		if err := router.NeighborAdd(nbr, remoteAs); err != nil {
+			return err
+		}
+		// address family and weight configured before neighbor was added
+		if cand, _ := bgp.ConfRootCandidate().Get(bgpNeighFamilyPath(asnStr, nbrStr, bgpwire.IPv6Unicast)); cand != nil {
+			if err := router.NeighborFamily(nbr, bgpwire.IPv6Unicast, true); err != nil {
+				return err
+			}
+		}
+		if cand, _ := bgp.ConfRootCandidate().Get(bgpNeighWeightPath(asnStr, nbrStr)); cand != nil && len(cand.Children) > 0 {
+			if weight, err := bgpParseWeight(command.LastToken(cand.Children[0].Path)); err == nil {
+				return router.NeighborWeight(nbr, weight)
+			}
+		}
+		return nil
+	}
+
+	if _, errCheck := bgpAsnCheck(bgp, asnStr); errCheck != nil || bgp.router == nil {
+		return fmt.Errorf("applyNeighAsn: bgp %s not running", asnStr)
+	}
+
+	if err := bgp.router.NeighborDel(nbr); err != nil {
+		return err
+	}
+
+	enableBgp(bgp, asnStr, false) // disable bgp if needed
+
 	return nil
 }
 
+func cmdNeighFamily(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func applyNeighFamily(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	bgp := bgpCtx(ctx, c)
+	if bgp == nil {
+		return nil
+	}
+
+	// router bgp ASN neighbor IPADDR address-family ipv6 unicast
+	f := strings.Fields(action.Cmd)
+	asnStr := f[2]
+	nbrStr := f[4]
+
+	nbr := net.ParseIP(nbrStr)
+	if nbr == nil {
+		return fmt.Errorf("applyNeighFamily: bad neighbor address: '%s'", nbrStr)
+	}
+
+	if bgp.router == nil {
+		return nil // picked up when neighbor is added
+	}
+
+	if _, err := bgpAsnCheck(bgp, asnStr); err != nil {
+		return fmt.Errorf("applyNeighFamily: %v", err)
+	}
+
+	if !bgp.router.HasNeighbor(nbr) {
+		return nil // picked up when neighbor is added
+	}
+
+	return bgp.router.NeighborFamily(nbr, bgpwire.IPv6Unicast, action.Enable)
+}
+
+// bgpNeighFamilyPath(): config path activating address family for neighbor
+func bgpNeighFamilyPath(asnStr, nbrStr string, f bgpwire.Family) string {
+	return fmt.Sprintf("router bgp %s neighbor %s address-family %s", asnStr, nbrStr, f)
+}
+
+func cmdNeighWeight(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func applyNeighWeight(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	bgp := bgpCtx(ctx, c)
+	if bgp == nil {
+		return nil
+	}
+
+	// router bgp ASN neighbor IPADDR weight WEIGHT
+	f := strings.Fields(action.Cmd)
+	asnStr := f[2]
+	nbrStr := f[4]
+	weightStr := f[6]
+
+	nbr := net.ParseIP(nbrStr)
+	if nbr == nil {
+		return fmt.Errorf("applyNeighWeight: bad neighbor address: '%s'", nbrStr)
+	}
+	weight, err := bgpParseWeight(weightStr)
+	if err != nil {
+		return fmt.Errorf("applyNeighWeight: %v", err)
+	}
+	if !action.Enable {
+		weight = 0
+	}
+
+	if bgp.router == nil {
+		return nil // picked up when neighbor is added
+	}
+
+	if _, err := bgpAsnCheck(bgp, asnStr); err != nil {
+		return fmt.Errorf("applyNeighWeight: %v", err)
+	}
+
+	if !bgp.router.HasNeighbor(nbr) {
+		return nil // picked up when neighbor is added
+	}
+
+	return bgp.router.NeighborWeight(nbr, weight)
+}
+
+// bgpNeighWeightPath(): config path holding weight for neighbor
+func bgpNeighWeightPath(asnStr, nbrStr string) string {
+	return fmt.Sprintf("router bgp %s neighbor %s weight", asnStr, nbrStr)
+}
+
+// bgpParseWeight(): neighbor weight ranges from 0 to 65535
+func bgpParseWeight(s string) (int, error) {
+	weight, err := strconv.Atoi(s)
+	if err != nil || weight < 0 || weight > 65535 {
+		return 0, fmt.Errorf("bad weight: '%s'", s)
+	}
+	return weight, nil
+}
+
+func cmdRouterId(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func applyRouterId(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	bgp := bgpCtx(ctx, c)
+	if bgp == nil {
+		return nil
+	}
+
+	// router bgp ASN router-id IPADDR
+	f := strings.Fields(action.Cmd)
+	asnStr := f[2]
+	idStr := f[4]
+
+	id := net.ParseIP(idStr)
+	if id == nil || id.To4() == nil || id.Equal(net.IPv4zero) {
+		return fmt.Errorf("applyRouterId: bad router-id: '%s'", idStr)
+	}
+
+	if action.Enable {
+		bgp.routerId = id
+	} else {
+		bgp.routerId = nil
+	}
+
+	if bgp.router == nil {
+		return nil // picked up when bgp is enabled
+	}
+
+	if _, err := bgpAsnCheck(bgp, asnStr); err != nil {
+		return fmt.Errorf("applyRouterId: %v", err)
+	}
+
+	bgp.router.SetRouterId(bgpRouterId(bgp))
+
+	return nil
+}
+
+// bgpAsnCheck(): running instance must match configured ASN
+func bgpAsnCheck(bgp *Bgp, asnStr string) (int, error) {
+	asn, err := addr.ParseAsn(asnStr)
+	if err != nil {
+		return 0, err
+	}
+	if bgp.router != nil && bgp.router.asn != int(asn) {
+		return 0, fmt.Errorf("bgp %d already running", bgp.router.asn)
+	}
+	return int(asn), nil
+}
+
+/*
+enableBgp(): start BGP instance for ASN, if needed.
+Disabling stops the instance only after its config is fully removed.
+*/
+func enableBgp(bgp *Bgp, asnStr string, enable bool) (*BgpRouter, error) {
+
+	asn, err := bgpAsnCheck(bgp, asnStr)
+	if err != nil {
+		return nil, fmt.Errorf("enableBgp: %v", err)
+	}
+
+	if enable {
+		if bgp.router == nil {
+			bgp.router = NewBgpRouter(asn, bgpRouterId(bgp), bgp.hardware)
+		}
+		return bgp.router, nil
+	}
+
+	if cand, _ := bgp.ConfRootCandidate().Get("router bgp " + asnStr); cand != nil {
+		return bgp.router, nil // router still in place
+	}
+
+	if bgp.router == nil {
+		return nil, nil // bgp not running
+	}
+
+	bgp.router.Stop()
+	bgp.router = nil
+
+	return nil, nil
+}
+
+// bgpRouterId(): configured router-id, otherwise highest interface IPv4 address
+func bgpRouterId(bgp *Bgp) net.IP {
+	if bgp.routerId != nil {
+		return bgp.routerId
+	}
+
+	id := net.IPv4zero
+	ifaces, _, err := bgp.hardware.Interfaces()
+	if err != nil {
+		log.Printf("bgpRouterId: %v", err)
+	}
+	for _, ifname := range ifaces {
+		addrs, _ := bgp.hardware.InterfaceAddressGet(ifname)
+		for _, a := range addrs {
+			ip4 := a.IP.To4()
+			if ip4 == nil || ip4.IsLoopback() {
+				continue
+			}
+			if bgpIdLess(id, ip4) {
+				id = ip4
+			}
+		}
+	}
+	if id.Equal(net.IPv4zero) {
+		log.Printf("bgpRouterId: no IPv4 address found: please configure router-id")
+	}
+	return id
+}
+
+func cmdShowBgp(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	bgp := ctx.(*Bgp)
+	if bgp.router == nil {
+		c.Sendln("BGP not running")
+		return
+	}
+
+	// show ip bgp
+	// show ip bgp ipv6 unicast
+	f := bgpwire.IPv4Unicast
+	if strings.HasSuffix(node.Path, " ipv6 unicast") {
+		f = bgpwire.IPv6Unicast
+	}
+
+	bgp.router.ShowRoutes(c, f)
+}
+
+func cmdShowBgpNetwork(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	bgp := ctx.(*Bgp)
+	if bgp.router == nil {
+		c.Sendln("BGP not running")
+		return
+	}
+
+	// show ip bgp NETWORK
+	// show ip bgp ipv6 unicast NETWORK
+	f := strings.Fields(line)
+	_, prefix, err := net.ParseCIDR(f[len(f)-1])
+	if err != nil {
+		c.Sendln(fmt.Sprintf("bad network: %v", err))
+		return
+	}
+
+	bgp.router.ShowRoute(c, *prefix)
+}
+
+func cmdShowBgpNeighbors(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	bgp := ctx.(*Bgp)
+	if bgp.router == nil {
+		c.Sendln("BGP not running")
+		return
+	}
+	bgp.router.ShowNeighbors(c)
+}
+
 func cmdNeighDesc(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
 	// line: "router    bgp XXX  neighbor YYY    descr   AAA   BBB  CCC "
 	//                                                   ^^^^^^^^^^^
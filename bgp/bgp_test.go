@@ -3,8 +3,13 @@ package main
 import (
 	"fmt"
 	"log"
-	//"testing"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
 
+	"github.com/udhos/nexthop/bgpwire"
 	"github.com/udhos/nexthop/command"
 	"github.com/udhos/nexthop/fwd"
 )
@@ -167,6 +172,28 @@ func Example_diff2() {
 	// router bgp 2 neighbor 4.4.4.4 remote-as 3
 }
 
+func Example_diff3() {
+
+	app, c := setup_diff()
+
+	f := func(s string) {
+		if err := command.Dispatch(app, s, c, command.CONF, false); err != nil {
+			log.Printf("dispatch: [%s]: %v", s, err)
+		}
+	}
+
+	f("router bgp 1 neighbor 1.1.1.1 remote-as 2")
+	f("router bgp 1 neighbor 1.1.1.1 weight 10")
+	f("router bgp 1 neighbor 1.1.1.1 weight 20")
+	f("router bgp 1 neighbor 2.2.2.2 weight 30")
+
+	command.WriteConfig(app.confRootCandidate, &outputWriter{})
+	// Output:
+	// router bgp 1 neighbor 1.1.1.1 remote-as 2
+	// router bgp 1 neighbor 1.1.1.1 weight 20
+	// router bgp 1 neighbor 2.2.2.2 weight 30
+}
+
 func setup_diff() (*bgpTestApp, *bgpTestClient) {
 	app := &bgpTestApp{
 		cmdRoot:           &command.CmdNode{MinLevel: command.EXEC},
@@ -201,6 +228,7 @@ func setup_diff() (*bgpTestApp, *bgpTestClient) {
 	command.CmdInstall(root, cmdNone, "show version", command.EXEC, cmdVersion, nil, "Show version")
 	command.CmdInstall(root, cmdConf, "router bgp {ASN} neighbor {IPADDR} description {ANY}", command.CONF, cmdNeighDesc, command.ApplyBogus, "BGP neighbor description")
 	command.CmdInstall(root, cmdConf, "router bgp {ASN} neighbor {IPADDR} remote-as (ASN)", command.CONF, cmdNeighAsn, applyNeighAsn, "BGP neighbor ASN")
+	command.CmdInstall(root, cmdConf, "router bgp {ASN} neighbor {IPADDR} weight (WEIGHT)", command.CONF, cmdNeighWeight, applyNeighWeight, "BGP neighbor weight")
 
 	outputSinkFunc := func(m string) {
 	}
@@ -208,3 +236,791 @@ func setup_diff() (*bgpTestApp, *bgpTestClient) {
 
 	return app, c
 }
+
+// bgpTestPair(): two routers listening on the same port at distinct loopback addresses
+func wantBgpError(t *testing.T, label string, err error, code, subcode int) {
+	e, ok := err.(*bgpwire.Error)
+	if !ok {
+		t.Errorf("%s: want bgp error %d/%d, got: %v", label, code, subcode, err)
+		return
+	}
+	if e.Code != code || e.Subcode != subcode {
+		t.Errorf("%s: want bgp error %d/%d, got: %d/%d %s", label, code, subcode, e.Code, e.Subcode, e.Reason)
+	}
+}
+
+func bgpTestPair(t *testing.T, as1, as2 int) (*BgpRouter, *BgpRouter) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("free port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	r1 := allocRouter(as1, net.ParseIP("1.1.1.1"), net.ParseIP("127.0.0.1"), port)
+	r2 := allocRouter(as2, net.ParseIP("2.2.2.2"), net.ParseIP("127.0.0.2"), port)
+	for _, r := range []*BgpRouter{r1, r2} {
+		r.connectRetry = 200 * time.Millisecond
+		if err := r.listen(); err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		go r.run()
+	}
+	return r1, r2
+}
+
+// waitState(): wait for neighbor FSM to reach state
+func waitState(t *testing.T, r *BgpRouter, nbr net.IP, want int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state, sessions := r.neighborState(nbr)
+		if state == want && (state != BGP_ESTABLISHED || sessions == 1) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("as%d neighbor %v: want state=%s got state=%s sessions=%d", r.asn, nbr, bgpStateName(want), bgpStateName(state), sessions)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestBgpSession(t *testing.T) {
+	r1, r2 := bgpTestPair(t, 1, 2)
+	defer r2.Stop()
+
+	addr1 := net.ParseIP("127.0.0.1")
+	addr2 := net.ParseIP("127.0.0.2")
+
+	// both sides connect at once: collision must leave a single session
+	if err := r1.NeighborAdd(addr2, 2); err != nil {
+		t.Fatalf("neighbor add: %v", err)
+	}
+	if err := r2.NeighborAdd(addr1, 1); err != nil {
+		t.Fatalf("neighbor add: %v", err)
+	}
+	waitState(t, r1, addr2, BGP_ESTABLISHED)
+	waitState(t, r2, addr1, BGP_ESTABLISHED)
+
+	// deconfigured neighbor sends Cease: remote side falls back, then reconnects
+	if err := r1.NeighborDel(addr2); err != nil {
+		t.Fatalf("neighbor del: %v", err)
+	}
+	if state, _ := r2.neighborState(addr1); state == BGP_ESTABLISHED {
+		waitState(t, r2, addr1, BGP_IDLE)
+	}
+	if err := r1.NeighborAdd(addr2, 2); err != nil {
+		t.Fatalf("neighbor re-add: %v", err)
+	}
+	waitState(t, r2, addr1, BGP_ESTABLISHED)
+
+	r1.Stop()
+	if state, _ := r2.neighborState(addr1); state == BGP_ESTABLISHED {
+		waitState(t, r2, addr1, BGP_IDLE)
+	}
+}
+
+func TestBgpOpenReject(t *testing.T) {
+	r1, r2 := bgpTestPair(t, 1, 2)
+	defer r1.Stop()
+	defer r2.Stop()
+
+	addr1 := net.ParseIP("127.0.0.1")
+	addr2 := net.ParseIP("127.0.0.2")
+
+	r1.NeighborAdd(addr2, 3) // wrong remote-as
+	r2.NeighborAdd(addr1, 1)
+
+	// wait for remote side to report the notification
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var lastError string
+		r2.call(func() { lastError = r2.peers[addr1.String()].lastError })
+		if lastError != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bad peer AS: notification not reported to remote side")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if state, _ := r1.neighborState(addr2); state == BGP_ESTABLISHED || state == BGP_OPENCONFIRM {
+		t.Errorf("bad peer AS: unexpected state=%s", bgpStateName(state))
+	}
+}
+
+// bgpTestConn(): connected TCP pair
+func bgpTestConn(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	c1, err1 := net.Dial("tcp", l.Addr().String())
+	if err1 != nil {
+		t.Fatalf("dial: %v", err1)
+	}
+	c2, err2 := l.Accept()
+	if err2 != nil {
+		t.Fatalf("accept: %v", err2)
+	}
+	return c1, c2
+}
+
+func TestBgpCollision(t *testing.T) {
+	remoteOpen := bgpwire.OpenEncode(&bgpwire.Open{Version: bgpwire.BGP_VERSION, As: 2, HoldTime: 90, Id: net.ParseIP("2.2.2.2")})
+
+	// sessions(): peer with one connection per state, all outgoing except the last one
+	sessions := func(localId string, states ...int) (*BgpRouter, *bgpPeer) {
+		r := allocRouter(1, net.ParseIP(localId), nil, 0)
+		p := &bgpPeer{addr: net.ParseIP("127.0.0.2"), remoteAs: 2}
+		r.peers[p.addr.String()] = p
+		for i, state := range states {
+			c1, c2 := bgpTestConn(t)
+			t.Cleanup(func() { c2.Close() })
+			p.sessions = append(p.sessions, &bgpSession{peer: p, conn: c1, outgoing: i < len(states)-1, state: state})
+		}
+		return r, p
+	}
+
+	// cleanup(): stop timers and connections left by the FSM
+	cleanup := func(r *BgpRouter, p *bgpPeer) {
+		for _, s := range p.sessions {
+			r.timerStop(&s.hold)
+			r.timerStop(&s.keepalive)
+			s.conn.Close()
+		}
+		r.timerStop(&p.connectRetry)
+	}
+
+	// OPEN arrives on incoming connection while other ones are in states
+	collide := func(localId string, states ...int) ([]*bgpSession, *bgpPeer) {
+		r, p := sessions(localId, append(states, BGP_OPENSENT)...)
+		all := p.sessions
+		r.recvOpen(all[len(all)-1], remoteOpen[bgpwire.BGP_HEADER_SIZE:])
+		cleanup(r, p)
+		return all, p
+	}
+
+	// remote identifier is higher: keep connection initiated by remote
+	all, p := collide("1.1.1.1", BGP_OPENCONFIRM)
+	in := all[1]
+	if len(p.sessions) != 1 || p.sessions[0] != in || in.state != BGP_OPENCONFIRM {
+		t.Errorf("collision with higher remote id: want incoming session kept in OpenConfirm")
+	}
+
+	// local identifier is higher: keep connection initiated locally
+	all, p = collide("3.3.3.3", BGP_OPENCONFIRM)
+	if len(p.sessions) != 1 || p.sessions[0] != all[0] {
+		t.Errorf("collision with lower remote id: want outgoing session kept")
+	}
+
+	// every other connection is checked, not only the first one in OpenConfirm
+	all, p = collide("1.1.1.1", BGP_OPENSENT, BGP_OPENCONFIRM, BGP_OPENCONFIRM)
+	if len(p.sessions) != 2 || p.sessions[0] != all[0] || p.sessions[1] != all[3] {
+		t.Errorf("collision with several sessions: want both OpenConfirm sessions closed, got %d sessions", len(p.sessions))
+	}
+
+	// established connection always wins
+	all, p = collide("1.1.1.1", BGP_ESTABLISHED)
+	if len(p.sessions) != 1 || p.sessions[0] != all[0] {
+		t.Errorf("collision with established session: want incoming session closed")
+	}
+
+	// session reaching Established closes every other connection
+	r, p := sessions("1.1.1.1", BGP_OPENSENT, BGP_OPENSENT, BGP_OPENCONFIRM)
+	s := p.sessions[2]
+	r.sessionEstablished(s)
+	cleanup(r, p)
+	if len(p.sessions) != 1 || p.sessions[0] != s {
+		t.Errorf("established: want single session left, got %d", len(p.sessions))
+	}
+}
+
+func bgpTestPath(peer *bgpPeer, id string, attrs bgpwire.Attrs) *bgpPath {
+	for _, typeCode := range []int{bgpwire.BGP_ATTR_ORIGIN, bgpwire.BGP_ATTR_AS_PATH, bgpwire.BGP_ATTR_NEXT_HOP} {
+		attrs.Set(typeCode)
+	}
+	return &bgpPath{peer: peer, remoteId: net.ParseIP(id), attrs: &attrs, nexthop: attrs.Nexthop}
+}
+
+func bgpTestSeq(asns ...int) []bgpwire.AsSegment {
+	return []bgpwire.AsSegment{{Type: bgpwire.BGP_AS_SEQUENCE, Asns: asns}}
+}
+
+func TestBgpDecision(t *testing.T) {
+	r := allocRouter(1, net.ParseIP("1.1.1.1"), nil, 0)
+
+	ext2 := &bgpPeer{addr: net.ParseIP("10.0.0.2"), remoteAs: 2}
+	ext2b := &bgpPeer{addr: net.ParseIP("10.0.0.3"), remoteAs: 2}
+	ext3 := &bgpPeer{addr: net.ParseIP("10.0.0.4"), remoteAs: 3}
+	int1 := &bgpPeer{addr: net.ParseIP("10.0.0.5"), remoteAs: 1}
+	heavy := &bgpPeer{addr: net.ParseIP("10.0.0.6"), remoteAs: 3, weight: 10}
+
+	nh1 := net.ParseIP("192.168.0.1")
+	nh2 := net.ParseIP("192.168.0.2")
+
+	var lp200 bgpwire.Attrs
+	lp200.LocalPref = 200
+	lp200.Set(bgpwire.BGP_ATTR_LOCAL_PREF)
+	lp200.AsPath = bgpTestSeq(2, 5, 6)
+
+	var med bgpwire.Attrs
+	med.Med = 5
+	med.AsPath = bgpTestSeq(2)
+
+	r.igpCost = func(nexthop net.IP) (uint32, bool) {
+		if nexthop.Equal(nh2) {
+			return 20, true
+		}
+		return 10, !nexthop.Equal(net.ParseIP("192.168.0.9"))
+	}
+
+	for _, c := range []struct {
+		label string
+		a, b  *bgpPath
+		step  int
+	}{
+		{"weight", bgpTestPath(heavy, "6.6.6.6", bgpwire.Attrs{AsPath: bgpTestSeq(3, 4, 5)}), bgpTestPath(ext2, "2.2.2.2", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), BGP_BEST_WEIGHT},
+		{"local-pref", bgpTestPath(int1, "5.5.5.5", lp200), bgpTestPath(ext2, "2.2.2.2", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), BGP_BEST_LOCAL_PREF},
+		{"local-pref ignored from external", bgpTestPath(ext2, "2.2.2.2", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), bgpTestPath(ext3, "4.4.4.4", lp200), BGP_BEST_AS_PATH},
+		{"as-path set counts one", bgpTestPath(ext2, "2.2.2.2", bgpwire.Attrs{AsPath: []bgpwire.AsSegment{{Type: bgpwire.BGP_AS_SEQUENCE, Asns: []int{2}}, {Type: bgpwire.BGP_AS_SET, Asns: []int{7, 8, 9}}}}), bgpTestPath(ext3, "4.4.4.4", bgpwire.Attrs{AsPath: bgpTestSeq(3, 4, 5)}), BGP_BEST_AS_PATH},
+		{"origin", bgpTestPath(ext3, "4.4.4.4", bgpwire.Attrs{AsPath: bgpTestSeq(3)}), bgpTestPath(ext2, "2.2.2.2", bgpwire.Attrs{AsPath: bgpTestSeq(2), Origin: bgpwire.BGP_ORIGIN_INCOMPLETE}), BGP_BEST_ORIGIN},
+		{"med", bgpTestPath(ext2b, "3.3.3.3", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), bgpTestPath(ext2, "2.2.2.2", med), BGP_BEST_MED},
+		{"med ignored across AS", bgpTestPath(ext2, "2.2.2.2", med), bgpTestPath(ext3, "4.4.4.4", bgpwire.Attrs{AsPath: bgpTestSeq(3)}), BGP_BEST_ROUTER_ID},
+		{"ebgp", bgpTestPath(ext2, "7.7.7.7", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), bgpTestPath(int1, "5.5.5.5", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), BGP_BEST_EBGP},
+		{"igp-cost", bgpTestPath(ext2, "7.7.7.7", bgpwire.Attrs{AsPath: bgpTestSeq(2), Nexthop: nh1}), bgpTestPath(ext3, "4.4.4.4", bgpwire.Attrs{AsPath: bgpTestSeq(3), Nexthop: nh2}), BGP_BEST_IGP_COST},
+		{"router-id", bgpTestPath(ext3, "4.4.4.4", bgpwire.Attrs{AsPath: bgpTestSeq(3)}), bgpTestPath(ext2, "7.7.7.7", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), BGP_BEST_ROUTER_ID},
+		{"neighbor-addr", bgpTestPath(ext2, "2.2.2.2", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), bgpTestPath(ext2b, "2.2.2.2", bgpwire.Attrs{AsPath: bgpTestSeq(2)}), BGP_BEST_PEER_ADDR},
+	} {
+		if better, step := r.pathCompare(c.a, c.b); !better || step != c.step {
+			t.Errorf("%s: want better=true step=%s got better=%v step=%s", c.label, bgpBestName(c.step), better, bgpBestName(step))
+		}
+		if better, step := r.pathCompare(c.b, c.a); better || step != c.step {
+			t.Errorf("%s reversed: want better=false step=%s got better=%v step=%s", c.label, bgpBestName(c.step), better, bgpBestName(step))
+		}
+
+		// best path reports tie-breaker against closest candidate
+		best, reason := r.bestPath([]*bgpPath{c.b, c.a})
+		if best != c.a || reason != c.step {
+			t.Errorf("%s: best path: want reason=%s got reason=%s", c.label, bgpBestName(c.step), bgpBestName(reason))
+		}
+	}
+
+	// ineligible paths are skipped
+	loop := bgpTestPath(heavy, "6.6.6.6", bgpwire.Attrs{AsPath: bgpTestSeq(3, 1)})
+	unreachable := bgpTestPath(heavy, "6.6.6.6", bgpwire.Attrs{AsPath: bgpTestSeq(3), Nexthop: net.ParseIP("192.168.0.9")})
+	valid := bgpTestPath(ext2, "2.2.2.2", bgpwire.Attrs{AsPath: bgpTestSeq(2, 3, 4)})
+	if best, reason := r.bestPath([]*bgpPath{loop, unreachable, valid}); best != valid || reason != BGP_BEST_ONLY {
+		t.Errorf("ineligible: want only valid path, got best=%v reason=%s", best, bgpBestName(reason))
+	}
+	if best, _ := r.bestPath([]*bgpPath{loop, unreachable}); best != nil {
+		t.Errorf("ineligible: unexpected best path: %v", best)
+	}
+}
+
+/*
+bgpTestPeer(): add peer with established session to router not running.
+Messages sent to peer are read from returned connection.
+*/
+func bgpTestPeer(t *testing.T, r *BgpRouter, addr string, as int, id string) (*bgpSession, *bgpTestRemote) {
+	local, remote := bgpTestConn(t)
+	families := map[bgpwire.Family]bool{bgpwire.IPv4Unicast: true, bgpwire.IPv6Unicast: true}
+	p := &bgpPeer{addr: net.ParseIP(addr), remoteAs: as, families: families, ribIn: newRibIn(), ribOut: newRibOut()}
+	r.peers[p.addr.String()] = p
+	s := &bgpSession{peer: p, conn: local, state: BGP_ESTABLISHED, remoteId: net.ParseIP(id), as4: true, families: families}
+	p.sessions = []*bgpSession{s}
+	return s, &bgpTestRemote{Conn: remote, local: local}
+}
+
+// bgpTestRemote: remote end of test session, keeps local end for sync
+type bgpTestRemote struct {
+	net.Conn
+	local net.Conn
+}
+
+/*
+bgpTestRecv(): summary of UPDATEs received by peer so far.
+A KEEPALIVE is queued behind pending messages as end marker, so reading
+never depends on timing. If the router closed the session, reading stops
+at end of stream instead.
+*/
+func bgpTestRecv(t *testing.T, conn *bgpTestRemote, as4 bool) []string {
+	conn.local.SetWriteDeadline(time.Now().Add(BGP_WRITE_TIMEOUT))
+	_, errMark := conn.local.Write(bgpwire.KeepaliveEncode())
+	list := []string{}
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		msgType, body, err := bgpwire.Read(conn)
+		if err != nil {
+			if errMark == nil {
+				t.Errorf("recv: end marker not received: %v", err)
+			}
+			return list // session closed: nothing else was sent
+		}
+		if msgType == bgpwire.BGP_MSG_KEEPALIVE {
+			return list // end marker
+		}
+		if msgType != bgpwire.BGP_MSG_UPDATE {
+			t.Fatalf("unexpected message type=%d", msgType)
+		}
+		u, errDecode := bgpwire.UpdateDecode(body, as4)
+		if errDecode != nil {
+			t.Fatalf("bad update: %v", errDecode)
+		}
+		for _, n := range append(u.Withdrawn, u.Attrs.MpUnreach.Withdrawn...) {
+			list = append(list, "withdraw "+n.String())
+		}
+		lp := "-"
+		if u.Attrs.Has(bgpwire.BGP_ATTR_LOCAL_PREF) {
+			lp = fmt.Sprintf("%d", u.Attrs.LocalPref)
+		}
+		for _, n := range u.Nlri {
+			list = append(list, fmt.Sprintf("%v path=[%s] nexthop=%v local-pref=%s", &n, bgpwire.AsPathString(u.Attrs.AsPath), u.Attrs.Nexthop, lp))
+		}
+		m := u.Attrs.MpReach
+		for _, n := range m.Nlri {
+			nexthop := m.Nexthop.String()
+			if m.LinkLocal != nil {
+				nexthop += "," + m.LinkLocal.String()
+			}
+			list = append(list, fmt.Sprintf("%v path=[%s] nexthop=%s local-pref=%s", &n, bgpwire.AsPathString(u.Attrs.AsPath), nexthop, lp))
+		}
+	}
+}
+
+type bgpTestLines []string
+
+func (l *bgpTestLines) Sendln(s string) int {
+	*l = append(*l, s)
+	return len(s)
+}
+
+func TestBgpRib(t *testing.T) {
+	r := allocRouter(1, net.ParseIP("1.1.1.1"), nil, 0)
+
+	sa, ca := bgpTestPeer(t, r, "10.0.0.2", 2, "2.2.2.2")
+	sb, cb := bgpTestPeer(t, r, "10.0.0.3", 3, "3.3.3.3")
+	sc, cc := bgpTestPeer(t, r, "10.0.0.4", 1, "4.4.4.4")
+	_, cd := bgpTestPeer(t, r, "10.0.0.5", 1, "5.5.5.5")
+
+	_, prefix, _ := net.ParseCIDR("10.1.0.0/16")
+	network := prefix.String()
+
+	announce := func(s *bgpSession, nexthop string, localPref uint32, asns ...int) {
+		u := &bgpwire.Update{Nlri: []net.IPNet{*prefix}}
+		u.Attrs.AsPath = bgpTestSeq(asns...)
+		u.Attrs.Nexthop = net.ParseIP(nexthop)
+		for _, typeCode := range []int{bgpwire.BGP_ATTR_ORIGIN, bgpwire.BGP_ATTR_AS_PATH, bgpwire.BGP_ATTR_NEXT_HOP} {
+			u.Attrs.Set(typeCode)
+		}
+		if localPref > 0 {
+			u.Attrs.LocalPref = localPref
+			u.Attrs.Set(bgpwire.BGP_ATTR_LOCAL_PREF)
+		}
+		r.sessionRecv(s, bgpwire.BGP_MSG_UPDATE, bgpwire.UpdateEncode(u, true)[bgpwire.BGP_HEADER_SIZE:])
+	}
+
+	check := func(label string, best *bgpSession, reason int, want map[*bgpTestRemote][]string) {
+		d := r.locRib[bgpwire.IPv4Unicast][network]
+		if d == nil || d.best.peer != best.peer || d.reason != reason {
+			t.Errorf("%s: want best=%v reason=%s got %+v", label, best.peer.addr, bgpBestName(reason), d)
+		}
+		for _, conn := range []*bgpTestRemote{ca, cb, cc, cd} {
+			if got := bgpTestRecv(t, conn, true); !reflect.DeepEqual(got, append([]string{}, want[conn]...)) {
+				t.Errorf("%s: peer %v: want %q got %q", label, conn.LocalAddr(), want[conn], got)
+			}
+		}
+	}
+
+	// local address towards external peers
+	self := sa.localAddr(nil).String()
+
+	announce(sa, "10.0.0.2", 0, 2, 9)
+	check("first path", sa, BGP_BEST_ONLY, map[*bgpTestRemote][]string{
+		cb: {network + " path=[1 2 9] nexthop=" + self + " local-pref=-"},
+		cc: {network + " path=[2 9] nexthop=10.0.0.2 local-pref=100"},
+		cd: {network + " path=[2 9] nexthop=10.0.0.2 local-pref=100"},
+	})
+
+	announce(sb, "10.0.0.3", 0, 3)
+	check("shorter path", sb, BGP_BEST_AS_PATH, map[*bgpTestRemote][]string{
+		ca: {network + " path=[1 3] nexthop=" + self + " local-pref=-"},
+		cb: {"withdraw " + network},
+		cc: {network + " path=[3] nexthop=10.0.0.3 local-pref=100"},
+		cd: {network + " path=[3] nexthop=10.0.0.3 local-pref=100"},
+	})
+
+	// internal route is not sent to internal peers; AS 4 path is sent back to peer B
+	announce(sc, "10.0.0.4", 200, 4)
+	check("internal path", sc, BGP_BEST_LOCAL_PREF, map[*bgpTestRemote][]string{
+		ca: {network + " path=[1 4] nexthop=" + self + " local-pref=-"},
+		cb: {network + " path=[1 4] nexthop=" + self + " local-pref=-"},
+		cc: {"withdraw " + network},
+		cd: {"withdraw " + network},
+	})
+
+	var lines bgpTestLines
+	r.showRoutes(&lines, bgpwire.IPv4Unicast)
+	if len(lines) != 6 || !strings.HasPrefix(lines[5], "*> 10.1.0.0/16") || !strings.Contains(lines[5], " local-pref ") {
+		t.Errorf("show routes: unexpected output: %q", lines)
+	}
+
+	lines = nil
+	r.showRoute(&lines, *prefix)
+	if len(lines) < 2 || lines[1] != "Paths: 3 available, best: 10.0.0.4 (local-pref)" {
+		t.Errorf("show route: unexpected output: %q", lines)
+	}
+
+	// session loss flushes peer routes
+	r.sessionClose(sc, "test")
+	r.timerStop(&sc.peer.connectRetry)
+	check("session lost", sb, BGP_BEST_AS_PATH, map[*bgpTestRemote][]string{
+		ca: {network + " path=[1 3] nexthop=" + self + " local-pref=-"},
+		cb: {"withdraw " + network},
+		cd: {network + " path=[3] nexthop=10.0.0.3 local-pref=100"},
+	})
+	if len(sc.peer.ribIn[bgpwire.IPv4Unicast]) != 0 || len(sc.peer.ribOut[bgpwire.IPv4Unicast]) != 0 {
+		t.Errorf("session lost: peer tables not flushed")
+	}
+
+	// withdraw last paths
+	for _, s := range []*bgpSession{sa, sb} {
+		r.sessionRecv(s, bgpwire.BGP_MSG_UPDATE, bgpwire.UpdateEncode(&bgpwire.Update{Withdrawn: []net.IPNet{*prefix}}, true)[bgpwire.BGP_HEADER_SIZE:])
+	}
+	if _, found := r.locRib[bgpwire.IPv4Unicast][network]; found {
+		t.Errorf("withdraw: route still in Loc-RIB")
+	}
+	if got := bgpTestRecv(t, cd, true); !reflect.DeepEqual(got, []string{"withdraw " + network}) {
+		t.Errorf("withdraw: internal peer: got %q", got)
+	}
+}
+
+func TestBgpAs4Rib(t *testing.T) {
+	r := allocRouter(196608, net.ParseIP("1.1.1.1"), nil, 0) // asdot 3.0
+
+	sOld, cOld := bgpTestPeer(t, r, "10.0.0.2", 2, "2.2.2.2")
+	sOld.as4 = false
+	sNew, cNew := bgpTestPeer(t, r, "10.0.0.3", 70000, "3.3.3.3")
+
+	_, prefix1, _ := net.ParseCIDR("10.1.0.0/16")
+	_, prefix2, _ := net.ParseCIDR("10.2.0.0/16")
+
+	announce := func(s *bgpSession, prefix *net.IPNet, a bgpwire.Attrs) {
+		for _, typeCode := range []int{bgpwire.BGP_ATTR_ORIGIN, bgpwire.BGP_ATTR_AS_PATH, bgpwire.BGP_ATTR_NEXT_HOP} {
+			a.Set(typeCode)
+		}
+		a.Nexthop = s.peer.addr
+		r.sessionRecv(s, bgpwire.BGP_MSG_UPDATE, bgpwire.UpdateEncode(&bgpwire.Update{Nlri: []net.IPNet{*prefix}, Attrs: a}, s.as4)[bgpwire.BGP_HEADER_SIZE:])
+	}
+
+	// wide path towards 2-octet speaker: AS_TRANS in AS_PATH, true path in AS4_PATH
+	announce(sNew, prefix1, bgpwire.Attrs{AsPath: bgpTestSeq(70000, 80000)})
+	self := sOld.localAddr(nil).String()
+	if got, want := bgpTestRecv(t, cOld, false), []string{prefix1.String() + " path=[23456 23456 23456] nexthop=" + self + " local-pref=-"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("2-octet peer: want %q got %q", want, got)
+	}
+	if out := sOld.peer.ribOut[bgpwire.IPv4Unicast][prefix1.String()]; out == nil {
+		t.Errorf("2-octet peer: prefix not in Adj-RIB-Out")
+	} else {
+		var a bgpwire.Attrs
+		bgpwire.AttrsDecode(&a, out.attrs, false)
+		if bgpwire.AsPathString(a.As4Path) != "196608 70000 80000" {
+			t.Errorf("2-octet peer: bad AS4_PATH=[%s]", bgpwire.AsPathString(a.As4Path))
+		}
+	}
+
+	// 2-octet speaker relays path through AS4_PATH
+	var a bgpwire.Attrs
+	a.AsPath = bgpTestSeq(2, 23456, 5)
+	a.As4Path = bgpTestSeq(90000, 5)
+	a.Set(bgpwire.BGP_ATTR_AS4_PATH)
+	announce(sOld, prefix2, a)
+	if got, want := bgpTestRecv(t, cNew, true), []string{prefix2.String() + " path=[196608 2 90000 5] nexthop=" + self + " local-pref=-"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("4-octet peer: want %q got %q", want, got)
+	}
+	if path := sOld.peer.ribIn[bgpwire.IPv4Unicast][prefix2.String()]; path == nil || path.attrs.Has(bgpwire.BGP_ATTR_AS4_PATH) {
+		t.Errorf("2-octet peer: AS4_PATH kept in Adj-RIB-In")
+	}
+}
+
+func TestBgpAs4Session(t *testing.T) {
+	r := allocRouter(196608, net.ParseIP("1.1.1.1"), nil, 0)
+	p := &bgpPeer{addr: net.ParseIP("10.0.0.2"), remoteAs: 200000}
+
+	open := &bgpwire.Open{Version: bgpwire.BGP_VERSION, As: bgpwire.BGP_AS_TRANS, HoldTime: 90, Id: net.ParseIP("2.2.2.2")}
+	wantBgpError(t, "2-octet speaker", r.openCheck(p, open), bgpwire.BGP_ERR_OPEN, bgpwire.BGP_ERR_OPEN_PEER_AS)
+
+	open.Caps = []bgpwire.Capability{bgpwire.As4Capability(200000)}
+	if e := r.openCheck(p, open); e != nil {
+		t.Errorf("4-octet speaker: unexpected error: %v", e)
+	}
+
+	open.Caps = []bgpwire.Capability{{Code: bgpwire.BGP_CAP_AS4, Value: []byte{1}}}
+	wantBgpError(t, "bad capability", r.openCheck(p, open), bgpwire.BGP_ERR_OPEN, bgpwire.BGP_ERR_OPEN_UNSPECIFIC)
+
+	// full session between 4-octet and 2-octet AS numbers
+	r1, r2 := bgpTestPair(t, 196608, 2)
+	defer r1.Stop()
+	defer r2.Stop()
+
+	addr1 := net.ParseIP("127.0.0.1")
+	addr2 := net.ParseIP("127.0.0.2")
+
+	if err := r1.NeighborAdd(addr2, 2); err != nil {
+		t.Fatalf("neighbor add: %v", err)
+	}
+	if err := r2.NeighborAdd(addr1, 196608); err != nil {
+		t.Fatalf("neighbor add: %v", err)
+	}
+	waitState(t, r1, addr2, BGP_ESTABLISHED)
+	waitState(t, r2, addr1, BGP_ESTABLISHED)
+
+	var as4 bool
+	r2.call(func() { as4 = r2.peers[addr1.String()].establishedSession().as4 })
+	if !as4 {
+		t.Errorf("4-octet AS capability not negotiated")
+	}
+}
+
+func TestBgpMpRib(t *testing.T) {
+	r := allocRouter(1, net.ParseIP("1.1.1.1"), nil, 0)
+	hardware := fwd.NewDataplaneBogus()
+	r.hardware = hardware
+
+	sa, ca := bgpTestPeer(t, r, "2001:db8:a::2", 2, "2.2.2.2")
+	sa.ifName = "eth1" // directly connected
+	sb, cb := bgpTestPeer(t, r, "2001:db8:b::2", 3, "3.3.3.3")
+	sb.nexthop6 = net.ParseIP("2001:db8:b::1")
+	sb.linkLocal6 = net.ParseIP("fe80::b1")
+	sc, cc := bgpTestPeer(t, r, "10.0.0.4", 4, "4.4.4.4")
+	sc.families = map[bgpwire.Family]bool{bgpwire.IPv4Unicast: true}
+	_, cd := bgpTestPeer(t, r, "10.0.0.5", 1, "5.5.5.5")
+
+	_, prefix, _ := net.ParseCIDR("2001:db8:100::/48")
+	network := prefix.String()
+
+	send := func(s *bgpSession, a bgpwire.Attrs) {
+		r.sessionRecv(s, bgpwire.BGP_MSG_UPDATE, bgpwire.UpdateEncode(&bgpwire.Update{Attrs: a}, true)[bgpwire.BGP_HEADER_SIZE:])
+	}
+	check := func(label string, want map[*bgpTestRemote][]string) {
+		for _, conn := range []*bgpTestRemote{ca, cb, cc, cd} {
+			if got := bgpTestRecv(t, conn, true); !reflect.DeepEqual(got, append([]string{}, want[conn]...)) {
+				t.Errorf("%s: peer %v: want %q got %q", label, conn.LocalAddr(), want[conn], got)
+			}
+		}
+	}
+
+	var a bgpwire.Attrs
+	a.AsPath = bgpTestSeq(2, 9)
+	a.MpReach = bgpwire.MpReach{Family: bgpwire.IPv6Unicast, Nexthop: net.ParseIP("2001:db8:a::2"), LinkLocal: net.ParseIP("fe80::a2"), Nlri: []net.IPNet{*prefix}}
+	for _, typeCode := range []int{bgpwire.BGP_ATTR_ORIGIN, bgpwire.BGP_ATTR_AS_PATH, bgpwire.BGP_ATTR_MP_REACH_NLRI} {
+		a.Set(typeCode)
+	}
+	send(sa, a)
+
+	// external peer gets local next hops; internal peer gets global next hop only
+	check("announce", map[*bgpTestRemote][]string{
+		cb: {network + " path=[1 2 9] nexthop=2001:db8:b::1,fe80::b1 local-pref=-"},
+		cd: {network + " path=[2 9] nexthop=2001:db8:a::2 local-pref=100"},
+	})
+	if len(r.locRib[bgpwire.IPv4Unicast]) != 0 || r.locRib[bgpwire.IPv6Unicast][network] == nil {
+		t.Errorf("announce: route not in IPv6 Loc-RIB only")
+	}
+
+	// link-local next hop is installed through interface shared with peer
+	_, routes, _ := hardware.RouteList(fwd.FAMILY_INET6, fwd.PROTO_BGP)
+	if len(routes) != 1 || len(routes[0].Nexthops) != 1 || !routes[0].Nexthops[0].Gw.Equal(net.ParseIP("fe80::a2")) || routes[0].Nexthops[0].IfName != "eth1" {
+		t.Errorf("fib: unexpected routes: %v", routes)
+	}
+
+	var lines bgpTestLines
+	r.showRoute(&lines, *prefix)
+	if len(lines) < 7 || !reflect.DeepEqual(lines[5:7], bgpTestLines{"    next hop 2001:db8:a::2, IGP cost 0, MED 0, local-pref 100", "    link-local next hop fe80::a2 (eth1)"}) {
+		t.Errorf("show route: unexpected output: %q", lines)
+	}
+
+	// family not negotiated with peer is ignored
+	send(sc, a)
+	if paths := r.candidates(bgpwire.IPv6Unicast, r.sortedPeers(), network); len(paths) != 1 {
+		t.Errorf("family not negotiated: want 1 path, got %d", len(paths))
+	}
+
+	var w bgpwire.Attrs
+	w.MpUnreach = bgpwire.MpUnreach{Family: bgpwire.IPv6Unicast, Withdrawn: []net.IPNet{*prefix}}
+	w.Set(bgpwire.BGP_ATTR_MP_UNREACH_NLRI)
+	send(sa, w)
+
+	check("withdraw", map[*bgpTestRemote][]string{
+		cb: {"withdraw " + network},
+		cd: {"withdraw " + network},
+	})
+	if _, routes, _ := hardware.RouteList(fwd.FAMILY_INET6, fwd.PROTO_BGP); len(routes) != 0 {
+		t.Errorf("withdraw: route left in fib: %v", routes)
+	}
+}
+
+func TestBgpMpNexthops(t *testing.T) {
+	r := allocRouter(1, net.ParseIP("1.1.1.1"), nil, 0)
+	hardware := fwd.NewDataplaneBogus()
+	r.hardware = hardware
+	for _, a := range []string{"127.0.0.1/8", "fe80::2/64", "2001:db8:2::1/64"} {
+		if err := hardware.InterfaceAddressAdd("eth2", a); err != nil {
+			t.Fatalf("address add: %v", err)
+		}
+	}
+
+	// session over IPv4 towards directly connected peer
+	s, _ := bgpTestPeer(t, r, "127.0.0.2", 2, "2.2.2.2")
+	r.sessionNexthops(s)
+	if !s.nexthop6.Equal(net.ParseIP("2001:db8:2::1")) || !s.linkLocal6.Equal(net.ParseIP("fe80::2")) || s.ifName != "eth2" {
+		t.Errorf("connected peer: got nexthop=%v link-local=%v interface=%s", s.nexthop6, s.linkLocal6, s.ifName)
+	}
+
+	// link-local address is not sent to remote peer
+	s, _ = bgpTestPeer(t, r, "192.168.0.2", 3, "3.3.3.3")
+	r.sessionNexthops(s)
+	if !s.nexthop6.Equal(net.ParseIP("2001:db8:2::1")) || s.linkLocal6 != nil || s.ifName != "" {
+		t.Errorf("remote peer: got nexthop=%v link-local=%v interface=%s", s.nexthop6, s.linkLocal6, s.ifName)
+	}
+}
+
+func TestBgpNexthopScan(t *testing.T) {
+	r := allocRouter(1, net.ParseIP("1.1.1.1"), nil, 0)
+	hardware := fwd.NewDataplaneBogus()
+	r.hardware = hardware
+	if err := hardware.InterfaceAddressAdd("eth0", "10.0.0.1/24"); err != nil {
+		t.Fatalf("address add: %v", err)
+	}
+
+	sa, _ := bgpTestPeer(t, r, "10.0.0.2", 2, "2.2.2.2")
+	sb, _ := bgpTestPeer(t, r, "10.0.0.3", 3, "3.3.3.3")
+
+	r.nexthopScan() // as NewBgpRouter
+	go r.run()
+	defer r.Stop()
+
+	_, prefix, _ := net.ParseCIDR("10.1.0.0/16")
+	network := prefix.String()
+
+	announce := func(s *bgpSession, nexthop string, asns ...int) {
+		a := bgpwire.Attrs{AsPath: bgpTestSeq(asns...), Nexthop: net.ParseIP(nexthop)}
+		for _, typeCode := range []int{bgpwire.BGP_ATTR_ORIGIN, bgpwire.BGP_ATTR_AS_PATH, bgpwire.BGP_ATTR_NEXT_HOP} {
+			a.Set(typeCode)
+		}
+		r.call(func() {
+			r.sessionRecv(s, bgpwire.BGP_MSG_UPDATE, bgpwire.UpdateEncode(&bgpwire.Update{Nlri: []net.IPNet{*prefix}, Attrs: a}, true)[bgpwire.BGP_HEADER_SIZE:])
+		})
+	}
+	check := func(label string, best *bgpSession, reason int) {
+		r.call(func() {
+			d := r.locRib[bgpwire.IPv4Unicast][network]
+			if d == nil || d.best.peer != best.peer || d.reason != reason {
+				t.Errorf("%s: want best=%v reason=%s got %+v", label, best.peer.addr, bgpBestName(reason), d)
+			}
+		})
+	}
+
+	// next hop on connected subnet, next hop without route
+	announce(sa, "10.0.0.2", 2, 9)
+	announce(sb, "192.168.1.1", 3)
+	check("unresolved next hop", sa, BGP_BEST_ONLY)
+
+	// interior route resolves next hop on next scan
+	igp := fwd.Route{Prefix: net.IPNet{IP: net.ParseIP("192.168.1.0").To4(), Mask: net.CIDRMask(24, 32)},
+		Nexthops: []fwd.Nexthop{{Gw: net.ParseIP("10.0.0.9")}}, Metric: 2, Protocol: fwd.PROTO_RIP}
+	if err := hardware.RouteReplace("", igp); err != nil {
+		t.Fatalf("route add: %v", err)
+	}
+	r.call(r.nexthopScan)
+	check("resolved next hop", sb, BGP_BEST_AS_PATH)
+	r.call(func() {
+		if cost, reachable := r.igpCost(net.ParseIP("192.168.1.1")); cost != 2 || !reachable {
+			t.Errorf("igp cost: want cost=2 reachable=true got cost=%d reachable=%v", cost, reachable)
+		}
+		if cost, reachable := r.igpCost(net.ParseIP("10.0.0.2")); cost != 0 || !reachable {
+			t.Errorf("connected: want cost=0 reachable=true got cost=%d reachable=%v", cost, reachable)
+		}
+	})
+
+	// weight overrides AS_PATH length
+	if err := r.NeighborWeight(sa.peer.addr, 10); err != nil {
+		t.Fatalf("weight: %v", err)
+	}
+	check("weight", sa, BGP_BEST_WEIGHT)
+	if err := r.NeighborWeight(sa.peer.addr, 0); err != nil {
+		t.Fatalf("weight: %v", err)
+	}
+	check("weight removed", sb, BGP_BEST_AS_PATH)
+	if err := r.NeighborWeight(net.ParseIP("10.0.0.4"), 10); err == nil {
+		t.Errorf("weight: unknown neighbor accepted")
+	}
+
+	// BGP routes do not resolve next hops
+	if err := hardware.RouteDel("", igp); err != nil {
+		t.Fatalf("route del: %v", err)
+	}
+	bgpRoute := fwd.Route{Prefix: igp.Prefix, Nexthops: igp.Nexthops, Protocol: fwd.PROTO_BGP}
+	if err := hardware.RouteReplace("", bgpRoute); err != nil {
+		t.Fatalf("route add: %v", err)
+	}
+	r.call(r.nexthopScan)
+	check("next hop lost", sa, BGP_BEST_ONLY)
+}
+
+func TestBgpMpSession(t *testing.T) {
+	open := &bgpwire.Open{Caps: []bgpwire.Capability{bgpwire.As4Capability(1)}}
+	if got := bgpwire.FamilyList(bgpwire.OpenFamilies(open)); got != "ipv4 unicast" {
+		t.Errorf("no multiprotocol capability: want ipv4 unicast only, got %q", got)
+	}
+	open.Caps = append(open.Caps, bgpwire.MpCapability(bgpwire.IPv6Unicast), bgpwire.Capability{Code: bgpwire.BGP_CAP_MULTIPROTOCOL, Value: []byte{0}})
+	if got := bgpwire.FamilyList(bgpwire.OpenFamilies(open)); got != "ipv6 unicast" {
+		t.Errorf("ipv6 capability: want ipv6 unicast only, got %q", got)
+	}
+
+	r1, r2 := bgpTestPair(t, 1, 2)
+	defer r1.Stop()
+	defer r2.Stop()
+
+	addr1 := net.ParseIP("127.0.0.1")
+	addr2 := net.ParseIP("127.0.0.2")
+
+	families := func(r *BgpRouter, nbr net.IP) string {
+		var list string
+		r.call(func() {
+			if s := r.peers[nbr.String()].establishedSession(); s != nil {
+				list = bgpwire.FamilyList(s.families)
+			}
+		})
+		return list
+	}
+
+	// family activated on one side only is not negotiated
+	if err := r1.NeighborAdd(addr2, 2); err != nil {
+		t.Fatalf("neighbor add: %v", err)
+	}
+	if err := r1.NeighborFamily(addr2, bgpwire.IPv6Unicast, true); err != nil {
+		t.Fatalf("neighbor family: %v", err)
+	}
+	if err := r2.NeighborAdd(addr1, 1); err != nil {
+		t.Fatalf("neighbor add: %v", err)
+	}
+	waitState(t, r1, addr2, BGP_ESTABLISHED)
+	waitState(t, r2, addr1, BGP_ESTABLISHED)
+	if got := families(r2, addr1); got != "ipv4 unicast" {
+		t.Errorf("one side: want ipv4 unicast, got %q", got)
+	}
+
+	// activation resets session in order to negotiate family
+	if err := r2.NeighborFamily(addr1, bgpwire.IPv6Unicast, true); err != nil {
+		t.Fatalf("neighbor family: %v", err)
+	}
+	waitState(t, r2, addr1, BGP_ESTABLISHED)
+	deadline := time.Now().Add(5 * time.Second)
+	for families(r1, addr2) != "ipv4 unicast, ipv6 unicast" || families(r2, addr1) != "ipv4 unicast, ipv6 unicast" {
+		if time.Now().After(deadline) {
+			t.Fatalf("both sides: want ipv4 and ipv6 unicast, got %q and %q", families(r1, addr2), families(r2, addr1))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
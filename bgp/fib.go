@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/udhos/nexthop/bgpwire"
+	"github.com/udhos/nexthop/fwd"
+)
+
+/*
+Best paths from Loc-RIB are installed into the FIB of the default VRF.
+
+RFC2545 3: an IPv6 path learned with a link-local next hop from a
+directly connected peer is installed through that next hop on the
+shared interface. Otherwise the global next hop is used.
+*/
+
+// bgpFibRoute(): FIB entry for Loc-RIB destination, without next hops if d is nil
+func bgpFibRoute(prefix net.IPNet, d *bgpDest) fwd.Route {
+	route := fwd.Route{Prefix: prefix, Protocol: fwd.PROTO_BGP}
+	if d == nil {
+		return route
+	}
+	nexthop := fwd.Nexthop{Gw: d.best.nexthop}
+	if d.best.linkLocal != nil && d.best.ifName != "" {
+		nexthop = fwd.Nexthop{Gw: d.best.linkLocal, IfName: d.best.ifName}
+	}
+	route.Nexthops = []fwd.Nexthop{nexthop}
+	return route
+}
+
+// fibSync(): push Loc-RIB state of prefix into FIB.
+// Runs within BgpRouter goroutine.
+func (r *BgpRouter) fibSync(f bgpwire.Family, prefix net.IPNet) {
+	if r.hardware == nil {
+		return
+	}
+
+	d := r.locRib[f][prefix.String()]
+	route := bgpFibRoute(prefix, d)
+
+	if d == nil {
+		if err := r.hardware.RouteDel("", route); err != nil {
+			log.Printf("bgp router: fib: %v", err)
+		}
+		return
+	}
+	if err := r.hardware.RouteReplace("", route); err != nil {
+		log.Printf("bgp router: fib: %v", err)
+	}
+}
+
+// fibFlush(): remove routes left behind in FIB by previous instances
+func (r *BgpRouter) fibFlush() {
+	for _, family := range []int{fwd.FAMILY_INET, fwd.FAMILY_INET6} {
+		vrfnames, routes, err := r.hardware.RouteList(family, fwd.PROTO_BGP)
+		if err != nil {
+			log.Printf("bgp router: fib flush: %v", err)
+			continue
+		}
+		for i, route := range routes {
+			if err := r.hardware.RouteDel(vrfnames[i], route); err != nil {
+				log.Printf("bgp router: fib flush: vrf=[%s] %v", vrfnames[i], err)
+			}
+		}
+		if len(routes) > 0 {
+			log.Printf("bgp router: fib flush: removed %d stale routes", len(routes))
+		}
+	}
+}
+
+/*
+RFC4271 9.1.2.1: next hop resolution.
+
+A next hop is reachable when it belongs to a subnet of an interface in
+the default VRF, at IGP cost 0, or when it is covered by a FIB route from
+an interior source. The longest match gives the IGP cost from its metric.
+Routes installed by BGP itself are never used to resolve next hops.
+
+The FIB is polled every BGP_SCAN_INTERVAL, since the dataplane does not
+report changes. Route selection is rerun only when the snapshot changes.
+*/
+
+const BGP_SCAN_INTERVAL = 60 * time.Second
+
+// bgpIgpProtocols: FIB route sources trusted for next hop resolution
+var bgpIgpProtocols = []int{fwd.PROTO_BOOT, fwd.PROTO_STATIC, fwd.PROTO_RIP}
+
+type bgpIgpTable struct {
+	connected []net.IPNet
+	routes    []fwd.Route // longest prefix first
+}
+
+// bgpIgpLoad(): snapshot of interface subnets and interior routes from default VRF
+func bgpIgpLoad(hardware fwd.Dataplane) (*bgpIgpTable, error) {
+	ifaces, vrfs, err := hardware.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("interfaces: %v", err)
+	}
+
+	table := &bgpIgpTable{}
+	for i, ifname := range ifaces {
+		if vrfs[i] != "" {
+			continue
+		}
+		addrs, _ := hardware.InterfaceAddressGet(ifname)
+		for _, a := range addrs {
+			table.connected = append(table.connected, net.IPNet{IP: a.IP.Mask(a.Mask), Mask: a.Mask})
+		}
+	}
+
+	for _, family := range []int{fwd.FAMILY_INET, fwd.FAMILY_INET6} {
+		for _, protocol := range bgpIgpProtocols {
+			vrfnames, routes, errList := hardware.RouteList(family, protocol)
+			if errList != nil {
+				return nil, fmt.Errorf("routes: %v", errList)
+			}
+			for i, route := range routes {
+				if vrfnames[i] == "" {
+					table.routes = append(table.routes, route)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(table.routes, func(i, j int) bool {
+		ones1, _ := table.routes[i].Prefix.Mask.Size()
+		ones2, _ := table.routes[j].Prefix.Mask.Size()
+		if ones1 != ones2 {
+			return ones1 > ones2
+		}
+		return bgpPrefixLess(table.routes[i].Prefix, table.routes[j].Prefix)
+	})
+
+	return table, nil
+}
+
+// cost(): IGP cost to next hop, and whether next hop is reachable
+func (t *bgpIgpTable) cost(nexthop net.IP) (uint32, bool) {
+	for _, n := range t.connected {
+		if n.Contains(nexthop) {
+			return 0, true
+		}
+	}
+	for _, route := range t.routes {
+		if route.Prefix.Contains(nexthop) {
+			return uint32(route.Metric), true
+		}
+	}
+	return 0, false
+}
+
+// nexthopScan(): reload next hop resolver from FIB, then schedule next scan
+func (r *BgpRouter) nexthopScan() {
+	if r.hardware == nil {
+		return
+	}
+
+	table, err := bgpIgpLoad(r.hardware)
+	if err != nil {
+		log.Printf("bgp router: next hop scan: %v", err)
+	} else if !reflect.DeepEqual(table, r.igpTable) {
+		r.igpTable = table
+		r.igpCost = table.cost
+		r.ribReselect()
+	}
+
+	r.timerStart(&r.scan, BGP_SCAN_INTERVAL, r.nexthopScan)
+}
@@ -0,0 +1,697 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/udhos/nexthop/bgpwire"
+)
+
+/*
+RFC4271 8 BGP Finite State Machine
+
+The peer state is Idle, Connect or Active while no TCP connection has
+been established. Each TCP connection (bgpSession) then runs through
+OpenSent, OpenConfirm and Established. Two sessions may coexist for the
+same peer during a connection collision (RFC4271 6.8), in which case the
+peer reports the most advanced one.
+*/
+
+const (
+	BGP_IDLE = iota
+	BGP_CONNECT
+	BGP_ACTIVE
+	BGP_OPENSENT
+	BGP_OPENCONFIRM
+	BGP_ESTABLISHED
+)
+
+func bgpStateName(state int) string {
+	switch state {
+	case BGP_IDLE:
+		return "Idle"
+	case BGP_CONNECT:
+		return "Connect"
+	case BGP_ACTIVE:
+		return "Active"
+	case BGP_OPENSENT:
+		return "OpenSent"
+	case BGP_OPENCONFIRM:
+		return "OpenConfirm"
+	case BGP_ESTABLISHED:
+		return "Established"
+	}
+	return "state" + strconv.Itoa(state)
+}
+
+type bgpPeer struct {
+	addr     net.IP
+	remoteAs int
+	weight   int                     // locally assigned preference for routes from peer
+	families map[bgpwire.Family]bool // activated address families
+
+	state    int           // Idle, Connect or Active: meaningful only without sessions
+	sessions []*bgpSession // TCP connections: more than one only during collision
+
+	connectRetry        bgpTimer
+	connectRetryCounter int
+	dialSeq             int // discard results from abandoned connection attempts
+	dialing             bool
+
+	lastChange time.Time // last transition into or out of Established
+	lastError  string
+	msgSent    int
+	msgRecv    int
+
+	ribIn  map[bgpwire.Family]map[string]*bgpPath   // Adj-RIB-In
+	ribOut map[bgpwire.Family]map[string]*bgpAdvert // Adj-RIB-Out
+}
+
+type bgpSession struct {
+	peer     *bgpPeer
+	conn     net.Conn
+	outgoing bool // initiated by local system
+	state    int  // OpenSent, OpenConfirm or Established
+	remoteId net.IP
+	holdTime time.Duration           // negotiated: zero means no keepalive nor hold timer
+	as4      bool                    // peer supports 4-octet AS numbers
+	families map[bgpwire.Family]bool // negotiated address families
+
+	// RFC2545 3: IPv6 next hops advertised to external peer
+	nexthop6   net.IP // global address
+	linkLocal6 net.IP // link-local address, only for directly connected peer
+	ifName     string // interface shared with directly connected peer
+
+	hold      bgpTimer
+	keepalive bgpTimer
+}
+
+// establishedSession(): session in Established state, if any
+func (p *bgpPeer) establishedSession() *bgpSession {
+	for _, s := range p.sessions {
+		if s.state == BGP_ESTABLISHED {
+			return s
+		}
+	}
+	return nil
+}
+
+// localAddr(): local address of session, used as next hop for external peers
+func (s *bgpSession) localAddr(defaultAddr net.IP) net.IP {
+	if a, ok := s.conn.LocalAddr().(*net.TCPAddr); ok && a.IP.To4() != nil {
+		return a.IP.To4()
+	}
+	return defaultAddr
+}
+
+/*
+sessionNexthops(): find IPv6 next hops for session: the session local
+address, if global IPv6, otherwise a global IPv6 address from the
+interface holding the local address. The link-local address of that
+interface is used only when the peer address belongs to the interface
+subnets.
+*/
+func (r *BgpRouter) sessionNexthops(s *bgpSession) {
+	local, ok := s.conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	if local.IP.To4() == nil && !local.IP.IsLinkLocalUnicast() {
+		s.nexthop6 = local.IP
+	}
+
+	if r.hardware == nil {
+		return
+	}
+
+	ifaces, _, err := r.hardware.Interfaces()
+	if err != nil {
+		log.Printf("bgp router: neighbor %v: next hop: %v", s.peer.addr, err)
+		return
+	}
+
+	for _, ifname := range ifaces {
+		addrs, _ := r.hardware.InterfaceAddressGet(ifname)
+		if !bgpAddrsHold(addrs, local.IP) {
+			continue
+		}
+		var linkLocal net.IP
+		connected := false
+		for _, a := range addrs {
+			connected = connected || a.Contains(s.peer.addr)
+			switch {
+			case a.IP.To4() != nil:
+				// IPv4 address
+			case a.IP.IsLinkLocalUnicast():
+				if linkLocal == nil {
+					linkLocal = a.IP
+				}
+			case s.nexthop6 == nil:
+				s.nexthop6 = a.IP
+			}
+		}
+		if connected {
+			s.ifName = ifname
+			s.linkLocal6 = linkLocal
+		}
+		return
+	}
+}
+
+// bgpAddrsHold(): ip is one of the interface addresses
+func bgpAddrsHold(addrs []net.IPNet, ip net.IP) bool {
+	for _, a := range addrs {
+		if a.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentState(): most advanced session state, if any
+func (p *bgpPeer) currentState() int {
+	state := p.state
+	for _, s := range p.sessions {
+		if s.state > state {
+			state = s.state
+		}
+	}
+	return state
+}
+
+/*
+bgpTimer: timer firing within BgpRouter goroutine.
+Expiration queued before a stop or restart is discarded.
+*/
+type bgpTimer struct {
+	timer *time.Timer
+	seq   int
+}
+
+func (r *BgpRouter) timerStart(t *bgpTimer, d time.Duration, expire func()) {
+	r.timerStop(t)
+	seq := t.seq
+	t.timer = time.AfterFunc(d, func() {
+		r.post(func() {
+			if t.seq == seq {
+				t.timer = nil
+				expire()
+			}
+		})
+	})
+}
+
+func (r *BgpRouter) timerStop(t *bgpTimer) {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.seq++
+}
+
+// peerStart(): ManualStart/AutomaticStart: try to connect
+func (r *BgpRouter) peerStart(p *bgpPeer) {
+	p.state = BGP_CONNECT
+	r.connectRetryStart(p)
+	r.dial(p)
+}
+
+// peerStop(): ManualStop: release every session
+func (r *BgpRouter) peerStop(p *bgpPeer, ceaseSubcode int) {
+	p.dialSeq++ // abandon pending connection attempt
+	p.dialing = false
+	for len(p.sessions) > 0 {
+		r.sessionNotify(p.sessions[0], bgpwire.BGP_ERR_CEASE, ceaseSubcode, nil)
+		r.sessionClose(p.sessions[0], "stopped")
+	}
+	r.timerStop(&p.connectRetry) // after sessionClose, which schedules restart
+	p.state = BGP_IDLE
+	p.connectRetryCounter = 0
+}
+
+// peerFailed(): last session lost: back to Idle, restart automatically after ConnectRetry
+func (r *BgpRouter) peerFailed(p *bgpPeer) {
+	p.state = BGP_IDLE
+	p.connectRetryCounter++
+	r.connectRetryStart(p)
+}
+
+/*
+connectRetryStart(): RFC4271 10: ConnectRetry is jittered by up to 25%,
+so that peers failing together do not retry in lockstep.
+*/
+func (r *BgpRouter) connectRetryStart(p *bgpPeer) {
+	jitter := time.Duration(rand.Int63n(int64(r.connectRetry)/4 + 1))
+	r.timerStart(&p.connectRetry, r.connectRetry-jitter, func() { r.connectRetryExpire(p) })
+}
+
+func (r *BgpRouter) connectRetryExpire(p *bgpPeer) {
+	switch p.state {
+	case BGP_IDLE:
+		if len(p.sessions) == 0 {
+			r.peerStart(p) // AutomaticStart
+		}
+		return
+	case BGP_CONNECT, BGP_ACTIVE:
+		p.dialSeq++ // drop pending attempt, if any
+		p.dialing = false
+		p.state = BGP_CONNECT
+	}
+	r.connectRetryStart(p)
+	if len(p.sessions) == 0 {
+		r.dial(p)
+	}
+}
+
+// dial(): open outgoing connection in background
+func (r *BgpRouter) dial(p *bgpPeer) {
+	p.dialSeq++
+	p.dialing = true
+	seq := p.dialSeq
+	raddr := net.JoinHostPort(p.addr.String(), strconv.Itoa(r.port))
+	dialer := net.Dialer{Timeout: r.connectRetry}
+	if r.listenAddr != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: r.listenAddr}
+	}
+	go func() {
+		conn, err := dialer.Dial("tcp", raddr)
+		if !r.post(func() { r.dialResult(p, seq, conn, err) }) && conn != nil {
+			conn.Close()
+		}
+	}()
+}
+
+func (r *BgpRouter) dialResult(p *bgpPeer, seq int, conn net.Conn, err error) {
+	if seq != p.dialSeq || r.peers[p.addr.String()] != p {
+		if conn != nil {
+			conn.Close() // stale attempt
+		}
+		return
+	}
+	p.dialing = false
+
+	if err != nil {
+		log.Printf("bgp router: neighbor %v: connect: %v", p.addr, err)
+		if len(p.sessions) == 0 && p.state == BGP_CONNECT {
+			// TcpConnectionFails: wait for incoming connection until ConnectRetry expires
+			p.state = BGP_ACTIVE
+		}
+		return
+	}
+
+	if p.currentState() == BGP_ESTABLISHED {
+		conn.Close() // collision with established session: keep existing one
+		return
+	}
+
+	r.sessionStart(p, conn, true)
+}
+
+// accept(): incoming connection
+func (r *BgpRouter) accept(conn net.Conn) {
+	raddr := conn.RemoteAddr().(*net.TCPAddr)
+	p, found := r.peers[raddr.IP.String()]
+	if !found {
+		log.Printf("bgp router: refusing connection from unknown neighbor %v", raddr)
+		conn.Close()
+		return
+	}
+	if p.currentState() == BGP_ESTABLISHED {
+		log.Printf("bgp router: neighbor %v: refusing connection: session established", raddr)
+		conn.Close()
+		return
+	}
+
+	r.sessionStart(p, conn, false)
+}
+
+// sessionStart(): TcpConnectionConfirmed: send OPEN and wait for peer OPEN
+func (r *BgpRouter) sessionStart(p *bgpPeer, conn net.Conn, outgoing bool) {
+	log.Printf("bgp router: neighbor %v: connected: local=%v outgoing=%v", p.addr, conn.LocalAddr(), outgoing)
+
+	r.timerStop(&p.connectRetry)
+
+	s := &bgpSession{peer: p, conn: conn, outgoing: outgoing, state: BGP_OPENSENT}
+	p.sessions = append(p.sessions, s)
+
+	go r.sessionReader(s)
+
+	open := &bgpwire.Open{Version: bgpwire.BGP_VERSION, As: bgpwire.As2(r.asn), HoldTime: int(r.holdTime / time.Second), Id: r.routerId, Caps: r.openCaps(p)}
+	if err := r.sessionSend(s, bgpwire.OpenEncode(open)); err != nil {
+		return
+	}
+
+	r.timerStart(&s.hold, BGP_OPEN_HOLD, func() { r.holdExpire(s) })
+}
+
+// openCaps(): capabilities advertised in OPEN: 4-octet AS, then every family activated for peer
+func (r *BgpRouter) openCaps(p *bgpPeer) []bgpwire.Capability {
+	caps := []bgpwire.Capability{bgpwire.As4Capability(r.asn)}
+	for _, f := range bgpwire.Families {
+		if p.families[f] {
+			caps = append(caps, bgpwire.MpCapability(f))
+		}
+	}
+	return caps
+}
+
+// sessionReader(): deliver messages from connection into BgpRouter goroutine
+func (r *BgpRouter) sessionReader(s *bgpSession) {
+	for {
+		msgType, body, err := bgpwire.Read(s.conn)
+		if err != nil {
+			r.post(func() { r.sessionError(s, err) })
+			return
+		}
+		if !r.post(func() { r.sessionRecv(s, msgType, body) }) {
+			return
+		}
+	}
+}
+
+func (r *BgpRouter) sessionActive(s *bgpSession) bool {
+	for _, t := range s.peer.sessions {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *BgpRouter) sessionSend(s *bgpSession, msg []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(BGP_WRITE_TIMEOUT))
+	if _, err := s.conn.Write(msg); err != nil {
+		log.Printf("bgp router: neighbor %v: send: %v", s.peer.addr, err)
+		r.sessionClose(s, err.Error())
+		return err
+	}
+	s.peer.msgSent++
+	return nil
+}
+
+// sessionNotify(): report error to peer; caller closes the session
+func (r *BgpRouter) sessionNotify(s *bgpSession, code, subcode int, data []byte) {
+	s.conn.SetWriteDeadline(time.Now().Add(BGP_WRITE_TIMEOUT))
+	if _, err := s.conn.Write(bgpwire.NotificationEncode(code, subcode, data)); err != nil {
+		log.Printf("bgp router: neighbor %v: send notification: %v", s.peer.addr, err)
+		return
+	}
+	s.peer.msgSent++
+}
+
+// sessionClose(): drop connection; peer fails when its last session is lost
+func (r *BgpRouter) sessionClose(s *bgpSession, reason string) {
+	if !r.sessionActive(s) {
+		return
+	}
+
+	p := s.peer
+
+	log.Printf("bgp router: neighbor %v: session %s closed: %s", p.addr, bgpStateName(s.state), reason)
+
+	r.timerStop(&s.hold)
+	r.timerStop(&s.keepalive)
+	s.conn.Close() // break sessionReader
+
+	sessions := []*bgpSession{}
+	for _, t := range p.sessions {
+		if t != s {
+			sessions = append(sessions, t)
+		}
+	}
+	p.sessions = sessions
+
+	if s.state == BGP_ESTABLISHED {
+		p.lastChange = time.Now()
+		r.ribPeerFlush(p)
+	}
+
+	if len(p.sessions) > 0 || r.peers[p.addr.String()] != p {
+		return // collision survivor remains, or peer is being removed
+	}
+
+	if p.dialing {
+		p.state = BGP_CONNECT
+		r.connectRetryStart(p)
+		return
+	}
+
+	r.peerFailed(p)
+}
+
+// sessionError(): reader failure: report header errors to peer
+func (r *BgpRouter) sessionError(s *bgpSession, err error) {
+	if !r.sessionActive(s) {
+		return
+	}
+	if e, ok := err.(*bgpwire.Error); ok {
+		r.sessionFail(s, e)
+		return
+	}
+	if err == io.EOF {
+		s.peer.lastError = "connection closed by peer"
+	} else {
+		s.peer.lastError = err.Error()
+	}
+	r.sessionClose(s, s.peer.lastError)
+}
+
+// sessionFail(): send NOTIFICATION for error, then drop connection
+func (r *BgpRouter) sessionFail(s *bgpSession, e *bgpwire.Error) {
+	s.peer.lastError = "sent: " + e.Error()
+	r.sessionNotify(s, e.Code, e.Subcode, e.Data)
+	r.sessionClose(s, e.Error())
+}
+
+func (r *BgpRouter) holdExpire(s *bgpSession) {
+	r.sessionFail(s, bgpwire.NewError(bgpwire.BGP_ERR_HOLD_TIMER, bgpwire.BGP_ERR_SUB_NONE, nil, "hold timer expired"))
+}
+
+func (r *BgpRouter) keepaliveExpire(s *bgpSession) {
+	if r.sessionSend(s, bgpwire.KeepaliveEncode()) != nil {
+		return
+	}
+	r.timerStart(&s.keepalive, s.holdTime/3, func() { r.keepaliveExpire(s) })
+}
+
+// holdRestart(): peer is alive
+func (r *BgpRouter) holdRestart(s *bgpSession) {
+	if s.holdTime > 0 {
+		r.timerStart(&s.hold, s.holdTime, func() { r.holdExpire(s) })
+	}
+}
+
+func (r *BgpRouter) sessionRecv(s *bgpSession, msgType int, body []byte) {
+	if !r.sessionActive(s) {
+		return // discard messages queued before session was closed
+	}
+
+	p := s.peer
+	p.msgRecv++
+
+	if msgType == bgpwire.BGP_MSG_NOTIFICATION {
+		code, subcode, _, err := bgpwire.NotificationDecode(body)
+		if err != nil {
+			p.lastError = "received: bad notification"
+		} else {
+			p.lastError = "received: " + bgpwire.NewError(code, subcode, nil, "notification").Error()
+		}
+		r.sessionClose(s, p.lastError)
+		return
+	}
+
+	switch s.state {
+	case BGP_OPENSENT:
+		if msgType != bgpwire.BGP_MSG_OPEN {
+			r.sessionFail(s, bgpwire.NewError(bgpwire.BGP_ERR_FSM, bgpwire.BGP_ERR_FSM_OPENSENT, nil, "unexpected message type=%d in OpenSent", msgType))
+			return
+		}
+		r.recvOpen(s, body)
+
+	case BGP_OPENCONFIRM:
+		if msgType != bgpwire.BGP_MSG_KEEPALIVE {
+			r.sessionFail(s, bgpwire.NewError(bgpwire.BGP_ERR_FSM, bgpwire.BGP_ERR_FSM_OPENCONFIRM, nil, "unexpected message type=%d in OpenConfirm", msgType))
+			return
+		}
+		r.sessionEstablished(s)
+
+	case BGP_ESTABLISHED:
+		switch msgType {
+		case bgpwire.BGP_MSG_KEEPALIVE:
+			r.holdRestart(s)
+		case bgpwire.BGP_MSG_UPDATE:
+			u, err := bgpwire.UpdateDecode(body, s.as4)
+			if err != nil {
+				r.sessionFail(s, err.(*bgpwire.Error))
+				return
+			}
+			r.holdRestart(s)
+			r.recvUpdate(s, u)
+		default:
+			r.sessionFail(s, bgpwire.NewError(bgpwire.BGP_ERR_FSM, bgpwire.BGP_ERR_FSM_ESTABLISHED, nil, "unexpected message type=%d in Established", msgType))
+		}
+	}
+}
+
+// recvOpen(): OPEN in OpenSent: validate, resolve collision, then OpenConfirm
+func (r *BgpRouter) recvOpen(s *bgpSession, body []byte) {
+	p := s.peer
+
+	open, err := bgpwire.OpenDecode(body)
+	if err != nil {
+		r.sessionFail(s, err.(*bgpwire.Error))
+		return
+	}
+	if e := r.openCheck(p, open); e != nil {
+		r.sessionFail(s, e)
+		return
+	}
+
+	s.remoteId = open.Id
+	_, s.as4, _ = bgpwire.OpenAs4(open)
+
+	// negotiated families: activated locally and announced by peer
+	remoteFamilies := bgpwire.OpenFamilies(open)
+	s.families = map[bgpwire.Family]bool{}
+	for f := range p.families {
+		if remoteFamilies[f] {
+			s.families[f] = true
+		}
+	}
+
+	if !r.collisionResolve(s) {
+		return // this session lost
+	}
+
+	s.holdTime = r.holdTime
+	if remoteHold := time.Duration(open.HoldTime) * time.Second; remoteHold < s.holdTime {
+		s.holdTime = remoteHold
+	}
+
+	if r.sessionSend(s, bgpwire.KeepaliveEncode()) != nil {
+		return
+	}
+
+	s.state = BGP_OPENCONFIRM
+
+	if s.holdTime > 0 {
+		r.timerStart(&s.keepalive, s.holdTime/3, func() { r.keepaliveExpire(s) })
+		r.holdRestart(s)
+	} else {
+		r.timerStop(&s.hold)
+	}
+}
+
+// openCheck(): RFC4271 6.2 OPEN Message Error Handling
+func (r *BgpRouter) openCheck(p *bgpPeer, open *bgpwire.Open) *bgpwire.Error {
+	if open.Version != bgpwire.BGP_VERSION {
+		data := []byte{0, bgpwire.BGP_VERSION}
+		return bgpwire.NewError(bgpwire.BGP_ERR_OPEN, bgpwire.BGP_ERR_OPEN_VERSION, data, "unsupported version=%d", open.Version)
+	}
+	peerAs, as4, e := bgpwire.OpenAs4(open)
+	if e != nil {
+		return e
+	}
+	if !as4 {
+		peerAs = open.As // 2-octet AS speaker
+	}
+	if peerAs != p.remoteAs {
+		return bgpwire.NewError(bgpwire.BGP_ERR_OPEN, bgpwire.BGP_ERR_OPEN_PEER_AS, nil, "bad peer AS=%d expected=%d", peerAs, p.remoteAs)
+	}
+	if open.HoldTime > 0 && time.Duration(open.HoldTime)*time.Second < BGP_HOLD_TIME_MIN {
+		return bgpwire.NewError(bgpwire.BGP_ERR_OPEN, bgpwire.BGP_ERR_OPEN_HOLD_TIME, nil, "unacceptable hold time=%d", open.HoldTime)
+	}
+	if open.Id.Equal(net.IPv4zero) || open.Id.Equal(r.routerId) {
+		return bgpwire.NewError(bgpwire.BGP_ERR_OPEN, bgpwire.BGP_ERR_OPEN_BGP_ID, nil, "bad BGP identifier=%v", open.Id)
+	}
+	return nil
+}
+
+/*
+collisionResolve(): RFC4271 6.8 BGP Connection Collision Detection
+
+When OPEN arrives on one connection, it is checked against every other
+connection to the same peer. An Established connection always wins.
+Against a connection in OpenConfirm, the connection initiated by the
+system with the higher BGP Identifier is kept. Returns false if s was
+closed.
+*/
+func (r *BgpRouter) collisionResolve(s *bgpSession) bool {
+	p := s.peer
+	others := p.sessions // sessionClose() replaces p.sessions
+	for _, other := range others {
+		if other == s {
+			continue
+		}
+
+		var loser *bgpSession
+		switch other.state {
+		case BGP_ESTABLISHED:
+			loser = s
+			log.Printf("bgp router: neighbor %v: connection collision with established session", p.addr)
+		case BGP_OPENCONFIRM:
+			// close connection initiated by the system with lower identifier
+			keepOutgoing := !bgpIdLess(r.routerId, s.remoteId)
+			loser = s
+			if other.outgoing != keepOutgoing {
+				loser = other
+			}
+			log.Printf("bgp router: neighbor %v: connection collision: local id=%v remote id=%v: keeping outgoing=%v",
+				p.addr, r.routerId, s.remoteId, keepOutgoing)
+		default:
+			continue
+		}
+
+		r.sessionNotify(loser, bgpwire.BGP_ERR_CEASE, bgpwire.BGP_CEASE_COLLISION, nil)
+		r.sessionClose(loser, "connection collision")
+
+		if loser == s {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionEstablished(): KEEPALIVE in OpenConfirm
+func (r *BgpRouter) sessionEstablished(s *bgpSession) {
+	p := s.peer
+
+	// every other connection collides with the established one
+	others := p.sessions // sessionClose() replaces p.sessions
+	for _, other := range others {
+		if other != s {
+			r.sessionNotify(other, bgpwire.BGP_ERR_CEASE, bgpwire.BGP_CEASE_COLLISION, nil)
+			r.sessionClose(other, "connection collision with established session")
+		}
+	}
+
+	s.state = BGP_ESTABLISHED
+	p.connectRetryCounter = 0
+	p.lastChange = time.Now()
+	p.lastError = ""
+	p.dialSeq++ // abandon pending connection attempt
+	p.dialing = false
+
+	r.holdRestart(s)
+
+	log.Printf("bgp router: neighbor %v: session established: remote id=%v hold=%v families=%v", p.addr, s.remoteId, s.holdTime, bgpwire.FamilyList(s.families))
+
+	r.sessionNexthops(s)
+
+	// initial update: entire Loc-RIB
+	p.ribIn = newRibIn()
+	p.ribOut = newRibOut()
+	for _, f := range bgpwire.Families {
+		r.ribOutSync(s, f, r.locRibPrefixes(f))
+	}
+}
+
+// bgpIdLess(): compare identifiers as unsigned integers
+func bgpIdLess(id1, id2 net.IP) bool {
+	return bytes.Compare(id1.To16(), id2.To16()) < 0
+}
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/udhos/nexthop/bgpwire"
+	"github.com/udhos/nexthop/command"
+)
+
+/*
+RFC4271 3.2 Routing Information Base
+
+Adj-RIB-In:  routes received from each peer (bgpPeer.ribIn)
+Loc-RIB:     route selected by the Decision Process for each prefix (BgpRouter.locRib)
+Adj-RIB-Out: routes advertised to each peer (bgpPeer.ribOut)
+
+Every table holds one map per address family, keyed by prefix string.
+*/
+
+const BGP_LOCAL_PREF_DEFAULT = 100
+
+// Decision Process tie-breakers (RFC4271 9.1.2.2), in order of evaluation
+const (
+	BGP_BEST_ONLY = iota // no other candidate
+	BGP_BEST_WEIGHT
+	BGP_BEST_LOCAL_PREF
+	BGP_BEST_AS_PATH
+	BGP_BEST_ORIGIN
+	BGP_BEST_MED
+	BGP_BEST_EBGP
+	BGP_BEST_IGP_COST
+	BGP_BEST_ROUTER_ID
+	BGP_BEST_PEER_ADDR
+)
+
+func bgpBestName(step int) string {
+	switch step {
+	case BGP_BEST_ONLY:
+		return "only-path"
+	case BGP_BEST_WEIGHT:
+		return "weight"
+	case BGP_BEST_LOCAL_PREF:
+		return "local-pref"
+	case BGP_BEST_AS_PATH:
+		return "as-path"
+	case BGP_BEST_ORIGIN:
+		return "origin"
+	case BGP_BEST_MED:
+		return "med"
+	case BGP_BEST_EBGP:
+		return "ebgp"
+	case BGP_BEST_IGP_COST:
+		return "igp-cost"
+	case BGP_BEST_ROUTER_ID:
+		return "router-id"
+	case BGP_BEST_PEER_ADDR:
+		return "neighbor-addr"
+	}
+	return "step" + strconv.Itoa(step)
+}
+
+// bgpPath: route received from peer (Adj-RIB-In entry)
+type bgpPath struct {
+	prefix    net.IPNet
+	peer      *bgpPeer
+	remoteId  net.IP         // peer BGP identifier
+	attrs     *bgpwire.Attrs // shared by prefixes from the same UPDATE: never modified
+	nexthop   net.IP         // from NEXT_HOP or MP_REACH_NLRI
+	linkLocal net.IP         // IPv6 link-local next hop, if any
+	ifName    string         // interface shared with peer, required by link-local next hop
+	received  time.Time
+}
+
+// bgpDest: Loc-RIB entry
+type bgpDest struct {
+	prefix net.IPNet
+	best   *bgpPath
+	reason int // tie-breaker deciding against closest candidate
+}
+
+// bgpAdvert: Adj-RIB-Out entry
+type bgpAdvert struct {
+	prefix net.IPNet
+	attrs  []byte // encoded as sent
+}
+
+func newRibIn() map[bgpwire.Family]map[string]*bgpPath {
+	rib := map[bgpwire.Family]map[string]*bgpPath{}
+	for _, f := range bgpwire.Families {
+		rib[f] = map[string]*bgpPath{}
+	}
+	return rib
+}
+
+func newRibOut() map[bgpwire.Family]map[string]*bgpAdvert {
+	rib := map[bgpwire.Family]map[string]*bgpAdvert{}
+	for _, f := range bgpwire.Families {
+		rib[f] = map[string]*bgpAdvert{}
+	}
+	return rib
+}
+
+func newLocRib() map[bgpwire.Family]map[string]*bgpDest {
+	rib := map[bgpwire.Family]map[string]*bgpDest{}
+	for _, f := range bgpwire.Families {
+		rib[f] = map[string]*bgpDest{}
+	}
+	return rib
+}
+
+/*
+recvUpdate(): store UPDATE into peer Adj-RIB-In, then run Decision Process.
+
+IPv4 unicast routes come in withdrawn routes and NLRI, other families in
+MP_UNREACH_NLRI and MP_REACH_NLRI. Routes for families not negotiated
+with the peer are ignored.
+*/
+func (r *BgpRouter) recvUpdate(s *bgpSession, u *bgpwire.Update) {
+	p := s.peer
+	changed := map[bgpwire.Family][]net.IPNet{}
+
+	if s.as4 {
+		bgpwire.As4Clear(&u.Attrs)
+	} else {
+		bgpwire.As4Merge(&u.Attrs)
+	}
+
+	// attributes shared by announced prefixes: next hop is kept by each path
+	attrs := u.Attrs
+	attrs.Nexthop = nil
+	attrs.MpReach = bgpwire.MpReach{}
+	attrs.MpUnreach = bgpwire.MpUnreach{}
+	attrs.Clear(bgpwire.BGP_ATTR_NEXT_HOP)
+	attrs.Clear(bgpwire.BGP_ATTR_MP_REACH_NLRI)
+	attrs.Clear(bgpwire.BGP_ATTR_MP_UNREACH_NLRI)
+
+	negotiated := func(f bgpwire.Family, prefixes []net.IPNet) bool {
+		if !s.families[f] && len(prefixes) > 0 {
+			log.Printf("bgp router: neighbor %v: ignoring %d prefixes from family not negotiated: %v", p.addr, len(prefixes), f)
+		}
+		return s.families[f]
+	}
+
+	withdraw := func(f bgpwire.Family, prefixes []net.IPNet) {
+		if !negotiated(f, prefixes) {
+			return
+		}
+		for _, n := range prefixes {
+			key := n.String()
+			if _, found := p.ribIn[f][key]; found {
+				delete(p.ribIn[f], key)
+				changed[f] = append(changed[f], n)
+			}
+		}
+	}
+
+	now := time.Now()
+
+	announce := func(f bgpwire.Family, prefixes []net.IPNet, nexthop, linkLocal net.IP) {
+		if !negotiated(f, prefixes) {
+			return
+		}
+		for _, n := range prefixes {
+			path := &bgpPath{prefix: n, peer: p, remoteId: s.remoteId, attrs: &attrs, nexthop: nexthop, received: now}
+			if linkLocal != nil {
+				path.linkLocal = linkLocal
+				path.ifName = s.ifName
+			}
+			p.ribIn[f][n.String()] = path
+			changed[f] = append(changed[f], n)
+		}
+	}
+
+	withdraw(bgpwire.IPv4Unicast, u.Withdrawn)
+	if u.Attrs.Has(bgpwire.BGP_ATTR_MP_UNREACH_NLRI) {
+		withdraw(u.Attrs.MpUnreach.Family, u.Attrs.MpUnreach.Withdrawn)
+	}
+
+	announce(bgpwire.IPv4Unicast, u.Nlri, u.Attrs.Nexthop, nil)
+	if m := &u.Attrs.MpReach; u.Attrs.Has(bgpwire.BGP_ATTR_MP_REACH_NLRI) {
+		announce(m.Family, m.Nlri, m.Nexthop, m.LinkLocal)
+	}
+
+	for _, f := range bgpwire.Families {
+		r.ribUpdate(f, changed[f])
+	}
+}
+
+// ribPeerFlush(): session lost: drop routes from and to peer
+func (r *BgpRouter) ribPeerFlush(p *bgpPeer) {
+	ribIn := p.ribIn
+	p.ribIn = newRibIn()
+	p.ribOut = newRibOut()
+	for _, f := range bgpwire.Families {
+		changed := make([]net.IPNet, 0, len(ribIn[f]))
+		for _, path := range ribIn[f] {
+			changed = append(changed, path.prefix)
+		}
+		r.ribUpdate(f, changed)
+	}
+}
+
+// ribUpdate(): select routes for prefixes of family, then advertise changes to peers
+func (r *BgpRouter) ribUpdate(f bgpwire.Family, prefixes []net.IPNet) {
+	if len(prefixes) == 0 {
+		return
+	}
+
+	peers := r.sortedPeers()
+
+	for _, n := range prefixes {
+		r.decide(f, peers, n)
+	}
+
+	for _, p := range peers {
+		if s := p.establishedSession(); s != nil {
+			r.ribOutSync(s, f, prefixes)
+		}
+	}
+}
+
+// ribReselect(): rerun route selection for every prefix, after a change affecting paths from any peer
+func (r *BgpRouter) ribReselect() {
+	peers := r.sortedPeers()
+	for _, f := range bgpwire.Families {
+		r.ribUpdate(f, r.bgpPrefixes(f, peers))
+	}
+}
+
+// decide(): RFC4271 9.1.2 Phase 2: Route Selection, then FIB update when best path changes
+func (r *BgpRouter) decide(f bgpwire.Family, peers []*bgpPeer, prefix net.IPNet) {
+	key := prefix.String()
+	old := r.locRib[f][key]
+
+	best, reason := r.bestPath(r.candidates(f, peers, key))
+	if best == nil {
+		delete(r.locRib[f], key)
+	} else {
+		r.locRib[f][key] = &bgpDest{prefix: prefix, best: best, reason: reason}
+	}
+
+	if (old == nil && best == nil) || (old != nil && old.best == best) {
+		return // FIB is up to date
+	}
+
+	r.fibSync(f, prefix)
+}
+
+// candidates(): every path for prefix, ordered as peers
+func (r *BgpRouter) candidates(f bgpwire.Family, peers []*bgpPeer, key string) []*bgpPath {
+	paths := []*bgpPath{}
+	for _, p := range peers {
+		if path, found := p.ribIn[f][key]; found {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+/*
+bestPath(): most preferred eligible path.
+
+The reason is the tie-breaker separating the best path from its
+closest competitor.
+*/
+func (r *BgpRouter) bestPath(paths []*bgpPath) (*bgpPath, int) {
+	var best *bgpPath
+	for _, path := range paths {
+		if r.pathIneligible(path) != "" {
+			continue
+		}
+		if best == nil {
+			best = path
+			continue
+		}
+		if better, _ := r.pathCompare(path, best); better {
+			best = path
+		}
+	}
+
+	if best == nil {
+		return nil, BGP_BEST_ONLY
+	}
+
+	reason := BGP_BEST_ONLY
+	for _, path := range paths {
+		if path == best || r.pathIneligible(path) != "" {
+			continue
+		}
+		if _, step := r.pathCompare(best, path); step > reason {
+			reason = step
+		}
+	}
+
+	return best, reason
+}
+
+// pathIneligible(): reason for excluding path from selection, if any
+func (r *BgpRouter) pathIneligible(path *bgpPath) string {
+	if bgpwire.AsPathContains(path.attrs.AsPath, r.asn) {
+		return "as-loop"
+	}
+	if _, reachable := r.pathIgpCost(path); !reachable {
+		return "unreachable"
+	}
+	return ""
+}
+
+/*
+pathCompare(): RFC4271 9.1.2.2 Breaking Ties (Phase 2).
+Returns true if path a is preferred over path b, and the deciding tie-breaker.
+
+MED is compared only between paths from the same neighboring AS. A missing
+MED is taken as the lowest value.
+*/
+func (r *BgpRouter) pathCompare(a, b *bgpPath) (bool, int) {
+	if a.peer.weight != b.peer.weight {
+		return a.peer.weight > b.peer.weight, BGP_BEST_WEIGHT
+	}
+	if la, lb := r.pathLocalPref(a), r.pathLocalPref(b); la != lb {
+		return la > lb, BGP_BEST_LOCAL_PREF
+	}
+	if la, lb := bgpwire.AsPathLen(a.attrs.AsPath), bgpwire.AsPathLen(b.attrs.AsPath); la != lb {
+		return la < lb, BGP_BEST_AS_PATH
+	}
+	if a.attrs.Origin != b.attrs.Origin {
+		return a.attrs.Origin < b.attrs.Origin, BGP_BEST_ORIGIN
+	}
+	if r.neighborAs(a) == r.neighborAs(b) && a.attrs.Med != b.attrs.Med {
+		return a.attrs.Med < b.attrs.Med, BGP_BEST_MED
+	}
+	if ea, eb := r.pathExternal(a), r.pathExternal(b); ea != eb {
+		return ea, BGP_BEST_EBGP
+	}
+	ca, _ := r.pathIgpCost(a)
+	cb, _ := r.pathIgpCost(b)
+	if ca != cb {
+		return ca < cb, BGP_BEST_IGP_COST
+	}
+	if !a.remoteId.Equal(b.remoteId) {
+		return bgpIdLess(a.remoteId, b.remoteId), BGP_BEST_ROUTER_ID
+	}
+	return bgpIdLess(a.peer.addr, b.peer.addr), BGP_BEST_PEER_ADDR
+}
+
+func (r *BgpRouter) pathExternal(path *bgpPath) bool {
+	return path.peer.remoteAs != r.asn
+}
+
+// pathLocalPref(): LOCAL_PREF is meaningful only for routes from internal peers
+func (r *BgpRouter) pathLocalPref(path *bgpPath) uint32 {
+	if r.pathExternal(path) || !path.attrs.Has(bgpwire.BGP_ATTR_LOCAL_PREF) {
+		return BGP_LOCAL_PREF_DEFAULT
+	}
+	return path.attrs.LocalPref
+}
+
+// pathIgpCost(): interior cost to next hop; every next hop is reachable at cost 0 without resolver
+func (r *BgpRouter) pathIgpCost(path *bgpPath) (uint32, bool) {
+	if r.igpCost == nil {
+		return 0, true
+	}
+	return r.igpCost(path.nexthop)
+}
+
+// neighborAs(): AS the route was received from: leftmost AS_SEQUENCE entry, or local AS
+func (r *BgpRouter) neighborAs(path *bgpPath) int {
+	if asPath := path.attrs.AsPath; len(asPath) > 0 && asPath[0].Type == bgpwire.BGP_AS_SEQUENCE {
+		return asPath[0].Asns[0]
+	}
+	return r.asn
+}
+
+/*
+ribOutSync(): advertise Loc-RIB changes for prefixes of family into peer
+Adj-RIB-Out. Prefixes sharing attributes are packed into the same UPDATE.
+Nothing is sent for families not negotiated with the peer.
+*/
+func (r *BgpRouter) ribOutSync(s *bgpSession, f bgpwire.Family, prefixes []net.IPNet) {
+	if !s.families[f] || !r.sessionActive(s) {
+		return
+	}
+
+	p := s.peer
+	ribOut := p.ribOut[f]
+
+	withdrawn := []net.IPNet{}
+	groups := map[string]*bgpwire.Attrs{}
+	members := map[string][]net.IPNet{}
+	order := []string{} // stable output
+
+	for _, n := range prefixes {
+		key := n.String()
+
+		var a *bgpwire.Attrs
+		var attrs []byte
+		if d, found := r.locRib[f][key]; found {
+			a, attrs = r.ribExport(s, f, d.best)
+		}
+
+		old, advertised := ribOut[key]
+		if attrs == nil {
+			if advertised {
+				delete(ribOut, key)
+				withdrawn = append(withdrawn, n)
+			}
+			continue
+		}
+		if advertised && bytes.Equal(old.attrs, attrs) {
+			continue // peer is up to date
+		}
+
+		ribOut[key] = &bgpAdvert{prefix: n, attrs: attrs}
+
+		group := string(attrs)
+		if _, found := groups[group]; !found {
+			groups[group] = a
+			order = append(order, group)
+		}
+		members[group] = append(members[group], n)
+	}
+
+	msgs := bgpwire.UpdatePack(f, nil, withdrawn, s.as4)
+	for _, group := range order {
+		msgs = append(msgs, bgpwire.UpdatePack(f, groups[group], members[group], s.as4)...)
+	}
+
+	for _, m := range msgs {
+		if r.sessionSend(s, m) != nil {
+			return // session closed
+		}
+	}
+}
+
+/*
+ribExport(): attributes advertised to session peer for path, both as
+struct and encoded, or nil if path is not advertised to peer.
+Prefixes are left out of multiprotocol attributes.
+
+RFC4271 9.2: routes are not sent back to their originating peer, and
+routes learned from internal peers are not sent to internal peers.
+*/
+func (r *BgpRouter) ribExport(s *bgpSession, f bgpwire.Family, path *bgpPath) (*bgpwire.Attrs, []byte) {
+	p := s.peer
+	external := p.remoteAs != r.asn
+
+	if path.peer == p {
+		return nil, nil
+	}
+	if !external && !r.pathExternal(path) {
+		return nil, nil // iBGP split horizon
+	}
+	if external && bgpwire.AsPathContains(path.attrs.AsPath, p.remoteAs) {
+		return nil, nil // peer would discard it as a loop
+	}
+
+	a := *path.attrs // shallow copy: shared slices are replaced, never modified
+
+	// RFC4271 5: unrecognized optional transitive attributes are passed along as partial
+	a.Unknown = nil
+	for _, u := range path.attrs.Unknown {
+		if u.Flags&bgpwire.BGP_ATTR_FLAG_TRANSITIVE != 0 {
+			u.Flags |= bgpwire.BGP_ATTR_FLAG_PARTIAL
+			a.Unknown = append(a.Unknown, u)
+		}
+	}
+
+	if !r.exportNexthop(s, f, path, &a, external) {
+		return nil, nil
+	}
+
+	if external {
+		a.AsPath = bgpwire.AsPathPrepend(a.AsPath, r.asn)
+		a.Clear(bgpwire.BGP_ATTR_LOCAL_PREF)
+		a.Clear(bgpwire.BGP_ATTR_MED) // RFC4271 5.1.4: MED is not propagated to other neighboring ASes
+	} else {
+		a.LocalPref = r.pathLocalPref(path)
+		a.Set(bgpwire.BGP_ATTR_LOCAL_PREF)
+	}
+
+	if !s.as4 {
+		bgpwire.As4Split(&a)
+	}
+
+	attrs := bgpwire.AttrsEncode(&a, s.as4)
+	if len(attrs) > bgpwire.BGP_MAX_SIZE-bgpwire.BGP_HEADER_SIZE-bgpwire.BGP_UPDATE_SIZE-2-f.Bits()/8 { // room for one prefix
+		log.Printf("bgp router: neighbor %v: prefix %v: attributes too large: %d bytes", p.addr, &path.prefix, len(attrs))
+		return nil, nil
+	}
+
+	return &a, attrs
+}
+
+/*
+exportNexthop(): RFC4271 5.1.3: next hop is the local address towards
+external peers, and it is kept towards internal peers.
+
+RFC2545 3: an IPv6 link-local next hop is meaningful only on its own
+link, then it is sent only along with our own global next hop to a
+directly connected peer.
+*/
+func (r *BgpRouter) exportNexthop(s *bgpSession, f bgpwire.Family, path *bgpPath, a *bgpwire.Attrs, external bool) bool {
+	if f == bgpwire.IPv4Unicast {
+		a.Nexthop = path.nexthop
+		if external {
+			a.Nexthop = s.localAddr(r.routerId)
+		}
+		a.Set(bgpwire.BGP_ATTR_NEXT_HOP)
+		return true
+	}
+
+	a.MpReach = bgpwire.MpReach{Family: f, Nexthop: path.nexthop}
+	if external {
+		if s.nexthop6 == nil {
+			log.Printf("bgp router: neighbor %v: prefix %v: no global IPv6 address for next hop", s.peer.addr, &path.prefix)
+			return false
+		}
+		a.MpReach.Nexthop = s.nexthop6
+		a.MpReach.LinkLocal = s.linkLocal6
+	}
+	a.Set(bgpwire.BGP_ATTR_MP_REACH_NLRI)
+	return true
+}
+
+// locRibPrefixes(): Loc-RIB prefixes of family in address order
+func (r *BgpRouter) locRibPrefixes(f bgpwire.Family) []net.IPNet {
+	prefixes := make([]net.IPNet, 0, len(r.locRib[f]))
+	for _, d := range r.locRib[f] {
+		prefixes = append(prefixes, d.prefix)
+	}
+	bgpSortPrefixes(prefixes)
+	return prefixes
+}
+
+func bgpSortPrefixes(prefixes []net.IPNet) {
+	sort.Slice(prefixes, func(i, j int) bool { return bgpPrefixLess(prefixes[i], prefixes[j]) })
+}
+
+func bgpPrefixLess(n1, n2 net.IPNet) bool {
+	if c := bytes.Compare(n1.IP.To16(), n2.IP.To16()); c != 0 {
+		return c < 0
+	}
+	ones1, _ := n1.Mask.Size()
+	ones2, _ := n2.Mask.Size()
+	return ones1 < ones2
+}
+
+func bgpOriginName(origin int) string {
+	switch origin {
+	case bgpwire.BGP_ORIGIN_IGP:
+		return "IGP"
+	case bgpwire.BGP_ORIGIN_EGP:
+		return "EGP"
+	}
+	return "incomplete"
+}
+
+// bgpOriginCode(): short origin for route table
+func bgpOriginCode(origin int) string {
+	switch origin {
+	case bgpwire.BGP_ORIGIN_IGP:
+		return "i"
+	case bgpwire.BGP_ORIGIN_EGP:
+		return "e"
+	}
+	return "?"
+}
+
+func (r *BgpRouter) ShowRoutes(c command.LineSender, f bgpwire.Family) {
+	r.call(func() { r.showRoutes(c, f) })
+}
+
+// ShowRoute(): paths for prefix, looked up in the table for its family
+func (r *BgpRouter) ShowRoute(c command.LineSender, prefix net.IPNet) {
+	r.call(func() { r.showRoute(c, prefix) })
+}
+
+func (r *BgpRouter) showRoutes(c command.LineSender, f bgpwire.Family) {
+
+	netWidth, nexthopWidth := 18, 15
+	if f.Afi == bgpwire.BGP_AFI_IPV6 {
+		netWidth, nexthopWidth = 30, 25
+	}
+
+	c.Sendln(fmt.Sprintf("BGP router identifier %v, local AS number %d", r.routerId, r.asn))
+	c.Sendln("Status codes: * valid, > best, x ineligible")
+	c.Sendln(fmt.Sprintf("   %-*s %-*s %10s %10s %6s %-13s %s", netWidth, "NETWORK", nexthopWidth, "NEXTHOP", "MED", "LOCPRF", "WEIGHT", "REASON", "PATH"))
+
+	peers := r.sortedPeers()
+
+	for _, n := range r.bgpPrefixes(f, peers) {
+		d := r.locRib[f][n.String()]
+		for _, path := range r.candidates(f, peers, n.String()) {
+			status := "* "
+			reason := "-"
+			if ineligible := r.pathIneligible(path); ineligible != "" {
+				status = "x "
+				reason = ineligible
+			} else if d != nil && d.best == path {
+				status = "*>"
+				reason = bgpBestName(d.reason)
+			}
+			med := "-"
+			if path.attrs.Has(bgpwire.BGP_ATTR_MED) {
+				med = strconv.FormatUint(uint64(path.attrs.Med), 10)
+			}
+			asPath := strings.TrimSpace(bgpwire.AsPathString(path.attrs.AsPath) + " " + bgpOriginCode(path.attrs.Origin))
+			c.Sendln(fmt.Sprintf("%s %-*v %-*v %10s %10d %6d %-13s %s", status, netWidth, &path.prefix, nexthopWidth, path.nexthop, med,
+				r.pathLocalPref(path), path.peer.weight, reason, asPath))
+		}
+	}
+}
+
+// bgpPrefixes(): prefixes of family from every Adj-RIB-In, in address order
+func (r *BgpRouter) bgpPrefixes(f bgpwire.Family, peers []*bgpPeer) []net.IPNet {
+	prefixes := []net.IPNet{}
+	seen := map[string]bool{}
+	for _, p := range peers {
+		for key, path := range p.ribIn[f] {
+			if !seen[key] {
+				seen[key] = true
+				prefixes = append(prefixes, path.prefix)
+			}
+		}
+	}
+	bgpSortPrefixes(prefixes)
+	return prefixes
+}
+
+func (r *BgpRouter) showRoute(c command.LineSender, prefix net.IPNet) {
+	f := bgpwire.PrefixFamily(prefix)
+	key := prefix.String()
+	paths := r.candidates(f, r.sortedPeers(), key)
+	if len(paths) == 0 {
+		c.Sendln(fmt.Sprintf("%% Network not in table: %s", key))
+		return
+	}
+
+	d := r.locRib[f][key]
+
+	c.Sendln(fmt.Sprintf("BGP routing table entry for %s", key))
+	if d == nil {
+		c.Sendln(fmt.Sprintf("Paths: %d available, no best path", len(paths)))
+	} else {
+		c.Sendln(fmt.Sprintf("Paths: %d available, best: %v (%s)", len(paths), d.best.peer.addr, bgpBestName(d.reason)))
+	}
+
+	now := time.Now()
+
+	for i, path := range paths {
+		var status string
+		switch {
+		case r.pathIneligible(path) != "":
+			status = "ineligible: " + r.pathIneligible(path)
+		case d != nil && d.best == path:
+			status = "best: " + bgpBestName(d.reason)
+		case d != nil:
+			_, step := r.pathCompare(d.best, path)
+			status = "not best: lost on " + bgpBestName(step)
+		}
+
+		peerType := "internal"
+		if r.pathExternal(path) {
+			peerType = "external"
+		}
+
+		a := path.attrs
+		cost, _ := r.pathIgpCost(path)
+
+		c.Sendln(fmt.Sprintf("  Path #%d: %s", i+1, status))
+		c.Sendln(fmt.Sprintf("    neighbor %v (id %v) %s AS %d, weight %d", path.peer.addr, path.remoteId, peerType, path.peer.remoteAs, path.peer.weight))
+		c.Sendln(fmt.Sprintf("    AS path: %s, origin %s", bgpwire.AsPathString(a.AsPath), bgpOriginName(a.Origin)))
+		c.Sendln(fmt.Sprintf("    next hop %v, IGP cost %d, MED %d, local-pref %d", path.nexthop, cost, a.Med, r.pathLocalPref(path)))
+		if path.linkLocal != nil {
+			ifName := path.ifName
+			if ifName == "" {
+				ifName = "unused: peer not directly connected"
+			}
+			c.Sendln(fmt.Sprintf("    link-local next hop %v (%s)", path.linkLocal, ifName))
+		}
+		if a.Has(bgpwire.BGP_ATTR_ATOMIC_AGGREGATE) {
+			c.Sendln("    atomic-aggregate")
+		}
+		if a.Has(bgpwire.BGP_ATTR_AGGREGATOR) {
+			c.Sendln(fmt.Sprintf("    aggregator AS %d id %v", a.AggregatorAs, a.AggregatorId))
+		}
+		c.Sendln(fmt.Sprintf("    received %s ago", now.Sub(path.received).Truncate(time.Second)))
+	}
+}
@@ -1,6 +1,303 @@
 package main
 
-/*
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/udhos/nexthop/bgpwire"
+	"github.com/udhos/nexthop/command"
+	"github.com/udhos/nexthop/fwd"
+)
+
+const (
+	BGP_PORT          = 179
+	BGP_HOLD_TIME     = 90 * time.Second
+	BGP_HOLD_TIME_MIN = 3 * time.Second
+	BGP_CONNECT_RETRY = 120 * time.Second
+	BGP_OPEN_HOLD     = 240 * time.Second // RFC4271 8.2.2: large hold time while waiting for OPEN
+	BGP_WRITE_TIMEOUT = 5 * time.Second
+)
+
 type BgpRouter struct {
+	asn        int
+	routerId   net.IP
+	listenAddr net.IP // also used as source for outgoing connections (nil means any)
+	port       int
+
+	holdTime     time.Duration
+	connectRetry time.Duration
+
+	peers    map[string]*bgpPeer // key: neighbor address
+	listener *net.TCPListener
+
+	locRib   map[bgpwire.Family]map[string]*bgpDest // key: prefix
+	igpCost  func(nexthop net.IP) (uint32, bool)    // next hop resolver: nil means every next hop reachable at cost 0
+	igpTable *bgpIgpTable                           // FIB snapshot behind igpCost
+	scan     bgpTimer                               // next hop scanner
+	hardware fwd.Dataplane                          // FIB: nil means routes are not installed
+
+	events chan func() // operations run within BgpRouter goroutine
+	quit   bool        // set by stop request
+	done   chan struct{}
+}
+
+// NewBgpRouter(): start BGP instance listening on TCP port 179, installing routes into hardware
+func NewBgpRouter(asn int, routerId net.IP, hardware fwd.Dataplane) *BgpRouter {
+	r := allocRouter(asn, routerId, nil, BGP_PORT)
+	r.hardware = hardware
+	r.fibFlush()
+	if err := r.listen(); err != nil {
+		// warning only: we can still open outgoing connections
+		log.Printf("NewBgpRouter: %v", err)
+	}
+	r.nexthopScan()
+	go r.run()
+	return r
+}
+
+// allocRouter(): create router without listener or goroutine
+func allocRouter(asn int, routerId, listenAddr net.IP, port int) *BgpRouter {
+	return &BgpRouter{asn: asn, routerId: routerId, listenAddr: listenAddr, port: port, holdTime: BGP_HOLD_TIME, connectRetry: BGP_CONNECT_RETRY,
+		peers: map[string]*bgpPeer{}, locRib: newLocRib(), events: make(chan func()), done: make(chan struct{})}
+}
+
+func (r *BgpRouter) listen() error {
+	laddr := &net.TCPAddr{IP: r.listenAddr, Port: r.port}
+	l, err := net.ListenTCP("tcp", laddr)
+	if err != nil {
+		return fmt.Errorf("listen: %v: %v", laddr, err)
+	}
+	r.listener = l
+	go r.acceptLoop(l)
+	return nil
 }
+
+// acceptLoop(): hand incoming connections to BgpRouter goroutine
+func (r *BgpRouter) acceptLoop(l *net.TCPListener) {
+	for {
+		conn, err := l.AcceptTCP()
+		if err != nil {
+			log.Printf("bgp router: accept: %v", err)
+			return // listener closed
+		}
+		if !r.post(func() { r.accept(conn) }) {
+			conn.Close()
+			return
+		}
+	}
+}
+
+/*
+post(): queue op for BgpRouter goroutine without waiting.
+Returns false if the goroutine has finished.
 */
+func (r *BgpRouter) post(op func()) bool {
+	select {
+	case r.events <- op:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// call(): run op within BgpRouter goroutine, then wait for its completion
+func (r *BgpRouter) call(op func()) {
+	finished := make(chan struct{})
+	if r.post(func() { op(); close(finished) }) {
+		<-finished
+	}
+}
+
+// run(): BgpRouter goroutine -- the single owner of peers and sessions
+func (r *BgpRouter) run() {
+	log.Printf("bgp router: goroutine started: as=%d id=%v", r.asn, r.routerId)
+
+	for !r.quit {
+		op := <-r.events
+		op()
+	}
+
+	close(r.done) // release pending posts
+
+	log.Printf("bgp router: goroutine finished")
+}
+
+// Stop(): shut down every session, then finish BgpRouter goroutine
+func (r *BgpRouter) Stop() {
+	r.call(func() {
+		if r.listener != nil {
+			r.listener.Close() // break acceptLoop
+		}
+		r.timerStop(&r.scan)
+		for _, p := range r.peers {
+			r.peerStop(p, bgpwire.BGP_CEASE_ADMIN_SHUTDOWN)
+		}
+		r.quit = true
+	})
+	<-r.done
+}
+
+func (r *BgpRouter) NeighborAdd(nbr net.IP, remoteAs int) error {
+	var err error
+	r.call(func() {
+		key := nbr.String()
+		if _, found := r.peers[key]; found {
+			err = fmt.Errorf("NeighborAdd: neighbor %v exists", nbr)
+			return
+		}
+		p := &bgpPeer{addr: nbr, remoteAs: remoteAs, state: BGP_IDLE, families: map[bgpwire.Family]bool{bgpwire.IPv4Unicast: true}, ribIn: newRibIn(), ribOut: newRibOut()}
+		r.peers[key] = p
+		log.Printf("bgp router: neighbor %v remote-as %d added", nbr, remoteAs)
+		r.peerStart(p) // ManualStart
+	})
+	return err
+}
+
+func (r *BgpRouter) NeighborDel(nbr net.IP) error {
+	var err error
+	r.call(func() {
+		key := nbr.String()
+		p, found := r.peers[key]
+		if !found {
+			err = fmt.Errorf("NeighborDel: neighbor %v not found", nbr)
+			return
+		}
+		r.peerStop(p, bgpwire.BGP_CEASE_DECONFIGURED) // ManualStop
+		delete(r.peers, key)
+		log.Printf("bgp router: neighbor %v removed", nbr)
+	})
+	return err
+}
+
+// HasNeighbor(): neighbor is configured
+func (r *BgpRouter) HasNeighbor(nbr net.IP) bool {
+	found := false
+	r.call(func() {
+		_, found = r.peers[nbr.String()]
+	})
+	return found
+}
+
+/*
+NeighborFamily(): activate or deactivate address family for neighbor.
+The session is reset in order to negotiate the new families.
+*/
+func (r *BgpRouter) NeighborFamily(nbr net.IP, f bgpwire.Family, enable bool) error {
+	var err error
+	r.call(func() {
+		p, found := r.peers[nbr.String()]
+		if !found {
+			err = fmt.Errorf("NeighborFamily: neighbor %v not found", nbr)
+			return
+		}
+		if p.families[f] == enable {
+			return
+		}
+		if enable {
+			p.families[f] = true
+		} else {
+			delete(p.families, f)
+		}
+		log.Printf("bgp router: neighbor %v address-family %v: active=%v", nbr, f, enable)
+		if len(p.sessions) > 0 {
+			r.peerStop(p, bgpwire.BGP_CEASE_CONFIG_CHANGE)
+			r.peerStart(p)
+		}
+	})
+	return err
+}
+
+/*
+NeighborWeight(): locally assigned preference for routes from neighbor.
+Route selection is rerun without resetting the session.
+*/
+func (r *BgpRouter) NeighborWeight(nbr net.IP, weight int) error {
+	var err error
+	r.call(func() {
+		p, found := r.peers[nbr.String()]
+		if !found {
+			err = fmt.Errorf("NeighborWeight: neighbor %v not found", nbr)
+			return
+		}
+		if p.weight == weight {
+			return
+		}
+		log.Printf("bgp router: neighbor %v weight: %d -> %d", nbr, p.weight, weight)
+		p.weight = weight
+		r.ribReselect()
+	})
+	return err
+}
+
+// SetRouterId(): new identifier is announced after resetting every session
+func (r *BgpRouter) SetRouterId(id net.IP) {
+	r.call(func() {
+		if r.routerId.Equal(id) {
+			return
+		}
+		log.Printf("bgp router: router-id changed: %v -> %v", r.routerId, id)
+		r.routerId = id
+		for _, p := range r.peers {
+			if p.state == BGP_IDLE && len(p.sessions) == 0 {
+				continue
+			}
+			r.peerStop(p, bgpwire.BGP_CEASE_CONFIG_CHANGE)
+			r.peerStart(p)
+		}
+	})
+}
+
+// neighborState(): FSM state and number of TCP sessions for neighbor
+func (r *BgpRouter) neighborState(nbr net.IP) (int, int) {
+	state, sessions := BGP_IDLE, 0
+	r.call(func() {
+		if p, found := r.peers[nbr.String()]; found {
+			state = p.currentState()
+			sessions = len(p.sessions)
+		}
+	})
+	return state, sessions
+}
+
+func (r *BgpRouter) ShowNeighbors(c command.LineSender) {
+	r.call(func() { r.showNeighbors(c) })
+}
+
+func (r *BgpRouter) showNeighbors(c command.LineSender) {
+
+	c.Sendln(fmt.Sprintf("BGP router identifier %v, local AS number %d", r.routerId, r.asn))
+	c.Sendln(fmt.Sprintf("%-15s %10s %-11s %8s %8s %8s %s", "NEIGHBOR", "AS", "STATE", "UP/DOWN", "MSG-RCVD", "MSG-SENT", "LAST-ERROR"))
+
+	now := time.Now()
+
+	for _, p := range r.sortedPeers() {
+		upDown := "never"
+		if !p.lastChange.IsZero() {
+			upDown = now.Sub(p.lastChange).Truncate(time.Second).String()
+		}
+		lastError := p.lastError
+		if lastError == "" {
+			lastError = "-"
+		}
+		c.Sendln(fmt.Sprintf("%-15v %10d %-11s %8s %8d %8d %s", p.addr, p.remoteAs, bgpStateName(p.currentState()), upDown, p.msgRecv, p.msgSent, lastError))
+	}
+}
+
+// sortedPeers(): peers ordered by address for stable display
+func (r *BgpRouter) sortedPeers() []*bgpPeer {
+	peers := make([]*bgpPeer, 0, len(r.peers))
+	for _, p := range r.peers {
+		i := 0
+		for ; i < len(peers); i++ {
+			if bgpIdLess(p.addr, peers[i].addr) {
+				break
+			}
+		}
+		peers = append(peers, nil)
+		copy(peers[i+1:], peers[i:])
+		peers[i] = p
+	}
+	return peers
+}
@@ -0,0 +1,127 @@
+package bgpwire
+
+import (
+	"github.com/udhos/nexthop/netorder"
+)
+
+/*
+RFC6793 BGP Support for Four-Octet Autonomous System (AS) Number Space
+
+Routes are kept with 4-octet AS numbers. Towards a 2-octet AS speaker
+(session without the 4-octet AS capability) AS numbers beyond 65535 are
+sent as AS_TRANS, and the true values travel in the optional transitive
+AS4_PATH and AS4_AGGREGATOR attributes. Routes from such a speaker are
+rebuilt from those attributes.
+*/
+
+// OpenAs4(): 4-octet AS number announced in OPEN capability, if any
+func OpenAs4(open *Open) (int, bool, *Error) {
+	for _, c := range open.Caps {
+		if c.Code != BGP_CAP_AS4 {
+			continue
+		}
+		if len(c.Value) != 4 {
+			return 0, false, NewError(BGP_ERR_OPEN, BGP_ERR_OPEN_UNSPECIFIC, nil, "bad 4-octet AS capability length=%d", len(c.Value))
+		}
+		return int(netorder.ReadUint32(c.Value, 0)), true, nil
+	}
+	return 0, false, nil
+}
+
+// As4Capability(): capability announcing local 4-octet AS number
+func As4Capability(asn int) Capability {
+	value := make([]byte, 4)
+	netorder.WriteUint32(value, 0, uint32(asn))
+	return Capability{Code: BGP_CAP_AS4, Value: value}
+}
+
+// As4Clear(): drop AS4 attributes: RFC6793 4.1: they are meaningless between 4-octet AS speakers
+func As4Clear(a *Attrs) {
+	a.Clear(BGP_ATTR_AS4_PATH)
+	a.Clear(BGP_ATTR_AS4_AGGREGATOR)
+	a.As4Path = nil
+	a.As4AggregatorAs = 0
+	a.As4AggregatorId = nil
+}
+
+/*
+As4Merge(): RFC6793 4.2.3: rebuild 4-octet AS information received
+from 2-octet AS speaker.
+
+AS4_PATH replaces the trailing part of AS_PATH, unless AS_PATH is
+shorter than AS4_PATH. Both AS4 attributes are ignored when AGGREGATOR
+carries a true 2-octet AS number while AS4_AGGREGATOR is present.
+*/
+func As4Merge(a *Attrs) {
+	defer As4Clear(a)
+
+	if a.Has(BGP_ATTR_AGGREGATOR) && a.Has(BGP_ATTR_AS4_AGGREGATOR) {
+		if a.AggregatorAs != BGP_AS_TRANS {
+			return
+		}
+		a.AggregatorAs = a.As4AggregatorAs
+		a.AggregatorId = a.As4AggregatorId
+	}
+
+	if !a.Has(BGP_ATTR_AS_PATH) || !a.Has(BGP_ATTR_AS4_PATH) {
+		return
+	}
+
+	size, size4 := AsPathLen(a.AsPath), AsPathLen(a.As4Path)
+	if size < size4 {
+		return
+	}
+
+	head := asPathHead(a.AsPath, size-size4)
+	a.AsPath = append(head, a.As4Path...)
+}
+
+// As4Split(): RFC6793 4.2.2: AS4 attributes for 2-octet AS speaker
+func As4Split(a *Attrs) {
+	As4Clear(a)
+
+	if a.Has(BGP_ATTR_AS_PATH) && asPathWide(a.AsPath) {
+		a.As4Path = a.AsPath
+		a.Set(BGP_ATTR_AS4_PATH)
+	}
+
+	if a.Has(BGP_ATTR_AGGREGATOR) && a.AggregatorAs > 0xFFFF {
+		a.As4AggregatorAs = a.AggregatorAs
+		a.As4AggregatorId = a.AggregatorId
+		a.Set(BGP_ATTR_AS4_AGGREGATOR)
+	}
+}
+
+// asPathWide(): path holds AS number not representable in 2 octets
+func asPathWide(segments []AsSegment) bool {
+	for _, seg := range segments {
+		for _, as := range seg.Asns {
+			if as > 0xFFFF {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// asPathHead(): leading path with size ASes, counted as for path length
+func asPathHead(segments []AsSegment, size int) []AsSegment {
+	head := []AsSegment{}
+	for _, seg := range segments {
+		if size < 1 {
+			break
+		}
+		if seg.Type == BGP_AS_SET {
+			head = append(head, seg)
+			size--
+			continue
+		}
+		count := len(seg.Asns)
+		if count > size {
+			count = size
+		}
+		head = append(head, AsSegment{Type: seg.Type, Asns: seg.Asns[:count]})
+		size -= count
+	}
+	return head
+}
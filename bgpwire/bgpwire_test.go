@@ -0,0 +1,314 @@
+package bgpwire
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func testSeq(asns ...int) []AsSegment {
+	return []AsSegment{{Type: BGP_AS_SEQUENCE, Asns: asns}}
+}
+
+func testUpdate() *Update {
+	_, w, _ := net.ParseCIDR("10.9.0.0/16")
+	_, n1, _ := net.ParseCIDR("10.1.0.0/16")
+	_, n2, _ := net.ParseCIDR("192.168.1.128/25")
+	_, n3, _ := net.ParseCIDR("0.0.0.0/0")
+	u := &Update{
+		Withdrawn: []net.IPNet{*w},
+		Attrs: Attrs{
+			Origin:       BGP_ORIGIN_EGP,
+			AsPath:       []AsSegment{{Type: BGP_AS_SEQUENCE, Asns: []int{100, 65535}}, {Type: BGP_AS_SET, Asns: []int{7, 8, 9}}},
+			Nexthop:      net.ParseIP("10.0.0.1"),
+			Med:          50,
+			LocalPref:    200,
+			AggregatorAs: 100,
+			AggregatorId: net.ParseIP("1.1.1.1"),
+			Unknown:      []RawAttr{{Flags: BGP_ATTR_FLAG_OPTIONAL | BGP_ATTR_FLAG_TRANSITIVE, TypeCode: 99, Value: bytes.Repeat([]byte{1}, 300)}},
+		},
+		Nlri: []net.IPNet{*n1, *n2, *n3},
+	}
+	for _, typeCode := range []int{BGP_ATTR_ORIGIN, BGP_ATTR_AS_PATH, BGP_ATTR_NEXT_HOP, BGP_ATTR_MED, BGP_ATTR_LOCAL_PREF, BGP_ATTR_ATOMIC_AGGREGATE, BGP_ATTR_AGGREGATOR} {
+		u.Attrs.Set(typeCode)
+	}
+	return u
+}
+
+// testUpdate6(): IPv6 routes carried in multiprotocol attributes
+func testUpdate6() *Update {
+	_, w, _ := net.ParseCIDR("2001:db8:9::/48")
+	_, n1, _ := net.ParseCIDR("2001:db8:1::/48")
+	_, n2, _ := net.ParseCIDR("::/0")
+	_, n3, _ := net.ParseCIDR("2001:db8::1/128")
+	u := &Update{
+		Withdrawn: []net.IPNet{},
+		Attrs: Attrs{
+			Origin: BGP_ORIGIN_IGP,
+			AsPath: testSeq(100, 200),
+			MpReach: MpReach{
+				Family:    IPv6Unicast,
+				Nexthop:   net.ParseIP("2001:db8::1"),
+				LinkLocal: net.ParseIP("fe80::1"),
+				Nlri:      []net.IPNet{*n1, *n2, *n3},
+			},
+			MpUnreach: MpUnreach{Family: IPv6Unicast, Withdrawn: []net.IPNet{*w}},
+		},
+		Nlri: []net.IPNet{},
+	}
+	for _, typeCode := range []int{BGP_ATTR_ORIGIN, BGP_ATTR_AS_PATH, BGP_ATTR_MP_REACH_NLRI, BGP_ATTR_MP_UNREACH_NLRI} {
+		u.Attrs.Set(typeCode)
+	}
+	return u
+}
+
+// testRead(): read single message from buffer
+func testRead(t *testing.T, msg []byte, wantType int) []byte {
+	msgType, body, err := Read(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if msgType != wantType {
+		t.Fatalf("read: want type=%d got=%d", wantType, msgType)
+	}
+	return body
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, as4 := range []bool{false, true} {
+		for _, u := range []*Update{testUpdate(), testUpdate6()} {
+			got, err := UpdateDecode(testRead(t, UpdateEncode(u, as4), BGP_MSG_UPDATE), as4)
+			if err != nil {
+				t.Fatalf("update decode as4=%v: %v", as4, err)
+			}
+			if !reflect.DeepEqual(u, got) {
+				t.Errorf("update round trip as4=%v:\nwant %+v\n got %+v", as4, u, got)
+			}
+		}
+	}
+
+	open := &Open{Version: BGP_VERSION, As: 65001, HoldTime: 180, Id: net.ParseIP("10.0.0.1"),
+		Caps: []Capability{{Code: BGP_CAP_ROUTE_REFRESH, Value: []byte{}}, {Code: BGP_CAP_AS4, Value: []byte{0, 0, 0xfd, 0xe9}}, MpCapability(IPv6Unicast)}}
+	gotOpen, errOpen := OpenDecode(testRead(t, OpenEncode(open), BGP_MSG_OPEN))
+	if errOpen != nil {
+		t.Fatalf("open decode: %v", errOpen)
+	}
+	if !reflect.DeepEqual(open, gotOpen) {
+		t.Errorf("open round trip:\nwant %+v\n got %+v", open, gotOpen)
+	}
+
+	code, subcode, data, errNotif := NotificationDecode(testRead(t, NotificationEncode(BGP_ERR_CEASE, BGP_CEASE_COLLISION, []byte{1, 2}), BGP_MSG_NOTIFICATION))
+	if errNotif != nil || code != BGP_ERR_CEASE || subcode != BGP_CEASE_COLLISION || !bytes.Equal(data, []byte{1, 2}) {
+		t.Errorf("notification round trip: code=%d subcode=%d data=%v err=%v", code, subcode, data, errNotif)
+	}
+
+	testRead(t, KeepaliveEncode(), BGP_MSG_KEEPALIVE)
+}
+
+func wantError(t *testing.T, label string, err error, code, subcode int) {
+	e, ok := err.(*Error)
+	if !ok {
+		t.Errorf("%s: want bgp error %d/%d, got: %v", label, code, subcode, err)
+		return
+	}
+	if e.Code != code || e.Subcode != subcode {
+		t.Errorf("%s: want bgp error %d/%d, got: %d/%d %s", label, code, subcode, e.Code, e.Subcode, e.Reason)
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	// header errors
+	badMarker := KeepaliveEncode()
+	badMarker[3] = 0
+	badType := Encode(9, nil)
+	longKeepalive := Encode(BGP_MSG_KEEPALIVE, []byte{0})
+	shortUpdate := Encode(BGP_MSG_UPDATE, []byte{0, 0})
+	for _, c := range []struct {
+		label   string
+		msg     []byte
+		subcode int
+	}{
+		{"bad marker", badMarker, BGP_ERR_SUB_NOT_SYNC},
+		{"bad type", badType, BGP_ERR_SUB_BAD_TYPE},
+		{"long keepalive", longKeepalive, BGP_ERR_SUB_BAD_LEN},
+		{"short update", shortUpdate, BGP_ERR_SUB_BAD_LEN},
+	} {
+		_, _, err := Read(bytes.NewReader(c.msg))
+		wantError(t, c.label, err, BGP_ERR_HEADER, c.subcode)
+	}
+
+	// OPEN errors
+	badParam := OpenEncode(&Open{Version: BGP_VERSION, As: 1, HoldTime: 90, Id: net.ParseIP("1.1.1.1")})[BGP_HEADER_SIZE:]
+	badParam = append(badParam, 1, 0) // authentication parameter (deprecated)
+	badParam[9] = 2
+	_, err := OpenDecode(badParam)
+	wantError(t, "unsupported optional parameter", err, BGP_ERR_OPEN, BGP_ERR_OPEN_UNSUPP_OPT)
+
+	// UPDATE errors: attributes after empty withdrawn routes
+	update := func(attrs []byte, nlri ...byte) []byte {
+		body := []byte{0, 0, byte(len(attrs) >> 8), byte(len(attrs))}
+		body = append(body, attrs...)
+		return append(body, nlri...)
+	}
+	origin := []byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_ORIGIN, 1, 0}
+	asPath := []byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_AS_PATH, 4, BGP_AS_SEQUENCE, 1, 0, 100}
+	nexthop := []byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_NEXT_HOP, 4, 10, 0, 0, 1}
+	mandatory := append(append(append([]byte{}, origin...), asPath...), nexthop...)
+	cat := func(a ...[]byte) []byte { return bytes.Join(a, nil) }
+	for _, c := range []struct {
+		label   string
+		body    []byte
+		subcode int
+	}{
+		{"withdrawn overflow", []byte{0, 9, 0, 0}, BGP_ERR_UPDATE_ATTR_LIST},
+		{"attributes overflow", []byte{0, 0, 0, 9}, BGP_ERR_UPDATE_ATTR_LIST},
+		{"duplicate", update(cat(mandatory, origin)), BGP_ERR_UPDATE_ATTR_LIST},
+		{"unrecognized well-known", update([]byte{BGP_ATTR_FLAG_TRANSITIVE, 99, 0}), BGP_ERR_UPDATE_UNRECOGNIZED},
+		{"missing next hop", update(cat(origin, asPath), 8, 10), BGP_ERR_UPDATE_MISSING},
+		{"flags", update([]byte{BGP_ATTR_FLAG_OPTIONAL, BGP_ATTR_ORIGIN, 1, 0}), BGP_ERR_UPDATE_ATTR_FLAGS},
+		{"partial well-known", update([]byte{BGP_ATTR_FLAG_TRANSITIVE | BGP_ATTR_FLAG_PARTIAL, BGP_ATTR_ORIGIN, 1, 0}), BGP_ERR_UPDATE_ATTR_FLAGS},
+		{"partial optional non-transitive", update([]byte{BGP_ATTR_FLAG_OPTIONAL | BGP_ATTR_FLAG_PARTIAL, BGP_ATTR_MED, 4, 0, 0, 0, 1}), BGP_ERR_UPDATE_ATTR_FLAGS},
+		{"length", update([]byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_ORIGIN, 2, 0, 0}), BGP_ERR_UPDATE_ATTR_LEN},
+		{"origin", update([]byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_ORIGIN, 1, 3}), BGP_ERR_UPDATE_ORIGIN},
+		{"next hop", update([]byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_NEXT_HOP, 4, 224, 0, 0, 1}), BGP_ERR_UPDATE_NEXTHOP},
+		{"network", update(mandatory, 33, 10, 0, 0, 0, 0), BGP_ERR_UPDATE_NETWORK},
+		{"truncated network", update(mandatory, 24, 10), BGP_ERR_UPDATE_NETWORK},
+		{"as path", update([]byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_AS_PATH, 4, BGP_AS_SEQUENCE, 2, 0, 100}), BGP_ERR_UPDATE_AS_PATH},
+		{"as path segment type", update([]byte{BGP_ATTR_FLAG_TRANSITIVE, BGP_ATTR_AS_PATH, 4, 9, 1, 0, 100}), BGP_ERR_UPDATE_AS_PATH},
+		{"mp family", update(cat(origin, asPath, []byte{BGP_ATTR_FLAG_OPTIONAL, BGP_ATTR_MP_REACH_NLRI, 9, 0, 2, 128, 4, 10, 0, 0, 1, 0})), BGP_ERR_UPDATE_OPTIONAL_ATTR},
+		{"mp next hop length", update(cat(origin, asPath, []byte{BGP_ATTR_FLAG_OPTIONAL, BGP_ATTR_MP_REACH_NLRI, 9, 0, 2, 1, 4, 10, 0, 0, 1, 0})), BGP_ERR_UPDATE_OPTIONAL_ATTR},
+		{"mp truncated", update([]byte{BGP_ATTR_FLAG_OPTIONAL, BGP_ATTR_MP_UNREACH_NLRI, 2, 0, 2}), BGP_ERR_UPDATE_OPTIONAL_ATTR},
+		{"mp network", update([]byte{BGP_ATTR_FLAG_OPTIONAL, BGP_ATTR_MP_UNREACH_NLRI, 5, 0, 2, 1, 129, 0}), BGP_ERR_UPDATE_NETWORK},
+		{"mp missing as path", update(cat(origin, []byte{BGP_ATTR_FLAG_OPTIONAL, BGP_ATTR_MP_REACH_NLRI, 21, 0, 2, 1, 16, 0x20, 1, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0})), BGP_ERR_UPDATE_MISSING},
+	} {
+		_, err := UpdateDecode(c.body, false)
+		wantError(t, c.label, err, BGP_ERR_UPDATE, c.subcode)
+	}
+
+	// reachable routes with mandatory attributes only
+	if u, err := UpdateDecode(update(mandatory, 8, 10), false); err != nil || len(u.Nlri) != 1 {
+		t.Errorf("mandatory attributes: unexpected error: %v", err)
+	}
+
+	// Partial bit is valid on optional transitive attributes
+	aggregator := []byte{BGP_ATTR_FLAG_OPTIONAL | BGP_ATTR_FLAG_TRANSITIVE | BGP_ATTR_FLAG_PARTIAL, BGP_ATTR_AGGREGATOR, 6, 0, 100, 1, 1, 1, 1}
+	if _, err := UpdateDecode(update(cat(mandatory, aggregator), 8, 10), false); err != nil {
+		t.Errorf("partial optional transitive: unexpected error: %v", err)
+	}
+
+	// NEXT_HOP is not required for routes carried only in MP_REACH_NLRI
+	mpReach := []byte{BGP_ATTR_FLAG_OPTIONAL, BGP_ATTR_MP_REACH_NLRI, 24, 0, 2, 1, 16, 0x20, 1, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 16, 0x20, 1}
+	if u, err := UpdateDecode(update(cat(origin, asPath, mpReach)), false); err != nil || len(u.Attrs.MpReach.Nlri) != 1 || u.Attrs.MpReach.LinkLocal != nil {
+		t.Errorf("mp reach without next hop: unexpected result: %v", err)
+	}
+}
+
+// fuzzError(): decoding failures must map into NOTIFICATION
+func fuzzError(t *testing.T, err error) {
+	if _, ok := err.(*Error); !ok {
+		t.Fatalf("error not mapped to notification: %v", err)
+	}
+}
+
+func FuzzUpdateDecode(f *testing.F) {
+	f.Add(UpdateEncode(testUpdate(), false)[BGP_HEADER_SIZE:], false)
+	f.Add(UpdateEncode(testUpdate(), true)[BGP_HEADER_SIZE:], true)
+	f.Add(UpdateEncode(testUpdate6(), true)[BGP_HEADER_SIZE:], true)
+	f.Add([]byte{0, 0, 0, 0}, true)
+	f.Fuzz(func(t *testing.T, body []byte, as4 bool) {
+		u, err := UpdateDecode(body, as4)
+		if err != nil {
+			fuzzError(t, err)
+			return
+		}
+		again, err2 := UpdateDecode(UpdateEncode(u, as4)[BGP_HEADER_SIZE:], as4)
+		if err2 != nil {
+			t.Fatalf("re-encoded update rejected: %v", err2)
+		}
+		if !reflect.DeepEqual(u, again) {
+			t.Fatalf("update round trip:\nwant %+v\n got %+v", u, again)
+		}
+	})
+}
+
+func FuzzOpenDecode(f *testing.F) {
+	f.Add(OpenEncode(&Open{Version: BGP_VERSION, As: 1, HoldTime: 90, Id: net.ParseIP("1.1.1.1"), Caps: []Capability{{Code: BGP_CAP_AS4, Value: []byte{0, 0, 0, 1}}}})[BGP_HEADER_SIZE:])
+	f.Fuzz(func(t *testing.T, body []byte) {
+		open, err := OpenDecode(body)
+		if err != nil {
+			fuzzError(t, err)
+			return
+		}
+		again, err2 := OpenDecode(OpenEncode(open)[BGP_HEADER_SIZE:])
+		if err2 != nil {
+			t.Fatalf("re-encoded open rejected: %v", err2)
+		}
+		if !reflect.DeepEqual(open, again) {
+			t.Fatalf("open round trip:\nwant %+v\n got %+v", open, again)
+		}
+	})
+}
+
+func FuzzRead(f *testing.F) {
+	f.Add(KeepaliveEncode())
+	f.Add(NotificationEncode(BGP_ERR_CEASE, BGP_CEASE_DECONFIGURED, nil))
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		_, _, err := Read(bytes.NewReader(msg))
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			fuzzError(t, err)
+		}
+	})
+}
+
+func TestAs4Merge(t *testing.T) {
+	// 2-octet encoding hides wide AS numbers behind AS_TRANS
+	var a Attrs
+	a.AsPath = []AsSegment{{Type: BGP_AS_SEQUENCE, Asns: []int{100, 65536, 70000}}, {Type: BGP_AS_SET, Asns: []int{7, 80000}}}
+	a.AggregatorAs = 80000
+	a.AggregatorId = net.ParseIP("1.1.1.1")
+	for _, typeCode := range []int{BGP_ATTR_ORIGIN, BGP_ATTR_AS_PATH, BGP_ATTR_NEXT_HOP, BGP_ATTR_AGGREGATOR} {
+		a.Set(typeCode)
+	}
+	a.Nexthop = net.ParseIP("10.0.0.1")
+	full := a
+
+	As4Split(&a)
+	var got Attrs
+	if err := AttrsDecode(&got, AttrsEncode(&a, false), false); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := "100 23456 23456 {7,23456}"; AsPathString(got.AsPath) != want || got.AggregatorAs != BGP_AS_TRANS {
+		t.Errorf("2-octet path: want path=[%s] aggregator=%d got path=[%s] aggregator=%d", want, BGP_AS_TRANS, AsPathString(got.AsPath), got.AggregatorAs)
+	}
+
+	As4Merge(&got)
+	if !reflect.DeepEqual(got.AsPath, full.AsPath) || got.AggregatorAs != 80000 || got.Has(BGP_ATTR_AS4_PATH) || got.Has(BGP_ATTR_AS4_AGGREGATOR) {
+		t.Errorf("merge: want path=[%s] aggregator=80000 got path=[%s] aggregator=%d", AsPathString(full.AsPath), AsPathString(got.AsPath), got.AggregatorAs)
+	}
+
+	merge := func(asPath, as4Path []AsSegment, aggregatorAs int) Attrs {
+		var m Attrs
+		m.AsPath, m.As4Path = asPath, as4Path
+		m.AggregatorAs, m.As4AggregatorAs = aggregatorAs, 90000
+		for _, typeCode := range []int{BGP_ATTR_AS_PATH, BGP_ATTR_AS4_PATH, BGP_ATTR_AGGREGATOR, BGP_ATTR_AS4_AGGREGATOR} {
+			m.Set(typeCode)
+		}
+		As4Merge(&m)
+		return m
+	}
+
+	// 2-octet speakers prepended to path after it left the 4-octet region
+	if m := merge(testSeq(10, 20, 23456, 30), testSeq(70000, 30), BGP_AS_TRANS); AsPathString(m.AsPath) != "10 20 70000 30" || m.AggregatorAs != 90000 {
+		t.Errorf("merge prepended: got path=[%s] aggregator=%d", AsPathString(m.AsPath), m.AggregatorAs)
+	}
+	// AS4_PATH longer than AS_PATH is ignored
+	if m := merge(testSeq(23456), testSeq(70000, 30), BGP_AS_TRANS); AsPathString(m.AsPath) != "23456" {
+		t.Errorf("merge longer AS4_PATH: got path=[%s]", AsPathString(m.AsPath))
+	}
+	// true 2-octet aggregator: AS4 attributes are ignored
+	if m := merge(testSeq(10, 23456), testSeq(70000), 10); AsPathString(m.AsPath) != "10 23456" || m.AggregatorAs != 10 {
+		t.Errorf("merge 2-octet aggregator: got path=[%s] aggregator=%d", AsPathString(m.AsPath), m.AggregatorAs)
+	}
+}
@@ -0,0 +1,299 @@
+package bgpwire
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/udhos/nexthop/addr"
+	"github.com/udhos/nexthop/netorder"
+)
+
+/*
+RFC4271 4.1 Message Header Format
+
+      0                   1                   2                   3
+      0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+      +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+      |                                                               |
+      +                                                               +
+      |                                                               |
+      +                                                               +
+      |                           Marker                              |
+      +                                                               +
+      |                                                               |
+      +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+      |          Length               |      Type     |
+      +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+const BGP_VERSION = 4
+
+const (
+	BGP_MARKER_SIZE       = 16
+	BGP_HEADER_SIZE       = 19
+	BGP_MAX_SIZE          = 4096
+	BGP_OPEN_SIZE         = 10 // OPEN body without optional parameters
+	BGP_UPDATE_SIZE       = 4  // UPDATE body without withdrawn routes, attributes and NLRI
+	BGP_NOTIFICATION_SIZE = 2  // NOTIFICATION body without data
+)
+
+// message types
+const (
+	BGP_MSG_OPEN         = 1
+	BGP_MSG_UPDATE       = 2
+	BGP_MSG_NOTIFICATION = 3
+	BGP_MSG_KEEPALIVE    = 4
+)
+
+// NOTIFICATION error codes
+const (
+	BGP_ERR_HEADER       = 1
+	BGP_ERR_OPEN         = 2
+	BGP_ERR_UPDATE       = 3
+	BGP_ERR_HOLD_TIMER   = 4
+	BGP_ERR_FSM          = 5
+	BGP_ERR_CEASE        = 6
+	BGP_ERR_SUB_NONE     = 0
+	BGP_ERR_SUB_NOT_SYNC = 1 // header: connection not synchronized
+	BGP_ERR_SUB_BAD_LEN  = 2 // header: bad message length
+	BGP_ERR_SUB_BAD_TYPE = 3 // header: bad message type
+)
+
+// OPEN error subcodes
+const (
+	BGP_ERR_OPEN_UNSPECIFIC = 0
+	BGP_ERR_OPEN_VERSION    = 1
+	BGP_ERR_OPEN_PEER_AS    = 2
+	BGP_ERR_OPEN_BGP_ID     = 3
+	BGP_ERR_OPEN_UNSUPP_OPT = 4
+	BGP_ERR_OPEN_HOLD_TIME  = 6
+)
+
+// UPDATE error subcodes
+const (
+	BGP_ERR_UPDATE_ATTR_LIST     = 1 // malformed attribute list
+	BGP_ERR_UPDATE_UNRECOGNIZED  = 2 // unrecognized well-known attribute
+	BGP_ERR_UPDATE_MISSING       = 3 // missing well-known attribute
+	BGP_ERR_UPDATE_ATTR_FLAGS    = 4
+	BGP_ERR_UPDATE_ATTR_LEN      = 5
+	BGP_ERR_UPDATE_ORIGIN        = 6 // invalid ORIGIN attribute
+	BGP_ERR_UPDATE_NEXTHOP       = 8 // invalid NEXT_HOP attribute
+	BGP_ERR_UPDATE_OPTIONAL_ATTR = 9 // optional attribute error
+	BGP_ERR_UPDATE_NETWORK       = 10
+	BGP_ERR_UPDATE_AS_PATH       = 11 // malformed AS_PATH
+)
+
+// FSM error subcodes (RFC6608)
+const (
+	BGP_ERR_FSM_OPENSENT    = 1
+	BGP_ERR_FSM_OPENCONFIRM = 2
+	BGP_ERR_FSM_ESTABLISHED = 3
+)
+
+// Cease subcodes (RFC4486)
+const (
+	BGP_CEASE_ADMIN_SHUTDOWN = 2
+	BGP_CEASE_DECONFIGURED   = 3
+	BGP_CEASE_CONFIG_CHANGE  = 6
+	BGP_CEASE_COLLISION      = 7
+)
+
+// Error: error to be reported to peer as NOTIFICATION
+type Error struct {
+	Code    int
+	Subcode int
+	Data    []byte
+	Reason  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bgp error code=%d subcode=%d: %s", e.Code, e.Subcode, e.Reason)
+}
+
+func NewError(code, subcode int, data []byte, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Subcode: subcode, Data: data, Reason: fmt.Sprintf(format, a...)}
+}
+
+// OPEN optional parameter types
+const (
+	BGP_PARAM_CAPABILITY = 2 // RFC5492
+)
+
+// capability codes
+const (
+	BGP_CAP_MULTIPROTOCOL = 1  // RFC4760
+	BGP_CAP_ROUTE_REFRESH = 2  // RFC2918
+	BGP_CAP_AS4           = 65 // RFC6793
+)
+
+const BGP_AS_TRANS = 23456 // RFC6793: 2-octet stand-in for AS number beyond 65535
+
+// Open: OPEN message body
+type Open struct {
+	Version  int
+	As       int
+	HoldTime int // seconds
+	Id       net.IP
+	Caps     []Capability
+}
+
+// Capability: RFC5492 capability advertised in OPEN
+type Capability struct {
+	Code  int
+	Value []byte
+}
+
+// Encode(): prepend header to message body
+func Encode(msgType int, body []byte) []byte {
+	size := BGP_HEADER_SIZE + len(body)
+	buf := make([]byte, size)
+	for i := 0; i < BGP_MARKER_SIZE; i++ {
+		buf[i] = 0xFF
+	}
+	netorder.WriteUint16(buf, 16, uint16(size))
+	buf[18] = byte(msgType)
+	copy(buf[BGP_HEADER_SIZE:], body)
+	return buf
+}
+
+func KeepaliveEncode() []byte {
+	return Encode(BGP_MSG_KEEPALIVE, nil)
+}
+
+func NotificationEncode(code, subcode int, data []byte) []byte {
+	body := make([]byte, 2+len(data))
+	body[0] = byte(code)
+	body[1] = byte(subcode)
+	copy(body[2:], data)
+	return Encode(BGP_MSG_NOTIFICATION, body)
+}
+
+// OpenEncode(): each capability is carried in its own optional parameter
+func OpenEncode(open *Open) []byte {
+	params := []byte{}
+	for _, c := range open.Caps {
+		params = append(params, BGP_PARAM_CAPABILITY, byte(2+len(c.Value)), byte(c.Code), byte(len(c.Value)))
+		params = append(params, c.Value...)
+	}
+
+	body := make([]byte, BGP_OPEN_SIZE+len(params))
+	body[0] = byte(open.Version)
+	netorder.WriteUint16(body, 1, uint16(open.As))
+	netorder.WriteUint16(body, 3, uint16(open.HoldTime))
+	addr.WriteIPv4(body, 5, open.Id)
+	body[9] = byte(len(params))
+	copy(body[BGP_OPEN_SIZE:], params)
+	return Encode(BGP_MSG_OPEN, body)
+}
+
+/*
+Read(): read one message from stream.
+Header errors are returned as *Error; stream errors as they come.
+*/
+func Read(r io.Reader) (int, []byte, error) {
+	header := make([]byte, BGP_HEADER_SIZE)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	for i := 0; i < BGP_MARKER_SIZE; i++ {
+		if header[i] != 0xFF {
+			return 0, nil, NewError(BGP_ERR_HEADER, BGP_ERR_SUB_NOT_SYNC, nil, "bad marker")
+		}
+	}
+
+	size := int(netorder.ReadUint16(header, 16))
+	msgType := int(header[18])
+
+	lenField := header[16:18]
+
+	if size < BGP_HEADER_SIZE || size > BGP_MAX_SIZE {
+		return 0, nil, NewError(BGP_ERR_HEADER, BGP_ERR_SUB_BAD_LEN, lenField, "bad length=%d", size)
+	}
+
+	var minSize int
+	switch msgType {
+	case BGP_MSG_OPEN:
+		minSize = BGP_HEADER_SIZE + BGP_OPEN_SIZE
+	case BGP_MSG_UPDATE:
+		minSize = BGP_HEADER_SIZE + BGP_UPDATE_SIZE
+	case BGP_MSG_NOTIFICATION:
+		minSize = BGP_HEADER_SIZE + BGP_NOTIFICATION_SIZE
+	case BGP_MSG_KEEPALIVE:
+		minSize = BGP_HEADER_SIZE
+	default:
+		return 0, nil, NewError(BGP_ERR_HEADER, BGP_ERR_SUB_BAD_TYPE, []byte{byte(msgType)}, "bad type=%d", msgType)
+	}
+
+	body := make([]byte, size-BGP_HEADER_SIZE)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	if size < minSize || (msgType == BGP_MSG_KEEPALIVE && size != BGP_HEADER_SIZE) {
+		return 0, nil, NewError(BGP_ERR_HEADER, BGP_ERR_SUB_BAD_LEN, lenField, "bad length=%d for type=%d", size, msgType)
+	}
+
+	return msgType, body, nil
+}
+
+func OpenDecode(body []byte) (*Open, error) {
+	if len(body) < BGP_OPEN_SIZE {
+		return nil, NewError(BGP_ERR_HEADER, BGP_ERR_SUB_BAD_LEN, nil, "short open: size=%d", len(body))
+	}
+	paramsLen := int(body[9])
+	if BGP_OPEN_SIZE+paramsLen != len(body) {
+		return nil, NewError(BGP_ERR_OPEN, BGP_ERR_OPEN_UNSPECIFIC, nil, "open optional parameters length=%d mismatch body size=%d", paramsLen, len(body))
+	}
+	caps, err := paramsDecode(body[BGP_OPEN_SIZE:])
+	if err != nil {
+		return nil, err
+	}
+	open := &Open{
+		Version:  int(body[0]),
+		As:       int(netorder.ReadUint16(body, 1)),
+		HoldTime: int(netorder.ReadUint16(body, 3)),
+		Id:       addr.ReadIPv4(body, 5),
+		Caps:     caps,
+	}
+	return open, nil
+}
+
+/*
+paramsDecode(): capabilities from OPEN optional parameters.
+
+RFC5492 4: a parameter may hold one or more capabilities.
+Other parameter types are reported as unsupported.
+*/
+func paramsDecode(params []byte) ([]Capability, error) {
+	caps := []Capability{}
+	for len(params) > 0 {
+		if len(params) < 2 || len(params) < 2+int(params[1]) {
+			return nil, NewError(BGP_ERR_OPEN, BGP_ERR_OPEN_UNSPECIFIC, nil, "truncated optional parameter")
+		}
+		paramType := int(params[0])
+		value := params[2 : 2+int(params[1])]
+		params = params[2+int(params[1]):]
+
+		if paramType != BGP_PARAM_CAPABILITY {
+			return nil, NewError(BGP_ERR_OPEN, BGP_ERR_OPEN_UNSUPP_OPT, nil, "unsupported optional parameter type=%d", paramType)
+		}
+
+		for len(value) > 0 {
+			if len(value) < 2 || len(value) < 2+int(value[1]) {
+				return nil, NewError(BGP_ERR_OPEN, BGP_ERR_OPEN_UNSPECIFIC, nil, "truncated capability")
+			}
+			caps = append(caps, Capability{Code: int(value[0]), Value: value[2 : 2+int(value[1])]})
+			value = value[2+int(value[1]):]
+		}
+	}
+	return caps, nil
+}
+
+func NotificationDecode(body []byte) (int, int, []byte, error) {
+	if len(body) < BGP_NOTIFICATION_SIZE {
+		return 0, 0, nil, NewError(BGP_ERR_HEADER, BGP_ERR_SUB_BAD_LEN, nil, "short notification: size=%d", len(body))
+	}
+	return int(body[0]), int(body[1]), body[2:], nil
+}
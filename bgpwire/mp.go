@@ -0,0 +1,230 @@
+package bgpwire
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/udhos/nexthop/addr"
+	"github.com/udhos/nexthop/netorder"
+)
+
+/*
+RFC4760 Multiprotocol Extensions for BGP-4
+RFC2545 Use of BGP-4 Multiprotocol Extensions for IPv6 Inter-Domain Routing
+
+Address families other than IPv4 unicast carry their prefixes in the
+optional non-transitive MP_REACH_NLRI and MP_UNREACH_NLRI attributes.
+An IPv6 next hop is a global address, optionally followed by the
+link-local address of the advertising router on the shared link.
+A family is exchanged only when both peers announce it in the
+multiprotocol capability.
+*/
+
+// address family identifiers
+const (
+	BGP_AFI_IPV4 = 1
+	BGP_AFI_IPV6 = 2
+)
+
+// subsequent address family identifiers
+const (
+	BGP_SAFI_UNICAST = 1
+)
+
+type Family struct {
+	Afi  int
+	Safi int
+}
+
+var (
+	IPv4Unicast = Family{Afi: BGP_AFI_IPV4, Safi: BGP_SAFI_UNICAST}
+	IPv6Unicast = Family{Afi: BGP_AFI_IPV6, Safi: BGP_SAFI_UNICAST}
+)
+
+// Families: supported address families, in display order
+var Families = []Family{IPv4Unicast, IPv6Unicast}
+
+func (f Family) String() string {
+	switch f {
+	case IPv4Unicast:
+		return "ipv4 unicast"
+	case IPv6Unicast:
+		return "ipv6 unicast"
+	}
+	return fmt.Sprintf("afi=%d safi=%d", f.Afi, f.Safi)
+}
+
+// bits(): address size
+func (f Family) Bits() int {
+	if f.Afi == BGP_AFI_IPV6 {
+		return 128
+	}
+	return 32
+}
+
+// FamilyList(): families in display order
+func FamilyList(families map[Family]bool) string {
+	list := []string{}
+	for _, f := range Families {
+		if families[f] {
+			list = append(list, f.String())
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+func FamilySupported(f Family) bool {
+	for _, g := range Families {
+		if f == g {
+			return true
+		}
+	}
+	return false
+}
+
+// PrefixFamily(): unicast family for prefix
+func PrefixFamily(prefix net.IPNet) Family {
+	if prefix.IP.To4() != nil {
+		return IPv4Unicast
+	}
+	return IPv6Unicast
+}
+
+// MpCapability(): capability announcing family
+func MpCapability(f Family) Capability {
+	value := make([]byte, 4)
+	netorder.WriteUint16(value, 0, uint16(f.Afi))
+	value[3] = byte(f.Safi) // value[2] is reserved
+	return Capability{Code: BGP_CAP_MULTIPROTOCOL, Value: value}
+}
+
+/*
+OpenFamilies(): families announced in OPEN multiprotocol capabilities.
+
+RFC4760 8: a speaker without the capability supports IPv4 unicast only.
+Malformed capabilities are ignored.
+*/
+func OpenFamilies(open *Open) map[Family]bool {
+	families := map[Family]bool{}
+	found := false
+	for _, c := range open.Caps {
+		if c.Code != BGP_CAP_MULTIPROTOCOL {
+			continue
+		}
+		found = true
+		if len(c.Value) != 4 {
+			continue
+		}
+		families[Family{Afi: int(netorder.ReadUint16(c.Value, 0)), Safi: int(c.Value[3])}] = true
+	}
+	if !found {
+		families[IPv4Unicast] = true
+	}
+	return families
+}
+
+// MpReach: MP_REACH_NLRI attribute
+type MpReach struct {
+	Family    Family
+	Nexthop   net.IP
+	LinkLocal net.IP // RFC2545 3: IPv6 link-local next hop, if any
+	Nlri      []net.IPNet
+}
+
+// MpUnreach: MP_UNREACH_NLRI attribute
+type MpUnreach struct {
+	Family    Family
+	Withdrawn []net.IPNet
+}
+
+func mpReachEncode(m *MpReach) []byte {
+	buf := []byte{byte(m.Family.Afi >> 8), byte(m.Family.Afi), byte(m.Family.Safi)}
+	switch {
+	case m.Family.Afi == BGP_AFI_IPV4:
+		buf = append(buf, net.IPv4len)
+		buf = append(buf, m.Nexthop.To4()...)
+	case m.LinkLocal != nil:
+		buf = append(buf, 2*net.IPv6len)
+		buf = append(buf, m.Nexthop.To16()...)
+		buf = append(buf, m.LinkLocal.To16()...)
+	default:
+		buf = append(buf, net.IPv6len)
+		buf = append(buf, m.Nexthop.To16()...)
+	}
+	buf = append(buf, 0) // reserved
+	return append(buf, prefixesEncode(m.Nlri)...)
+}
+
+func mpUnreachEncode(m *MpUnreach) []byte {
+	buf := []byte{byte(m.Family.Afi >> 8), byte(m.Family.Afi), byte(m.Family.Safi)}
+	return append(buf, prefixesEncode(m.Withdrawn)...)
+}
+
+// mpFamilyDecode(): AFI and SAFI leading both multiprotocol attributes
+func mpFamilyDecode(value, attr []byte, minLen int) (Family, error) {
+	if len(value) < minLen {
+		return Family{}, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_OPTIONAL_ATTR, attr, "short multiprotocol attribute: length=%d", len(value))
+	}
+	f := Family{Afi: int(netorder.ReadUint16(value, 0)), Safi: int(value[2])}
+	if !FamilySupported(f) {
+		return f, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_OPTIONAL_ATTR, attr, "unsupported address family: %v", f)
+	}
+	return f, nil
+}
+
+/*
+mpReachDecode(): RFC4760 3 MP_REACH_NLRI.
+
+A second IPv6 next hop other than link-local is ignored, since some
+speakers fill it with zeros.
+*/
+func mpReachDecode(value, attr []byte) (MpReach, error) {
+	m := MpReach{}
+
+	var err error
+	if m.Family, err = mpFamilyDecode(value, attr, 5); err != nil {
+		return m, err
+	}
+
+	nexthopLen := int(value[3])
+	if 4+nexthopLen+1 > len(value) {
+		return m, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_OPTIONAL_ATTR, attr, "next hop length=%d exceeds attribute", nexthopLen)
+	}
+	nexthop := value[4 : 4+nexthopLen]
+
+	switch {
+	case m.Family.Afi == BGP_AFI_IPV4 && nexthopLen == net.IPv4len:
+		m.Nexthop = addr.ReadIPv4(nexthop, 0)
+	case m.Family.Afi == BGP_AFI_IPV6 && (nexthopLen == net.IPv6len || nexthopLen == 2*net.IPv6len):
+		m.Nexthop = append(net.IP{}, nexthop[:net.IPv6len]...)
+		if linkLocal := net.IP(nexthop[net.IPv6len:]); len(linkLocal) > 0 && linkLocal.IsLinkLocalUnicast() {
+			m.LinkLocal = append(net.IP{}, linkLocal...)
+		}
+	default:
+		return m, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_OPTIONAL_ATTR, attr, "bad next hop length=%d for %v", nexthopLen, m.Family)
+	}
+
+	if m.Nexthop.IsUnspecified() || m.Nexthop.IsMulticast() {
+		return m, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_NEXTHOP, attr, "bad next hop=%v", m.Nexthop)
+	}
+
+	// reserved octet is ignored
+	m.Nlri, err = prefixesDecode(value[4+nexthopLen+1:], m.Family.Bits())
+
+	return m, err
+}
+
+// mpUnreachDecode(): RFC4760 4 MP_UNREACH_NLRI
+func mpUnreachDecode(value, attr []byte) (MpUnreach, error) {
+	m := MpUnreach{}
+
+	var err error
+	if m.Family, err = mpFamilyDecode(value, attr, 3); err != nil {
+		return m, err
+	}
+
+	m.Withdrawn, err = prefixesDecode(value[3:], m.Family.Bits())
+
+	return m, err
+}
@@ -0,0 +1,624 @@
+package bgpwire
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/udhos/nexthop/addr"
+	"github.com/udhos/nexthop/netorder"
+)
+
+/*
+RFC4271 4.3 UPDATE Message Format
+
+      +-----------------------------------------------------+
+      |   Withdrawn Routes Length (2 octets)                |
+      +-----------------------------------------------------+
+      |   Withdrawn Routes (variable)                       |
+      +-----------------------------------------------------+
+      |   Total Path Attribute Length (2 octets)            |
+      +-----------------------------------------------------+
+      |   Path Attributes (variable)                        |
+      +-----------------------------------------------------+
+      |   Network Layer Reachability Information (variable) |
+      +-----------------------------------------------------+
+*/
+
+// path attribute flags
+const (
+	BGP_ATTR_FLAG_OPTIONAL   = 0x80
+	BGP_ATTR_FLAG_TRANSITIVE = 0x40
+	BGP_ATTR_FLAG_PARTIAL    = 0x20
+	BGP_ATTR_FLAG_EXTENDED   = 0x10 // two-octet attribute length
+)
+
+// path attribute type codes
+const (
+	BGP_ATTR_ORIGIN           = 1
+	BGP_ATTR_AS_PATH          = 2
+	BGP_ATTR_NEXT_HOP         = 3
+	BGP_ATTR_MED              = 4
+	BGP_ATTR_LOCAL_PREF       = 5
+	BGP_ATTR_ATOMIC_AGGREGATE = 6
+	BGP_ATTR_AGGREGATOR       = 7
+	BGP_ATTR_MP_REACH_NLRI    = 14 // RFC4760
+	BGP_ATTR_MP_UNREACH_NLRI  = 15 // RFC4760
+	BGP_ATTR_AS4_PATH         = 17 // RFC6793
+	BGP_ATTR_AS4_AGGREGATOR   = 18 // RFC6793
+)
+
+// ORIGIN values
+const (
+	BGP_ORIGIN_IGP        = 0
+	BGP_ORIGIN_EGP        = 1
+	BGP_ORIGIN_INCOMPLETE = 2
+)
+
+// AS_PATH segment types
+const (
+	BGP_AS_SET      = 1
+	BGP_AS_SEQUENCE = 2
+)
+
+// Update: UPDATE message body
+type Update struct {
+	Withdrawn []net.IPNet
+	Attrs     Attrs
+	Nlri      []net.IPNet
+}
+
+// Attrs: path attributes
+type Attrs struct {
+	present      uint64 // bit (1 << type code) for each known attribute found
+	Origin       int
+	AsPath       []AsSegment
+	Nexthop      net.IP
+	Med          uint32
+	LocalPref    uint32
+	AggregatorAs int
+	AggregatorId net.IP
+	Unknown      []RawAttr // unrecognized optional attributes
+
+	// RFC6793: 4-octet AS information exchanged with 2-octet AS speakers
+	As4Path         []AsSegment
+	As4AggregatorAs int
+	As4AggregatorId net.IP
+
+	// RFC4760: routes for families other than IPv4 unicast
+	MpReach   MpReach
+	MpUnreach MpUnreach
+}
+
+type AsSegment struct {
+	Type int
+	Asns []int
+}
+
+// RawAttr: attribute kept as received
+type RawAttr struct {
+	Flags    int // without extended length bit
+	TypeCode int
+	Value    []byte
+}
+
+func (a *Attrs) Has(typeCode int) bool {
+	return a.present&(1<<uint(typeCode)) != 0
+}
+
+func (a *Attrs) Set(typeCode int) {
+	a.present |= 1 << uint(typeCode)
+}
+
+func (a *Attrs) Clear(typeCode int) {
+	a.present &^= 1 << uint(typeCode)
+}
+
+// attrFlags(): expected optional and transitive bits for known attributes
+func attrFlags(typeCode int) (int, bool) {
+	switch typeCode {
+	case BGP_ATTR_ORIGIN, BGP_ATTR_AS_PATH, BGP_ATTR_NEXT_HOP, BGP_ATTR_LOCAL_PREF, BGP_ATTR_ATOMIC_AGGREGATE:
+		return BGP_ATTR_FLAG_TRANSITIVE, true // well-known
+	case BGP_ATTR_MED, BGP_ATTR_MP_REACH_NLRI, BGP_ATTR_MP_UNREACH_NLRI:
+		return BGP_ATTR_FLAG_OPTIONAL, true // optional non-transitive
+	case BGP_ATTR_AGGREGATOR, BGP_ATTR_AS4_PATH, BGP_ATTR_AS4_AGGREGATOR:
+		return BGP_ATTR_FLAG_OPTIONAL | BGP_ATTR_FLAG_TRANSITIVE, true
+	}
+	return 0, false
+}
+
+/*
+UpdateEncode(): encode UPDATE.
+AS numbers take 4 octets when as4 is set, otherwise 2 octets (RFC6793).
+*/
+func UpdateEncode(u *Update, as4 bool) []byte {
+	return updateBuild(prefixesEncode(u.Withdrawn), AttrsEncode(&u.Attrs, as4), prefixesEncode(u.Nlri))
+}
+
+// updateBuild(): UPDATE from encoded sections
+func updateBuild(withdrawn, attrs, nlri []byte) []byte {
+	body := make([]byte, 2, BGP_UPDATE_SIZE+len(withdrawn)+len(attrs)+len(nlri))
+	netorder.WriteUint16(body, 0, uint16(len(withdrawn)))
+	body = append(body, withdrawn...)
+	body = append(body, 0, 0)
+	netorder.WriteUint16(body, 2+len(withdrawn), uint16(len(attrs)))
+	body = append(body, attrs...)
+	body = append(body, nlri...)
+
+	return Encode(BGP_MSG_UPDATE, body)
+}
+
+/*
+UpdatePack(): split prefixes of family sharing attributes into UPDATE
+messages within BGP_MAX_SIZE. Prefixes are withdrawn when attrs is nil.
+
+Families other than IPv4 unicast travel within MP_REACH_NLRI, whose
+family and next hop are taken from attrs, or MP_UNREACH_NLRI.
+*/
+func UpdatePack(f Family, attrs *Attrs, prefixes []net.IPNet, as4 bool) [][]byte {
+	mp := f != IPv4Unicast
+
+	a := Attrs{}
+	if attrs != nil {
+		a = *attrs
+	} else if mp {
+		a.MpUnreach = MpUnreach{Family: f}
+		a.Set(BGP_ATTR_MP_UNREACH_NLRI)
+	}
+
+	base := AttrsEncode(&a, as4) // without prefixes
+	room := BGP_MAX_SIZE - BGP_HEADER_SIZE - BGP_UPDATE_SIZE - len(base)
+	if mp {
+		room-- // attribute length may grow into extended length
+	}
+
+	msgs := [][]byte{}
+	chunk := []net.IPNet{}
+	size := 0
+	flush := func() {
+		switch {
+		case mp && attrs == nil:
+			a.MpUnreach.Withdrawn = chunk
+			msgs = append(msgs, updateBuild(nil, AttrsEncode(&a, as4), nil))
+		case mp:
+			a.MpReach.Nlri = chunk
+			msgs = append(msgs, updateBuild(nil, AttrsEncode(&a, as4), nil))
+		case attrs == nil:
+			msgs = append(msgs, updateBuild(prefixesEncode(chunk), nil, nil))
+		default:
+			msgs = append(msgs, updateBuild(nil, base, prefixesEncode(chunk)))
+		}
+		chunk = []net.IPNet{}
+		size = 0
+	}
+	for _, p := range prefixes {
+		ones, _ := p.Mask.Size()
+		prefixSize := 1 + (ones+7)/8
+		if size+prefixSize > room {
+			flush()
+		}
+		chunk = append(chunk, p)
+		size += prefixSize
+	}
+	if len(chunk) > 0 {
+		flush()
+	}
+	return msgs
+}
+
+func attrEncode(buf []byte, flags, typeCode int, value []byte) []byte {
+	flags &^= BGP_ATTR_FLAG_EXTENDED
+	if len(value) > 255 {
+		flags |= BGP_ATTR_FLAG_EXTENDED
+		buf = append(buf, byte(flags), byte(typeCode), byte(len(value)>>8), byte(len(value)))
+	} else {
+		buf = append(buf, byte(flags), byte(typeCode), byte(len(value)))
+	}
+	return append(buf, value...)
+}
+
+// AttrsEncode(): known attributes in type code order, then unknown ones as received
+func AttrsEncode(a *Attrs, as4 bool) []byte {
+	buf := []byte{}
+
+	put := func(typeCode int, value []byte) {
+		flags, _ := attrFlags(typeCode)
+		buf = attrEncode(buf, flags, typeCode, value)
+	}
+
+	if a.Has(BGP_ATTR_ORIGIN) {
+		put(BGP_ATTR_ORIGIN, []byte{byte(a.Origin)})
+	}
+	if a.Has(BGP_ATTR_AS_PATH) {
+		put(BGP_ATTR_AS_PATH, asPathEncode(a.AsPath, as4))
+	}
+	if a.Has(BGP_ATTR_NEXT_HOP) {
+		value := make([]byte, 4)
+		addr.WriteIPv4(value, 0, a.Nexthop)
+		put(BGP_ATTR_NEXT_HOP, value)
+	}
+	if a.Has(BGP_ATTR_MED) {
+		value := make([]byte, 4)
+		netorder.WriteUint32(value, 0, a.Med)
+		put(BGP_ATTR_MED, value)
+	}
+	if a.Has(BGP_ATTR_LOCAL_PREF) {
+		value := make([]byte, 4)
+		netorder.WriteUint32(value, 0, a.LocalPref)
+		put(BGP_ATTR_LOCAL_PREF, value)
+	}
+	if a.Has(BGP_ATTR_ATOMIC_AGGREGATE) {
+		put(BGP_ATTR_ATOMIC_AGGREGATE, nil)
+	}
+	if a.Has(BGP_ATTR_AGGREGATOR) {
+		put(BGP_ATTR_AGGREGATOR, aggregatorEncode(a.AggregatorAs, a.AggregatorId, as4))
+	}
+	if a.Has(BGP_ATTR_MP_REACH_NLRI) {
+		put(BGP_ATTR_MP_REACH_NLRI, mpReachEncode(&a.MpReach))
+	}
+	if a.Has(BGP_ATTR_MP_UNREACH_NLRI) {
+		put(BGP_ATTR_MP_UNREACH_NLRI, mpUnreachEncode(&a.MpUnreach))
+	}
+	if a.Has(BGP_ATTR_AS4_PATH) {
+		put(BGP_ATTR_AS4_PATH, asPathEncode(a.As4Path, true))
+	}
+	if a.Has(BGP_ATTR_AS4_AGGREGATOR) {
+		put(BGP_ATTR_AS4_AGGREGATOR, aggregatorEncode(a.As4AggregatorAs, a.As4AggregatorId, true))
+	}
+
+	for _, u := range a.Unknown {
+		buf = attrEncode(buf, u.Flags, u.TypeCode, u.Value)
+	}
+
+	return buf
+}
+
+// asPathEncode(): 2-octet encoding replaces AS numbers beyond 65535 with AS_TRANS
+func asPathEncode(segments []AsSegment, as4 bool) []byte {
+	buf := []byte{}
+	for _, seg := range segments {
+		buf = append(buf, byte(seg.Type), byte(len(seg.Asns)))
+		for _, as := range seg.Asns {
+			if as4 {
+				buf = append(buf, byte(as>>24), byte(as>>16), byte(as>>8), byte(as))
+				continue
+			}
+			as = As2(as)
+			buf = append(buf, byte(as>>8), byte(as))
+		}
+	}
+	return buf
+}
+
+func aggregatorEncode(as int, id net.IP, as4 bool) []byte {
+	if as4 {
+		value := make([]byte, 8)
+		netorder.WriteUint32(value, 0, uint32(as))
+		addr.WriteIPv4(value, 4, id)
+		return value
+	}
+	value := make([]byte, 6)
+	netorder.WriteUint16(value, 0, uint16(As2(as)))
+	addr.WriteIPv4(value, 2, id)
+	return value
+}
+
+// As2(): AS number as seen by 2-octet AS speaker
+func As2(as int) int {
+	if as > 0xFFFF {
+		return BGP_AS_TRANS
+	}
+	return as
+}
+
+// prefixesEncode(): length in bits followed by significant octets
+func prefixesEncode(prefixes []net.IPNet) []byte {
+	buf := []byte{}
+	for _, p := range prefixes {
+		ones, bits := p.Mask.Size()
+		ip := p.IP.To4()
+		if bits == 128 {
+			ip = p.IP.To16()
+		}
+		buf = append(buf, byte(ones))
+		buf = append(buf, ip[:(ones+7)/8]...)
+	}
+	return buf
+}
+
+/*
+UpdateDecode(): parse UPDATE body.
+Errors are *Error carrying NOTIFICATION code and subcode
+per RFC4271 6.3 UPDATE Message Error Handling.
+*/
+func UpdateDecode(body []byte, as4 bool) (*Update, error) {
+	size := len(body)
+	if size < BGP_UPDATE_SIZE {
+		return nil, NewError(BGP_ERR_HEADER, BGP_ERR_SUB_BAD_LEN, nil, "short update: size=%d", size)
+	}
+
+	withdrawnLen := int(netorder.ReadUint16(body, 0))
+	if 2+withdrawnLen+2 > size {
+		return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_LIST, nil, "withdrawn routes length=%d exceeds update size=%d", withdrawnLen, size)
+	}
+	attrsOffset := 2 + withdrawnLen + 2
+	attrsLen := int(netorder.ReadUint16(body, attrsOffset-2))
+	if attrsOffset+attrsLen > size {
+		return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_LIST, nil, "path attributes length=%d exceeds update size=%d", attrsLen, size)
+	}
+
+	u := &Update{}
+
+	var err error
+	if u.Withdrawn, err = prefixesDecode(body[2:2+withdrawnLen], 32); err != nil {
+		return nil, err
+	}
+	if err := AttrsDecode(&u.Attrs, body[attrsOffset:attrsOffset+attrsLen], as4); err != nil {
+		return nil, err
+	}
+	if u.Nlri, err = prefixesDecode(body[attrsOffset+attrsLen:], 32); err != nil {
+		return nil, err
+	}
+
+	if len(u.Nlri) > 0 || u.Attrs.Has(BGP_ATTR_MP_REACH_NLRI) {
+		// RFC4271 5: mandatory attributes for reachable routes
+		// RFC4760 3: NEXT_HOP is not required for routes carried only in MP_REACH_NLRI
+		mandatory := []int{BGP_ATTR_ORIGIN, BGP_ATTR_AS_PATH}
+		if len(u.Nlri) > 0 {
+			mandatory = append(mandatory, BGP_ATTR_NEXT_HOP)
+		}
+		for _, typeCode := range mandatory {
+			if !u.Attrs.Has(typeCode) {
+				return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_MISSING, []byte{byte(typeCode)}, "missing well-known attribute type=%d", typeCode)
+			}
+		}
+	}
+
+	return u, nil
+}
+
+// prefixesDecode(): prefixes for address size bits: 32 (IPv4) or 128 (IPv6)
+func prefixesDecode(buf []byte, bits int) ([]net.IPNet, error) {
+	prefixes := []net.IPNet{}
+	for len(buf) > 0 {
+		ones := int(buf[0])
+		if ones > bits {
+			return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_NETWORK, nil, "bad prefix length=%d", ones)
+		}
+		octets := (ones + 7) / 8
+		if 1+octets > len(buf) {
+			return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_NETWORK, nil, "truncated prefix: length=%d", ones)
+		}
+		ip := make(net.IP, bits/8)
+		copy(ip, buf[1:1+octets])
+		mask := net.CIDRMask(ones, bits)
+		prefixes = append(prefixes, net.IPNet{IP: ip.Mask(mask), Mask: mask}) // trailing bits are irrelevant
+		buf = buf[1+octets:]
+	}
+	return prefixes, nil
+}
+
+func AttrsDecode(a *Attrs, buf []byte, as4 bool) error {
+	seen := map[int]bool{}
+
+	for len(buf) > 0 {
+		if len(buf) < 3 {
+			return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_LIST, nil, "truncated attribute header")
+		}
+		flags := int(buf[0])
+		typeCode := int(buf[1])
+		headerLen := 3
+		valueLen := int(buf[2])
+		if flags&BGP_ATTR_FLAG_EXTENDED != 0 {
+			if len(buf) < 4 {
+				return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_LIST, nil, "truncated attribute header")
+			}
+			headerLen = 4
+			valueLen = int(netorder.ReadUint16(buf, 2))
+		}
+		if headerLen+valueLen > len(buf) {
+			return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_LEN, buf, "attribute type=%d length=%d exceeds attributes", typeCode, valueLen)
+		}
+		attr := buf[:headerLen+valueLen] // reported as NOTIFICATION data
+		value := buf[headerLen : headerLen+valueLen]
+		buf = buf[headerLen+valueLen:]
+
+		if seen[typeCode] {
+			return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_LIST, nil, "duplicate attribute type=%d", typeCode)
+		}
+		seen[typeCode] = true
+
+		if err := attrDecode(a, flags, typeCode, value, attr, as4); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func attrDecode(a *Attrs, flags, typeCode int, value, attr []byte, as4 bool) error {
+	expected, known := attrFlags(typeCode)
+	if !known {
+		if flags&BGP_ATTR_FLAG_OPTIONAL == 0 {
+			return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_UNRECOGNIZED, attr, "unrecognized well-known attribute type=%d", typeCode)
+		}
+		a.Unknown = append(a.Unknown, RawAttr{Flags: flags &^ BGP_ATTR_FLAG_EXTENDED, TypeCode: typeCode, Value: value})
+		return nil
+	}
+
+	// RFC4271 4.3: Partial bit is set only for optional transitive attributes
+	mask := BGP_ATTR_FLAG_OPTIONAL | BGP_ATTR_FLAG_TRANSITIVE
+	if flags&mask != expected || (expected != mask && flags&BGP_ATTR_FLAG_PARTIAL != 0) {
+		return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_FLAGS, attr, "bad flags=0x%02x for attribute type=%d", flags, typeCode)
+	}
+
+	checkLen := func(want int) error {
+		if len(value) != want {
+			return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ATTR_LEN, attr, "bad length=%d for attribute type=%d", len(value), typeCode)
+		}
+		return nil
+	}
+
+	switch typeCode {
+	case BGP_ATTR_ORIGIN:
+		if err := checkLen(1); err != nil {
+			return err
+		}
+		a.Origin = int(value[0])
+		if a.Origin > BGP_ORIGIN_INCOMPLETE {
+			return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_ORIGIN, attr, "bad origin=%d", a.Origin)
+		}
+	case BGP_ATTR_AS_PATH:
+		path, err := asPathDecode(value, as4)
+		if err != nil {
+			return err
+		}
+		a.AsPath = path
+	case BGP_ATTR_NEXT_HOP:
+		if err := checkLen(4); err != nil {
+			return err
+		}
+		a.Nexthop = addr.ReadIPv4(value, 0)
+		if a.Nexthop.Equal(net.IPv4zero) || a.Nexthop.Equal(net.IPv4bcast) || a.Nexthop.IsMulticast() {
+			return NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_NEXTHOP, attr, "bad next hop=%v", a.Nexthop)
+		}
+	case BGP_ATTR_MED:
+		if err := checkLen(4); err != nil {
+			return err
+		}
+		a.Med = netorder.ReadUint32(value, 0)
+	case BGP_ATTR_LOCAL_PREF:
+		if err := checkLen(4); err != nil {
+			return err
+		}
+		a.LocalPref = netorder.ReadUint32(value, 0)
+	case BGP_ATTR_ATOMIC_AGGREGATE:
+		if err := checkLen(0); err != nil {
+			return err
+		}
+	case BGP_ATTR_AGGREGATOR:
+		if as4 {
+			if err := checkLen(8); err != nil {
+				return err
+			}
+			a.AggregatorAs = int(netorder.ReadUint32(value, 0))
+			a.AggregatorId = addr.ReadIPv4(value, 4)
+			break
+		}
+		if err := checkLen(6); err != nil {
+			return err
+		}
+		a.AggregatorAs = int(netorder.ReadUint16(value, 0))
+		a.AggregatorId = addr.ReadIPv4(value, 2)
+	case BGP_ATTR_AS4_PATH:
+		// RFC6793 6: malformed AS4 attributes are discarded without session reset
+		path, err := asPathDecode(value, true)
+		if err != nil {
+			return nil
+		}
+		a.As4Path = path
+	case BGP_ATTR_AS4_AGGREGATOR:
+		if len(value) != 8 {
+			return nil // discarded
+		}
+		a.As4AggregatorAs = int(netorder.ReadUint32(value, 0))
+		a.As4AggregatorId = addr.ReadIPv4(value, 4)
+	case BGP_ATTR_MP_REACH_NLRI:
+		m, err := mpReachDecode(value, attr)
+		if err != nil {
+			return err
+		}
+		a.MpReach = m
+	case BGP_ATTR_MP_UNREACH_NLRI:
+		m, err := mpUnreachDecode(value, attr)
+		if err != nil {
+			return err
+		}
+		a.MpUnreach = m
+	}
+
+	a.Set(typeCode)
+
+	return nil
+}
+
+func asPathDecode(buf []byte, as4 bool) ([]AsSegment, error) {
+	asSize := 2
+	if as4 {
+		asSize = 4
+	}
+	segments := []AsSegment{}
+	for len(buf) > 0 {
+		if len(buf) < 2 {
+			return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_AS_PATH, nil, "truncated segment header")
+		}
+		segType := int(buf[0])
+		count := int(buf[1])
+		if segType != BGP_AS_SET && segType != BGP_AS_SEQUENCE {
+			return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_AS_PATH, nil, "bad segment type=%d", segType)
+		}
+		if count == 0 || 2+asSize*count > len(buf) {
+			return nil, NewError(BGP_ERR_UPDATE, BGP_ERR_UPDATE_AS_PATH, nil, "bad segment length=%d", count)
+		}
+		asns := make([]int, count)
+		for i := range asns {
+			if as4 {
+				asns[i] = int(netorder.ReadUint32(buf, 2+4*i))
+				continue
+			}
+			asns[i] = int(netorder.ReadUint16(buf, 2+2*i))
+		}
+		segments = append(segments, AsSegment{Type: segType, Asns: asns})
+		buf = buf[2+asSize*count:]
+	}
+	return segments, nil
+}
+
+// AsPathLen(): RFC4271 9.1.2.2 (a): an AS_SET counts as 1
+func AsPathLen(segments []AsSegment) int {
+	size := 0
+	for _, seg := range segments {
+		if seg.Type == BGP_AS_SET {
+			size++
+			continue
+		}
+		size += len(seg.Asns)
+	}
+	return size
+}
+
+func AsPathContains(segments []AsSegment, asn int) bool {
+	for _, seg := range segments {
+		for _, as := range seg.Asns {
+			if as == asn {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AsPathPrepend(): RFC4271 5.1.2: new path, input is left untouched
+func AsPathPrepend(segments []AsSegment, asn int) []AsSegment {
+	if len(segments) > 0 && segments[0].Type == BGP_AS_SEQUENCE && len(segments[0].Asns) < 255 {
+		first := AsSegment{Type: BGP_AS_SEQUENCE, Asns: append([]int{asn}, segments[0].Asns...)}
+		return append([]AsSegment{first}, segments[1:]...)
+	}
+	return append([]AsSegment{{Type: BGP_AS_SEQUENCE, Asns: []int{asn}}}, segments...)
+}
+
+func AsPathString(segments []AsSegment) string {
+	list := []string{}
+	for _, seg := range segments {
+		asns := make([]string, len(seg.Asns))
+		for i, as := range seg.Asns {
+			asns[i] = strconv.Itoa(as)
+		}
+		if seg.Type == BGP_AS_SET {
+			list = append(list, "{"+strings.Join(asns, ",")+"}")
+			continue
+		}
+		list = append(list, asns...)
+	}
+	return strings.Join(list, " ")
+}
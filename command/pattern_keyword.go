@@ -77,6 +77,7 @@ func LoadKeywordTable(ifScannerFunc interfaceListFunc, commitScannerFunc options
 	keywordAdd("{COMMITID}", matchCommitId, commitScannerFunc)
 	keywordAdd("{NETWORK}", matchNetwork, nil)
 	keywordAdd("{RIPMETRIC}", matchRipMetric, nil)
+	keywordAdd("{ASN}", matchAsn, nil)
 }
 
 func MatchKeyword(word, label string) error {
@@ -217,3 +218,9 @@ func matchRipMetric(costStr string) error {
 
 	return nil // accept
 }
+
+// matchAsn: 4-octet AS number in asplain (65536) or asdot (1.0) notation
+func matchAsn(asnStr string) error {
+	_, err := addr.ParseAsn(asnStr)
+	return err
+}
@@ -4,12 +4,13 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sync"
 
 	"github.com/udhos/nexthop/addr"
 )
 
 func NewDataplaneBogus() *bogusDataplane {
-	d := &bogusDataplane{interfaceTable: map[string]*bogusIface{}}
+	d := &bogusDataplane{interfaceTable: map[string]*bogusIface{}, routeTable: map[string][]Route{}}
 	d.interfaceAdd("eth0", "")
 	d.interfaceAdd("eth1", "")
 	d.interfaceAdd("eth2", "")
@@ -27,6 +28,8 @@ type bogusIface struct {
 
 type bogusDataplane struct {
 	interfaceTable map[string]*bogusIface
+	routeMutex     sync.Mutex         // routing protocols install routes from their own goroutines
+	routeTable     map[string][]Route // vrf => routes
 }
 
 func (d *bogusDataplane) InterfaceVrf(ifname, vrfname string) error {
@@ -157,3 +160,60 @@ func (d *bogusDataplane) InterfaceVrfGet(ifname string) (string, error) {
 
 	return i.vrf, nil
 }
+
+func (d *bogusDataplane) routeFind(vrfname string, route Route) int {
+	for i, r := range d.routeTable[vrfname] {
+		if r.Protocol == route.Protocol && addr.NetEqual(&r.Prefix, &route.Prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *bogusDataplane) RouteReplace(vrfname string, route Route) error {
+	defer d.routeMutex.Unlock()
+	d.routeMutex.Lock()
+
+	log.Printf("bogusDataplane.RouteReplace: vrf=[%s] route: %v", vrfname, route)
+
+	if i := d.routeFind(vrfname, route); i >= 0 {
+		d.routeTable[vrfname][i] = route // replace
+		return nil
+	}
+	d.routeTable[vrfname] = append(d.routeTable[vrfname], route)
+	return nil
+}
+
+func (d *bogusDataplane) RouteDel(vrfname string, route Route) error {
+	defer d.routeMutex.Unlock()
+	d.routeMutex.Lock()
+
+	log.Printf("bogusDataplane.RouteDel: vrf=[%s] route: %v", vrfname, route)
+
+	i := d.routeFind(vrfname, route)
+	if i < 0 {
+		return fmt.Errorf("bogusDataplane.RouteDel: vrf=[%s] route not found: %v", vrfname, &route.Prefix)
+	}
+	routes := d.routeTable[vrfname]
+	last := len(routes) - 1
+	routes[i] = routes[last]
+	d.routeTable[vrfname] = routes[:last] // pop
+	return nil
+}
+
+func (d *bogusDataplane) RouteList(family, protocol int) ([]string, []Route, error) {
+	defer d.routeMutex.Unlock()
+	d.routeMutex.Lock()
+
+	var vrfnames []string
+	var routes []Route
+	for vrfname, table := range d.routeTable {
+		for _, r := range table {
+			if r.Protocol == protocol && RouteFamily(&r.Prefix) == family {
+				vrfnames = append(vrfnames, vrfname)
+				routes = append(routes, r)
+			}
+		}
+	}
+	return vrfnames, routes, nil
+}
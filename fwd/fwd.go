@@ -14,6 +14,51 @@ type Dataplane interface {
 	VrfAddresses(vrfname string) ([]net.IPNet, error)
 	Interfaces() ([]string, []string, error)
 	InterfaceVrfGet(ifname string) (string, error)
+
+	// RouteReplace installs route, replacing any previous route for the
+	// same prefix from the same protocol.
+	RouteReplace(vrfname string, route Route) error
+	// RouteDel removes route for prefix from protocol.
+	RouteDel(vrfname string, route Route) error
+	// RouteList lists routes from protocol: vrf names and routes are returned as parallel slices.
+	RouteList(family, protocol int) ([]string, []Route, error)
+}
+
+const (
+	FAMILY_INET  = 2  // AF_INET   IPv4
+	FAMILY_INET6 = 10 // AF_INET6  IPv6
+)
+
+// Routing protocol identifiers (rtnetlink RTPROT_*)
+const (
+	PROTO_BOOT   = 3 // routes added by "ip route" without explicit protocol
+	PROTO_STATIC = 4 // static routes
+	PROTO_BGP    = 186
+	PROTO_RIP    = 189
+)
+
+type Nexthop struct {
+	Gw     net.IP // unspecified address means directly connected
+	IfName string // required for IPv6 link-local gateway
+}
+
+type Route struct {
+	Prefix   net.IPNet
+	Nexthops []Nexthop // more than one nexthop means ECMP
+	Metric   int       // protocol metric (informational)
+	Protocol int
+}
+
+func (r Route) String() string {
+	return fmt.Sprintf("%v nexthops=%v metric=%d proto=%d", &r.Prefix, r.Nexthops, r.Metric, r.Protocol)
+}
+
+// RouteFamily: FAMILY_INET or FAMILY_INET6 according to prefix
+func RouteFamily(prefix *net.IPNet) int {
+	if prefix.IP.To4() != nil {
+		return FAMILY_INET
+	}
+	return FAMILY_INET6
 }
 
 func NewDataplane(dataplaneName string) Dataplane {
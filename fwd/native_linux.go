@@ -133,3 +133,96 @@ func (d *linuxDataplane) InterfaceVrfGet(ifname string) (string, error) {
 	log.Printf("linuxDataplane.InterfaceVrfGet(%s): FIXME WRITEME", ifname)
 	return "", nil
 }
+
+// linuxRoute: convert route into netlink route
+func linuxRoute(vrfname string, route Route) (*netlink.Route, error) {
+	if vrfname != "" {
+		return nil, fmt.Errorf("linuxRoute: FIXME WRITEME vrf=[%s] routing table", vrfname)
+	}
+
+	prefix := route.Prefix // clone struct: netlink keeps pointer
+	r := &netlink.Route{Dst: &prefix, Protocol: route.Protocol}
+
+	// route.Metric is not mapped into kernel priority: priority is part of the
+	// kernel route key, then a metric change would add a new route instead of
+	// replacing the existing one.
+
+	for _, n := range route.Nexthops {
+		nh := &netlink.NexthopInfo{}
+		if !n.Gw.IsUnspecified() {
+			nh.Gw = n.Gw
+		}
+		if n.IfName != "" {
+			link, err := netlink.LinkByName(n.IfName)
+			if err != nil {
+				return nil, fmt.Errorf("linuxRoute: netlink LinkByName(%s) error: %v", n.IfName, err)
+			}
+			nh.LinkIndex = link.Attrs().Index
+		}
+		r.MultiPath = append(r.MultiPath, nh)
+	}
+
+	if len(r.MultiPath) == 1 {
+		// single path
+		r.Gw = r.MultiPath[0].Gw
+		r.LinkIndex = r.MultiPath[0].LinkIndex
+		r.MultiPath = nil
+	}
+
+	return r, nil
+}
+
+func (d *linuxDataplane) RouteReplace(vrfname string, route Route) error {
+	r, err1 := linuxRoute(vrfname, route)
+	if err1 != nil {
+		return err1
+	}
+	if err := netlink.RouteReplace(r); err != nil {
+		return fmt.Errorf("linuxDataplane.RouteReplace: netlink RouteReplace(%v) error: %v", route, err)
+	}
+	return nil
+}
+
+func (d *linuxDataplane) RouteDel(vrfname string, route Route) error {
+	if vrfname != "" {
+		return fmt.Errorf("linuxDataplane.RouteDel: FIXME WRITEME vrf=[%s] routing table", vrfname)
+	}
+	prefix := route.Prefix // clone struct: netlink keeps pointer
+	r := &netlink.Route{Dst: &prefix, Protocol: route.Protocol}
+	if err := netlink.RouteDel(r); err != nil {
+		return fmt.Errorf("linuxDataplane.RouteDel: netlink RouteDel(%v) error: %v", &route.Prefix, err)
+	}
+	return nil
+}
+
+func (d *linuxDataplane) RouteList(family, protocol int) ([]string, []Route, error) {
+	nlFamily := netlink.FAMILY_V4
+	if family == FAMILY_INET6 {
+		nlFamily = netlink.FAMILY_V6
+	}
+
+	list, err := netlink.RouteList(nil, nlFamily)
+	if err != nil {
+		return nil, nil, fmt.Errorf("linuxDataplane.RouteList: netlink RouteList error: %v", err)
+	}
+
+	var vrfnames []string
+	var routes []Route
+
+	for _, r := range list {
+		if r.Protocol != protocol || r.Dst == nil {
+			continue
+		}
+		route := Route{Prefix: *r.Dst, Protocol: r.Protocol}
+		if len(r.MultiPath) == 0 {
+			route.Nexthops = []Nexthop{{Gw: r.Gw, IfName: index2name(r.LinkIndex)}}
+		}
+		for _, nh := range r.MultiPath {
+			route.Nexthops = append(route.Nexthops, Nexthop{Gw: nh.Gw, IfName: index2name(nh.LinkIndex)})
+		}
+		vrfnames = append(vrfnames, "") // FIXME WRITEME vrf routing tables
+		routes = append(routes, route)
+	}
+
+	return vrfnames, routes, nil
+}
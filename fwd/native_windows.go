@@ -26,3 +26,15 @@ func (d *windowsDataplane) InterfaceAddressGet(ifname string) ([]string, error)
 func (d *windowsDataplane) Interfaces() ([]string, []string, error) {
 	return nil, nil, nil
 }
+
+func (d *windowsDataplane) RouteReplace(vrfname string, route Route) error {
+	return nil
+}
+
+func (d *windowsDataplane) RouteDel(vrfname string, route Route) error {
+	return nil
+}
+
+func (d *windowsDataplane) RouteList(family, protocol int) ([]string, []Route, error) {
+	return nil, nil, nil
+}
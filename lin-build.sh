@@ -11,8 +11,8 @@ PATH=$GOPATH/bin:$PATH
 NHPATH=github.com/udhos/nexthop
 NEXTHOP=$GOPATH/src/$NHPATH
 
-src="addr bgp cli command fwd netorder rib rib-old rip sock telnet tools           sample"
-unu="addr bgp cli command fwd netorder rib rib-old rip sock telnet tools/rip-query"
+src="addr bgp bgpwire cli command fwd netorder rib rib-old rip sock telnet tools           sample"
+unu="addr bgp bgpwire cli command fwd netorder rib rib-old rip sock telnet tools/rip-query"
 
 msg() {
     echo $*
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/udhos/nexthop/netorder"
+)
+
+const (
+	RIP_AUTH_FAMILY              = 0xFFFF
+	RIP_AUTH_NONE                = 0 // authentication disabled
+	RIP_AUTH_TEXT                = 2 // RFC2453 4.1 simple password
+	RIP_AUTH_CRYPTO              = 3 // RFC4822 cryptographic authentication
+	RIP_AUTH_TRAILER             = 1
+	RIP_AUTH_TRAILER_HEADER_SIZE = 4
+	RIP_AUTH_PASSWORD_SIZE       = 16
+	RIP_AUTH_KEY_ID_MAX          = 255
+)
+
+type ripAuthAlgorithm struct {
+	name string
+	hmac bool // false means RFC2082 keyed-MD5
+	size int  // digest length
+	hash func() hash.Hash
+}
+
+var ripAuthAlgorithms = []*ripAuthAlgorithm{
+	{name: "md5", hmac: false, size: md5.Size, hash: md5.New},
+	{name: "hmac-sha-1", hmac: true, size: sha1.Size, hash: sha1.New},
+	{name: "hmac-sha-256", hmac: true, size: sha256.Size, hash: sha256.New},
+	{name: "hmac-sha-384", hmac: true, size: sha512.Size384, hash: sha512.New384},
+	{name: "hmac-sha-512", hmac: true, size: sha512.Size, hash: sha512.New},
+}
+
+func ripAuthAlgorithmFind(name string) *ripAuthAlgorithm {
+	for _, a := range ripAuthAlgorithms {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+type ripKey struct {
+	id          int
+	secret      string
+	algorithm   *ripAuthAlgorithm // nil means md5
+	sendStart   time.Time         // zero: always
+	sendEnd     time.Time         // zero: infinite
+	acceptStart time.Time         // zero: always
+	acceptEnd   time.Time         // zero: infinite
+}
+
+func (k *ripKey) alg() *ripAuthAlgorithm {
+	if k.algorithm == nil {
+		return ripAuthAlgorithms[0] // md5
+	}
+	return k.algorithm
+}
+
+func lifetimeValid(start, end, now time.Time) bool {
+	if !start.IsZero() && now.Before(start) {
+		return false
+	}
+	if !end.IsZero() && !now.Before(end) {
+		return false
+	}
+	return true
+}
+
+func (k *ripKey) sendValid(now time.Time) bool {
+	return k.secret != "" && lifetimeValid(k.sendStart, k.sendEnd, now)
+}
+
+func (k *ripKey) acceptValid(now time.Time) bool {
+	return k.secret != "" && lifetimeValid(k.acceptStart, k.acceptEnd, now)
+}
+
+type ripKeyChain struct {
+	name string
+	keys []*ripKey
+}
+
+type sortByKeyId []*ripKey
+
+func (s sortByKeyId) Len() int {
+	return len(s)
+}
+func (s sortByKeyId) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortByKeyId) Less(i, j int) bool {
+	return s[i].id < s[j].id
+}
+
+// ripKeyChains: key chain table shared between main goroutine (config) and RipRouter goroutine (send/receive)
+type ripKeyChains struct {
+	mutex  sync.RWMutex
+	chains map[string]*ripKeyChain
+}
+
+func newRipKeyChains() *ripKeyChains {
+	return &ripKeyChains{chains: map[string]*ripKeyChain{}}
+}
+
+// keySet(): caller must hold mutex
+func (t *ripKeyChains) keySet(chainName string, id int) *ripKey {
+	chain := t.chains[chainName]
+	if chain == nil {
+		chain = &ripKeyChain{name: chainName}
+		t.chains[chainName] = chain
+	}
+	for _, k := range chain.keys {
+		if k.id == id {
+			return k
+		}
+	}
+	k := &ripKey{id: id}
+	chain.keys = append(chain.keys, k)
+	sort.Sort(sortByKeyId(chain.keys))
+	return k
+}
+
+// keyUpdate(): apply change to key, creating it if needed
+func (t *ripKeyChains) keyUpdate(chainName string, id int, change func(k *ripKey)) {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+
+	change(t.keySet(chainName, id))
+}
+
+/*
+sendKey(): find key for signing outgoing packets.
+Among keys valid for sending, pick the most recently activated one.
+*/
+func (t *ripKeyChains) sendKey(chainName string, now time.Time) *ripKey {
+	defer t.mutex.RUnlock()
+	t.mutex.RLock()
+
+	chain := t.chains[chainName]
+	if chain == nil {
+		return nil
+	}
+
+	var best *ripKey
+	for _, k := range chain.keys {
+		if !k.sendValid(now) {
+			continue
+		}
+		if best == nil || k.sendStart.After(best.sendStart) {
+			best = k
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	key := *best // copy
+	return &key
+}
+
+// acceptKey(): find key for verifying incoming packets
+func (t *ripKeyChains) acceptKey(chainName string, id int, now time.Time) *ripKey {
+	defer t.mutex.RUnlock()
+	t.mutex.RLock()
+
+	chain := t.chains[chainName]
+	if chain == nil {
+		return nil
+	}
+
+	for _, k := range chain.keys {
+		if k.id == id && k.acceptValid(now) {
+			key := *k // copy
+			return &key
+		}
+	}
+
+	return nil
+}
+
+// acceptPasswords(): list secrets valid for accepting simple password authentication
+func (t *ripKeyChains) acceptPasswords(chainName string, now time.Time) []string {
+	defer t.mutex.RUnlock()
+	t.mutex.RLock()
+
+	chain := t.chains[chainName]
+	if chain == nil {
+		return nil
+	}
+
+	var list []string
+	for _, k := range chain.keys {
+		if k.acceptValid(now) {
+			list = append(list, k.secret)
+		}
+	}
+
+	return list
+}
+
+// ripAuth: authentication settings for one interface
+type ripAuth struct {
+	mode     int // RIP_AUTH_NONE, RIP_AUTH_TEXT, RIP_AUTH_CRYPTO
+	keyChain string
+}
+
+func (a ripAuth) enabled() bool {
+	return a.mode != RIP_AUTH_NONE
+}
+
+func ripAuthPassword(secret string) []byte {
+	password := make([]byte, RIP_AUTH_PASSWORD_SIZE) // zero padded
+	copy(password, secret)
+	return password
+}
+
+/*
+RFC4822 3.2.1 Authentication Data
+
+Keyed-MD5 (RFC2082): the key, padded to 16 octets, fills the
+Authentication Data field, and the MD5 digest is computed over
+the whole packet, including the trailer.
+
+HMAC-SHA: the key is zero padded (or hashed, if longer) to the
+digest length, the Authentication Data field is filled with Apad
+(0x878FE1F3 repeated), and the HMAC is computed over the whole
+packet, including the trailer.
+
+data holds the packet up to (and including) the trailer header.
+*/
+func ripAuthDigest(key *ripKey, data []byte) []byte {
+	alg := key.alg()
+
+	if !alg.hmac {
+		h := alg.hash()
+		h.Write(data)
+		h.Write(ripAuthPassword(key.secret))
+		return h.Sum(nil)
+	}
+
+	k := []byte(key.secret)
+	if len(k) > alg.size {
+		h := alg.hash()
+		h.Write(k)
+		k = h.Sum(nil)
+	} else {
+		padded := make([]byte, alg.size)
+		copy(padded, k)
+		k = padded
+	}
+
+	apad := make([]byte, alg.size)
+	for i := 0; i < len(apad); i += 4 {
+		netorder.WriteUint32(apad, i, 0x878FE1F3)
+	}
+
+	mac := hmac.New(alg.hash, k)
+	mac.Write(data)
+	mac.Write(apad)
+	return mac.Sum(nil)
+}
+
+/*
+ripAuthSign(): fill in authentication entry (entry 0) of buf and append trailer if needed.
+buf holds RIP header plus entries, where entry 0 is reserved for authentication.
+*/
+func ripAuthSign(buf []byte, auth ripAuth, key *ripKey, seq uint32) []byte {
+	offset := ripEntryOffset(0)
+
+	netorder.WriteUint16(buf, offset, RIP_AUTH_FAMILY)
+	netorder.WriteUint16(buf, offset+2, uint16(auth.mode))
+
+	if auth.mode == RIP_AUTH_TEXT {
+		copy(buf[offset+4:offset+RIP_ENTRY_SIZE], ripAuthPassword(key.secret))
+		return buf
+	}
+
+	alg := key.alg()
+	pktLen := len(buf)
+
+	netorder.WriteUint16(buf, offset+4, uint16(pktLen))
+	buf[offset+6] = byte(key.id)
+	buf[offset+7] = byte(RIP_AUTH_TRAILER_HEADER_SIZE + alg.size)
+	netorder.WriteUint32(buf, offset+8, seq)
+	for i := offset + 12; i < offset+RIP_ENTRY_SIZE; i++ {
+		buf[i] = 0 // reserved
+	}
+
+	trailer := make([]byte, RIP_AUTH_TRAILER_HEADER_SIZE)
+	netorder.WriteUint16(trailer, 0, RIP_AUTH_FAMILY)
+	netorder.WriteUint16(trailer, 2, RIP_AUTH_TRAILER)
+
+	pkt := append(buf, trailer...)
+
+	return append(pkt, ripAuthDigest(key, pkt)...)
+}
+
+/*
+ripAuthCheck(): verify authentication of incoming packet.
+Returns the packet stripped of authentication entry and trailer,
+and the cryptographic sequence number (if any).
+*/
+func ripAuthCheck(buf []byte, version int, auth ripAuth, chains *ripKeyChains, now time.Time) ([]byte, uint32, error) {
+
+	offset := ripEntryOffset(0)
+	size := len(buf)
+
+	hasAuth := size >= ripEntryOffset(1) && version >= RIP_V2 && netorder.ReadUint16(buf, offset) == RIP_AUTH_FAMILY
+
+	if !auth.enabled() {
+		/*
+			RFC2453 5.2 Authentication
+			If the router is not configured to authenticate RIP-2 messages,
+			then RIP-1 and unauthenticated RIP-2 messages will be accepted;
+			authenticated RIP-2 messages shall be discarded.
+		*/
+		if hasAuth {
+			return nil, 0, fmt.Errorf("authenticated packet on interface without authentication")
+		}
+		return buf, 0, nil
+	}
+
+	if version < RIP_V2 {
+		return nil, 0, fmt.Errorf("RIPv1 packet on interface with authentication")
+	}
+
+	if !hasAuth {
+		return nil, 0, fmt.Errorf("missing authentication")
+	}
+
+	authType := int(netorder.ReadUint16(buf, offset+2))
+	if authType != auth.mode {
+		return nil, 0, fmt.Errorf("authentication type mismatch: want=%d got=%d", auth.mode, authType)
+	}
+
+	if auth.mode == RIP_AUTH_TEXT {
+		if size%RIP_ENTRY_SIZE != RIP_HEADER_SIZE {
+			return nil, 0, fmt.Errorf("bad packet size=%d", size)
+		}
+		password := buf[offset+4 : offset+RIP_ENTRY_SIZE]
+		for _, secret := range chains.acceptPasswords(auth.keyChain, now) {
+			if hmac.Equal(password, ripAuthPassword(secret)) {
+				return ripAuthStrip(buf, size), 0, nil
+			}
+		}
+		return nil, 0, fmt.Errorf("bad password")
+	}
+
+	pktLen := int(netorder.ReadUint16(buf, offset+4))
+	keyId := int(buf[offset+6])
+	authLen := int(buf[offset+7])
+	seq := netorder.ReadUint32(buf, offset+8)
+
+	if pktLen < ripEntryOffset(1) || pktLen%RIP_ENTRY_SIZE != RIP_HEADER_SIZE || pktLen+RIP_AUTH_TRAILER_HEADER_SIZE > size {
+		return nil, 0, fmt.Errorf("bad packet length=%d size=%d", pktLen, size)
+	}
+
+	key := chains.acceptKey(auth.keyChain, keyId, now)
+	if key == nil {
+		return nil, 0, fmt.Errorf("no valid key: chain=[%s] key=%d", auth.keyChain, keyId)
+	}
+
+	alg := key.alg()
+
+	// some implementations include the trailer header in the auth data length
+	if authLen != alg.size && authLen != alg.size+RIP_AUTH_TRAILER_HEADER_SIZE {
+		return nil, 0, fmt.Errorf("bad auth data length=%d for %s", authLen, alg.name)
+	}
+
+	dataLen := pktLen + RIP_AUTH_TRAILER_HEADER_SIZE
+	if size != dataLen+alg.size {
+		return nil, 0, fmt.Errorf("bad trailer size: packet=%d length=%d digest=%d", size, pktLen, alg.size)
+	}
+
+	if netorder.ReadUint16(buf, pktLen) != RIP_AUTH_FAMILY || netorder.ReadUint16(buf, pktLen+2) != RIP_AUTH_TRAILER {
+		return nil, 0, fmt.Errorf("bad trailer header")
+	}
+
+	digest := ripAuthDigest(key, buf[:dataLen])
+	if !hmac.Equal(digest, buf[dataLen:]) {
+		return nil, 0, fmt.Errorf("bad digest: chain=[%s] key=%d algorithm=%s", auth.keyChain, keyId, alg.name)
+	}
+
+	return ripAuthStrip(buf, pktLen), seq, nil
+}
+
+// ripAuthStrip(): remove authentication entry, keeping RIP header and route entries
+func ripAuthStrip(buf []byte, pktLen int) []byte {
+	stripped := make([]byte, pktLen-RIP_ENTRY_SIZE)
+	copy(stripped, buf[:RIP_HEADER_SIZE])
+	copy(stripped[RIP_HEADER_SIZE:], buf[ripEntryOffset(1):pktLen])
+	return stripped
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+)
+
+// ripClock: time source for RipRouter, replaced by a simulated clock in tests
+type ripClock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) ripTimer
+}
+
+// ripTimer: the subset of time.Timer used by RipRouter
+type ripTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// ripSystemClock: wall clock
+type ripSystemClock struct{}
+
+func (c ripSystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c ripSystemClock) NewTimer(d time.Duration) ripTimer {
+	return ripSystemTimer{time.NewTimer(d)}
+}
+
+type ripSystemTimer struct {
+	*time.Timer
+}
+
+func (t ripSystemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// now(): current time according to router clock
+func (r *RipRouter) now() time.Time {
+	if r.clock == nil {
+		return time.Now() // router built without clock (unit tests)
+	}
+	return r.clock.Now()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"net"
+
+	"github.com/udhos/nexthop/addr"
+	"github.com/udhos/nexthop/fwd"
+)
+
+// fibRoute(): build FIB entry for prefix from learnt routes marked as installed.
+// Only external routes are pushed into the FIB: local networks are already
+// known by the dataplane. Only nexthops with the best metric are kept.
+// Runs within RipRouter goroutine.
+func (v *ripVrf) fibRoute(prefix *net.IPNet) (fwd.Route, bool) {
+	fibRoute := fwd.Route{Prefix: *prefix, Protocol: fwd.PROTO_RIP, Metric: RIP_METRIC_INFINITY}
+	for _, route := range v.routes {
+		if !route.installed || !route.srcExternal || route.metric >= RIP_METRIC_INFINITY {
+			continue
+		}
+		if !addr.NetEqual(prefix, &route.addr) {
+			continue
+		}
+		if route.metric > fibRoute.Metric {
+			continue // worse route is about to be disabled
+		}
+		if route.metric < fibRoute.Metric {
+			// better route replaces previous nexthops
+			fibRoute.Metric = route.metric
+			fibRoute.Nexthops = nil
+		}
+		fibRoute.Nexthops = append(fibRoute.Nexthops, fwd.Nexthop{Gw: route.nexthop, IfName: route.srcIfName})
+	}
+	return fibRoute, len(fibRoute.Nexthops) > 0
+}
+
+// fibSync(): push current state of prefix into FIB.
+// A single FIB entry per prefix carries all nexthops, so any change in
+// metric or nexthops is a plain replace.
+// Runs within RipRouter goroutine.
+func (v *ripVrf) fibSync(prefix *net.IPNet) {
+	fibRoute, found := v.fibRoute(prefix)
+	if !found {
+		if err := v.hardware.RouteDel(v.name, fibRoute); err != nil {
+			log.Printf("ripVrf.fibSync: vrf=[%s] %v", v.name, err)
+		}
+		return
+	}
+	if err := v.hardware.RouteReplace(v.name, fibRoute); err != nil {
+		log.Printf("ripVrf.fibSync: vrf=[%s] %v", v.name, err)
+	}
+}
+
+// fibReconcile(): make FIB match routing table.
+// Removes FIB routes left behind by previous instances and refreshes routes we own.
+func (r *RipRouter) fibReconcile() {
+
+	vrfnames, fibRoutes, err := r.hardware.RouteList(r.family, fwd.PROTO_RIP)
+	if err != nil {
+		log.Printf("RipRouter.fibReconcile: %v", err)
+		return
+	}
+
+	stale := 0
+
+	for i, fibRoute := range fibRoutes {
+		_, v := r.vrfGet(vrfnames[i])
+		if v != nil {
+			if _, found := v.fibRoute(&fibRoute.Prefix); found {
+				v.fibSync(&fibRoute.Prefix) // refresh
+				continue
+			}
+		}
+		if err := r.hardware.RouteDel(vrfnames[i], fibRoute); err != nil {
+			log.Printf("RipRouter.fibReconcile: vrf=[%s] %v", vrfnames[i], err)
+			continue
+		}
+		stale++
+	}
+
+	log.Printf("RipRouter.fibReconcile: %s: removed %d stale FIB routes", r.protoName(), stale)
+}
+
+// fibFlush(): withdraw all routes from FIB on shutdown
+func (r *RipRouter) fibFlush() {
+
+	for _, v := range r.vrfs {
+		for _, route := range v.routes {
+			route.installed = false
+		}
+	}
+
+	r.fibReconcile()
+}
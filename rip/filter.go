@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+const (
+	RIP_FILTER_IN  = "in"  // distribute-list/offset-list applied on receive
+	RIP_FILTER_OUT = "out" // distribute-list/offset-list applied on send
+)
+
+// ripPrefixListEntry: "seq N permit|deny prefix [ge X] [le Y]"
+type ripPrefixListEntry struct {
+	seq    int
+	permit bool
+	prefix net.IPNet
+	ge     int // zero: unset
+	le     int // zero: unset
+}
+
+func (e *ripPrefixListEntry) String() string {
+	action := "deny"
+	if e.permit {
+		action = "permit"
+	}
+	s := fmt.Sprintf("seq %d %s %v", e.seq, action, &e.prefix)
+	if e.ge > 0 {
+		s += fmt.Sprintf(" ge %d", e.ge)
+	}
+	if e.le > 0 {
+		s += fmt.Sprintf(" le %d", e.le)
+	}
+	return s
+}
+
+/*
+match(): without ge/le, the prefix must match exactly.
+With ge/le, the prefix must fall within the entry prefix and
+its length must be in the range [ge..le], where missing ge
+defaults to the entry prefix length and missing le defaults
+to the address length.
+*/
+func (e *ripPrefixListEntry) match(prefix *net.IPNet) bool {
+	entryLen, bits := e.prefix.Mask.Size()
+	plen, pbits := prefix.Mask.Size()
+
+	if bits != pbits {
+		return false // address family mismatch
+	}
+
+	if e.ge == 0 && e.le == 0 {
+		return plen == entryLen && e.prefix.IP.Equal(prefix.IP.Mask(e.prefix.Mask))
+	}
+
+	if plen < entryLen || !e.prefix.IP.Equal(prefix.IP.Mask(e.prefix.Mask)) {
+		return false // not within entry prefix
+	}
+
+	min := entryLen
+	if e.ge > 0 {
+		min = e.ge
+	}
+	max := bits
+	if e.le > 0 {
+		max = e.le
+	}
+
+	return min <= plen && plen <= max
+}
+
+type ripPrefixList struct {
+	name    string
+	entries []*ripPrefixListEntry
+}
+
+type sortBySeq []*ripPrefixListEntry
+
+func (s sortBySeq) Len() int {
+	return len(s)
+}
+func (s sortBySeq) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortBySeq) Less(i, j int) bool {
+	return s[i].seq < s[j].seq
+}
+
+// ripPrefixLists: prefix-list table shared between main goroutine (config) and RipRouter goroutine (send/receive)
+type ripPrefixLists struct {
+	mutex sync.RWMutex
+	lists map[string]*ripPrefixList
+}
+
+func newRipPrefixLists() *ripPrefixLists {
+	return &ripPrefixLists{lists: map[string]*ripPrefixList{}}
+}
+
+// entrySet(): add entry, replacing previous entry with same sequence number
+func (t *ripPrefixLists) entrySet(listName string, entry *ripPrefixListEntry) {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+
+	list := t.lists[listName]
+	if list == nil {
+		list = &ripPrefixList{name: listName}
+		t.lists[listName] = list
+	}
+	for i, e := range list.entries {
+		if e.seq == entry.seq {
+			list.entries[i] = entry // replace
+			return
+		}
+	}
+	list.entries = append(list.entries, entry)
+	sort.Sort(sortBySeq(list.entries))
+}
+
+func (t *ripPrefixLists) entryDel(listName string, seq int) error {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+
+	list := t.lists[listName]
+	if list == nil {
+		return fmt.Errorf("entryDel: prefix-list not found: [%s]", listName)
+	}
+	for i, e := range list.entries {
+		if e.seq == seq {
+			list.entries = append(list.entries[:i], list.entries[i+1:]...) // keep order
+			if len(list.entries) == 0 {
+				delete(t.lists, listName)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("entryDel: prefix-list [%s] seq %d not found", listName, seq)
+}
+
+/*
+permit(): first matching entry decides.
+A prefix not matching any entry is denied (implicit deny).
+An undefined prefix-list permits everything.
+*/
+func (t *ripPrefixLists) permit(listName string, prefix *net.IPNet) bool {
+	defer t.mutex.RUnlock()
+	t.mutex.RLock()
+
+	list := t.lists[listName]
+	if list == nil {
+		return true
+	}
+	for _, e := range list.entries {
+		if e.match(prefix) {
+			return e.permit
+		}
+	}
+	return false
+}
+
+// ripFilterKey: filter direction plus interface (empty ifname means all interfaces)
+type ripFilterKey struct {
+	dir    string
+	ifname string
+}
+
+func (r *RipRouter) DistributeListAdd(dir, ifname, listName string) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	key := ripFilterKey{dir, ifname}
+	for _, name := range r.distLists[key] {
+		if name == listName {
+			return // already present
+		}
+	}
+	r.distLists[key] = append(r.distLists[key], listName)
+}
+
+func (r *RipRouter) DistributeListDel(dir, ifname, listName string) error {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	key := ripFilterKey{dir, ifname}
+	lists := r.distLists[key]
+	for i, name := range lists {
+		if name == listName {
+			lists[i] = lists[len(lists)-1]
+			r.distLists[key] = lists[:len(lists)-1] // pop
+			return nil
+		}
+	}
+	return fmt.Errorf("DistributeListDel: distribute-list not found: %s %s interface=[%s]", listName, dir, ifname)
+}
+
+/*
+filterPermit(): check prefix against distribute-lists for direction.
+Both global and interface distribute-lists must permit the prefix.
+*/
+func (r *RipRouter) filterPermit(dir, ifname string, prefix *net.IPNet) bool {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	for _, key := range []ripFilterKey{{dir, ""}, {dir, ifname}} {
+		for _, listName := range r.distLists[key] {
+			if !r.prefixLists.permit(listName, prefix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ripOffsetList: add offset to metric of routes permitted by prefix-list
+type ripOffsetList struct {
+	prefixList string
+	offset     int
+}
+
+// OffsetListSet(): set offset for prefix-list, replacing previous offset
+func (r *RipRouter) OffsetListSet(dir, ifname, listName string, offset int) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	key := ripFilterKey{dir, ifname}
+	lists := r.offsetLists[key]
+	for i, o := range lists {
+		if o.prefixList == listName {
+			lists[i].offset = offset
+			return
+		}
+	}
+	r.offsetLists[key] = append(lists, ripOffsetList{prefixList: listName, offset: offset})
+}
+
+func (r *RipRouter) OffsetListDel(dir, ifname, listName string) error {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	key := ripFilterKey{dir, ifname}
+	lists := r.offsetLists[key]
+	for i, o := range lists {
+		if o.prefixList == listName {
+			r.offsetLists[key] = append(lists[:i], lists[i+1:]...) // keep order
+			return nil
+		}
+	}
+	return fmt.Errorf("OffsetListDel: offset-list not found: %s %s interface=[%s]", listName, dir, ifname)
+}
+
+/*
+metricOffset(): find offset to add to metric of prefix.
+Interface offset-lists take precedence over global ones.
+Within the same scope, the first offset-list matching the prefix wins.
+*/
+func (r *RipRouter) metricOffset(dir, ifname string, prefix *net.IPNet) int {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	for _, key := range []ripFilterKey{{dir, ifname}, {dir, ""}} {
+		for _, o := range r.offsetLists[key] {
+			if r.prefixLists.permit(o.prefixList, prefix) {
+				return o.offset
+			}
+		}
+	}
+	return 0
+}
+
+func (r *RipRouter) RouteMapPolicyAdd(dir, ifname, mapName string) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	key := ripFilterKey{dir, ifname}
+	for _, name := range r.policies[key] {
+		if name == mapName {
+			return // already present
+		}
+	}
+	r.policies[key] = append(r.policies[key], mapName)
+}
+
+func (r *RipRouter) RouteMapPolicyDel(dir, ifname, mapName string) error {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	key := ripFilterKey{dir, ifname}
+	lists := r.policies[key]
+	for i, name := range lists {
+		if name == mapName {
+			r.policies[key] = append(lists[:i], lists[i+1:]...) // keep order
+			return nil
+		}
+	}
+	return fmt.Errorf("RouteMapPolicyDel: route-map not found: %s %s interface=[%s]", mapName, dir, ifname)
+}
+
+/*
+policyApply(): run route through route-maps for direction.
+Global route-maps are applied first, then interface route-maps.
+Every route-map must permit the route; set clauses accumulate.
+*/
+func (r *RipRouter) policyApply(dir, ifname string, prefix *net.IPNet, attr ripRouteAttr) (bool, ripRouteAttr) {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	for _, key := range []ripFilterKey{{dir, ""}, {dir, ifname}} {
+		for _, mapName := range r.policies[key] {
+			var permit bool
+			permit, attr = r.routeMaps.apply(mapName, prefix, attr, r.prefixLists)
+			if !permit {
+				return false, attr
+			}
+		}
+	}
+	return true, attr
+}
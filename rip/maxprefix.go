@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+)
+
+// ripMaxPrefix: limit for prefixes learned from neighbors within VRF, or from a single neighbor
+type ripMaxPrefix struct {
+	limit       int
+	warningOnly bool // log excess routes, but accept them
+}
+
+// SetMaximumPrefix(): set limit for VRF, then resume learning from suspended neighbors
+func (r *RipRouter) SetMaximumPrefix(vrfname string, limit int, warningOnly bool) {
+	r.configMutex.Lock()
+	if r.maxPrefix == nil {
+		r.maxPrefix = map[string]ripMaxPrefix{}
+	}
+	r.maxPrefix[vrfname] = ripMaxPrefix{limit: limit, warningOnly: warningOnly}
+	r.configMutex.Unlock()
+
+	r.request(&ripPeersResumeRequest{})
+}
+
+// DelMaximumPrefix(): remove limit for VRF, then resume learning from suspended neighbors
+func (r *RipRouter) DelMaximumPrefix(vrfname string) {
+	r.configMutex.Lock()
+	delete(r.maxPrefix, vrfname)
+	r.configMutex.Unlock()
+
+	r.request(&ripPeersResumeRequest{})
+}
+
+func (r *RipRouter) getMaximumPrefix(vrfname string) (ripMaxPrefix, bool) {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	max, found := r.maxPrefix[vrfname]
+	return max, found
+}
+
+// SetNeighborMaximumPrefix(): set limit for source router, then resume learning from suspended neighbors
+func (r *RipRouter) SetNeighborMaximumPrefix(nbr net.IP, limit int, warningOnly bool) {
+	r.configMutex.Lock()
+	if r.nbrMaxPrefix == nil {
+		r.nbrMaxPrefix = map[string]ripMaxPrefix{}
+	}
+	r.nbrMaxPrefix[nbr.String()] = ripMaxPrefix{limit: limit, warningOnly: warningOnly}
+	r.configMutex.Unlock()
+
+	r.request(&ripPeersResumeRequest{})
+}
+
+// DelNeighborMaximumPrefix(): remove limit for source router, then resume learning from suspended neighbors
+func (r *RipRouter) DelNeighborMaximumPrefix(nbr net.IP) {
+	r.configMutex.Lock()
+	delete(r.nbrMaxPrefix, nbr.String())
+	r.configMutex.Unlock()
+
+	r.request(&ripPeersResumeRequest{})
+}
+
+func (r *RipRouter) getNeighborMaximumPrefix(nbr net.IP) (ripMaxPrefix, bool) {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	max, found := r.nbrMaxPrefix[nbr.String()]
+	return max, found
+}
+
+// peerKey: source router is identified by address and interface (link-local addresses may repeat across links)
+func peerKey(src net.IP, ifname string) string {
+	return src.String() + "%" + ifname
+}
+
+/*
+learnedUpdate(): account for external route entering (delta=1) or leaving (delta=-1) the FIB.
+Counters are kept incrementally so that maximum-prefix does not scan the routing table.
+*/
+func (v *ripVrf) learnedUpdate(route *ripRoute, delta int) {
+	if v.learned == nil {
+		v.learned = map[string]int{}
+		v.peerLearned = map[string]int{}
+	}
+
+	prefix := route.addr.String()
+	if v.learned[prefix] += delta; v.learned[prefix] < 1 {
+		delete(v.learned, prefix)
+	}
+
+	key := peerKey(route.srcRouter, route.srcIfName)
+	if v.peerLearned[key] += delta; v.peerLearned[key] < 1 {
+		delete(v.peerLearned, key)
+	}
+}
+
+// learnedPrefixes(): number of distinct valid prefixes learned from neighbors
+func (v *ripVrf) learnedPrefixes() int {
+	return len(v.learned)
+}
+
+// peerPrefixes(): number of valid routes learned from source router
+func (v *ripVrf) peerPrefixes(src net.IP, ifname string) int {
+	return v.peerLearned[peerKey(src, ifname)]
+}
+
+/*
+prefixLimitAccept(): decide whether a new route from neighbor fits within maximum-prefix.
+The neighbor limit applies to every route from the neighbor, the VRF limit
+only to prefixes not yet present in the VRF (newPrefix).
+Runs within RipRouter goroutine.
+*/
+func (r *RipRouter) prefixLimitAccept(v *ripVrf, netaddr *net.IPNet, nbr net.IP, ifname string, newPrefix bool) bool {
+	if max, found := r.getNeighborMaximumPrefix(nbr); found {
+		scope := fmt.Sprintf("neighbor %v", nbr)
+		if !r.prefixLimitCheck(max, v.peerPrefixes(nbr, ifname), scope, netaddr, nbr, ifname) {
+			return false
+		}
+	}
+
+	if !newPrefix {
+		return true
+	}
+
+	if max, found := r.getMaximumPrefix(v.name); found {
+		scope := fmt.Sprintf("vrf=[%s]", v.name)
+		return r.prefixLimitCheck(max, v.learnedPrefixes(), scope, netaddr, nbr, ifname)
+	}
+
+	return true
+}
+
+/*
+prefixLimitCheck(): beyond the limit, the route is rejected and learning from the neighbor is suspended,
+unless the limit is warning-only.
+*/
+func (r *RipRouter) prefixLimitCheck(max ripMaxPrefix, count int, scope string, netaddr *net.IPNet, nbr net.IP, ifname string) bool {
+	if count < max.limit {
+		return true
+	}
+
+	if max.warningOnly {
+		log.Printf("RipRouter.prefixLimitCheck: %s maximum-prefix %d exceeded by %v from neighbor %v on '%s' (warning-only)",
+			scope, max.limit, netaddr, nbr, ifname)
+		return true
+	}
+
+	log.Printf("RipRouter.prefixLimitCheck: %s maximum-prefix %d exceeded: rejecting %v and suspending neighbor %v on '%s'",
+		scope, max.limit, netaddr, nbr, ifname)
+
+	r.peerSuspend(nbr, ifname)
+
+	return false
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/udhos/nexthop/addr"
+	"github.com/udhos/nexthop/fwd"
+)
+
+// redistribution sources
+const (
+	RIP_REDIST_CONNECTED = "connected"
+	RIP_REDIST_STATIC    = "static"
+	RIP_REDIST_BGP       = "bgp"
+	RIP_REDIST_DEFAULT   = "default" // default-information originate
+
+	RIP_REDIST_DEFAULT_METRIC = 1
+)
+
+// ripRedist: "redistribute SOURCE [metric N] [route-map NAME]"
+type ripRedist struct {
+	metric   int    // zero: RIP_REDIST_DEFAULT_METRIC
+	routeMap string // empty: redistribute everything
+}
+
+func (r *RipRouter) getRedist() map[string]ripRedist {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	redist := map[string]ripRedist{}
+	for source, rd := range r.redist {
+		redist[source] = rd
+	}
+	return redist // clone
+}
+
+// RedistributeSet(): enable redistribution from source, replacing previous metric/route-map
+func (r *RipRouter) RedistributeSet(source string, redist ripRedist) {
+	r.configMutex.Lock()
+	r.redist[source] = redist
+	r.configMutex.Unlock()
+
+	r.request(&ripRedistSyncRequest{})
+}
+
+func (r *RipRouter) RedistributeDel(source string) error {
+	r.configMutex.Lock()
+	_, found := r.redist[source]
+	delete(r.redist, source)
+	r.configMutex.Unlock()
+
+	if !found {
+		return fmt.Errorf("RedistributeDel: redistribution not enabled: %s", source)
+	}
+
+	r.request(&ripRedistSyncRequest{})
+
+	return nil
+}
+
+// redistAppend(): add candidate, keeping only the best metric per prefix
+func redistAppend(nets []*ripNet, n *ripNet) []*ripNet {
+	for _, m := range nets {
+		if addr.NetEqual(&m.addr, &n.addr) {
+			if n.metric < m.metric {
+				m.metric = n.metric
+				m.tag = n.tag
+			}
+			return nets
+		}
+	}
+	return append(nets, n)
+}
+
+func redistFind(nets []*ripNet, prefix *net.IPNet) *ripNet {
+	for _, n := range nets {
+		if addr.NetEqual(&n.addr, prefix) {
+			return n
+		}
+	}
+	return nil
+}
+
+// connectedPrefixes(): interface subnets, as vrf names and prefixes in parallel slices
+func (r *RipRouter) connectedPrefixes() ([]string, []net.IPNet) {
+	ifnames, ifvrfs, err := r.hardware.Interfaces()
+	if err != nil {
+		log.Printf("RipRouter.connectedPrefixes: %v", err)
+		return nil, nil
+	}
+	var vrfnames []string
+	var prefixes []net.IPNet
+	for i, ifname := range ifnames {
+		addrs, err := r.hardware.InterfaceAddressGet(ifname)
+		if err != nil {
+			log.Printf("RipRouter.connectedPrefixes: %v", err)
+			continue
+		}
+		for _, a := range addrs {
+			if (a.IP.To4() != nil) != (r.family == RIP_FAMILY_INET) {
+				continue // address family mismatch
+			}
+			if a.IP.IsLoopback() || a.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			vrfnames = append(vrfnames, ifvrfs[i])
+			prefixes = append(prefixes, net.IPNet{IP: a.IP.Mask(a.Mask), Mask: a.Mask})
+		}
+	}
+	return vrfnames, prefixes
+}
+
+// fibPrefixes(): FIB routes from protocols, as vrf names and prefixes in parallel slices
+func (r *RipRouter) fibPrefixes(protocols ...int) ([]string, []net.IPNet) {
+	var vrfnames []string
+	var prefixes []net.IPNet
+	for _, proto := range protocols {
+		vrfs, routes, err := r.hardware.RouteList(r.family, proto)
+		if err != nil {
+			log.Printf("RipRouter.fibPrefixes: protocol=%d: %v", proto, err)
+			continue
+		}
+		for i, route := range routes {
+			vrfnames = append(vrfnames, vrfs[i])
+			prefixes = append(prefixes, route.Prefix)
+		}
+	}
+	return vrfnames, prefixes
+}
+
+// redistCandidates(): routes to be redistributed, per vrf name
+func (r *RipRouter) redistCandidates() map[string][]*ripNet {
+	want := map[string][]*ripNet{}
+
+	for source, redist := range r.getRedist() {
+		var vrfnames []string
+		var prefixes []net.IPNet
+
+		switch source {
+		case RIP_REDIST_DEFAULT:
+			_, defaultRoute, _ := net.ParseCIDR("0.0.0.0/0")
+			if r.family == RIP_FAMILY_INET6 {
+				_, defaultRoute, _ = net.ParseCIDR("::/0")
+			}
+			vrfnames, prefixes = []string{""}, []net.IPNet{*defaultRoute}
+		case RIP_REDIST_CONNECTED:
+			vrfnames, prefixes = r.connectedPrefixes()
+		case RIP_REDIST_STATIC:
+			vrfnames, prefixes = r.fibPrefixes(fwd.PROTO_BOOT, fwd.PROTO_STATIC)
+		case RIP_REDIST_BGP:
+			vrfnames, prefixes = r.fibPrefixes(fwd.PROTO_BGP)
+		default:
+			log.Printf("RipRouter.redistCandidates: unsupported source: %s", source)
+			continue
+		}
+
+		for i := range prefixes {
+			prefix := prefixes[i]
+			attr := ripRouteAttr{metric: redist.metric}
+			if attr.metric == 0 {
+				attr.metric = RIP_REDIST_DEFAULT_METRIC
+			}
+			if redist.routeMap != "" {
+				var permit bool
+				permit, attr = r.routeMaps.apply(redist.routeMap, &prefix, attr, r.prefixLists)
+				if !permit {
+					continue
+				}
+			}
+			n := &ripNet{addr: prefix, nexthop: unspecifiedAddr(&prefix), metric: attr.metric, tag: attr.tag}
+			want[vrfnames[i]] = redistAppend(want[vrfnames[i]], n)
+		}
+	}
+
+	return want
+}
+
+/*
+redistSync(): feed redistributed routes into VRFs as local routes.
+Routes whose source went away, or whose metric or tag changed, are withdrawn.
+Prefixes configured with "network" take precedence over redistribution.
+Runs within RipRouter goroutine, both on config changes and on the
+periodic scan for source route changes.
+*/
+func (r *RipRouter) redistSync() {
+
+	want := r.redistCandidates()
+
+	// withdraw
+	for i := len(r.vrfs) - 1; i >= 0; i-- {
+		v := r.vrfs[i]
+		if len(v.redistNets) < 1 {
+			continue
+		}
+		keep := []*ripNet{}
+		for _, n := range v.redistNets {
+			if _, local := v.netGet(&n.addr); local != nil {
+				continue // route now owned by "network" -- forget without withdrawing
+			}
+			if w := redistFind(want[v.name], &n.addr); w != nil && w.metric == n.metric && w.tag == n.tag {
+				keep = append(keep, n)
+				continue
+			}
+			v.localRouteDel(n, r)
+		}
+		v.redistNets = keep
+		if v.Empty() {
+			r.vrfDel(i)
+		}
+	}
+
+	// announce
+	for vrfname, nets := range want {
+		for _, n := range nets {
+			_, v := r.vrfGet(vrfname)
+			if v != nil {
+				if _, local := v.netGet(&n.addr); local != nil {
+					continue // "network" takes precedence
+				}
+				if redistFind(v.redistNets, &n.addr) != nil {
+					continue // already announced
+				}
+			} else {
+				v = r.vrfAdd(vrfname)
+			}
+			v.redistNets = append(v.redistNets, n)
+			v.localRouteAdd(n, r)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/udhos/nexthop/command"
+)
+
+/*
+ripRequest: typed operation submitted by main goroutine into RipRouter goroutine,
+which is the single owner of the routing table.
+serve() runs within RipRouter goroutine and stores any result into the request.
+*/
+type ripRequest interface {
+	serve(r *RipRouter)
+}
+
+// ripPending: request in flight, with channel closed after it has been served
+type ripPending struct {
+	req  ripRequest
+	done chan struct{}
+}
+
+/*
+request(): send req into RipRouter goroutine, then wait until it has been served.
+Returns without serving req if the goroutine has finished.
+*/
+func (r *RipRouter) request(req ripRequest) {
+	p := ripPending{req: req, done: make(chan struct{})}
+	select {
+	case r.requests <- p:
+		<-p.done
+	case <-r.finished:
+	}
+}
+
+// ripNetOp: change to locally originated network
+type ripNetOp int
+
+const (
+	ripNetAdd ripNetOp = iota
+	ripNetDel
+	ripNetNexthopAdd
+	ripNetNexthopDel
+	ripNetMetricAdd
+	ripNetMetricDel
+	ripNetTagAdd
+	ripNetTagDel
+)
+
+// ripNetRequest: add or remove network, or one of its attributes
+type ripNetRequest struct {
+	op      ripNetOp
+	vrf     string
+	netAddr string
+	nexthop net.IP
+	metric  int
+	tag     uint16
+	err     error // result
+}
+
+func (req *ripNetRequest) serve(r *RipRouter) {
+	switch req.op {
+	case ripNetAdd:
+		req.err = r.vrfSet(req.vrf).NetAdd(req.netAddr, r)
+		return
+	case ripNetNexthopAdd:
+		req.err = r.vrfSet(req.vrf).NetNexthopAdd(req.netAddr, req.nexthop, r)
+		return
+	case ripNetMetricAdd:
+		req.err = r.vrfSet(req.vrf).NetMetricAdd(req.netAddr, req.nexthop, req.metric, r)
+		return
+	case ripNetTagAdd:
+		req.err = r.vrfSet(req.vrf).NetTagAdd(req.netAddr, req.tag, r)
+		return
+	}
+
+	i, v := r.vrfGet(req.vrf)
+	if v == nil {
+		req.err = fmt.Errorf("RipRouter.%s: vrf not found: vrf=[%s] addr=[%s]", req.op, req.vrf, req.netAddr)
+		return
+	}
+
+	switch req.op {
+	case ripNetDel:
+		req.err = v.NetDel(req.netAddr, r) // remove net from VRF
+	case ripNetNexthopDel:
+		req.err = v.NetNexthopDel(req.netAddr, req.nexthop, r)
+	case ripNetMetricDel:
+		req.err = v.NetMetricDel(req.netAddr, req.nexthop, req.metric, r)
+	case ripNetTagDel:
+		req.err = v.NetTagDel(req.netAddr, req.tag, r)
+		return // removing tag keeps the network
+	}
+
+	if v.Empty() {
+		r.vrfDel(i)
+	}
+}
+
+func (op ripNetOp) String() string {
+	switch op {
+	case ripNetAdd:
+		return "NetAdd"
+	case ripNetDel:
+		return "NetDel"
+	case ripNetNexthopAdd:
+		return "NetNexthopAdd"
+	case ripNetNexthopDel:
+		return "NetNexthopDel"
+	case ripNetMetricAdd:
+		return "NetMetricAdd"
+	case ripNetMetricDel:
+		return "NetMetricDel"
+	case ripNetTagAdd:
+		return "NetTagAdd"
+	case ripNetTagDel:
+		return "NetTagDel"
+	}
+	return fmt.Sprintf("ripNetOp(%d)", int(op))
+}
+
+// ripClearRoutesRequest: flush learned routes
+type ripClearRoutesRequest struct {
+	vrf     string
+	prefix  *net.IPNet
+	flushed int   // result
+	err     error // result
+}
+
+func (req *ripClearRoutesRequest) serve(r *RipRouter) {
+	req.flushed, req.err = r.clearRoutes(req.vrf, req.prefix)
+}
+
+// ripClearNeighborRequest: expire routes learned from neighbor
+type ripClearNeighborRequest struct {
+	nbr     net.IP
+	expired int // result
+}
+
+func (req *ripClearNeighborRequest) serve(r *RipRouter) {
+	req.expired = r.clearNeighbor(req.nbr)
+}
+
+// ripClearStatisticsRequest: reset interface counters
+type ripClearStatisticsRequest struct{}
+
+func (req *ripClearStatisticsRequest) serve(r *RipRouter) {
+	r.stats = map[string]*ripStats{}
+}
+
+// ripMaximumPathsRequest: change ECMP limit
+type ripMaximumPathsRequest struct {
+	paths int
+}
+
+func (req *ripMaximumPathsRequest) serve(r *RipRouter) {
+	r.setMaximumPaths(req.paths)
+}
+
+// ripShowOp: operational state to display
+type ripShowOp int
+
+const (
+	ripShowRoutes ripShowOp = iota
+	ripShowInterfaces
+	ripShowNeighbors
+)
+
+// ripShowRequest: display operational state
+type ripShowRequest struct {
+	op ripShowOp
+	c  command.LineSender
+}
+
+func (req *ripShowRequest) serve(r *RipRouter) {
+	switch req.op {
+	case ripShowRoutes:
+		r.showRoutes(req.c)
+	case ripShowInterfaces:
+		r.showInterfaces(req.c)
+	case ripShowNeighbors:
+		r.showNeighbors(req.c)
+	}
+}
+
+// ripPeersResumeRequest: learn again from suspended neighbors after maximum-prefix change
+type ripPeersResumeRequest struct{}
+
+func (req *ripPeersResumeRequest) serve(r *RipRouter) {
+	r.peersResume()
+}
+
+// ripRedistSyncRequest: pick up redistribution or route-map changes
+type ripRedistSyncRequest struct{}
+
+func (req *ripRedistSyncRequest) serve(r *RipRouter) {
+	r.redistSync()
+}
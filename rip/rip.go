@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"strconv"
 	"strings"
@@ -25,7 +26,11 @@ type Rip struct {
 
 	hardware fwd.Dataplane
 
-	router *RipRouter
+	router      *RipRouter // RIPv2
+	ripng       *RipRouter // RIPng
+	keyChains   *ripKeyChains
+	prefixLists *ripPrefixLists
+	routeMaps   *ripRouteMaps
 }
 
 func (r Rip) CmdRoot() *command.CmdNode {
@@ -56,12 +61,17 @@ func main() {
 
 	log.Printf("%s daemon starting", daemonName)
 
+	rand.Seed(time.Now().UnixNano()) // timer jitter
+
 	rip := &Rip{
 		cmdRoot:           &command.CmdNode{Path: "", MinLevel: command.EXEC, Handler: nil},
 		confRootCandidate: &command.ConfNode{},
 		confRootActive:    &command.ConfNode{},
 		daemonName:        daemonName,
 		hardware:          fwd.NewDataplaneBogus(),
+		keyChains:         newRipKeyChains(),
+		prefixLists:       newRipPrefixLists(),
+		routeMaps:         newRipRouteMaps(),
 	}
 
 	var dataplaneName string
@@ -157,29 +167,297 @@ func installCommands(root *command.CmdNode) {
 	cmdConH := command.CMD_CONF
 
 	command.CmdInstall(root, cmdConH, "hostname (HOSTNAME)", command.CONF, command.HelperHostname, command.ApplyBogus, "Hostname")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} deny {NETWORK}", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list deny")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} deny {NETWORK} ge (PREFIXLEN)", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list deny minimum length")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} deny {NETWORK} ge (PREFIXLEN) le (PREFIXLEN)", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list deny length range")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} deny {NETWORK} le (PREFIXLEN)", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list deny maximum length")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} permit {NETWORK}", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list permit")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} permit {NETWORK} ge (PREFIXLEN)", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list permit minimum length")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} permit {NETWORK} ge (PREFIXLEN) le (PREFIXLEN)", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list permit length range")
+	command.CmdInstall(root, cmdConH, "ip prefix-list {PREFIXLIST} seq {SEQ} permit {NETWORK} le (PREFIXLEN)", command.CONF, cmdPrefixList, applyPrefixList, "Prefix-list permit maximum length")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} deny", command.CONF, cmdRouteMap, applyRouteMap, "Route-map deny")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} deny match ip address prefix-list {PREFIXLIST}", command.CONF, cmdRouteMap, applyRouteMap, "Route-map deny prefixes matching prefix-list")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} deny match tag (TAG)", command.CONF, cmdRouteMap, applyRouteMap, "Route-map deny routes with tag")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} permit", command.CONF, cmdRouteMap, applyRouteMap, "Route-map permit")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} permit match ip address prefix-list {PREFIXLIST}", command.CONF, cmdRouteMap, applyRouteMap, "Route-map permit prefixes matching prefix-list")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} permit match tag (TAG)", command.CONF, cmdRouteMap, applyRouteMap, "Route-map permit routes with tag")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} permit set metric (RIPMETRIC)", command.CONF, cmdRouteMap, applyRouteMap, "Route-map set metric")
+	command.CmdInstall(root, cmdConH, "route-map {ROUTEMAP} seq {SEQ} permit set tag (TAG)", command.CONF, cmdRouteMap, applyRouteMap, "Route-map set tag")
 	command.CmdInstall(root, cmdNone, "show version", command.EXEC, cmdVersion, nil, "Show version")
+	command.CmdInstall(root, cmdNone, "clear rip neighbor {IPADDR}", command.ENAB, cmdClearRipNeighbor, nil, "Expire RIP routes learned from neighbor")
+	command.CmdInstall(root, cmdNone, "clear rip routes", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIP routes")
+	command.CmdInstall(root, cmdNone, "clear rip routes network {NETWORK}", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIP routes for network")
+	command.CmdInstall(root, cmdNone, "clear rip routes vrf {VRFNAME}", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIP routes in VRF")
+	command.CmdInstall(root, cmdNone, "clear rip routes vrf {VRFNAME} network {NETWORK}", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIP routes for network in VRF")
+	command.CmdInstall(root, cmdNone, "clear rip statistics", command.ENAB, cmdClearRipStatistics, nil, "Reset RIP statistics")
+	command.CmdInstall(root, cmdNone, "clear ripng neighbor {IPADDR}", command.ENAB, cmdClearRipNeighbor, nil, "Expire RIPng routes learned from neighbor")
+	command.CmdInstall(root, cmdNone, "clear ripng routes", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIPng routes")
+	command.CmdInstall(root, cmdNone, "clear ripng routes network {NETWORK}", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIPng routes for network")
+	command.CmdInstall(root, cmdNone, "clear ripng routes vrf {VRFNAME}", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIPng routes in VRF")
+	command.CmdInstall(root, cmdNone, "clear ripng routes vrf {VRFNAME} network {NETWORK}", command.ENAB, cmdClearRipRoutes, nil, "Flush learned RIPng routes for network in VRF")
+	command.CmdInstall(root, cmdNone, "clear ripng statistics", command.ENAB, cmdClearRipStatistics, nil, "Reset RIPng statistics")
+	command.CmdInstall(root, cmdNone, "show rip interface", command.EXEC, cmdShowRipInterface, nil, "Show RIP interface statistics")
+	command.CmdInstall(root, cmdNone, "show rip neighbors", command.EXEC, cmdShowRipNeighbors, nil, "Show RIP neighbors")
 	command.CmdInstall(root, cmdNone, "show rip routes", command.EXEC, cmdShowRipRoutes, nil, "Show RIP routes")
+	command.CmdInstall(root, cmdNone, "show ripng interface", command.EXEC, cmdShowRipInterface, nil, "Show RIPng interface statistics")
+	command.CmdInstall(root, cmdNone, "show ripng neighbors", command.EXEC, cmdShowRipNeighbors, nil, "Show RIPng neighbors")
+	command.CmdInstall(root, cmdNone, "show ripng routes", command.EXEC, cmdShowRipRoutes, nil, "Show RIPng routes")
+	command.CmdInstall(root, cmdConH, "key chain {KEYCHAIN} key {KEYID} accept-lifetime end (TIMESTAMP)", command.CONF, cmdKeyLifetime, applyKeyLifetime, "Key accept lifetime end (RFC3339)")
+	command.CmdInstall(root, cmdConH, "key chain {KEYCHAIN} key {KEYID} accept-lifetime start (TIMESTAMP)", command.CONF, cmdKeyLifetime, applyKeyLifetime, "Key accept lifetime start (RFC3339)")
+	for _, alg := range ripAuthAlgorithms {
+		command.CmdInstall(root, cmdConH, "key chain {KEYCHAIN} key {KEYID} cryptographic-algorithm "+alg.name, command.CONF, cmdSingleMode, applyKeyAlgorithm, "Key cryptographic algorithm")
+	}
+	command.CmdInstall(root, cmdConH, "key chain {KEYCHAIN} key {KEYID} key-string (PASSWORD)", command.CONF, cmdKeyString, applyKeyString, "Key secret")
+	command.CmdInstall(root, cmdConH, "key chain {KEYCHAIN} key {KEYID} send-lifetime end (TIMESTAMP)", command.CONF, cmdKeyLifetime, applyKeyLifetime, "Key send lifetime end (RFC3339)")
+	command.CmdInstall(root, cmdConH, "key chain {KEYCHAIN} key {KEYID} send-lifetime start (TIMESTAMP)", command.CONF, cmdKeyLifetime, applyKeyLifetime, "Key send lifetime start (RFC3339)")
 	command.CmdInstall(root, cmdConH, "router rip", command.CONF, cmdRip, applyRip, "Enable RIP protocol")
+	command.CmdInstall(root, cmdConH, "router rip default-information originate", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Advertise default route into RIP")
+	command.CmdInstall(root, cmdConH, "router rip distribute-list {PREFIXLIST} in", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter received RIP routes")
+	command.CmdInstall(root, cmdConH, "router rip distribute-list {PREFIXLIST} in interface {IFNAME}", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter RIP routes received on interface")
+	command.CmdInstall(root, cmdConH, "router rip distribute-list {PREFIXLIST} out", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter sent RIP routes")
+	command.CmdInstall(root, cmdConH, "router rip distribute-list {PREFIXLIST} out interface {IFNAME}", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter RIP routes sent on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} authentication key-chain (KEYCHAIN)", command.CONF, cmdRipIfaceAuthKeyChain, applyRipIfaceAuthKeyChain, "RIP authentication key chain")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} authentication mode cryptographic", command.CONF, cmdSingleMode, applyRipIfaceAuthMode, "RIP cryptographic authentication (RFC4822)")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} authentication mode text", command.CONF, cmdSingleMode, applyRipIfaceAuthMode, "RIP simple password authentication")
 	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} cost (RIPMETRIC)", command.CONF, cmdRipIfaceCost, applyRipIfaceCost, "RIP interface cost")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} offset-list {PREFIXLIST} in (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of RIP routes received on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} offset-list {PREFIXLIST} out (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of RIP routes sent on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} receive version 1", command.CONF, cmdSingleMode, applyRipIfaceRecvVersion, "Accept only RIPv1 on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} receive version 2", command.CONF, cmdSingleMode, applyRipIfaceRecvVersion, "Accept only RIPv2 on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} receive version both", command.CONF, cmdSingleMode, applyRipIfaceRecvVersion, "Accept both RIPv1 and RIPv2 on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} route-map {ROUTEMAP} in", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to RIP routes received on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} route-map {ROUTEMAP} out", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to RIP routes sent on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} send version 1", command.CONF, cmdSingleMode, applyRipIfaceSendVersion, "Send RIPv1 broadcast on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} send version 2", command.CONF, cmdSingleMode, applyRipIfaceSendVersion, "Send RIPv2 multicast on interface")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} send version compatible", command.CONF, cmdSingleMode, applyRipIfaceSendVersion, "Send RIPv2 broadcast on interface (RIPv1 compatible)")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} split-horizon disable", command.CONF, cmdSingleMode, applyRipIfaceSplitHorizon, "Disable RIP split horizon")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} split-horizon poisoned-reverse", command.CONF, cmdSingleMode, applyRipIfaceSplitHorizon, "RIP split horizon with poisoned reverse")
+	command.CmdInstall(root, cmdConH, "router rip interface {IFNAME} summary-address {NETWORK}", command.CONF, cmdRipSummaryAddress, applyRipSummaryAddress, "Advertise summary route on interface")
+	command.CmdInstall(root, cmdConH, "router rip maximum-paths (PATHS)", command.CONF, cmdRipMaximumPaths, applyRipMaximumPaths, "Maximum number of RIP equal-cost paths")
+	command.CmdInstall(root, cmdConH, "router rip maximum-prefix (PREFIXES)", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Maximum number of learned RIP prefixes")
+	command.CmdInstall(root, cmdConH, "router rip maximum-prefix (PREFIXES) warning-only", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Only log when exceeding maximum number of learned RIP prefixes")
+	command.CmdInstall(root, cmdConH, "router rip neighbor {IPADDR}", command.CONF, cmdRipNeighbor, applyRipNeighbor, "Send unicast RIP updates to neighbor")
+	command.CmdInstall(root, cmdConH, "router rip neighbor {IPADDR} maximum-prefix (PREFIXES)", command.CONF, cmdRipMaximumPrefix, applyRipNeighborMaximumPrefix, "Maximum number of RIP prefixes learned from neighbor")
+	command.CmdInstall(root, cmdConH, "router rip neighbor {IPADDR} maximum-prefix (PREFIXES) warning-only", command.CONF, cmdRipMaximumPrefix, applyRipNeighborMaximumPrefix, "Only log when exceeding maximum number of RIP prefixes learned from neighbor")
 	command.CmdInstall(root, cmdConH, "router rip network {NETWORK}", command.CONF, cmdRipNetwork, applyRipNet, "Insert network into RIP protocol")
 	command.CmdInstall(root, cmdConH, "router rip network {NETWORK} cost (RIPMETRIC)", command.CONF, cmdRipNetCost, applyRipNetCost, "RIP network metric")
 	command.CmdInstall(root, cmdConH, "router rip network {NETWORK} nexthop {IPADDR}", command.CONF, cmdRipNetNexthop, applyRipNetNexthop, "RIP network nexthop")
 	command.CmdInstall(root, cmdConH, "router rip network {NETWORK} nexthop {IPADDR} cost (RIPMETRIC)", command.CONF, cmdRipNetNexthopCost, applyRipNetNexthopCost, "RIP network metric")
+	command.CmdInstall(root, cmdConH, "router rip network {NETWORK} tag (TAG)", command.CONF, cmdRipNetTag, applyRipNetTag, "RIP network route tag")
+	command.CmdInstall(root, cmdConH, "router rip offset-list {PREFIXLIST} in (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of received RIP routes")
+	command.CmdInstall(root, cmdConH, "router rip offset-list {PREFIXLIST} out (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of sent RIP routes")
+	command.CmdInstall(root, cmdConH, "router rip passive-interface {IFNAME}", command.CONF, cmdRipPassive, applyRipPassive, "Suppress RIP updates on interface")
+	for _, source := range []string{RIP_REDIST_BGP, RIP_REDIST_CONNECTED, RIP_REDIST_STATIC} {
+		command.CmdInstall(root, cmdConH, "router rip redistribute "+source, command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIP")
+		command.CmdInstall(root, cmdConH, "router rip redistribute "+source+" metric (RIPMETRIC)", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIP with metric")
+		command.CmdInstall(root, cmdConH, "router rip redistribute "+source+" metric (RIPMETRIC) route-map {ROUTEMAP}", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIP with metric, filtered by route-map")
+		command.CmdInstall(root, cmdConH, "router rip redistribute "+source+" route-map {ROUTEMAP}", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIP, filtered by route-map")
+	}
+	command.CmdInstall(root, cmdConH, "router rip route-map {ROUTEMAP} in", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to received RIP routes")
+	command.CmdInstall(root, cmdConH, "router rip route-map {ROUTEMAP} out", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to sent RIP routes")
+	command.CmdInstall(root, cmdConH, "router rip timers basic (UPDATE) (TIMEOUT) (GC)", command.CONF, cmdRipTimers, applyRipTimers, "RIP update, timeout and garbage-collection timers (seconds)")
+	command.CmdInstall(root, cmdConH, "router rip version 1", command.CONF, cmdSingleMode, applyRipVersion, "Send and receive only RIPv1")
+	command.CmdInstall(root, cmdConH, "router rip version 2", command.CONF, cmdSingleMode, applyRipVersion, "Send and receive only RIPv2")
+	command.CmdInstall(root, cmdConH, "router rip vrf {VRFNAME} maximum-prefix (PREFIXES)", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Maximum number of learned RIP prefixes in VRF")
+	command.CmdInstall(root, cmdConH, "router rip vrf {VRFNAME} maximum-prefix (PREFIXES) warning-only", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Only log when exceeding maximum number of learned RIP prefixes in VRF")
 	command.CmdInstall(root, cmdConH, "router rip vrf {VRFNAME} network {NETWORK}", command.CONF, cmdRipNetwork, applyRipVrfNet, "Insert network into RIP protocol")
 	command.CmdInstall(root, cmdConH, "router rip vrf {VRFNAME} network {NETWORK} cost (RIPMETRIC)", command.CONF, cmdRipNetCost, applyRipVrfNetCost, "RIP network metric")
 	command.CmdInstall(root, cmdConH, "router rip vrf {VRFNAME} network {NETWORK} nexthop {IPADDR}", command.CONF, cmdRipNetNexthop, applyRipVrfNetNexthop, "RIP network nexthop")
 	command.CmdInstall(root, cmdConH, "router rip vrf {VRFNAME} network {NETWORK} nexthop {IPADDR} cost (RIPMETRIC)", command.CONF, cmdRipNetNexthopCost, applyRipVrfNetNexthopCost, "RIP network metric")
+	command.CmdInstall(root, cmdConH, "router rip vrf {VRFNAME} network {NETWORK} tag (TAG)", command.CONF, cmdRipNetTag, applyRipVrfNetTag, "RIP network route tag")
+	command.CmdInstall(root, cmdConH, "router ripng", command.CONF, cmdRip, applyRip, "Enable RIPng protocol")
+	command.CmdInstall(root, cmdConH, "router ripng default-information originate", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Advertise default route into RIPng")
+	command.CmdInstall(root, cmdConH, "router ripng distribute-list {PREFIXLIST} in", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter received RIPng routes")
+	command.CmdInstall(root, cmdConH, "router ripng distribute-list {PREFIXLIST} in interface {IFNAME}", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter RIPng routes received on interface")
+	command.CmdInstall(root, cmdConH, "router ripng distribute-list {PREFIXLIST} out", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter sent RIPng routes")
+	command.CmdInstall(root, cmdConH, "router ripng distribute-list {PREFIXLIST} out interface {IFNAME}", command.CONF, cmdRipDistributeList, applyRipDistributeList, "Filter RIPng routes sent on interface")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} cost (RIPMETRIC)", command.CONF, cmdRipIfaceCost, applyRipIfaceCost, "RIPng interface cost")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} offset-list {PREFIXLIST} in (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of RIPng routes received on interface")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} offset-list {PREFIXLIST} out (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of RIPng routes sent on interface")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} route-map {ROUTEMAP} in", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to RIPng routes received on interface")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} route-map {ROUTEMAP} out", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to RIPng routes sent on interface")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} split-horizon disable", command.CONF, cmdSingleMode, applyRipIfaceSplitHorizon, "Disable RIPng split horizon")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} split-horizon poisoned-reverse", command.CONF, cmdSingleMode, applyRipIfaceSplitHorizon, "RIPng split horizon with poisoned reverse")
+	command.CmdInstall(root, cmdConH, "router ripng interface {IFNAME} summary-address {NETWORK}", command.CONF, cmdRipSummaryAddress, applyRipSummaryAddress, "Advertise summary route on interface")
+	command.CmdInstall(root, cmdConH, "router ripng maximum-paths (PATHS)", command.CONF, cmdRipMaximumPaths, applyRipMaximumPaths, "Maximum number of RIPng equal-cost paths")
+	command.CmdInstall(root, cmdConH, "router ripng maximum-prefix (PREFIXES)", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Maximum number of learned RIPng prefixes")
+	command.CmdInstall(root, cmdConH, "router ripng maximum-prefix (PREFIXES) warning-only", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Only log when exceeding maximum number of learned RIPng prefixes")
+	command.CmdInstall(root, cmdConH, "router ripng network {NETWORK}", command.CONF, cmdRipNetwork, applyRipNet, "Insert network into RIPng protocol")
+	command.CmdInstall(root, cmdConH, "router ripng network {NETWORK} cost (RIPMETRIC)", command.CONF, cmdRipNetCost, applyRipNetCost, "RIPng network metric")
+	command.CmdInstall(root, cmdConH, "router ripng network {NETWORK} nexthop {IPADDR}", command.CONF, cmdRipNetNexthop, applyRipNetNexthop, "RIPng network nexthop")
+	command.CmdInstall(root, cmdConH, "router ripng network {NETWORK} nexthop {IPADDR} cost (RIPMETRIC)", command.CONF, cmdRipNetNexthopCost, applyRipNetNexthopCost, "RIPng network metric")
+	command.CmdInstall(root, cmdConH, "router ripng network {NETWORK} tag (TAG)", command.CONF, cmdRipNetTag, applyRipNetTag, "RIPng network route tag")
+	command.CmdInstall(root, cmdConH, "router ripng offset-list {PREFIXLIST} in (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of received RIPng routes")
+	command.CmdInstall(root, cmdConH, "router ripng offset-list {PREFIXLIST} out (RIPMETRIC)", command.CONF, cmdRipOffsetList, applyRipOffsetList, "Add offset to metric of sent RIPng routes")
+	command.CmdInstall(root, cmdConH, "router ripng passive-interface {IFNAME}", command.CONF, cmdRipPassive, applyRipPassive, "Suppress RIPng updates on interface")
+	for _, source := range []string{RIP_REDIST_BGP, RIP_REDIST_CONNECTED, RIP_REDIST_STATIC} {
+		command.CmdInstall(root, cmdConH, "router ripng redistribute "+source, command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIPng")
+		command.CmdInstall(root, cmdConH, "router ripng redistribute "+source+" metric (RIPMETRIC)", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIPng with metric")
+		command.CmdInstall(root, cmdConH, "router ripng redistribute "+source+" metric (RIPMETRIC) route-map {ROUTEMAP}", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIPng with metric, filtered by route-map")
+		command.CmdInstall(root, cmdConH, "router ripng redistribute "+source+" route-map {ROUTEMAP}", command.CONF, cmdRipRedistribute, applyRipRedistribute, "Redistribute "+source+" routes into RIPng, filtered by route-map")
+	}
+	command.CmdInstall(root, cmdConH, "router ripng route-map {ROUTEMAP} in", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to received RIPng routes")
+	command.CmdInstall(root, cmdConH, "router ripng route-map {ROUTEMAP} out", command.CONF, cmdRipRouteMap, applyRipRouteMap, "Apply route-map to sent RIPng routes")
+	command.CmdInstall(root, cmdConH, "router ripng timers basic (UPDATE) (TIMEOUT) (GC)", command.CONF, cmdRipTimers, applyRipTimers, "RIPng update, timeout and garbage-collection timers (seconds)")
+	command.CmdInstall(root, cmdConH, "router ripng vrf {VRFNAME} maximum-prefix (PREFIXES)", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Maximum number of learned RIPng prefixes in VRF")
+	command.CmdInstall(root, cmdConH, "router ripng vrf {VRFNAME} maximum-prefix (PREFIXES) warning-only", command.CONF, cmdRipMaximumPrefix, applyRipMaximumPrefix, "Only log when exceeding maximum number of learned RIPng prefixes in VRF")
+	command.CmdInstall(root, cmdConH, "router ripng vrf {VRFNAME} network {NETWORK}", command.CONF, cmdRipNetwork, applyRipVrfNet, "Insert network into RIPng protocol")
+	command.CmdInstall(root, cmdConH, "router ripng vrf {VRFNAME} network {NETWORK} cost (RIPMETRIC)", command.CONF, cmdRipNetCost, applyRipVrfNetCost, "RIPng network metric")
+	command.CmdInstall(root, cmdConH, "router ripng vrf {VRFNAME} network {NETWORK} nexthop {IPADDR}", command.CONF, cmdRipNetNexthop, applyRipVrfNetNexthop, "RIPng network nexthop")
+	command.CmdInstall(root, cmdConH, "router ripng vrf {VRFNAME} network {NETWORK} nexthop {IPADDR} cost (RIPMETRIC)", command.CONF, cmdRipNetNexthopCost, applyRipVrfNetNexthopCost, "RIPng network metric")
+	command.CmdInstall(root, cmdConH, "router ripng vrf {VRFNAME} network {NETWORK} tag (TAG)", command.CONF, cmdRipNetTag, applyRipVrfNetTag, "RIPng network route tag")
 
 	// Node description is used for pretty display in command help.
 	// It is not strictly required, but its lack is reported by the command command.MissingDescription().
 	command.DescInstall(root, "hostname", "Assign hostname")
+	command.DescInstall(root, "ip", "IP configuration")
+	command.DescInstall(root, "ip prefix-list", "Prefix-list")
+	command.DescInstall(root, "ip prefix-list {PREFIXLIST}", "Prefix-list name")
+	command.DescInstall(root, "ip prefix-list {PREFIXLIST} seq", "Prefix-list entry")
+	command.DescInstall(root, "ip prefix-list {PREFIXLIST} seq {SEQ}", "Sequence number")
+	for _, act := range []string{"deny", "permit"} {
+		command.DescInstall(root, "ip prefix-list {PREFIXLIST} seq {SEQ} "+act, "Prefix-list "+act)
+		command.DescInstall(root, "ip prefix-list {PREFIXLIST} seq {SEQ} "+act+" {NETWORK} ge", "Minimum prefix length")
+		command.DescInstall(root, "ip prefix-list {PREFIXLIST} seq {SEQ} "+act+" {NETWORK} ge (PREFIXLEN) le", "Maximum prefix length")
+		command.DescInstall(root, "ip prefix-list {PREFIXLIST} seq {SEQ} "+act+" {NETWORK} le", "Maximum prefix length")
+	}
+	command.DescInstall(root, "key", "Authentication keys")
+	command.DescInstall(root, "key chain", "Key chain")
+	command.DescInstall(root, "key chain {KEYCHAIN}", "Key chain name")
+	command.DescInstall(root, "key chain {KEYCHAIN} key", "Key")
+	command.DescInstall(root, "key chain {KEYCHAIN} key {KEYID}", "Key identifier (0-255)")
+	command.DescInstall(root, "key chain {KEYCHAIN} key {KEYID} accept-lifetime", "Key accept lifetime")
+	command.DescInstall(root, "key chain {KEYCHAIN} key {KEYID} cryptographic-algorithm", "Key cryptographic algorithm")
+	command.DescInstall(root, "key chain {KEYCHAIN} key {KEYID} send-lifetime", "Key send lifetime")
+	command.DescInstall(root, "route-map", "Route-map")
+	command.DescInstall(root, "route-map {ROUTEMAP}", "Route-map name")
+	command.DescInstall(root, "route-map {ROUTEMAP} seq", "Route-map entry")
+	command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ}", "Sequence number")
+	for _, act := range []string{"deny", "permit"} {
+		command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} "+act+" match", "Match clause")
+		command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} "+act+" match ip", "Match IP")
+		command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} "+act+" match ip address", "Match IP address")
+		command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} "+act+" match ip address prefix-list", "Match prefix-list")
+		command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} "+act+" match tag", "Match route tag")
+	}
+	command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} permit set", "Set clause")
+	command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} permit set metric", "Set RIP metric")
+	command.DescInstall(root, "route-map {ROUTEMAP} seq {SEQ} permit set tag", "Set route tag")
 	command.DescInstall(root, "router", "Configure routing")
+	command.DescInstall(root, "router rip default-information", "Default route origination")
+	command.DescInstall(root, "router rip distribute-list", "Filter RIP routes")
+	command.DescInstall(root, "router rip distribute-list {PREFIXLIST}", "Prefix-list name")
+	command.DescInstall(root, "router rip distribute-list {PREFIXLIST} in interface", "Filter RIP routes received on interface")
+	command.DescInstall(root, "router rip distribute-list {PREFIXLIST} out interface", "Filter RIP routes sent on interface")
+	command.DescInstall(root, "router rip interface", "RIP interface parameters")
+	command.DescInstall(root, "router rip interface {IFNAME}", "RIP interface parameters")
+	command.DescInstall(root, "router rip interface {IFNAME} authentication", "RIP authentication")
+	command.DescInstall(root, "router rip interface {IFNAME} authentication mode", "RIP authentication mode")
+	command.DescInstall(root, "router rip interface {IFNAME} cost", "RIP interface cost")
+	command.DescInstall(root, "router rip interface {IFNAME} offset-list", "RIP metric offset")
+	command.DescInstall(root, "router rip interface {IFNAME} offset-list {PREFIXLIST}", "Prefix-list name")
+	command.DescInstall(root, "router rip interface {IFNAME} offset-list {PREFIXLIST} in", "Offset for received routes")
+	command.DescInstall(root, "router rip interface {IFNAME} offset-list {PREFIXLIST} out", "Offset for sent routes")
+	command.DescInstall(root, "router rip interface {IFNAME} receive", "RIP receive parameters")
+	command.DescInstall(root, "router rip interface {IFNAME} receive version", "RIP versions accepted on interface")
+	command.DescInstall(root, "router rip interface {IFNAME} route-map", "Apply route-map on interface")
+	command.DescInstall(root, "router rip interface {IFNAME} route-map {ROUTEMAP}", "Route-map name")
+	command.DescInstall(root, "router rip interface {IFNAME} send", "RIP send parameters")
+	command.DescInstall(root, "router rip interface {IFNAME} send version", "RIP version sent on interface")
+	command.DescInstall(root, "router rip interface {IFNAME} split-horizon", "RIP split horizon mode")
+	command.DescInstall(root, "router rip interface {IFNAME} summary-address", "Summary route advertised on interface")
+	command.DescInstall(root, "router rip maximum-paths", "Maximum number of RIP equal-cost paths")
+	command.DescInstall(root, "router rip maximum-prefix", "Maximum number of learned RIP prefixes")
+	command.DescInstall(root, "router rip neighbor", "Send unicast RIP updates to neighbor")
+	command.DescInstall(root, "router rip neighbor {IPADDR} maximum-prefix", "Maximum number of RIP prefixes learned from neighbor")
 	command.DescInstall(root, "router rip network", "Insert network into RIP protocol")
+	command.DescInstall(root, "router rip network {NETWORK} tag", "RIP network route tag")
 	command.DescInstall(root, "router rip network {NETWORK} cost", "RIP network cost")
+	command.DescInstall(root, "router rip offset-list", "RIP metric offset")
+	command.DescInstall(root, "router rip offset-list {PREFIXLIST}", "Prefix-list name")
+	command.DescInstall(root, "router rip offset-list {PREFIXLIST} in", "Offset for received routes")
+	command.DescInstall(root, "router rip offset-list {PREFIXLIST} out", "Offset for sent routes")
+	command.DescInstall(root, "router rip passive-interface", "Suppress RIP updates on interface")
+	command.DescInstall(root, "router rip redistribute", "Redistribute routes into RIP")
+	for _, source := range []string{RIP_REDIST_BGP, RIP_REDIST_CONNECTED, RIP_REDIST_STATIC} {
+		command.DescInstall(root, "router rip redistribute "+source+" metric", "RIP metric for redistributed routes")
+		command.DescInstall(root, "router rip redistribute "+source+" metric (RIPMETRIC) route-map", "Filter redistributed routes")
+		command.DescInstall(root, "router rip redistribute "+source+" route-map", "Filter redistributed routes")
+	}
+	command.DescInstall(root, "router rip route-map", "Apply route-map")
+	command.DescInstall(root, "router rip route-map {ROUTEMAP}", "Route-map name")
+	command.DescInstall(root, "router rip timers", "RIP timers")
+	command.DescInstall(root, "router rip timers basic", "RIP basic timers")
+	command.DescInstall(root, "router rip timers basic (UPDATE)", "Update interval")
+	command.DescInstall(root, "router rip timers basic (UPDATE) (TIMEOUT)", "Route timeout")
+	command.DescInstall(root, "router rip version", "RIP version")
 	command.DescInstall(root, "router rip vrf", "Insert network into RIP protocol for specific VRF")
 	command.DescInstall(root, "router rip vrf {VRFNAME}", "Insert network into RIP protocol for specific VRF")
+	command.DescInstall(root, "router rip vrf {VRFNAME} maximum-prefix", "Maximum number of learned RIP prefixes in VRF")
 	command.DescInstall(root, "router rip vrf {VRFNAME} network", "Insert network into RIP protocol for specific VRF")
+	command.DescInstall(root, "router rip vrf {VRFNAME} network {NETWORK} tag", "RIP network route tag")
 	command.DescInstall(root, "router rip vrf {VRFNAME} network {NETWORK} cost", "RIP network cost")
+	command.DescInstall(root, "router ripng default-information", "Default route origination")
+	command.DescInstall(root, "router ripng distribute-list", "Filter RIPng routes")
+	command.DescInstall(root, "router ripng distribute-list {PREFIXLIST}", "Prefix-list name")
+	command.DescInstall(root, "router ripng distribute-list {PREFIXLIST} in interface", "Filter RIPng routes received on interface")
+	command.DescInstall(root, "router ripng distribute-list {PREFIXLIST} out interface", "Filter RIPng routes sent on interface")
+	command.DescInstall(root, "router ripng interface", "RIPng interface parameters")
+	command.DescInstall(root, "router ripng interface {IFNAME}", "RIPng interface parameters")
+	command.DescInstall(root, "router ripng interface {IFNAME} cost", "RIPng interface cost")
+	command.DescInstall(root, "router ripng interface {IFNAME} offset-list", "RIPng metric offset")
+	command.DescInstall(root, "router ripng interface {IFNAME} offset-list {PREFIXLIST}", "Prefix-list name")
+	command.DescInstall(root, "router ripng interface {IFNAME} offset-list {PREFIXLIST} in", "Offset for received routes")
+	command.DescInstall(root, "router ripng interface {IFNAME} offset-list {PREFIXLIST} out", "Offset for sent routes")
+	command.DescInstall(root, "router ripng interface {IFNAME} route-map", "Apply route-map on interface")
+	command.DescInstall(root, "router ripng interface {IFNAME} route-map {ROUTEMAP}", "Route-map name")
+	command.DescInstall(root, "router ripng interface {IFNAME} split-horizon", "RIPng split horizon mode")
+	command.DescInstall(root, "router ripng interface {IFNAME} summary-address", "Summary route advertised on interface")
+	command.DescInstall(root, "router ripng maximum-paths", "Maximum number of RIPng equal-cost paths")
+	command.DescInstall(root, "router ripng maximum-prefix", "Maximum number of learned RIPng prefixes")
+	command.DescInstall(root, "router ripng network", "Insert network into RIPng protocol")
+	command.DescInstall(root, "router ripng network {NETWORK} tag", "RIPng network route tag")
+	command.DescInstall(root, "router ripng network {NETWORK} cost", "RIPng network cost")
+	command.DescInstall(root, "router ripng network {NETWORK} nexthop", "RIPng network nexthop")
+	command.DescInstall(root, "router ripng network {NETWORK} nexthop {IPADDR} cost", "RIPng network cost")
+	command.DescInstall(root, "router ripng offset-list", "RIPng metric offset")
+	command.DescInstall(root, "router ripng offset-list {PREFIXLIST}", "Prefix-list name")
+	command.DescInstall(root, "router ripng offset-list {PREFIXLIST} in", "Offset for received routes")
+	command.DescInstall(root, "router ripng offset-list {PREFIXLIST} out", "Offset for sent routes")
+	command.DescInstall(root, "router ripng passive-interface", "Suppress RIPng updates on interface")
+	command.DescInstall(root, "router ripng redistribute", "Redistribute routes into RIPng")
+	for _, source := range []string{RIP_REDIST_BGP, RIP_REDIST_CONNECTED, RIP_REDIST_STATIC} {
+		command.DescInstall(root, "router ripng redistribute "+source+" metric", "RIPng metric for redistributed routes")
+		command.DescInstall(root, "router ripng redistribute "+source+" metric (RIPMETRIC) route-map", "Filter redistributed routes")
+		command.DescInstall(root, "router ripng redistribute "+source+" route-map", "Filter redistributed routes")
+	}
+	command.DescInstall(root, "router ripng route-map", "Apply route-map")
+	command.DescInstall(root, "router ripng route-map {ROUTEMAP}", "Route-map name")
+	command.DescInstall(root, "router ripng timers", "RIPng timers")
+	command.DescInstall(root, "router ripng timers basic", "RIPng basic timers")
+	command.DescInstall(root, "router ripng timers basic (UPDATE)", "Update interval")
+	command.DescInstall(root, "router ripng timers basic (UPDATE) (TIMEOUT)", "Route timeout")
+	command.DescInstall(root, "router ripng vrf", "Insert network into RIPng protocol for specific VRF")
+	command.DescInstall(root, "router ripng vrf {VRFNAME}", "Insert network into RIPng protocol for specific VRF")
+	command.DescInstall(root, "router ripng vrf {VRFNAME} maximum-prefix", "Maximum number of learned RIPng prefixes in VRF")
+	command.DescInstall(root, "router ripng vrf {VRFNAME} network", "Insert network into RIPng protocol for specific VRF")
+	command.DescInstall(root, "router ripng vrf {VRFNAME} network {NETWORK} tag", "RIPng network route tag")
+	command.DescInstall(root, "router ripng vrf {VRFNAME} network {NETWORK} cost", "RIPng network cost")
+	command.DescInstall(root, "router ripng vrf {VRFNAME} network {NETWORK} nexthop", "RIPng network nexthop")
+	command.DescInstall(root, "router ripng vrf {VRFNAME} network {NETWORK} nexthop {IPADDR} cost", "RIPng network cost")
+	command.DescInstall(root, "clear", "Reset operational state")
+	command.DescInstall(root, "clear ripng", "Reset RIPng state")
+	command.DescInstall(root, "clear ripng neighbor", "Expire RIPng routes learned from neighbor")
+	command.DescInstall(root, "clear ripng routes network", "Flush learned RIPng routes for network")
+	command.DescInstall(root, "clear ripng routes vrf", "Flush learned RIPng routes in VRF")
+	command.DescInstall(root, "clear ripng routes vrf {VRFNAME} network", "Flush learned RIPng routes for network in VRF")
+	command.DescInstall(root, "clear rip", "Reset RIP state")
+	command.DescInstall(root, "clear rip neighbor", "Expire RIP routes learned from neighbor")
+	command.DescInstall(root, "clear rip routes network", "Flush learned RIP routes for network")
+	command.DescInstall(root, "clear rip routes vrf", "Flush learned RIP routes in VRF")
+	command.DescInstall(root, "clear rip routes vrf {VRFNAME} network", "Flush learned RIP routes for network in VRF")
+	command.DescInstall(root, "show ripng", "Show RIPng information")
+	command.DescInstall(root, "show rip", "Show RIP information")
 
 	command.MissingDescription(root)
 }
@@ -191,11 +469,106 @@ func cmdVersion(ctx command.ConfContext, node *command.CmdNode, line string, c c
 
 func cmdShowRipRoutes(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
 	rip := ctx.(*Rip)
-	if rip.router == nil {
-		c.Sendln("RIP not running")
+	proto := strings.Fields(node.Path)[1]
+	router := ripRouter(rip, proto)
+	if router == nil {
+		c.Sendln(fmt.Sprintf("%s not running", strings.ToUpper(proto)))
+		return
+	}
+	router.ShowRoutes(c)
+}
+
+func cmdShowRipInterface(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	rip := ctx.(*Rip)
+	proto := strings.Fields(node.Path)[1]
+	router := ripRouter(rip, proto)
+	if router == nil {
+		c.Sendln(fmt.Sprintf("%s not running", strings.ToUpper(proto)))
+		return
+	}
+	router.ShowInterfaces(c)
+}
+
+func cmdShowRipNeighbors(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	rip := ctx.(*Rip)
+	proto := strings.Fields(node.Path)[1]
+	router := ripRouter(rip, proto)
+	if router == nil {
+		c.Sendln(fmt.Sprintf("%s not running", strings.ToUpper(proto)))
+		return
+	}
+	router.ShowNeighbors(c)
+}
+
+func cmdClearRipRoutes(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	rip := ctx.(*Rip)
+	proto := strings.Fields(node.Path)[1]
+	router := ripRouter(rip, proto)
+	if router == nil {
+		c.Sendln(fmt.Sprintf("%s not running", strings.ToUpper(proto)))
+		return
+	}
+
+	expanded, err := command.CmdExpand(line, node.Path)
+	if err != nil {
+		c.Sendln(fmt.Sprintf("clear routes: %v", err))
+		return
+	}
+
+	// clear rip routes [vrf VRFNAME] [network NETWORK]
+	f := strings.Fields(expanded)
+	args := f[3:]
+	vrf := ""
+	if len(args) > 1 && args[0] == "vrf" {
+		vrf = args[1]
+		args = args[2:]
+	}
+	var prefix *net.IPNet
+	if len(args) > 1 && args[0] == "network" {
+		_, prefix, err = net.ParseCIDR(args[1])
+		if err != nil {
+			c.Sendln(fmt.Sprintf("clear routes: bad network: %v", err))
+			return
+		}
+	}
+
+	flushed, errClear := router.ClearRoutes(vrf, prefix)
+	if errClear != nil {
+		c.Sendln(fmt.Sprintf("clear routes: %v", errClear))
+		return
+	}
+	c.Sendln(fmt.Sprintf("%s: flushed %d routes", strings.ToUpper(proto), flushed))
+}
+
+func cmdClearRipNeighbor(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	rip := ctx.(*Rip)
+	proto := strings.Fields(node.Path)[1]
+	router := ripRouter(rip, proto)
+	if router == nil {
+		c.Sendln(fmt.Sprintf("%s not running", strings.ToUpper(proto)))
+		return
+	}
+
+	nbrStr := command.LastToken(line)
+	nbr := net.ParseIP(nbrStr)
+	if nbr == nil {
+		c.Sendln(fmt.Sprintf("clear neighbor: bad address: '%s'", nbrStr))
+		return
+	}
+
+	expired := router.ClearNeighbor(nbr)
+	c.Sendln(fmt.Sprintf("%s: expired %d routes from neighbor %v", strings.ToUpper(proto), expired, nbr))
+}
+
+func cmdClearRipStatistics(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	rip := ctx.(*Rip)
+	proto := strings.Fields(node.Path)[1]
+	router := ripRouter(rip, proto)
+	if router == nil {
+		c.Sendln(fmt.Sprintf("%s not running", strings.ToUpper(proto)))
 		return
 	}
-	rip.router.ShowRoutes(c)
+	router.ClearStatistics()
 }
 
 func cmdRip(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
@@ -206,6 +579,126 @@ func cmdRipIfaceCost(ctx command.ConfContext, node *command.CmdNode, line string
 	command.SetSimple(ctx, c, node.Path, line)
 }
 
+// cmdSingleMode(): the last (literal) label is a mode which replaces previous mode
+func cmdSingleMode(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	path, mode := command.StripLastToken(node.Path)
+	linePath, _ := command.StripLastToken(line)
+	command.SingleValueSet(ctx, c, path, linePath, mode)
+}
+
+func cmdRipIfaceAuthKeyChain(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdKeyString(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdKeyLifetime(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipPassive(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipNeighbor(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+// cmdPrefixList(): a sequence number holds a single entry, drop previous one
+func cmdPrefixList(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	if expanded, err := command.CmdExpand(line, node.Path); err == nil {
+		seqPath := strings.Join(strings.Fields(expanded)[:5], " ") // ip prefix-list NAME seq N
+		if seqNode, _ := ctx.ConfRootCandidate().Get(seqPath); seqNode != nil {
+			seqNode.Children = nil
+		}
+	}
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRouteMap(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	if expanded, err := command.CmdExpand(line, node.Path); err == nil {
+		f := strings.Fields(expanded)
+		seqPath := strings.Join(f[:4], " ") // route-map NAME seq N
+		if seqNode, _ := ctx.ConfRootCandidate().Get(seqPath); seqNode != nil {
+			// permit and deny are mutually exclusive
+			children := []*command.ConfNode{}
+			for _, child := range seqNode.Children {
+				if command.LastToken(child.Path) == f[4] {
+					children = append(children, child)
+				}
+			}
+			seqNode.Children = children
+		}
+	}
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipRedistribute(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	if expanded, err := command.CmdExpand(line, node.Path); err == nil {
+		f := strings.Fields(expanded)
+		for i, label := range f {
+			if label != "redistribute" || i+1 >= len(f) {
+				continue
+			}
+			// replace previous metric/route-map for source
+			sourcePath := strings.Join(f[:i+2], " ") // router rip|ripng redistribute SOURCE
+			if sourceNode, _ := ctx.ConfRootCandidate().Get(sourcePath); sourceNode != nil {
+				sourceNode.Children = nil
+			}
+			break
+		}
+	}
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipDistributeList(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipOffsetList(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipSummaryAddress(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipMaximumPaths(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipMaximumPrefix(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	if expanded, err := command.CmdExpand(line, node.Path); err == nil {
+		f := strings.Fields(expanded)
+		for i, label := range f {
+			if label != "maximum-prefix" {
+				continue
+			}
+			// replace previous limit
+			limitPath := strings.Join(f[:i+1], " ") // router rip|ripng [vrf VRFNAME | neighbor IPADDR] maximum-prefix
+			if limitNode, _ := ctx.ConfRootCandidate().Get(limitPath); limitNode != nil {
+				limitNode.Children = nil
+			}
+			break
+		}
+	}
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipRouteMap(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipNetTag(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
+func cmdRipTimers(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
+	command.SetSimple(ctx, c, node.Path, line)
+}
+
 func cmdRipNetwork(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
 	command.SetSimple(ctx, c, node.Path, line)
 }
@@ -240,7 +733,10 @@ func applyRip(ctx command.ConfContext, node *command.CmdNode, action command.Com
 		return nil
 	}
 
-	enableRip(rip, action.Enable)
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+
+	enableRip(rip, proto, action.Enable)
 
 	return nil
 }
@@ -253,6 +749,7 @@ func applyRipIfaceCost(ctx command.ConfContext, node *command.CmdNode, action co
 	}
 
 	f := strings.Fields(action.Cmd)
+	proto := f[1]
 	ifname := f[3]
 	costStr := f[5]
 
@@ -262,23 +759,24 @@ func applyRipIfaceCost(ctx command.ConfContext, node *command.CmdNode, action co
 	}
 
 	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		rip.router.setInterfaceRipCost(ifname, cost)
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.setInterfaceRipCost(ifname, cost)
 		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipIfaceCost: rip router disabled")
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipIfaceCost: %s router disabled", proto)
 	}
 
-	rip.router.clearInterfaceRipCost(ifname)
+	router.clearInterfaceRipCost(ifname)
 
-	enableRip(rip, false) // disable rip if needed
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func applyRipNet(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func applyRipIfaceSplitHorizon(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
@@ -286,94 +784,125 @@ func applyRipNet(ctx command.ConfContext, node *command.CmdNode, action command.
 	}
 
 	f := strings.Fields(action.Cmd)
-	vrf := ""
-	netAddr := f[3]
+	proto := f[1]
+	ifname := f[3]
+	modeStr := f[5]
+
+	var mode int
+	switch modeStr {
+	case "disable":
+		mode = RIP_SPLIT_HORIZON_DISABLE
+	case "poisoned-reverse":
+		mode = RIP_SPLIT_HORIZON_POISONED_REVERSE
+	default:
+		return fmt.Errorf("applyRipIfaceSplitHorizon: bad split horizon mode: '%s'", modeStr)
+	}
 
 	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetAdd(vrf, netAddr)
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.setInterfaceSplitHorizon(ifname, mode)
+		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipNet: rip router disabled")
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipIfaceSplitHorizon: %s router disabled", proto)
 	}
 
-	if err := rip.router.NetDel(vrf, netAddr); err != nil {
-		return err
-	}
+	router.clearInterfaceSplitHorizon(ifname)
 
-	enableRip(rip, false) // disable rip if needed
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func applyRipVrfNet(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func applyRipIfaceSendVersion(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
 		return nil
 	}
 
+	// router rip interface IFNAME send version MODE
 	f := strings.Fields(action.Cmd)
-	vrf := f[3]
-	netAddr := f[5]
+	proto := f[1]
+	ifname := f[3]
+	modeStr := f[6]
+
+	var mode int
+	switch modeStr {
+	case "1":
+		mode = RIP_SEND_V1
+	case "2":
+		mode = RIP_SEND_V2
+	case "compatible":
+		mode = RIP_SEND_COMPATIBLE
+	default:
+		return fmt.Errorf("applyRipIfaceSendVersion: bad send version: '%s'", modeStr)
+	}
 
 	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetAdd(vrf, netAddr)
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.setInterfaceSendVersion(ifname, mode)
+		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipVrfNet: rip router disabled")
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipIfaceSendVersion: %s router disabled", proto)
 	}
 
-	if err := rip.router.NetDel(vrf, netAddr); err != nil {
-		return err
-	}
+	router.setInterfaceSendVersion(ifname, RIP_SEND_DEFAULT)
 
-	enableRip(rip, false) // disable rip if needed
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func applyRipNetCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func applyRipIfaceRecvVersion(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
 		return nil
 	}
 
-	vrf := ""
+	// router rip interface IFNAME receive version MODE
 	f := strings.Fields(action.Cmd)
-	netAddr := f[3]
-	metricStr := f[5]
-
-	metric, err := strconv.Atoi(metricStr)
-	if err != nil {
-		return fmt.Errorf("applyRipNetCost: bad metric: '%s': %v", metricStr, err)
+	proto := f[1]
+	ifname := f[3]
+	modeStr := f[6]
+
+	var mode int
+	switch modeStr {
+	case "1":
+		mode = RIP_RECV_V1
+	case "2":
+		mode = RIP_RECV_V2
+	case "both":
+		mode = RIP_RECV_BOTH
+	default:
+		return fmt.Errorf("applyRipIfaceRecvVersion: bad receive version: '%s'", modeStr)
 	}
 
-	nexthop := net.IPv4zero
-
 	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.setInterfaceRecvVersion(ifname, mode)
+		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipNetCost: rip router disabled")
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipIfaceRecvVersion: %s router disabled", proto)
 	}
 
-	if err := rip.router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
-		return err
-	}
+	router.setInterfaceRecvVersion(ifname, RIP_RECV_DEFAULT)
 
-	enableRip(rip, false) // disable rip if needed
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func applyRipVrfNetCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func applyRipIfaceAuthMode(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
@@ -381,36 +910,39 @@ func applyRipVrfNetCost(ctx command.ConfContext, node *command.CmdNode, action c
 	}
 
 	f := strings.Fields(action.Cmd)
-	vrf := f[3]
-	netAddr := f[5]
-	metricStr := f[7]
-
-	metric, err := strconv.Atoi(metricStr)
-	if err != nil {
-		return fmt.Errorf("applyRipNetCost: bad metric: '%s': %v", metricStr, err)
+	proto := f[1]
+	ifname := f[3]
+	modeStr := f[6]
+
+	var mode int
+	switch modeStr {
+	case "text":
+		mode = RIP_AUTH_TEXT
+	case "cryptographic":
+		mode = RIP_AUTH_CRYPTO
+	default:
+		return fmt.Errorf("applyRipIfaceAuthMode: bad authentication mode: '%s'", modeStr)
 	}
 
-	nexthop := net.IPv4zero
-
 	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.setInterfaceAuthMode(ifname, mode)
+		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipVrfNetCost: rip router disabled")
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipIfaceAuthMode: %s router disabled", proto)
 	}
 
-	if err := rip.router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
-		return err
-	}
+	router.setInterfaceAuthMode(ifname, RIP_AUTH_NONE)
 
-	enableRip(rip, false) // disable rip if needed
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func applyRipNetNexthop(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func applyRipIfaceAuthKeyChain(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
@@ -418,34 +950,40 @@ func applyRipNetNexthop(ctx command.ConfContext, node *command.CmdNode, action c
 	}
 
 	f := strings.Fields(action.Cmd)
-	vrf := ""
-	netAddr := f[3]
-	nexthopStr := f[5]
-
-	nexthop := net.ParseIP(nexthopStr)
-	if nexthop == nil {
-		return fmt.Errorf("applyRipNetNexthop: bad address: '%s'", nexthopStr)
-	}
+	proto := f[1]
+	ifname := f[3]
+	keyChain := f[6]
 
 	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetNexthopAdd(vrf, netAddr, nexthop)
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.setInterfaceAuthKeyChain(ifname, keyChain)
+		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipNetNexthop: rip router disabled")
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipIfaceAuthKeyChain: %s router disabled", proto)
 	}
 
-	if err := rip.router.NetNexthopDel(vrf, netAddr, nexthop); err != nil {
-		return err
-	}
+	router.setInterfaceAuthKeyChain(ifname, "")
 
-	enableRip(rip, false) // disable rip if needed
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func applyRipVrfNetNexthop(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func parseKeyId(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return -1, fmt.Errorf("bad key id: '%s': %v", s, err)
+	}
+	if id < 0 || id > RIP_AUTH_KEY_ID_MAX {
+		return -1, fmt.Errorf("key id out of range 0-%d: %d", RIP_AUTH_KEY_ID_MAX, id)
+	}
+	return id, nil
+}
+
+func applyKeyString(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
@@ -453,75 +991,127 @@ func applyRipVrfNetNexthop(ctx command.ConfContext, node *command.CmdNode, actio
 	}
 
 	f := strings.Fields(action.Cmd)
-	vrf := f[3]
-	netAddr := f[5]
-	nexthopStr := f[7]
+	chain := f[2]
+	secret := f[6]
 
-	nexthop := net.ParseIP(nexthopStr)
-	if nexthop == nil {
-		return fmt.Errorf("applyRipVrfNetNexthop: bad address: '%s'", nexthopStr)
+	id, err := parseKeyId(f[4])
+	if err != nil {
+		return fmt.Errorf("applyKeyString: %v", err)
 	}
 
-	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetNexthopAdd(vrf, netAddr, nexthop)
+	if !action.Enable {
+		secret = ""
+	}
+
+	rip.keyChains.keyUpdate(chain, id, func(k *ripKey) { k.secret = secret })
+
+	return nil
+}
+
+func applyKeyAlgorithm(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipVrfNetNexthop: rip router disabled")
+	f := strings.Fields(action.Cmd)
+	chain := f[2]
+	algName := f[6]
+
+	id, err := parseKeyId(f[4])
+	if err != nil {
+		return fmt.Errorf("applyKeyAlgorithm: %v", err)
 	}
 
-	if err := rip.router.NetNexthopDel(vrf, netAddr, nexthop); err != nil {
-		return err
+	alg := ripAuthAlgorithmFind(algName)
+	if alg == nil {
+		return fmt.Errorf("applyKeyAlgorithm: unsupported algorithm: '%s'", algName)
 	}
 
-	enableRip(rip, false) // disable rip if needed
+	if !action.Enable {
+		alg = nil // default
+	}
+
+	rip.keyChains.keyUpdate(chain, id, func(k *ripKey) { k.algorithm = alg })
 
 	return nil
 }
 
-func applyRipNetNexthopCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func applyKeyLifetime(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
 		return nil
 	}
 
+	// key chain CHAIN key ID send-lifetime start TIMESTAMP
 	f := strings.Fields(action.Cmd)
-	vrf := ""
-	netAddr := f[3]
-	nexthopStr := f[5]
-	metricStr := f[7]
+	chain := f[2]
+	lifetime := f[5]
+	edge := f[6]
+	timestampStr := f[7]
 
-	nexthop := net.ParseIP(nexthopStr)
-	if nexthop == nil {
-		return fmt.Errorf("applyRipNetNexthopCost: bad address: '%s'", nexthopStr)
+	id, err1 := parseKeyId(f[4])
+	if err1 != nil {
+		return fmt.Errorf("applyKeyLifetime: %v", err1)
 	}
 
-	metric, err1 := strconv.Atoi(metricStr)
-	if err1 != nil {
-		return fmt.Errorf("applyRipNetNexthopCost: bad metric: '%s': %v", metricStr, err1)
+	timestamp, err2 := time.Parse(time.RFC3339, timestampStr)
+	if err2 != nil {
+		return fmt.Errorf("applyKeyLifetime: bad timestamp: '%s': %v", timestampStr, err2)
 	}
 
-	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+	if !action.Enable {
+		timestamp = time.Time{} // unbounded
+	}
+
+	rip.keyChains.keyUpdate(chain, id, func(k *ripKey) {
+		switch lifetime + " " + edge {
+		case "send-lifetime start":
+			k.sendStart = timestamp
+		case "send-lifetime end":
+			k.sendEnd = timestamp
+		case "accept-lifetime start":
+			k.acceptStart = timestamp
+		case "accept-lifetime end":
+			k.acceptEnd = timestamp
+		}
+	})
+
+	return nil
+}
+
+func applyRipPassive(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipNetNexthopCost: rip router disabled")
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	ifname := f[3]
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.setInterfacePassive(ifname, true)
+		return nil
 	}
 
-	if err := rip.router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
-		return err
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipPassive: %s router disabled", proto)
 	}
 
-	enableRip(rip, false) // disable rip if needed
+	router.setInterfacePassive(ifname, false)
+
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func applyRipVrfNetNexthopCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+func applyRipNeighbor(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
 	rip := ripCtx(ctx, c)
 	if rip == nil {
@@ -529,65 +1119,1019 @@ func applyRipVrfNetNexthopCost(ctx command.ConfContext, node *command.CmdNode, a
 	}
 
 	f := strings.Fields(action.Cmd)
-	vrf := f[3]
-	netAddr := f[5]
-	nexthopStr := f[7]
-	metricStr := f[9]
-
-	nexthop := net.ParseIP(nexthopStr)
-	if nexthop == nil {
-		return fmt.Errorf("applyRipVrfNetNexthopCost: bad address: '%s'", nexthopStr)
-	}
+	proto := f[1]
+	nbrStr := f[3]
 
-	metric, err1 := strconv.Atoi(metricStr)
-	if err1 != nil {
-		return fmt.Errorf("applyRipVrfNetNexthopCost: bad metric: '%s': %v", metricStr, err1)
+	nbr := net.ParseIP(nbrStr)
+	if nbr == nil {
+		return fmt.Errorf("applyRipNeighbor: bad address: '%s'", nbrStr)
 	}
 
 	if action.Enable {
-		enableRip(rip, true) // try to enable rip
-		return rip.router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NeighborAdd(nbr)
 	}
 
-	if rip.router == nil {
-		return fmt.Errorf("applyRipVrfNetNexthopCost: rip router disabled")
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipNeighbor: %s router disabled", proto)
 	}
 
-	if err := rip.router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
+	if err := router.NeighborDel(nbr); err != nil {
 		return err
 	}
 
-	enableRip(rip, false) // disable rip if needed
+	enableRip(rip, proto, false) // disable rip if needed
 
 	return nil
 }
 
-func enableRip(rip *Rip, enable bool) {
+func applyPrefixList(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
 
-	if enable {
-		// enable RIP
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
 
-		if rip.router == nil {
-			rip.router = NewRipRouter(rip.hardware)
-		}
+	// ip prefix-list NAME seq N permit|deny PREFIX [ge X] [le Y]
+	f := strings.Fields(action.Cmd)
+	listName := f[2]
+	seqStr := f[4]
 
-		return
+	seq, err1 := strconv.Atoi(seqStr)
+	if err1 != nil || seq < 1 {
+		return fmt.Errorf("applyPrefixList: bad sequence number: '%s'", seqStr)
 	}
 
-	// disable RIP
+	if !action.Enable {
+		return rip.prefixLists.entryDel(listName, seq)
+	}
+
+	_, prefix, err2 := net.ParseCIDR(f[6])
+	if err2 != nil {
+		return fmt.Errorf("applyPrefixList: bad prefix: '%s': %v", f[6], err2)
+	}
+
+	entry := &ripPrefixListEntry{seq: seq, permit: f[5] == "permit", prefix: *prefix}
+
+	entryLen, bits := prefix.Mask.Size()
+
+	for i := 7; i+1 < len(f); i += 2 {
+		length, err := strconv.Atoi(f[i+1])
+		if err != nil || length <= entryLen || length > bits {
+			return fmt.Errorf("applyPrefixList: bad %s length: '%s' (must be in range %d..%d)", f[i], f[i+1], entryLen+1, bits)
+		}
+		switch f[i] {
+		case "ge":
+			entry.ge = length
+		case "le":
+			entry.le = length
+		}
+	}
+
+	if entry.ge > 0 && entry.le > 0 && entry.ge > entry.le {
+		return fmt.Errorf("applyPrefixList: ge %d is greater than le %d", entry.ge, entry.le)
+	}
+
+	rip.prefixLists.entrySet(listName, entry)
+
+	return nil
+}
+
+func applyRouteMap(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// route-map NAME seq N permit|deny [match ip address prefix-list LIST] [match tag T] [set metric M] [set tag T]
+	f := strings.Fields(action.Cmd)
+	mapName := f[1]
+	seqStr := f[3]
+	permit := f[4] == "permit"
+
+	seq, err1 := strconv.Atoi(seqStr)
+	if err1 != nil || seq < 1 {
+		return fmt.Errorf("applyRouteMap: bad sequence number: '%s'", seqStr)
+	}
+
+	var update func(e *ripRouteMapEntry)
+
+	switch {
+	case len(f) == 5:
+		// bare entry
+	case f[5] == "match" && f[6] == "ip":
+		listName := f[9]
+		update = func(e *ripRouteMapEntry) {
+			if action.Enable {
+				e.matchPrefixList = listName
+			} else {
+				e.matchPrefixList = ""
+			}
+		}
+	case f[5] == "match" && f[6] == "tag":
+		tag, err := parseRipTag(f[7])
+		if err != nil {
+			return fmt.Errorf("applyRouteMap: %v", err)
+		}
+		update = func(e *ripRouteMapEntry) {
+			if action.Enable {
+				e.matchTag = tag
+			} else {
+				e.matchTag = 0
+			}
+		}
+	case f[5] == "set" && f[6] == "tag":
+		tag, err := parseRipTag(f[7])
+		if err != nil {
+			return fmt.Errorf("applyRouteMap: %v", err)
+		}
+		update = func(e *ripRouteMapEntry) {
+			if action.Enable {
+				e.setTag = tag
+			} else {
+				e.setTag = 0
+			}
+		}
+	case f[5] == "set" && f[6] == "metric":
+		metricStr := f[7]
+		metric, err := strconv.Atoi(metricStr)
+		if err != nil || metric < 1 || metric >= RIP_METRIC_INFINITY {
+			return fmt.Errorf("applyRouteMap: bad metric: '%s'", metricStr)
+		}
+		update = func(e *ripRouteMapEntry) {
+			if action.Enable {
+				e.setMetric = metric
+			} else {
+				e.setMetric = 0
+			}
+		}
+	default:
+		return fmt.Errorf("applyRouteMap: unexpected clause: '%s'", action.Cmd)
+	}
+
+	if action.Enable {
+		rip.routeMaps.entrySet(mapName, seq, permit, update)
+	} else if err := rip.routeMaps.entryUnset(mapName, seq, update); err != nil {
+		return err
+	}
+
+	// route-map changes affect redistributed routes
+	for _, proto := range []string{"rip", "ripng"} {
+		if router := ripRouter(rip, proto); router != nil {
+			router.request(&ripRedistSyncRequest{})
+		}
+	}
+
+	return nil
+}
+
+// parseRipTag(): route tag is a 16-bit non-zero value (zero means untagged)
+func parseRipTag(tagStr string) (uint16, error) {
+	tag, err := strconv.Atoi(tagStr)
+	if err != nil || tag < 1 || tag > 0xFFFF {
+		return 0, fmt.Errorf("bad tag: '%s' (must be in range 1..65535)", tagStr)
+	}
+	return uint16(tag), nil
+}
+
+func applyRipRouteMap(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip [interface IFNAME] route-map NAME in|out
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	ifname := ""
+	if f[2] == "interface" {
+		ifname = f[3]
+		f = append(f[:2:2], f[4:]...) // hide interface
+	}
+	mapName := f[3]
+	dir := f[4]
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.RouteMapPolicyAdd(dir, ifname, mapName)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipRouteMap: %s router disabled", proto)
+	}
+
+	if err := router.RouteMapPolicyDel(dir, ifname, mapName); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipDistributeList(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip distribute-list NAME in|out [interface IFNAME]
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	listName := f[3]
+	dir := f[4]
+	ifname := ""
+	if len(f) > 6 {
+		ifname = f[6]
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.DistributeListAdd(dir, ifname, listName)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipDistributeList: %s router disabled", proto)
+	}
+
+	if err := router.DistributeListDel(dir, ifname, listName); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipOffsetList(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip [interface IFNAME] offset-list NAME in|out OFFSET
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	ifname := ""
+	if f[2] == "interface" {
+		ifname = f[3]
+		f = append(f[:2:2], f[4:]...) // hide interface
+	}
+	listName := f[3]
+	dir := f[4]
+	offsetStr := f[5]
+
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		return fmt.Errorf("applyRipOffsetList: bad offset: '%s': %v", offsetStr, err)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.OffsetListSet(dir, ifname, listName, offset)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipOffsetList: %s router disabled", proto)
+	}
+
+	if err := router.OffsetListDel(dir, ifname, listName); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipRedistribute(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip default-information originate
+	// router rip redistribute SOURCE [metric N] [route-map NAME]
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+
+	source := RIP_REDIST_DEFAULT
+	var redist ripRedist
+
+	if f[2] == "redistribute" {
+		source = f[3]
+		for i := 4; i+1 < len(f); i += 2 {
+			switch f[i] {
+			case "metric":
+				metric, err := strconv.Atoi(f[i+1])
+				if err != nil || metric < 1 || metric >= RIP_METRIC_INFINITY {
+					return fmt.Errorf("applyRipRedistribute: bad metric: '%s'", f[i+1])
+				}
+				redist.metric = metric
+			case "route-map":
+				redist.routeMap = f[i+1]
+			}
+		}
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.RedistributeSet(source, redist)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipRedistribute: %s router disabled", proto)
+	}
+
+	if err := router.RedistributeDel(source); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipMaximumPaths(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip maximum-paths N
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	pathsStr := f[3]
+
+	paths, err := strconv.Atoi(pathsStr)
+	if err != nil || paths < 1 {
+		return fmt.Errorf("applyRipMaximumPaths: bad number of paths: '%s'", pathsStr)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.SetMaximumPaths(paths)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipMaximumPaths: %s router disabled", proto)
+	}
+
+	router.SetMaximumPaths(0) // restore default
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipMaximumPrefix(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip [vrf VRFNAME] maximum-prefix N [warning-only]
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	args := f[2:]
+	vrf := ""
+	if args[0] == "vrf" {
+		vrf = args[1]
+		args = args[2:]
+	}
+	limitStr := args[1]
+	warningOnly := len(args) > 2 && args[2] == "warning-only"
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return fmt.Errorf("applyRipMaximumPrefix: bad number of prefixes: '%s'", limitStr)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.SetMaximumPrefix(vrf, limit, warningOnly)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipMaximumPrefix: %s router disabled", proto)
+	}
+
+	router.DelMaximumPrefix(vrf)
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+// applyRipNeighborMaximumPrefix(): like other neighbor options, the limit implies the unicast neighbor
+func applyRipNeighborMaximumPrefix(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip neighbor IPADDR maximum-prefix N [warning-only]
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	nbrStr := f[3]
+	limitStr := f[5]
+	warningOnly := len(f) > 6 && f[6] == "warning-only"
+
+	nbr := net.ParseIP(nbrStr)
+	if nbr == nil {
+		return fmt.Errorf("applyRipNeighborMaximumPrefix: bad address: '%s'", nbrStr)
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return fmt.Errorf("applyRipNeighborMaximumPrefix: bad number of prefixes: '%s'", limitStr)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		if err := router.NeighborAdd(nbr); err != nil {
+			return err
+		}
+		router.SetNeighborMaximumPrefix(nbr, limit, warningOnly)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipNeighborMaximumPrefix: %s router disabled", proto)
+	}
+
+	router.DelNeighborMaximumPrefix(nbr)
+
+	if err := router.NeighborDel(nbr); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipVersion(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip version N
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	versionStr := f[3]
+
+	version, err := strconv.Atoi(versionStr)
+	if err != nil || (version != RIP_V1 && version != RIP_V2) {
+		return fmt.Errorf("applyRipVersion: bad version: '%s'", versionStr)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.SetVersion(version)
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipVersion: %s router disabled", proto)
+	}
+
+	router.SetVersion(0) // restore default
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipTimers(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip timers basic UPDATE TIMEOUT GC
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+
+	var secs [3]int
+	for i, str := range f[4:7] {
+		s, err := strconv.Atoi(str)
+		if err != nil {
+			return fmt.Errorf("applyRipTimers: bad timer: '%s': %v", str, err)
+		}
+		if s < 1 {
+			return fmt.Errorf("applyRipTimers: timer must be positive: '%s'", str)
+		}
+		secs[i] = s
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		router.SetTimers(ripTimers{
+			update:  time.Duration(secs[0]) * time.Second,
+			timeout: time.Duration(secs[1]) * time.Second,
+			gc:      time.Duration(secs[2]) * time.Second,
+		})
+		return nil
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipTimers: %s router disabled", proto)
+	}
+
+	router.SetTimers(ripTimers{}) // restore defaults
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipNet(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := ""
+	netAddr := f[3]
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetAdd(vrf, netAddr)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipNet: %s router disabled", proto)
+	}
+
+	if err := router.NetDel(vrf, netAddr); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipVrfNet(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := f[3]
+	netAddr := f[5]
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetAdd(vrf, netAddr)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipVrfNet: %s router disabled", proto)
+	}
+
+	if err := router.NetDel(vrf, netAddr); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipNetCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	vrf := ""
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	netAddr := f[3]
+	metricStr := f[5]
+
+	metric, err := strconv.Atoi(metricStr)
+	if err != nil {
+		return fmt.Errorf("applyRipNetCost: bad metric: '%s': %v", metricStr, err)
+	}
+
+	nexthop := protoUnspecified(proto)
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipNetCost: %s router disabled", proto)
+	}
+
+	if err := router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipVrfNetCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := f[3]
+	netAddr := f[5]
+	metricStr := f[7]
+
+	metric, err := strconv.Atoi(metricStr)
+	if err != nil {
+		return fmt.Errorf("applyRipNetCost: bad metric: '%s': %v", metricStr, err)
+	}
+
+	nexthop := protoUnspecified(proto)
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipVrfNetCost: %s router disabled", proto)
+	}
+
+	if err := router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipNetTag(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	vrf := ""
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	netAddr := f[3]
+	tagStr := f[5]
+
+	tag, err := parseRipTag(tagStr)
+	if err != nil {
+		return fmt.Errorf("applyRipNetTag: %v", err)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetTagAdd(vrf, netAddr, tag)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipNetTag: %s router disabled", proto)
+	}
+
+	if err := router.NetTagDel(vrf, netAddr, tag); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipVrfNetTag(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := f[3]
+	netAddr := f[5]
+	tagStr := f[7]
+
+	tag, err := parseRipTag(tagStr)
+	if err != nil {
+		return fmt.Errorf("applyRipVrfNetTag: %v", err)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetTagAdd(vrf, netAddr, tag)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipVrfNetTag: %s router disabled", proto)
+	}
+
+	if err := router.NetTagDel(vrf, netAddr, tag); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipNetNexthop(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := ""
+	netAddr := f[3]
+	nexthopStr := f[5]
+
+	nexthop := net.ParseIP(nexthopStr)
+	if nexthop == nil {
+		return fmt.Errorf("applyRipNetNexthop: bad address: '%s'", nexthopStr)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetNexthopAdd(vrf, netAddr, nexthop)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipNetNexthop: %s router disabled", proto)
+	}
+
+	if err := router.NetNexthopDel(vrf, netAddr, nexthop); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipVrfNetNexthop(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := f[3]
+	netAddr := f[5]
+	nexthopStr := f[7]
+
+	nexthop := net.ParseIP(nexthopStr)
+	if nexthop == nil {
+		return fmt.Errorf("applyRipVrfNetNexthop: bad address: '%s'", nexthopStr)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetNexthopAdd(vrf, netAddr, nexthop)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipVrfNetNexthop: %s router disabled", proto)
+	}
+
+	if err := router.NetNexthopDel(vrf, netAddr, nexthop); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipNetNexthopCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := ""
+	netAddr := f[3]
+	nexthopStr := f[5]
+	metricStr := f[7]
+
+	nexthop := net.ParseIP(nexthopStr)
+	if nexthop == nil {
+		return fmt.Errorf("applyRipNetNexthopCost: bad address: '%s'", nexthopStr)
+	}
+
+	metric, err1 := strconv.Atoi(metricStr)
+	if err1 != nil {
+		return fmt.Errorf("applyRipNetNexthopCost: bad metric: '%s': %v", metricStr, err1)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipNetNexthopCost: %s router disabled", proto)
+	}
+
+	if err := router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+func applyRipVrfNetNexthopCost(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	vrf := f[3]
+	netAddr := f[5]
+	nexthopStr := f[7]
+	metricStr := f[9]
+
+	nexthop := net.ParseIP(nexthopStr)
+	if nexthop == nil {
+		return fmt.Errorf("applyRipVrfNetNexthopCost: bad address: '%s'", nexthopStr)
+	}
+
+	metric, err1 := strconv.Atoi(metricStr)
+	if err1 != nil {
+		return fmt.Errorf("applyRipVrfNetNexthopCost: bad metric: '%s': %v", metricStr, err1)
+	}
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.NetMetricAdd(vrf, netAddr, nexthop, metric)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipVrfNetNexthopCost: %s router disabled", proto)
+	}
+
+	if err := router.NetMetricDel(vrf, netAddr, nexthop, metric); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
+}
+
+// ripRouter(): running router for proto "rip" (RIPv2) or "ripng"
+func ripRouter(rip *Rip, proto string) *RipRouter {
+	if proto == "ripng" {
+		return rip.ripng
+	}
+	return rip.router
+}
+
+// protoUnspecified(): default nexthop for proto "rip" (RIPv2) or "ripng"
+func protoUnspecified(proto string) net.IP {
+	if proto == "ripng" {
+		return net.IPv6unspecified
+	}
+	return net.IPv4zero
+}
+
+func enableRip(rip *Rip, proto string, enable bool) *RipRouter {
+
+	router := &rip.router
+	if proto == "ripng" {
+		router = &rip.ripng
+	}
+
+	if enable {
+		// enable RIP
+
+		if *router == nil {
+			if proto == "ripng" {
+				*router = NewRipngRouter(rip.hardware, rip.prefixLists, rip.routeMaps)
+			} else {
+				*router = NewRipRouter(rip.hardware, rip.keyChains, rip.prefixLists, rip.routeMaps)
+			}
+		}
+
+		return *router
+	}
+
+	// disable RIP
 
-	if cand, _ := rip.ConfRootCandidate().Get("router rip"); cand != nil {
-		return // router rip still in place
+	if cand, _ := rip.ConfRootCandidate().Get("router " + proto); cand != nil {
+		return *router // router still in place
 	}
 
-	//log.Printf("enableRip: disabling RIP")
+	//log.Printf("enableRip: disabling %s", proto)
 
-	if rip.router == nil {
-		return // rip not running
+	if *router == nil {
+		return nil // rip not running
 	}
 
 	// fully disable RIP
 
-	rip.router.done <- 1 // request end of rip goroutine
-	rip.router = nil
+	(*router).stop() // request end of rip goroutine
+	*router = nil
+
+	return nil
+}
+
+func applyRipSummaryAddress(ctx command.ConfContext, node *command.CmdNode, action command.CommitAction, c command.CmdClient) error {
+
+	rip := ripCtx(ctx, c)
+	if rip == nil {
+		return nil
+	}
+
+	// router rip interface IFNAME summary-address NETWORK
+	f := strings.Fields(action.Cmd)
+	proto := f[1]
+	ifname := f[3]
+	netAddr := f[5]
+
+	if action.Enable {
+		router := enableRip(rip, proto, true) // try to enable rip
+		return router.SummaryAddressAdd(ifname, netAddr)
+	}
+
+	router := ripRouter(rip, proto)
+	if router == nil {
+		return fmt.Errorf("applyRipSummaryAddress: %s router disabled", proto)
+	}
+
+	if err := router.SummaryAddressDel(ifname, netAddr); err != nil {
+		return err
+	}
+
+	enableRip(rip, proto, false) // disable rip if needed
+
+	return nil
 }
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/udhos/nexthop/addr"
 	"github.com/udhos/nexthop/command"
 	"github.com/udhos/nexthop/fwd"
 )
@@ -352,3 +356,1228 @@ func setup_diff() (*ripTestApp, *ripTestClient) {
 func cmdUsername(ctx command.ConfContext, node *command.CmdNode, line string, c command.CmdClient) {
 	command.SetSimple(ctx, c, node.Path, line)
 }
+
+func TestAdvertisedNexthop(t *testing.T) {
+	_, n1, _ := net.ParseCIDR("10.0.0.1/24")
+	ifaceAddrs := []net.IPNet{*n1}
+
+	wantNexthop(t, ripAdvertisedNexthop(net.ParseIP("10.0.0.2"), ifaceAddrs), "10.0.0.2")
+	wantNexthop(t, ripAdvertisedNexthop(net.ParseIP("10.0.1.2"), ifaceAddrs), "0.0.0.0")
+	wantNexthop(t, ripAdvertisedNexthop(net.IPv4zero, ifaceAddrs), "0.0.0.0")
+	wantNexthop(t, ripAdvertisedNexthop(net.ParseIP("10.0.0.2"), nil), "0.0.0.0")
+}
+
+func wantNexthop(t *testing.T, got net.IP, want string) {
+	if !got.Equal(net.ParseIP(want)) {
+		t.Errorf("bad advertised nexthop: want=%s got=%v", want, got)
+	}
+}
+
+func TestSplitHorizon(t *testing.T) {
+	local := &ripRoute{metric: 1}
+	learnt := &ripRoute{metric: 3, srcExternal: true, srcIfIndex: 2}
+
+	wantSplitHorizon(t, local, 2, RIP_SPLIT_HORIZON, 1, true)
+	wantSplitHorizon(t, learnt, 1, RIP_SPLIT_HORIZON, 3, true)
+	wantSplitHorizon(t, learnt, 2, RIP_SPLIT_HORIZON, 3, false)
+	wantSplitHorizon(t, learnt, 2, RIP_SPLIT_HORIZON_POISONED_REVERSE, RIP_METRIC_INFINITY, true)
+	wantSplitHorizon(t, learnt, 2, RIP_SPLIT_HORIZON_DISABLE, 3, true)
+}
+
+func wantSplitHorizon(t *testing.T, route *ripRoute, ifindex, mode, wantMetric int, wantSend bool) {
+	metric, send := ripSplitHorizonMetric(route, ifindex, mode)
+	if metric != wantMetric || send != wantSend {
+		t.Errorf("bad split horizon: route=%v ifindex=%d mode=%d: want metric=%d send=%v got metric=%d send=%v",
+			route, ifindex, mode, wantMetric, wantSend, metric, send)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	chains := newRipKeyChains()
+	chains.keyUpdate("chain1", 1, func(k *ripKey) { k.secret = "secret1" })
+	chains.keyUpdate("chain2", 7, func(k *ripKey) {
+		k.secret = "a-rather-long-secret-for-hmac-sha-256-with-more-than-32-octets"
+		k.algorithm = ripAuthAlgorithmFind("hmac-sha-256")
+	})
+
+	now := time.Now()
+
+	for _, auth := range []ripAuth{{RIP_AUTH_TEXT, "chain1"}, {RIP_AUTH_CRYPTO, "chain1"}, {RIP_AUTH_CRYPTO, "chain2"}} {
+
+		// header + auth entry + 2 routes
+		buf := make([]byte, ripEntryOffset(3))
+		buf[0] = RIP_RESPONSE
+		buf[1] = RIP_V2
+		_, n, _ := net.ParseCIDR("10.0.0.0/8")
+		setEntry(buf, 1, RIP_FAMILY_INET, 0, *n, net.IPv4zero, 1)
+		setEntry(buf, 2, RIP_FAMILY_INET, 0, *n, net.IPv4zero, 2)
+
+		pkt := ripAuthSign(buf, auth, chains.sendKey(auth.keyChain, now), 42)
+
+		info, seq, err := ripAuthCheck(pkt, RIP_V2, auth, chains, now)
+		if err != nil {
+			t.Errorf("auth=%v: unexpected failure: %v", auth, err)
+			continue
+		}
+		if len(info) != ripEntryOffset(2) {
+			t.Errorf("auth=%v: bad stripped size: want=%d got=%d", auth, ripEntryOffset(2), len(info))
+		}
+		if _, _, _, _, metric := parseEntry(info, 1); metric != 2 {
+			t.Errorf("auth=%v: bad stripped entry: metric want=2 got=%d", auth, metric)
+		}
+		if auth.mode == RIP_AUTH_CRYPTO && seq != 42 {
+			t.Errorf("auth=%v: bad sequence: want=42 got=%d", auth, seq)
+		}
+
+		if _, _, err := ripAuthCheck(pkt, RIP_V2, ripAuth{}, chains, now); err == nil {
+			t.Errorf("auth=%v: authenticated packet accepted on interface without authentication", auth)
+		}
+
+		pkt[ripEntryOffset(2)+19]++ // tamper with metric
+		if auth.mode == RIP_AUTH_TEXT {
+			pkt[ripEntryOffset(0)+4]++ // tamper with password
+		}
+		if _, _, err := ripAuthCheck(pkt, RIP_V2, auth, chains, now); err == nil {
+			t.Errorf("auth=%v: tampered packet accepted", auth)
+		}
+	}
+
+	// unauthenticated packet on interface with authentication
+	buf := make([]byte, ripEntryOffset(1))
+	buf[0] = RIP_RESPONSE
+	buf[1] = RIP_V2
+	if _, _, err := ripAuthCheck(buf, RIP_V2, ripAuth{RIP_AUTH_CRYPTO, "chain1"}, chains, now); err == nil {
+		t.Errorf("unauthenticated packet accepted")
+	}
+}
+
+func TestKeyLifetime(t *testing.T) {
+	chains := newRipKeyChains()
+	now := time.Now()
+	chains.keyUpdate("c", 1, func(k *ripKey) {
+		k.secret = "old"
+		k.sendEnd = now.Add(-time.Hour)
+	})
+	chains.keyUpdate("c", 2, func(k *ripKey) {
+		k.secret = "current"
+		k.sendStart = now.Add(-time.Minute)
+	})
+	chains.keyUpdate("c", 3, func(k *ripKey) {
+		k.secret = "future"
+		k.sendStart = now.Add(time.Hour)
+		k.acceptStart = now.Add(time.Hour)
+	})
+
+	if k := chains.sendKey("c", now); k == nil || k.id != 2 {
+		t.Errorf("bad send key: want=2 got=%v", k)
+	}
+	if k := chains.acceptKey("c", 1, now); k == nil {
+		t.Errorf("key 1 should be accepted")
+	}
+	if k := chains.acceptKey("c", 3, now); k != nil {
+		t.Errorf("key 3 should not be accepted yet")
+	}
+}
+
+func TestRipngEntry(t *testing.T) {
+	buf := make([]byte, ripEntryOffset(2))
+	prefix := net.ParseIP("2001:db8:1::")
+
+	setEntry6(buf, 0, net.ParseIP("fe80::1"), 0, 0, RIPNG_METRIC_NEXTHOP)
+	setEntry6(buf, 1, prefix, 7, 48, 3)
+
+	nh, _, _, nhMetric := parseEntry6(buf, 0)
+	if !nh.Equal(net.ParseIP("fe80::1")) || nhMetric != RIPNG_METRIC_NEXTHOP {
+		t.Errorf("next hop entry: got %v metric=%d", nh, nhMetric)
+	}
+
+	p, tag, plen, metric := parseEntry6(buf, 1)
+	if !p.Equal(prefix) || tag != 7 || plen != 48 || metric != 3 {
+		t.Errorf("route entry: got %v tag=%d plen=%d metric=%d", p, tag, plen, metric)
+	}
+
+	if max := ripngMaxEntries(1500); max != 72 {
+		t.Errorf("max entries for mtu 1500: want=72 got=%d", max)
+	}
+	if max := ripngMaxEntries(0); max != ripngMaxEntries(RIPNG_MTU_MIN) {
+		t.Errorf("max entries for unknown mtu: got=%d", max)
+	}
+
+	route := &ripRoute{nexthop: net.ParseIP("fe80::2"), srcExternal: true, srcIfIndex: 2}
+	wantNexthop(t, ripngAdvertisedNexthop(route, 2), "fe80::2")
+	wantNexthop(t, ripngAdvertisedNexthop(route, 3), "::")
+}
+
+func TestRipngHopLimit(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	hw.InterfaceAddressAdd("eth0", "fe80::1/64")
+	r := &RipRouter{family: RIP_FAMILY_INET6, hardware: hw}
+	r.vrfAdd("")
+	ifi := &net.Interface{Index: 1, Name: "eth0", MTU: 1500}
+	r.ports = []*port{{iface: ifi}}
+	_, n, _ := net.ParseCIDR("2001:db8:1::/48")
+
+	buf := make([]byte, ripEntryOffset(1))
+	buf[0] = RIP_RESPONSE
+	buf[1] = RIPNG_VERSION
+	setEntry6(buf, 0, n.IP, 0, 48, 1)
+	src := net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: RIPNG_PORT}
+
+	parseRipngPacket(r, &udpInfo{info: buf, src: src, ifIndex: 1, ifName: "eth0", hopLimit: 254})
+	if s := r.getStats("eth0"); s.badPackets != 1 {
+		t.Errorf("hop limit: want response with hop limit 254 rejected, got %+v", s)
+	}
+	if route, _ := r.lookupAddressFirstMatch("", *n); route != nil {
+		t.Errorf("hop limit: route learned from forwarded response: %v", route)
+	}
+
+	parseRipngPacket(r, &udpInfo{info: buf, src: src, ifIndex: 1, ifName: "eth0", hopLimit: RIPNG_HOP_LIMIT})
+	if route, _ := r.lookupAddressFirstMatch("", *n); route == nil {
+		t.Errorf("hop limit: route not learned from neighbor response")
+	}
+}
+
+func TestFibInstall(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := &RipRouter{family: RIP_FAMILY_INET, hardware: hw}
+	r.vrfAdd("")
+	_, n, _ := net.ParseCIDR("10.1.0.0/16")
+	nh1 := net.ParseIP("10.0.0.1")
+	nh2 := net.ParseIP("10.0.0.2")
+
+	r.extRouteAdd("", 0, *n, nh1, 5, 1, "eth0", nh1)
+	wantFib(t, hw, n, 5, nh1)
+
+	r.extRouteAdd("", 0, *n, nh1, 7, 1, "eth0", nh1) // metric change
+	wantFib(t, hw, n, 7, nh1)
+
+	r.extRouteAdd("", 0, *n, nh2, 3, 1, "eth0", nh2) // better nexthop replaces
+	wantFib(t, hw, n, 3, nh2)
+
+	r.fibFlush()
+	if _, routes, _ := hw.RouteList(fwd.FAMILY_INET, fwd.PROTO_RIP); len(routes) != 0 {
+		t.Errorf("fib flush: routes left: %v", routes)
+	}
+
+	// stale route from previous instance
+	hw.RouteReplace("", fwd.Route{Prefix: *n, Nexthops: []fwd.Nexthop{{Gw: nh1}}, Protocol: fwd.PROTO_RIP})
+	r2 := &RipRouter{family: RIP_FAMILY_INET, hardware: hw}
+	r2.fibReconcile()
+	if _, routes, _ := hw.RouteList(fwd.FAMILY_INET, fwd.PROTO_RIP); len(routes) != 0 {
+		t.Errorf("fib reconcile: stale routes left: %v", routes)
+	}
+}
+
+func wantFib(t *testing.T, hw fwd.Dataplane, prefix *net.IPNet, metric int, nexthop net.IP) {
+	_, routes, err := hw.RouteList(fwd.FAMILY_INET, fwd.PROTO_RIP)
+	if err != nil {
+		t.Errorf("fib: %v", err)
+		return
+	}
+	if len(routes) != 1 {
+		t.Errorf("fib: want 1 route, got %d: %v", len(routes), routes)
+		return
+	}
+	got := routes[0]
+	if got.Metric != metric || len(got.Nexthops) != 1 || !got.Nexthops[0].Gw.Equal(nexthop) || !addr.NetEqual(&got.Prefix, prefix) {
+		t.Errorf("fib: want %v metric=%d nexthop=%v, got %v", prefix, metric, nexthop, got)
+	}
+}
+
+func TestPassiveNeighbor(t *testing.T) {
+	r := &RipRouter{family: RIP_FAMILY_INET, config: map[string]*ripInterfaceConfig{}}
+	nbr := net.ParseIP("10.0.0.2")
+	u := &udpInfo{src: net.UDPAddr{IP: net.ParseIP("10.0.0.3"), Port: RIP_PORT}, ifName: "eth0"}
+
+	if !r.requestAccept(u) {
+		t.Errorf("request should be accepted on non-passive interface")
+	}
+
+	r.setInterfacePassive("eth0", true)
+	if r.requestAccept(u) {
+		t.Errorf("request from non-neighbor should be ignored on passive interface")
+	}
+
+	if err := r.NeighborAdd(nbr); err != nil {
+		t.Errorf("neighbor add: %v", err)
+	}
+	if err := r.NeighborAdd(net.ParseIP("fe80::1")); err == nil {
+		t.Errorf("neighbor add should reject IPv6 address for RIPv2")
+	}
+	u.src.IP = nbr
+	if !r.requestAccept(u) {
+		t.Errorf("request from neighbor should be accepted on passive interface")
+	}
+
+	if err := r.NeighborDel(nbr); err != nil {
+		t.Errorf("neighbor del: %v", err)
+	}
+	if r.isNeighbor(nbr) {
+		t.Errorf("neighbor not removed")
+	}
+}
+
+func TestUDPTransportUnicast(t *testing.T) {
+	testUDPTransportUnicast(t, RIP_FAMILY_INET, RIP_PORT, net.IPv4(224, 0, 0, 9), net.IPv4(127, 0, 0, 1))
+}
+
+func TestUDPTransportUnicast6(t *testing.T) {
+	testUDPTransportUnicast(t, RIP_FAMILY_INET6, RIPNG_PORT, net.ParseIP("ff02::9"), net.IPv6loopback)
+}
+
+// testUDPTransportUnicast(): unicast request and response must get through
+// after the transport has already sent multicast updates.
+// The well-known port is used, since any other socket bound to it could steal unicast.
+func testUDPTransportUnicast(t *testing.T, family, udpPort int, group, local net.IP) {
+	lo, errIf := net.InterfaceByName("lo")
+	if errIf != nil {
+		t.Skipf("loopback interface: %v", errIf)
+	}
+
+	tr, errOpen := newRipUDPTransport(family, udpPort, group, lo)
+	if errOpen != nil {
+		t.Skipf("transport on loopback: %v", errOpen)
+	}
+	input := make(chan *udpInfo, 10)
+	readerDone := make(chan int)
+	tr.start(input, readerDone)
+	defer func() {
+		tr.close()
+		<-readerDone
+	}()
+
+	// periodic update: loopback may not route IPv6 multicast, then only the attempt matters
+	if err := tr.send(&net.UDPAddr{IP: group, Port: udpPort}, []byte{RIP_RESPONSE, 0, 0, 0}); err != nil {
+		t.Logf("multicast send: %v", err)
+	}
+
+	client, errClient := net.ListenUDP("udp", &net.UDPAddr{IP: local})
+	if errClient != nil {
+		t.Fatalf("client socket: %v", errClient)
+	}
+	defer client.Close()
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+
+	if _, err := client.WriteToUDP([]byte{RIP_REQUEST, 0, 0, 0}, &net.UDPAddr{IP: local, Port: udpPort}); err != nil {
+		t.Fatalf("client request: %v", err)
+	}
+
+	var request *udpInfo
+	timeout := time.After(5 * time.Second)
+	for request == nil {
+		select {
+		case u := <-input:
+			if u.src.Port == clientAddr.Port {
+				request = u
+			}
+		case <-timeout:
+			t.Fatalf("unicast request not received by transport")
+		}
+	}
+
+	if err := tr.send(&request.src, []byte{RIP_RESPONSE, 0, 0, 0}); err != nil {
+		t.Fatalf("unicast response: %v", err)
+	}
+
+	buf := make([]byte, 100)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, src, errRead := client.ReadFromUDP(buf)
+	if errRead != nil {
+		t.Fatalf("unicast response not received by client: %v", errRead)
+	}
+	if n != 4 || buf[0] != RIP_RESPONSE || src.Port != udpPort {
+		t.Errorf("unicast response: got size=%d cmd=%d from %v", n, buf[0], src)
+	}
+}
+
+func TestPrefixList(t *testing.T) {
+	lists := newRipPrefixLists()
+	_, n8, _ := net.ParseCIDR("10.0.0.0/8")
+	_, n16, _ := net.ParseCIDR("192.168.0.0/16")
+
+	lists.entrySet("CUST", &ripPrefixListEntry{seq: 10, permit: false, prefix: *n16, le: 32})
+	lists.entrySet("CUST", &ripPrefixListEntry{seq: 5, permit: true, prefix: *n8, ge: 16, le: 24})
+	lists.entrySet("CUST", &ripPrefixListEntry{seq: 20, permit: true, prefix: *n8})
+
+	wantPermit(t, lists, "CUST", "10.0.0.0/8", true)         // seq 20 exact
+	wantPermit(t, lists, "CUST", "10.1.0.0/16", true)        // seq 5 ge
+	wantPermit(t, lists, "CUST", "10.1.2.0/24", true)        // seq 5 le
+	wantPermit(t, lists, "CUST", "10.1.2.128/25", false)     // beyond le: implicit deny
+	wantPermit(t, lists, "CUST", "192.168.1.0/24", false)    // seq 10
+	wantPermit(t, lists, "CUST", "172.16.0.0/12", false)     // implicit deny
+	wantPermit(t, lists, "UNDEFINED", "172.16.0.0/12", true) // undefined list permits
+
+	lists.entrySet("CUST", &ripPrefixListEntry{seq: 10, permit: true, prefix: *n16, le: 32}) // replace
+	wantPermit(t, lists, "CUST", "192.168.1.0/24", true)
+
+	if err := lists.entryDel("CUST", 10); err != nil {
+		t.Errorf("entryDel: %v", err)
+	}
+	wantPermit(t, lists, "CUST", "192.168.1.0/24", false)
+
+	r := &RipRouter{distLists: map[ripFilterKey][]string{}, prefixLists: lists}
+	r.DistributeListAdd(RIP_FILTER_OUT, "eth1", "CUST")
+	_, p, _ := net.ParseCIDR("172.16.0.0/12")
+	if !r.filterPermit(RIP_FILTER_OUT, "eth0", p) {
+		t.Errorf("distribute-list for eth1 should not filter eth0")
+	}
+	if r.filterPermit(RIP_FILTER_OUT, "eth1", p) {
+		t.Errorf("distribute-list for eth1 should filter %v", p)
+	}
+	if !r.filterPermit(RIP_FILTER_IN, "eth1", p) {
+		t.Errorf("distribute-list out should not filter received routes")
+	}
+}
+
+func wantPermit(t *testing.T, lists *ripPrefixLists, name, prefix string, want bool) {
+	_, p, _ := net.ParseCIDR(prefix)
+	if got := lists.permit(name, p); got != want {
+		t.Errorf("prefix-list %s: %s: want=%v got=%v", name, prefix, want, got)
+	}
+}
+
+func TestOffsetList(t *testing.T) {
+	lists := newRipPrefixLists()
+	_, n8, _ := net.ParseCIDR("10.0.0.0/8")
+	lists.entrySet("TEN", &ripPrefixListEntry{seq: 5, permit: true, prefix: *n8, le: 32})
+
+	r := &RipRouter{offsetLists: map[ripFilterKey][]ripOffsetList{}, prefixLists: lists}
+	r.OffsetListSet(RIP_FILTER_IN, "", "TEN", 2)
+	r.OffsetListSet(RIP_FILTER_IN, "eth1", "TEN", 5)
+
+	_, p, _ := net.ParseCIDR("10.1.0.0/16")
+	_, other, _ := net.ParseCIDR("172.16.0.0/12")
+
+	wantOffset(t, r, RIP_FILTER_IN, "eth0", p, 2)     // global
+	wantOffset(t, r, RIP_FILTER_IN, "eth1", p, 5)     // interface takes precedence
+	wantOffset(t, r, RIP_FILTER_IN, "eth0", other, 0) // not matched
+	wantOffset(t, r, RIP_FILTER_OUT, "eth0", p, 0)    // other direction
+
+	r.OffsetListSet(RIP_FILTER_IN, "", "TEN", 3) // replace
+	wantOffset(t, r, RIP_FILTER_IN, "eth0", p, 3)
+
+	if err := r.OffsetListDel(RIP_FILTER_IN, "eth1", "TEN"); err != nil {
+		t.Errorf("OffsetListDel: %v", err)
+	}
+	wantOffset(t, r, RIP_FILTER_IN, "eth1", p, 3)
+}
+
+func wantOffset(t *testing.T, r *RipRouter, dir, ifname string, prefix *net.IPNet, want int) {
+	if got := r.metricOffset(dir, ifname, prefix); got != want {
+		t.Errorf("offset-list %s %s %v: want=%d got=%d", dir, ifname, prefix, want, got)
+	}
+}
+
+func TestTimers(t *testing.T) {
+	r := &RipRouter{}
+	if timers := r.getTimers(); timers != ripDefaultTimers() {
+		t.Errorf("default timers: got %v", timers)
+	}
+
+	r.SetTimers(ripTimers{update: 10 * time.Second, timeout: 60 * time.Second, gc: 40 * time.Second})
+	now := time.Now()
+	route := &ripRoute{}
+	route.resetTimer(now, r.getTimers())
+	if !route.timeout.Equal(now.Add(60*time.Second)) || !route.garbageCollection.Equal(now.Add(100*time.Second)) {
+		t.Errorf("route timers: timeout=%v gc=%v", route.timeout.Sub(now), route.garbageCollection.Sub(now))
+	}
+
+	for i := 0; i < 100; i++ {
+		if j := ripUpdateJitter(30 * time.Second); j < 25*time.Second || j > 35*time.Second {
+			t.Errorf("update jitter out of range: %v", j)
+		}
+		if h := ripTriggeredHold(); h < time.Second || h > 5*time.Second {
+			t.Errorf("triggered holddown out of range: %v", h)
+		}
+	}
+}
+
+func TestRedistribute(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := startRouter(hw)
+	defer r.stop()
+	_, static, _ := net.ParseCIDR("10.2.0.0/16")
+	_, other, _ := net.ParseCIDR("10.3.0.0/16")
+	_, defaultRoute, _ := net.ParseCIDR("0.0.0.0/0")
+
+	hw.RouteReplace("", fwd.Route{Prefix: *static, Nexthops: []fwd.Nexthop{{Gw: net.ParseIP("10.0.0.1")}}, Protocol: fwd.PROTO_STATIC})
+	hw.RouteReplace("", fwd.Route{Prefix: *other, Nexthops: []fwd.Nexthop{{Gw: net.ParseIP("10.0.0.1")}}, Protocol: fwd.PROTO_STATIC})
+
+	r.RedistributeSet(RIP_REDIST_STATIC, ripRedist{metric: 3})
+	wantLocal(t, r, static, 3)
+	wantLocal(t, r, other, 3)
+
+	// route-map: deny 10.3.0.0/16, set metric 5 on everything else
+	r.prefixLists.entrySet("OTHER", &ripPrefixListEntry{seq: 1, permit: true, prefix: *other})
+	r.routeMaps.entrySet("RM", 10, false, func(e *ripRouteMapEntry) { e.matchPrefixList = "OTHER" })
+	r.routeMaps.entrySet("RM", 20, true, func(e *ripRouteMapEntry) { e.setMetric = 5 })
+	r.RedistributeSet(RIP_REDIST_STATIC, ripRedist{routeMap: "RM"})
+	wantLocal(t, r, static, 5)
+	wantLocal(t, r, other, RIP_METRIC_INFINITY)
+
+	// source route goes away
+	hw.RouteDel("", fwd.Route{Prefix: *static, Protocol: fwd.PROTO_STATIC})
+	r.call(r.redistSync)
+	wantLocal(t, r, static, RIP_METRIC_INFINITY)
+
+	r.RedistributeSet(RIP_REDIST_DEFAULT, ripRedist{})
+	wantLocal(t, r, defaultRoute, RIP_REDIST_DEFAULT_METRIC)
+	if err := r.RedistributeDel(RIP_REDIST_DEFAULT); err != nil {
+		t.Errorf("redistribute del: %v", err)
+	}
+	if err := r.RedistributeDel(RIP_REDIST_DEFAULT); err == nil {
+		t.Errorf("redistribute del: unexpected success for disabled source")
+	}
+}
+
+// wantLocal(): best valid local route for prefix must have metric (RIP_METRIC_INFINITY: no valid route)
+func wantLocal(t *testing.T, r *RipRouter, prefix *net.IPNet, metric int) {
+	got := RIP_METRIC_INFINITY
+	r.call(func() {
+		now := r.now()
+		for _, v := range r.vrfs {
+			for _, route := range v.routes {
+				if !route.srcExternal && route.isValid(now) && addr.NetEqual(&route.addr, prefix) && route.metric < got {
+					got = route.metric
+				}
+			}
+		}
+	})
+	if got != metric {
+		t.Errorf("local route %v: want metric=%d got=%d", prefix, metric, got)
+	}
+}
+
+func TestEcmp(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := startRouter(hw)
+	defer r.stop()
+	r.SetMaximumPaths(2)
+	var v *ripVrf
+	r.call(func() { v = r.vrfAdd("") })
+	_, n, _ := net.ParseCIDR("10.1.0.0/16")
+	nh1 := net.ParseIP("10.0.0.1")
+	nh2 := net.ParseIP("10.0.0.2")
+	nh3 := net.ParseIP("10.0.0.3")
+
+	// extRouteAdd(): learn route within router goroutine
+	extRouteAdd := func(nexthop net.IP, metric int) {
+		r.call(func() { r.extRouteAdd("", 0, *n, nexthop, metric, 1, "eth0", nexthop) })
+	}
+
+	extRouteAdd(nh1, 3)
+	extRouteAdd(nh2, 3)
+	extRouteAdd(nh3, 3) // exceeds maximum-paths
+	wantFibPaths(t, hw, 3, nh1, nh2)
+
+	extRouteAdd(nh1, 5) // path got worse: leaves ECMP set
+	wantFibPaths(t, hw, 3, nh2)
+
+	extRouteAdd(nh3, 3)
+	wantFibPaths(t, hw, 3, nh2, nh3)
+
+	r.call(func() {
+		if routes, _, _ := r.advertisedRoutes(v, "eth1", 2, false); len(routes) != 1 {
+			t.Errorf("ecmp: want single advertised entry, got %d: %v", len(routes), routes)
+		}
+	})
+
+	extRouteAdd(nh3, 2) // path got better: replaces ECMP set
+	wantFibPaths(t, hw, 2, nh3)
+
+	extRouteAdd(nh1, 2)
+	r.SetMaximumPaths(1)
+	wantFibPaths(t, hw, 2, nh3)
+}
+
+func wantFibPaths(t *testing.T, hw fwd.Dataplane, metric int, nexthops ...net.IP) {
+	_, routes, err := hw.RouteList(fwd.FAMILY_INET, fwd.PROTO_RIP)
+	if err != nil || len(routes) != 1 {
+		t.Errorf("fib: want 1 route, got %v: %v", routes, err)
+		return
+	}
+	got := routes[0]
+	if got.Metric != metric || len(got.Nexthops) != len(nexthops) {
+		t.Errorf("fib: want metric=%d nexthops=%v, got %v", metric, nexthops, got)
+		return
+	}
+	for i, nh := range nexthops {
+		if !got.Nexthops[i].Gw.Equal(nh) {
+			t.Errorf("fib: want metric=%d nexthops=%v, got %v", metric, nexthops, got)
+			return
+		}
+	}
+}
+
+func TestRouteTags(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := startRouter(hw)
+	defer r.stop()
+	_, n, _ := net.ParseCIDR("10.1.0.0/16")
+
+	// suppress routes leaked from another domain
+	r.routeMaps.entrySet("BOUNDARY", 10, false, func(e *ripRouteMapEntry) { e.matchTag = 100 })
+	r.routeMaps.entrySet("BOUNDARY", 20, true, nil)
+	r.RouteMapPolicyAdd(RIP_FILTER_IN, "", "BOUNDARY")
+	if permit, _ := r.policyApply(RIP_FILTER_IN, "eth0", n, ripRouteAttr{metric: 1, tag: 100}); permit {
+		t.Errorf("route tag 100: unexpected permit")
+	}
+	if permit, attr := r.policyApply(RIP_FILTER_IN, "eth0", n, ripRouteAttr{metric: 1, tag: 5}); !permit || attr.tag != 5 {
+		t.Errorf("route tag 5: permit=%v attr=%v", permit, attr)
+	}
+
+	// local network tag
+	if err := r.NetTagAdd("", "10.1.0.0/16", 7); err != nil {
+		t.Errorf("network tag: %v", err)
+	}
+	// advertisedTags(): tags sent on interface, computed within router goroutine
+	advertisedTags := func(ifname string, ifindex int) (routes []*ripRoute, tags []uint16) {
+		r.call(func() {
+			_, v := r.vrfGet("")
+			routes, _, tags = r.advertisedRoutes(v, ifname, ifindex, false)
+		})
+		return
+	}
+	if routes, tags := advertisedTags("eth0", 1); len(routes) != 1 || tags[0] != 7 {
+		t.Errorf("network tag: want tag 7, got %v", tags)
+	}
+
+	// mark routes sent to another domain
+	r.routeMaps.entrySet("MARK", 10, true, func(e *ripRouteMapEntry) { e.setTag = 100 })
+	r.RouteMapPolicyAdd(RIP_FILTER_OUT, "eth0", "MARK")
+	if _, tags := advertisedTags("eth0", 1); len(tags) != 1 || tags[0] != 100 {
+		t.Errorf("set tag: want tag 100, got %v", tags)
+	}
+	if _, tags := advertisedTags("eth1", 2); len(tags) != 1 || tags[0] != 7 {
+		t.Errorf("set tag on other interface: want tag 7, got %v", tags)
+	}
+
+	if err := r.NetTagDel("", "10.1.0.0/16", 7); err != nil {
+		t.Errorf("network tag del: %v", err)
+	}
+	if _, tags := advertisedTags("eth1", 2); len(tags) != 1 || tags[0] != 0 {
+		t.Errorf("network tag del: want tag 0, got %v", tags)
+	}
+}
+
+func TestSummaryAddress(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := &RipRouter{family: RIP_FAMILY_INET, hardware: hw, config: map[string]*ripInterfaceConfig{}}
+	v := r.vrfAdd("")
+	_, n1, _ := net.ParseCIDR("10.1.1.0/24")
+	_, n2, _ := net.ParseCIDR("10.1.2.0/24")
+	_, n3, _ := net.ParseCIDR("192.168.0.0/24")
+	nh := net.ParseIP("10.0.0.1")
+
+	r.extRouteAdd("", 0, *n1, nh, 3, 1, "eth0", nh)
+	r.extRouteAdd("", 0, *n2, nh, 2, 1, "eth0", nh)
+	r.extRouteAdd("", 0, *n3, nh, 4, 1, "eth0", nh)
+
+	if err := r.SummaryAddressAdd("eth1", "10.1.0.0/16"); err != nil {
+		t.Errorf("summary-address: %v", err)
+	}
+	if err := r.SummaryAddressAdd("eth1", "2001:db8::/32"); err == nil {
+		t.Errorf("summary-address: unexpected success for address family mismatch")
+	}
+
+	routes, metrics, _ := r.advertisedRoutes(v, "eth1", 2, false)
+	if len(routes) != 2 || routes[0].addr.String() != "10.1.0.0/16" || metrics[0] != 2 || routes[1].addr.String() != n3.String() {
+		t.Errorf("summary-address: want aggregate 10.1.0.0/16 metric 2 plus %v, got %v %v", n3, routes, metrics)
+	}
+
+	if routes, _, _ := r.advertisedRoutes(v, "eth2", 2, false); len(routes) != 3 {
+		t.Errorf("summary-address: want components on other interface, got %v", routes)
+	}
+
+	if err := r.SummaryAddressDel("eth1", "10.1.0.0/16"); err != nil {
+		t.Errorf("summary-address: %v", err)
+	}
+	if routes, _, _ := r.advertisedRoutes(v, "eth1", 2, false); len(routes) != 3 {
+		t.Errorf("summary-address: want components after removal, got %v", routes)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := &RipRouter{family: RIP_FAMILY_INET, hardware: hw}
+	r.vrfAdd("")
+	src := net.ParseIP("10.0.0.1")
+	_, n, _ := net.ParseCIDR("10.1.0.0/16")
+
+	parseRipPacket(r, &udpInfo{info: []byte{RIP_RESPONSE, RIP_V2}, src: net.UDPAddr{IP: src, Port: RIP_PORT}, ifName: "eth0"})
+	if s := r.getStats("eth0"); s.packetsRecv != 1 || s.badPackets != 1 {
+		t.Errorf("statistics: want 1 bad packet received, got %+v", s)
+	}
+
+	r.peerHeard(src, "eth0", RIP_V2, time.Now())
+	r.peerHeard(src, "eth0", RIP_V2, time.Now())
+	r.extRouteAdd("", 0, *n, src, 2, 1, "eth0", src)
+	if len(r.peers) != 1 || r.peerRoutes(r.peers[0]) != 1 {
+		t.Errorf("statistics: want single neighbor with 1 route, got %v", r.peers)
+	}
+
+	r.statsSent("eth1", 3)
+	if s := r.getStats("eth1"); s.packetsSent != 1 || s.routesSent != 3 {
+		t.Errorf("statistics: want 1 packet with 3 routes sent, got %+v", s)
+	}
+}
+
+func TestClear(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := startRouter(hw)
+	defer r.stop()
+	_, n1, _ := net.ParseCIDR("10.1.0.0/16")
+	_, n2, _ := net.ParseCIDR("10.2.0.0/16")
+	nh1 := net.ParseIP("10.0.0.1")
+	nh2 := net.ParseIP("10.0.0.2")
+
+	r.call(func() {
+		r.vrfAdd("")
+		r.extRouteAdd("", 0, *n1, nh1, 2, 1, "eth0", nh1)
+		r.extRouteAdd("", 0, *n2, nh2, 2, 1, "eth0", nh2)
+		r.peerHeard(nh1, "eth0", RIP_V2, r.now())
+	})
+
+	expired := r.ClearNeighbor(nh1)
+	var peers int
+	r.call(func() { peers = len(r.peers) })
+	if expired != 1 || peers != 0 {
+		t.Errorf("clear neighbor: want 1 route expired and neighbor forgotten, got %d %d", expired, peers)
+	}
+	wantFib(t, hw, n2, 2, nh2)
+
+	if _, err := r.ClearRoutes("red", nil); err == nil {
+		t.Errorf("clear routes: unexpected success for unknown VRF")
+	}
+	if flushed, _ := r.ClearRoutes("", n2); flushed != 1 {
+		t.Errorf("clear routes: want 1 route flushed, got %d", flushed)
+	}
+	if flushed, _ := r.ClearRoutes("", nil); flushed != 1 {
+		t.Errorf("clear routes: want expired route flushed, got %d", flushed)
+	}
+	if _, routes, _ := hw.RouteList(fwd.FAMILY_INET, fwd.PROTO_RIP); len(routes) != 0 {
+		t.Errorf("clear routes: want empty FIB, got %v", routes)
+	}
+
+	r.call(func() { r.statsSent("eth0", 1) })
+	r.ClearStatistics()
+	var s ripStats
+	r.call(func() { s = r.getStats("eth0") })
+	if s.packetsSent != 0 {
+		t.Errorf("clear statistics: want zero counters, got %+v", s)
+	}
+}
+
+type ripDiscard struct{}
+
+func (d ripDiscard) Sendln(msg string) int { return len(msg) }
+
+func TestConcurrentAccess(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := allocRouter(RIP_FAMILY_INET, RIP_PORT, net.IPv4(224, 0, 0, 9), hw, newRipKeyChains(), newRipPrefixLists(), newRipRouteMaps(), ripSystemClock{})
+	go r.run()
+
+	nh := net.ParseIP("10.0.0.1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			prefix := fmt.Sprintf("10.%d.0.0/16", i)
+			for j := 0; j < 50; j++ {
+				if err := r.NetAdd("", prefix); err != nil {
+					t.Errorf("concurrent: %v", err)
+				}
+				r.NetTagAdd("", prefix, 100)
+				r.SetMaximumPaths(j % 3)
+				r.RedistributeSet(RIP_REDIST_DEFAULT, ripRedist{})
+				r.ShowRoutes(ripDiscard{})
+				r.ShowNeighbors(ripDiscard{})
+				r.ClearNeighbor(nh)
+				r.ClearRoutes("", nil)
+				r.RedistributeDel(RIP_REDIST_DEFAULT)
+				r.NetTagDel("", prefix, 100)
+				if err := r.NetDel("", prefix); err != nil {
+					t.Errorf("concurrent: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	r.call(func() {
+		if len(r.vrfs) != 0 {
+			t.Errorf("concurrent: want empty routing table, got %d vrfs", len(r.vrfs))
+		}
+	})
+
+	r.stop()
+}
+
+/*
+startRouter(): router with running goroutine driven by simulated clock.
+Timers never fire since the clock is not advanced.
+*/
+func startRouter(hw fwd.Dataplane) *RipRouter {
+	clock := &simClock{now: time.Unix(1000000000, 0)}
+	r := allocRouter(RIP_FAMILY_INET, RIP_PORT, net.IPv4(224, 0, 0, 9), hw, newRipKeyChains(), newRipPrefixLists(), newRipRouteMaps(), clock)
+	go r.run()
+	r.call(func() {}) // wait for goroutine to set up its timers
+	return r
+}
+
+// ripCallRequest: run test code within RipRouter goroutine
+type ripCallRequest func()
+
+func (op ripCallRequest) serve(r *RipRouter) {
+	op()
+}
+
+// call(): run op within RipRouter goroutine, which owns router state, then wait for its completion
+func (r *RipRouter) call(op func()) {
+	r.request(ripCallRequest(op))
+}
+
+func TestRouterExit(t *testing.T) {
+	s := newRipSim()
+	r := s.router("eth0", "12")
+	go r.run()
+
+	s.ports[0].close() // last reader goroutine finishes: router goroutine exits
+	<-r.finished
+
+	ran := false
+	r.call(func() { ran = true })
+	if ran {
+		t.Errorf("router exit: call ran after router goroutine finished")
+	}
+	r.stop() // must not block
+}
+
+// simClock: simulated time, advanced explicitly by ripSim
+type simClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*simTimer
+}
+
+type simTimer struct {
+	clock    *simClock
+	c        chan time.Time // unbuffered: firing returns once router goroutine picked the event
+	deadline time.Time
+	active   bool
+}
+
+func (c *simClock) Now() time.Time {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	return c.now
+}
+
+func (c *simClock) NewTimer(d time.Duration) ripTimer {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	t := &simTimer{clock: c, c: make(chan time.Time), deadline: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *simTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *simTimer) Stop() bool {
+	defer t.clock.mutex.Unlock()
+	t.clock.mutex.Lock()
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func (t *simTimer) Reset(d time.Duration) bool {
+	defer t.clock.mutex.Unlock()
+	t.clock.mutex.Lock()
+	wasActive := t.active
+	t.deadline = t.clock.now.Add(d)
+	t.active = true
+	return wasActive
+}
+
+// simPort: ripTransport attached to a link of the in-memory network
+type simPort struct {
+	sim    *ripSim
+	router *RipRouter
+	ifi    *net.Interface
+	addr   net.IP
+	link   string
+	queue  chan *udpInfo
+}
+
+func (p *simPort) start(input chan<- *udpInfo, readerDone chan<- int) {
+	go func() {
+		for u := range p.queue {
+			input <- u
+			p.router.call(func() {}) // wait for packet processing
+			p.sim.inflight.Done()
+		}
+		readerDone <- 1
+	}()
+}
+
+func (p *simPort) send(dst *net.UDPAddr, buf []byte) error {
+	p.sim.mutex.Lock()
+	defer p.sim.mutex.Unlock()
+	if p.sim.loss[p.link] || p.sim.loss[p.addr.String()] {
+		return nil // lost on the wire
+	}
+	for _, q := range p.sim.ports {
+		if q == p || q.link != p.link || !(dst.IP.IsMulticast() || dst.IP.Equal(net.IPv4bcast) || dst.IP.Equal(q.addr)) {
+			continue
+		}
+		p.sim.inflight.Add(1)
+		q.queue <- &udpInfo{info: append([]byte{}, buf...), src: net.UDPAddr{IP: p.addr, Port: RIP_PORT}, dst: *dst, ifIndex: q.ifi.Index, ifName: q.ifi.Name}
+	}
+	return nil
+}
+
+func (p *simPort) close() {
+	close(p.queue)
+}
+
+// ripSim: RIP routers wired by in-memory links, driven by simulated clock
+type ripSim struct {
+	clock    *simClock
+	routers  []*RipRouter
+	mutex    sync.Mutex
+	ports    []*simPort
+	loss     map[string]bool // link or sender address => drop packets
+	inflight sync.WaitGroup  // packets not yet processed by receiving router
+}
+
+func newRipSim() *ripSim {
+	return &ripSim{clock: &simClock{now: time.Unix(1000000000, 0)}, loss: map[string]bool{}}
+}
+
+// router(): create router with interfaces given as pairs ifname, link, ifname, link...
+// Interface address on link L is 10.0.L.N/24, where N is the router number.
+func (s *ripSim) router(attach ...string) *RipRouter {
+	hw := fwd.NewDataplaneBogus()
+	r := allocRouter(RIP_FAMILY_INET, RIP_PORT, net.IPv4(224, 0, 0, 9), hw, newRipKeyChains(), newRipPrefixLists(), newRipRouteMaps(), s.clock)
+	s.routers = append(s.routers, r)
+	for i := 0; i < len(attach); i += 2 {
+		ifname, link := attach[i], attach[i+1]
+		a := fmt.Sprintf("10.0.%s.%d", link, len(s.routers))
+		hw.InterfaceAddressAdd(ifname, a+"/24")
+		p := &simPort{sim: s, router: r, ifi: &net.Interface{Index: i/2 + 1, Name: ifname}, addr: net.ParseIP(a), link: link, queue: make(chan *udpInfo, 1000)}
+		s.ports = append(s.ports, p)
+		r.portAdd(p.ifi, p)
+	}
+	return r
+}
+
+func (s *ripSim) start() {
+	for _, r := range s.routers {
+		go r.run()
+	}
+	for _, p := range s.ports {
+		p.router.NetAdd("", fmt.Sprintf("10.0.%s.0/24", p.link)) // network statement for link
+	}
+}
+
+func (s *ripSim) stop() {
+	for _, r := range s.routers {
+		r.stop()
+	}
+}
+
+// setLoss(): drop packets on link (both directions) or from sender address (one direction)
+func (s *ripSim) setLoss(key string, loss bool) {
+	s.mutex.Lock()
+	s.loss[key] = loss
+	s.mutex.Unlock()
+}
+
+// settle(): wait until every router went idle
+func (s *ripSim) settle() {
+	for _, r := range s.routers {
+		r.call(func() {})
+	}
+	s.inflight.Wait()
+}
+
+// advance(): move clock forward, firing timers in deadline order
+func (s *ripSim) advance(d time.Duration) {
+	c := s.clock
+	c.mutex.Lock()
+	target := c.now.Add(d)
+	c.mutex.Unlock()
+	for {
+		s.settle()
+		c.mutex.Lock()
+		var next *simTimer
+		for _, t := range c.timers {
+			if t.active && !t.deadline.After(target) && (next == nil || t.deadline.Before(next.deadline)) {
+				next = t
+			}
+		}
+		if next == nil {
+			c.now = target
+			c.mutex.Unlock()
+			return
+		}
+		if next.deadline.After(c.now) {
+			c.now = next.deadline
+		}
+		next.active = false
+		now := c.now
+		c.mutex.Unlock()
+		next.c <- now
+	}
+}
+
+func wantSimRoute(t *testing.T, r *RipRouter, prefix string, metric int, nexthop string) {
+	_, n, _ := net.ParseCIDR(prefix)
+	_, routes, _ := r.hardware.RouteList(fwd.FAMILY_INET, fwd.PROTO_RIP)
+	for _, got := range routes {
+		if !addr.NetEqual(&got.Prefix, n) {
+			continue
+		}
+		if metric == RIP_METRIC_INFINITY {
+			t.Errorf("sim: want %s withdrawn, got %v", prefix, got)
+			return
+		}
+		if got.Metric != metric || len(got.Nexthops) != 1 || !got.Nexthops[0].Gw.Equal(net.ParseIP(nexthop)) {
+			t.Errorf("sim: want %s metric=%d nexthop=%s, got %v", prefix, metric, nexthop, got)
+		}
+		return
+	}
+	if metric != RIP_METRIC_INFINITY {
+		t.Errorf("sim: route %s not found", prefix)
+	}
+}
+
+func TestSimConvergence(t *testing.T) {
+	// A --12-- B --23-- C
+	s := newRipSim()
+	a := s.router("eth0", "12")
+	b := s.router("eth0", "12", "eth1", "23")
+	c := s.router("eth0", "23")
+	s.start()
+	defer s.stop()
+
+	a.NetAdd("", "192.168.1.0/24")
+	s.advance(2 * time.Minute)
+	wantSimRoute(t, b, "192.168.1.0/24", 2, "10.0.12.1")
+	wantSimRoute(t, c, "192.168.1.0/24", 3, "10.0.23.2")
+
+	s.setLoss("12", true)
+	s.advance(5 * time.Minute) // timeout
+	wantSimRoute(t, b, "192.168.1.0/24", RIP_METRIC_INFINITY, "")
+	wantSimRoute(t, c, "192.168.1.0/24", RIP_METRIC_INFINITY, "")
+}
+
+func TestSimCountToInfinity(t *testing.T) {
+	s := newRipSim()
+	a := s.router("eth0", "12")
+	b := s.router("eth0", "12", "eth1", "23")
+	c := s.router("eth0", "23")
+	for _, r := range s.routers {
+		r.setInterfaceSplitHorizon("eth0", RIP_SPLIT_HORIZON_DISABLE)
+		r.setInterfaceSplitHorizon("eth1", RIP_SPLIT_HORIZON_DISABLE)
+	}
+	c.SetTimers(ripTimers{timeout: 10 * time.Minute}) // C keeps stale route long enough
+	s.start()
+	defer s.stop()
+
+	a.NetAdd("", "192.168.1.0/24")
+	s.advance(2 * time.Minute)
+	wantSimRoute(t, b, "192.168.1.0/24", 2, "10.0.12.1")
+	wantSimRoute(t, c, "192.168.1.0/24", 3, "10.0.23.2")
+
+	// A goes away, while C does not hear B's withdrawal
+	s.setLoss("12", true)
+	s.setLoss("10.0.23.2", true)
+	s.advance(4 * time.Minute)
+	wantSimRoute(t, b, "192.168.1.0/24", 4, "10.0.23.3") // loop: B points to C, C points to B
+
+	// B and C bounce the route between them until it reaches infinity
+	s.setLoss("10.0.23.2", false)
+	s.advance(5 * time.Minute)
+	wantSimRoute(t, b, "192.168.1.0/24", RIP_METRIC_INFINITY, "")
+	wantSimRoute(t, c, "192.168.1.0/24", RIP_METRIC_INFINITY, "")
+}
+
+func TestRipVersion(t *testing.T) {
+	ifaceAddrs := []net.IPNet{{IP: net.ParseIP("10.0.12.1"), Mask: net.CIDRMask(24, 32)}}
+	for _, c := range []struct {
+		addr string
+		want int
+	}{
+		{"10.0.5.0", 24},    // subnet of directly-connected network
+		{"10.0.5.7", 32},    // host within directly-connected network
+		{"172.16.0.0", 16},  // class B
+		{"172.16.5.0", 32},  // host bits beyond natural mask
+		{"192.168.1.0", 24}, // class C
+		{"0.0.0.0", 0},      // default route
+		{"224.0.0.9", 32},   // class D
+		{"10.0.0.0", 24},    // subnet zero
+	} {
+		if ones, _ := ripV1Mask(net.ParseIP(c.addr), ifaceAddrs).Size(); ones != c.want {
+			t.Errorf("RIPv1 mask for %s: want /%d, got /%d", c.addr, c.want, ones)
+		}
+	}
+
+	r := &RipRouter{config: map[string]*ripInterfaceConfig{}}
+	if mode := r.getInterfaceRecvVersion("eth0"); !ripRecvAccept(mode, RIP_V1) || !ripRecvAccept(mode, RIP_V2) || ripRecvAccept(mode, 0) {
+		t.Errorf("default receive mode: want both versions, got %d", mode)
+	}
+	r.SetVersion(RIP_V2)
+	if ripRecvAccept(r.getInterfaceRecvVersion("eth0"), RIP_V1) || r.getInterfaceSendVersion("eth0") != RIP_SEND_V2 {
+		t.Errorf("version 2: RIPv1 accepted")
+	}
+	r.setInterfaceRecvVersion("eth0", RIP_RECV_BOTH)
+	if !ripRecvAccept(r.getInterfaceRecvVersion("eth0"), RIP_V1) {
+		t.Errorf("receive version both: RIPv1 rejected")
+	}
+	r.SetVersion(RIP_V1)
+	if r.getInterfaceSendVersion("eth0") != RIP_SEND_V1 {
+		t.Errorf("version 1: want RIPv1 sent")
+	}
+
+	// A sends RIPv1 broadcast to B
+	s := newRipSim()
+	a := s.router("eth0", "12")
+	b := s.router("eth0", "12")
+	a.setInterfaceSendVersion("eth0", RIP_SEND_V1)
+	s.start()
+	defer s.stop()
+
+	a.NetAdd("", "172.16.5.0/24") // other classful network: summarized
+	a.NetAdd("", "10.0.7.0/24")   // same mask as subnet
+	a.NetAdd("", "10.0.99.0/25")  // not representable in RIPv1 on this subnet
+	s.advance(2 * time.Minute)
+	wantSimRoute(t, b, "172.16.0.0/16", 2, "10.0.12.1")
+	wantSimRoute(t, b, "10.0.7.0/24", 2, "10.0.12.1")
+	wantSimRoute(t, b, "10.0.99.0/24", RIP_METRIC_INFINITY, "")
+	wantSimRoute(t, b, "10.0.99.0/25", RIP_METRIC_INFINITY, "")
+
+	// B stops accepting RIPv1: routes time out
+	b.setInterfaceRecvVersion("eth0", RIP_RECV_V2)
+	s.advance(5 * time.Minute)
+	wantSimRoute(t, b, "172.16.0.0/16", RIP_METRIC_INFINITY, "")
+	b.call(func() {
+		if st := b.getStats("eth0"); st.badPackets == 0 {
+			t.Errorf("receive version 2: RIPv1 packets not counted as bad")
+		}
+	})
+}
+
+func TestMaximumPrefix(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := startRouter(hw)
+	defer r.stop()
+	var v *ripVrf
+	nh := net.ParseIP("10.0.0.1")
+	r.call(func() {
+		v = r.vrfAdd("")
+		r.peerHeard(nh, "eth0", RIP_V2, r.now())
+	})
+
+	r.SetMaximumPrefix("", 2, false)
+	r.call(func() {
+		for _, prefix := range []string{"10.1.0.0/16", "10.2.0.0/16", "10.3.0.0/16"} {
+			_, n, _ := net.ParseCIDR(prefix)
+			r.extRouteAdd("", 0, *n, nh, 2, 1, "eth0", nh)
+		}
+		if learned := v.learnedPrefixes(); learned != 2 {
+			t.Errorf("maximum-prefix: want 2 learned prefixes, got %d", learned)
+		}
+		if !r.peerSuspended(nh, "eth0") {
+			t.Errorf("maximum-prefix: neighbor not suspended")
+		}
+
+		// refreshing an existing prefix is not limited
+		_, n1, _ := net.ParseCIDR("10.1.0.0/16")
+		r.extRouteAdd("", 0, *n1, nh, 3, 1, "eth0", nh)
+		for _, route := range v.routes {
+			if addr.NetEqual(&route.addr, n1) && route.metric != 3 {
+				t.Errorf("maximum-prefix: existing prefix not refreshed: metric=%d", route.metric)
+			}
+		}
+	})
+
+	r.SetMaximumPrefix("", 2, true)
+	r.call(func() {
+		if r.peerSuspended(nh, "eth0") {
+			t.Errorf("maximum-prefix: neighbor still suspended after reconfiguration")
+		}
+		_, n3, _ := net.ParseCIDR("10.3.0.0/16")
+		r.extRouteAdd("", 0, *n3, nh, 2, 1, "eth0", nh)
+		if learned := v.learnedPrefixes(); learned != 3 {
+			t.Errorf("maximum-prefix warning-only: want 3 learned prefixes, got %d", learned)
+		}
+		if r.peerSuspended(nh, "eth0") {
+			t.Errorf("maximum-prefix warning-only: neighbor suspended")
+		}
+
+		// expired routes leave the count
+		r.clearNeighbor(nh)
+		if learned := v.learnedPrefixes(); learned != 0 {
+			t.Errorf("maximum-prefix: want 0 learned prefixes after clear neighbor, got %d", learned)
+		}
+	})
+}
+
+func TestNeighborMaximumPrefix(t *testing.T) {
+	hw := fwd.NewDataplaneBogus()
+	r := startRouter(hw)
+	defer r.stop()
+	var v *ripVrf
+	nh1 := net.ParseIP("10.0.0.1")
+	nh2 := net.ParseIP("10.0.0.2")
+	r.call(func() {
+		v = r.vrfAdd("")
+		now := r.now()
+		r.peerHeard(nh1, "eth0", RIP_V2, now)
+		r.peerHeard(nh2, "eth0", RIP_V2, now)
+	})
+
+	r.SetNeighborMaximumPrefix(nh1, 1, false)
+	r.call(func() {
+		for _, prefix := range []string{"10.1.0.0/16", "10.2.0.0/16"} {
+			_, n, _ := net.ParseCIDR(prefix)
+			r.extRouteAdd("", 0, *n, nh1, 2, 1, "eth0", nh1)
+			r.extRouteAdd("", 0, *n, nh2, 2, 1, "eth0", nh2)
+		}
+		if learned := v.peerPrefixes(nh1, "eth0"); learned != 1 {
+			t.Errorf("neighbor maximum-prefix: want 1 prefix from limited neighbor, got %d", learned)
+		}
+		if learned := v.peerPrefixes(nh2, "eth0"); learned != 2 {
+			t.Errorf("neighbor maximum-prefix: want 2 prefixes from other neighbor, got %d", learned)
+		}
+		if !r.peerSuspended(nh1, "eth0") {
+			t.Errorf("neighbor maximum-prefix: limited neighbor not suspended")
+		}
+		if r.peerSuspended(nh2, "eth0") {
+			t.Errorf("neighbor maximum-prefix: other neighbor suspended")
+		}
+		if learned := v.learnedPrefixes(); learned != 2 {
+			t.Errorf("neighbor maximum-prefix: want 2 learned prefixes, got %d", learned)
+		}
+
+		// withdrawn route leaves room for another prefix
+		_, n1, _ := net.ParseCIDR("10.1.0.0/16")
+		r.extRouteAdd("", 0, *n1, nh1, RIP_METRIC_INFINITY, 1, "eth0", nh1)
+		if learned := v.peerPrefixes(nh1, "eth0"); learned != 0 {
+			t.Errorf("neighbor maximum-prefix: want 0 prefixes after withdraw, got %d", learned)
+		}
+	})
+
+	r.DelNeighborMaximumPrefix(nh1)
+	r.call(func() {
+		if r.peerSuspended(nh1, "eth0") {
+			t.Errorf("neighbor maximum-prefix: neighbor still suspended after removing limit")
+		}
+	})
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"log"
+	"net"
+
+	"golang.org/x/net/ipv6"
+
+	"github.com/udhos/nexthop/netorder"
+)
+
+const (
+	RIPNG_VERSION        = 1
+	RIPNG_METRIC_NEXTHOP = 0xFF // next hop RTE
+	RIPNG_HOP_LIMIT      = 255
+	RIPNG_IPV6_HDR_SIZE  = 40
+	RIPNG_UDP_HDR_SIZE   = 8
+	RIPNG_MTU_MIN        = 1280 // IPv6 minimum link MTU
+	RIPNG_MTU_MAX        = 9000 // keep packets within udpReader buffer
+)
+
+/*
+RFC2080 2.1 Message Format
+
+The maximum number of RTEs is determined by the MTU of the medium:
+
+	+-                                                   -+
+	| MTU - sizeof(IPv6_hdrs) - UDP_hdrlen - RIPng_hdrlen |
+	| ----------------------------------------------------| + 1?
+	|                      RTE_size                       |
+	+-                                                   -+
+*/
+func ripngMaxEntries(mtu int) int {
+	if mtu < RIPNG_MTU_MIN {
+		mtu = RIPNG_MTU_MIN
+	}
+	if mtu > RIPNG_MTU_MAX {
+		mtu = RIPNG_MTU_MAX
+	}
+	return (mtu - RIPNG_IPV6_HDR_SIZE - RIPNG_UDP_HDR_SIZE - RIP_HEADER_SIZE) / RIP_ENTRY_SIZE
+}
+
+func setEntry6(buf []byte, entry int, prefix net.IP, tag uint16, prefixLen, metric int) {
+	offset := ripEntryOffset(entry)
+
+	copy(buf[offset:offset+net.IPv6len], prefix.To16())
+	netorder.WriteUint16(buf, offset+16, tag)
+	buf[offset+18] = byte(prefixLen)
+	buf[offset+19] = byte(metric)
+}
+
+func setEntryMetric6(buf []byte, entry, metric int) {
+	offset := ripEntryOffset(entry)
+	buf[offset+19] = byte(metric)
+}
+
+func parseEntry6(buf []byte, entry int) (prefix net.IP, tag uint16, prefixLen, metric int) {
+	offset := ripEntryOffset(entry)
+
+	prefix = make(net.IP, net.IPv6len)
+	copy(prefix, buf[offset:offset+net.IPv6len])
+	tag = netorder.ReadUint16(buf, offset+16)
+	prefixLen = int(buf[offset+18])
+	metric = int(buf[offset+19])
+
+	return
+}
+
+// ripngSendOptions(): prepare listening socket for sending updates
+func ripngSendOptions(p *ipv6.PacketConn, ifname string) {
+	// do not receive our own multicast updates
+	if err := p.SetMulticastLoopback(false); err != nil {
+		log.Printf("ripngSendOptions: could not disable multicast loopback for interface '%s': %v", ifname, err)
+	}
+	// RFC2080 2.4.2: hop limit 255 lets receivers check the packet is from a neighbor
+	if err := p.SetMulticastHopLimit(RIPNG_HOP_LIMIT); err != nil {
+		log.Printf("ripngSendOptions: could not set multicast hop limit for interface '%s': %v", ifname, err)
+	}
+	if err := p.SetHopLimit(RIPNG_HOP_LIMIT); err != nil {
+		log.Printf("ripngSendOptions: could not set hop limit for interface '%s': %v", ifname, err)
+	}
+}
+
+/*
+RFC2080 2.1.1 Next Hop
+
+A next hop must be a link-local address. Specifying :: indicates
+that routing should be via the originator of the RIPng advertisement.
+Only routes learnt from this same link can keep their next hop.
+*/
+func ripngAdvertisedNexthop(route *ripRoute, ifindex int) net.IP {
+	if route.srcExternal && route.srcIfIndex == ifindex && route.nexthop.IsLinkLocalUnicast() {
+		return route.nexthop
+	}
+	return net.IPv6unspecified
+}
+
+// ripngSendTable(): send routing table as RIPng responses.
+// changedOnly=true: include only routes flagged with routeChanged (triggered update).
+func ripngSendTable(r *RipRouter, vrfname string, p *port, dst *net.UDPAddr, ifname string, ifindex int, changedOnly bool) {
+
+	_, v := r.vrfGet(vrfname)
+	if v == nil {
+		log.Printf("ripngSendTable: VRF not found: vrf=[%s]", vrfname)
+		return
+	}
+
+	validRoutes, validMetrics, validTags := r.advertisedRoutes(v, ifname, ifindex, changedOnly)
+
+	maxEntries := ripngMaxEntries(p.iface.MTU)
+	buf := make([]byte, ripEntryOffset(maxEntries)) // largest possible buffer
+
+	// packet header
+	buf[0] = RIP_RESPONSE  // command response
+	buf[1] = RIPNG_VERSION // version 1
+
+	i := 0                         // entry in current packet
+	routes := 0                    // route entries in current packet (excluding next hop RTEs)
+	nexthop := net.IPv6unspecified // current next hop in packet
+	flush := func() {
+		if i < 1 {
+			return
+		}
+		if err := ripSend(p, dst, buf[:ripEntryOffset(i)], ifname, ifindex); err != nil {
+			log.Printf("ripngSendTable: %v", err)
+		} else {
+			r.statsSent(ifname, routes)
+		}
+		i = 0
+		routes = 0
+		nexthop = net.IPv6unspecified
+	}
+
+	for entry, route := range validRoutes {
+		nh := ripngAdvertisedNexthop(route, ifindex)
+
+		need := 1
+		if !nh.Equal(nexthop) {
+			need++ // next hop RTE
+		}
+		if i+need > maxEntries {
+			flush()
+		}
+
+		if !nh.Equal(nexthop) {
+			// next hop RTE applies to all following RTEs
+			setEntry6(buf, i, nh, 0, 0, RIPNG_METRIC_NEXTHOP)
+			nexthop = nh
+			i++
+		}
+
+		ones, _ := route.addr.Mask.Size()
+		setEntry6(buf, i, route.addr.IP, validTags[entry], ones, validMetrics[entry])
+		i++
+		routes++
+	}
+
+	flush()
+}
+
+func parseRipngPacket(r *RipRouter, u *udpInfo) {
+
+	r.statsUpdate(u.ifName, func(s *ripStats) { s.packetsRecv++ })
+
+	size := len(u.info)
+	entries := (size - RIP_HEADER_SIZE) / RIP_ENTRY_SIZE
+	if entries < 1 {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("parseRipngPacket: short packet size=%d bytes from %v to %v on %s ifIndex=%d",
+			size, &u.src, &u.dst, u.ifName, u.ifIndex)
+		return
+	}
+
+	cmd := u.info[0]
+	version := int(u.info[1])
+
+	if version != RIPNG_VERSION {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("parseRipngPacket: unsupported version=%d from %v to %v on %s ifIndex=%d",
+			version, &u.src, &u.dst, u.ifName, u.ifIndex)
+		return
+	}
+
+	vrf, err := r.hardware.InterfaceVrfGet(u.ifName)
+	if err != nil {
+		log.Printf("parseRipngPacket: unable to find VRF for interface '%s': %v", u.ifName, err)
+		return
+	}
+
+	port := r.getInterfaceByIndex(u.ifIndex)
+	if port == nil {
+		log.Printf("parseRipngPacket: unable to find RIPng interface for incoming %v to %v on %s ifIndex=%d",
+			&u.src, &u.dst, u.ifName, u.ifIndex)
+		return
+	}
+
+	switch cmd {
+	case RIP_REQUEST:
+		if !r.requestAccept(u) {
+			return
+		}
+		ripngParseRequest(r, u, port, entries, vrf)
+	case RIP_RESPONSE:
+		ripngParseResponse(r, u, port, size, entries, vrf)
+	default:
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("parseRipngPacket: unknown command %d size=%d from %v to %v on %s ifIndex=%d",
+			cmd, size, &u.src, &u.dst, u.ifName, u.ifIndex)
+	}
+}
+
+func ripngParseRequest(r *RipRouter, u *udpInfo, p *port, entries int, vrf string) {
+
+	if entries == 1 {
+		/*
+			RFC2080 2.4.1 Request Messages
+
+			If there is exactly one entry in the request, and it has a
+			destination prefix of zero, a prefix length of zero, and an
+			infinite metric, then this is a request to send the entire
+			routing table.
+		*/
+		prefix, _, prefixLen, metric := parseEntry6(u.info, 0)
+		if prefix.IsUnspecified() && prefixLen == 0 && metric == RIP_METRIC_INFINITY {
+			r.sendTable(vrf, p, &u.src, u.ifName, u.ifIndex, false)
+			return
+		}
+	}
+
+	u.info[0] = RIP_RESPONSE // change command to ripng response
+
+	// Update metric for every prefix in the request
+
+	for i := 0; i < entries; i++ {
+		prefix, _, prefixLen, _ := parseEntry6(u.info, i)
+		netaddr := net.IPNet{IP: prefix, Mask: net.CIDRMask(prefixLen, 8*net.IPv6len)}
+		route, _ := r.lookupAddressFirstMatch(vrf, netaddr)
+		metric := RIP_METRIC_INFINITY
+		if route != nil {
+			metric = route.metric
+		}
+
+		setEntryMetric6(u.info, i, metric)
+	}
+
+	// Echo request back to source
+	if err := ripSend(p, &u.src, u.info, u.ifName, u.ifIndex); err != nil {
+		log.Printf("ripngParseRequest: %v", err)
+		return
+	}
+	r.statsSent(u.ifName, entries)
+}
+
+func ripngParseResponse(r *RipRouter, u *udpInfo, p *port, size, entries int, vrf string) {
+
+	/*
+		RFC2080 2.4.2 Response Messages
+		The Response must be ignored if it is not from the RIPng port.
+	*/
+	if u.src.Port != RIPNG_PORT {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("ripngParseResponse: not from RIPng port (521): vrf=[%s] src=%v on '%s' ifIndex=%d", vrf, u.src.IP, u.ifName, u.ifIndex)
+		return
+	}
+
+	/*
+		RFC2080 2.4.2 Response Messages
+		Packets sent from the RIPng port must be examined to ensure
+		that the hop count is 255.
+	*/
+	if u.hopLimit != RIPNG_HOP_LIMIT {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("ripngParseResponse: bad hop limit=%d: vrf=[%s] src=%v on '%s' ifIndex=%d", u.hopLimit, vrf, u.src.IP, u.ifName, u.ifIndex)
+		return
+	}
+
+	/*
+		RFC2080 2.4.2 Response Messages
+		The datagram's IPv6 source address should be checked to see
+		whether the datagram is from a valid neighbor; the source of the
+		datagram must be a link-local address.
+	*/
+	if !u.src.IP.IsLinkLocalUnicast() {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("ripngParseResponse: source is not link-local: vrf=[%s] src=%v on '%s' ifIndex=%d", vrf, u.src.IP, u.ifName, u.ifIndex)
+		return
+	}
+
+	ifaceAddrs, err1 := r.hardware.InterfaceAddressGet(u.ifName)
+	if err1 != nil {
+		log.Printf("ripngParseResponse: unable to find addresses for interface %s: %v", u.ifName, err1)
+	}
+	for _, a := range ifaceAddrs {
+		if a.IP.Equal(u.src.IP) {
+			return // ignore our own packet
+		}
+	}
+
+	log.Printf("ripngParseResponse: VALID RESPONSE entries=%d size=%d from %v to %v on %s ifIndex=%d",
+		entries, size, &u.src, &u.dst, u.ifName, u.ifIndex)
+
+	r.peerHeard(u.src.IP, u.ifName, RIPNG_VERSION, r.now())
+
+	if r.peerSuspended(u.src.IP, u.ifName) {
+		log.Printf("ripngParseResponse: learning suspended by maximum-prefix: vrf=[%s] src=%v on '%s' ifIndex=%d", vrf, u.src.IP, u.ifName, u.ifIndex)
+		return
+	}
+
+	nexthop := u.src.IP // routing via originator
+
+	for i := 0; i < entries; i++ {
+		prefix, tag, prefixLen, metric := parseEntry6(u.info, i)
+
+		if metric == RIPNG_METRIC_NEXTHOP {
+			/*
+				RFC2080 2.1.1 Next Hop
+				If the received next hop address is not a link-local
+				address, it should be treated as 0:0:0:0:0:0:0:0.
+			*/
+			if prefix.IsLinkLocalUnicast() {
+				nexthop = prefix
+			} else {
+				nexthop = u.src.IP
+			}
+			continue
+		}
+
+		if metric < 1 || metric > RIP_METRIC_INFINITY {
+			log.Printf("ripngParseResponse: bad metric entry=%d/%d prefix=%v/%d metric=%d from %v on %s",
+				i, entries, prefix, prefixLen, metric, &u.src, u.ifName)
+			r.statsUpdate(u.ifName, func(s *ripStats) { s.badRoutes++ })
+			continue // ignore entry with bad metric
+		}
+
+		if prefixLen > 8*net.IPv6len {
+			log.Printf("ripngParseResponse: bad prefix length entry=%d/%d prefix=%v/%d from %v on %s",
+				i, entries, prefix, prefixLen, &u.src, u.ifName)
+			r.statsUpdate(u.ifName, func(s *ripStats) { s.badRoutes++ })
+			continue
+		}
+
+		if prefix.IsMulticast() || prefix.IsLinkLocalUnicast() {
+			log.Printf("ripngParseResponse: ignoring multicast/link-local entry=%d/%d prefix=%v/%d from %v on %s",
+				i, entries, prefix, prefixLen, &u.src, u.ifName)
+			r.statsUpdate(u.ifName, func(s *ripStats) { s.badRoutes++ })
+			continue
+		}
+
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.routesRecv++ })
+
+		mask := net.CIDRMask(prefixLen, 8*net.IPv6len)
+		netaddr := net.IPNet{IP: prefix.Mask(mask), Mask: mask}
+
+		if !r.filterPermit(RIP_FILTER_IN, u.ifName, &netaddr) {
+			continue // rejected by distribute-list
+		}
+
+		permit, attr := r.policyApply(RIP_FILTER_IN, u.ifName, &netaddr, ripRouteAttr{metric: metric, tag: tag})
+		if !permit {
+			continue // rejected by route-map
+		}
+		if metric < RIP_METRIC_INFINITY {
+			metric = attr.metric
+		}
+		tag = attr.tag
+
+		newMetric := metric + r.getInterfaceRipCost(u.ifName) + r.metricOffset(RIP_FILTER_IN, u.ifName, &netaddr)
+		if newMetric > RIP_METRIC_INFINITY {
+			newMetric = RIP_METRIC_INFINITY
+		}
+
+		r.extRouteAdd(vrf, tag, netaddr, nexthop, newMetric, u.ifIndex, u.ifName, u.src.IP)
+	}
+}
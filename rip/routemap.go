@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+// ripRouteMapEntry: "route-map NAME seq N permit|deny [match ...] [set ...]"
+type ripRouteMapEntry struct {
+	seq             int
+	permit          bool
+	matchPrefixList string // empty: match any prefix
+	matchTag        uint16 // zero: match any tag
+	setMetric       int    // zero: unset
+	setTag          uint16 // zero: unset
+}
+
+// empty(): entry does not carry any match/set clause
+func (e *ripRouteMapEntry) empty() bool {
+	return e.matchPrefixList == "" && e.matchTag == 0 && e.setMetric == 0 && e.setTag == 0
+}
+
+// ripRouteAttr: route attributes subject to route-map set clauses
+type ripRouteAttr struct {
+	metric int
+	tag    uint16
+}
+
+type sortRouteMapBySeq []*ripRouteMapEntry
+
+func (s sortRouteMapBySeq) Len() int {
+	return len(s)
+}
+func (s sortRouteMapBySeq) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortRouteMapBySeq) Less(i, j int) bool {
+	return s[i].seq < s[j].seq
+}
+
+// ripRouteMaps: route-map table shared between main goroutine (config) and RipRouter goroutine (redistribution)
+type ripRouteMaps struct {
+	mutex sync.RWMutex
+	maps  map[string][]*ripRouteMapEntry
+}
+
+func newRipRouteMaps() *ripRouteMaps {
+	return &ripRouteMaps{maps: map[string][]*ripRouteMapEntry{}}
+}
+
+// entrySet(): create entry if needed, then apply update to it
+func (t *ripRouteMaps) entrySet(mapName string, seq int, permit bool, update func(e *ripRouteMapEntry)) {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+
+	var entry *ripRouteMapEntry
+	for _, e := range t.maps[mapName] {
+		if e.seq == seq {
+			entry = e
+			break
+		}
+	}
+	if entry == nil {
+		entry = &ripRouteMapEntry{seq: seq}
+		t.maps[mapName] = append(t.maps[mapName], entry)
+		sort.Sort(sortRouteMapBySeq(t.maps[mapName]))
+	}
+	entry.permit = permit
+	if update != nil {
+		update(entry)
+	}
+}
+
+// entryUnset(): apply update to entry, then remove entry once it is left without clauses
+func (t *ripRouteMaps) entryUnset(mapName string, seq int, update func(e *ripRouteMapEntry)) error {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+
+	entries := t.maps[mapName]
+	for i, e := range entries {
+		if e.seq != seq {
+			continue
+		}
+		if update != nil {
+			update(e)
+		}
+		if e.empty() {
+			t.maps[mapName] = append(entries[:i], entries[i+1:]...) // keep order
+			if len(t.maps[mapName]) == 0 {
+				delete(t.maps, mapName)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("entryUnset: route-map [%s] seq %d not found", mapName, seq)
+}
+
+/*
+apply(): first matching entry decides.
+An entry matches when all its match clauses match.
+Permitted routes get the entry set clauses applied to attr.
+A route not matching any entry is denied (implicit deny).
+An undefined route-map denies everything.
+*/
+func (t *ripRouteMaps) apply(mapName string, prefix *net.IPNet, attr ripRouteAttr, prefixLists *ripPrefixLists) (bool, ripRouteAttr) {
+	defer t.mutex.RUnlock()
+	t.mutex.RLock()
+
+	for _, e := range t.maps[mapName] {
+		if e.matchPrefixList != "" && !prefixLists.permit(e.matchPrefixList, prefix) {
+			continue
+		}
+		if e.matchTag != 0 && e.matchTag != attr.tag {
+			continue
+		}
+		if !e.permit {
+			return false, attr
+		}
+		if e.setMetric != 0 {
+			attr.metric = e.setMetric
+		}
+		if e.setTag != 0 {
+			attr.tag = e.setTag
+		}
+		return true, attr
+	}
+	return false, attr
+}
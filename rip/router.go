@@ -3,27 +3,28 @@ package main
 import (
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"sort"
 	"sync"
 	"time"
 
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 
 	"github.com/udhos/nexthop/addr"
 	"github.com/udhos/nexthop/command"
 	"github.com/udhos/nexthop/fwd"
 	"github.com/udhos/nexthop/netorder"
-	"github.com/udhos/nexthop/sock"
 )
 
 type ripNet struct {
 	addr    net.IPNet
 	nexthop net.IP
 	metric  int
+	tag     uint16
 }
 
-// FIXME type ripRoute struct: concurrenct access from both main goroutine and NewRipRouter goroutine
 type ripRoute struct {
 	tag     uint16
 	addr    net.IPNet
@@ -60,45 +61,52 @@ func (route *ripRoute) Family() int {
 
 func newRipRoute(addr net.IPNet, nexthop net.IP, metric int, now time.Time, r *RipRouter) *ripRoute {
 	newRoute := &ripRoute{addr: addr, nexthop: nexthop, metric: metric, creation: now, routeChanged: true}
-	newRoute.resetTimer(now)
+	newRoute.resetTimer(now, r.getTimers())
 	r.trigUpdate(now) // since routeChanged=true, schedule triggered update
 	return newRoute
 }
 
-func (r *ripRoute) resetTimer(now time.Time) {
-	r.timeout = now.Add(RIP_ROUTE_TIMEOUT * time.Second) // start timeout timer
-	r.garbageCollection = r.timeout.Add(RIP_ROUTE_GC * time.Second)
+func (r *ripRoute) resetTimer(now time.Time, timers ripTimers) {
+	r.timeout = now.Add(timers.timeout) // start timeout timer
+	r.garbageCollection = r.timeout.Add(timers.gc)
 }
 
-func (r *ripRoute) disable(now time.Time) {
+func (r *ripRoute) disable(now time.Time, v *ripVrf, timers ripTimers) {
 	if r.isValid(now) {
-		r.timeout = now.Add(-1 * time.Second)                     // forcedly expire timeout
-		r.garbageCollection = now.Add(RIP_ROUTE_GC * time.Second) // start garbage collection timer
+		r.timeout = now.Add(-1 * time.Second)    // forcedly expire timeout
+		r.garbageCollection = now.Add(timers.gc) // start garbage collection timer
 	}
 	r.metric = RIP_METRIC_INFINITY
+	r.routeChanged = true // advertise route removal in triggered update
 	if r.installed {
 		// detect if we need to uninstall the route from FIB
 		// because .disable() might be called repeatedly for the same route
 		// but .uninstall() should be invoked only once per route
-		r.uninstall()
+		r.uninstall(v)
 	}
 }
 
-func (r *ripRoute) uninstall() {
+func (r *ripRoute) uninstall(v *ripVrf) {
 	if !r.installed {
 		log.Printf("ripRoute.uninstall: internal error: already uninstalled: %v", r)
 	}
 	r.installed = false
-	log.Printf("ripRoute.uninstall: FIXME: remove route from FIB: %s", r)
+	if r.srcExternal {
+		v.learnedUpdate(r, -1)
+		v.fibSync(&r.addr) // remove route from FIB
+	}
 	log.Printf("ripRoute.uninstall: route DOWN: %s", r)
 }
 
-func (r *ripRoute) install() {
+func (r *ripRoute) install(v *ripVrf) {
 	if r.installed {
 		log.Printf("ripRoute.install: internal error: already installed: %s", r)
 	}
 	r.installed = true
-	log.Printf("ripRoute.install: FIXME: send route to FIB: %s", r)
+	if r.srcExternal {
+		v.learnedUpdate(r, 1)
+		v.fibSync(&r.addr) // send route to FIB
+	}
 	log.Printf("ripRoute.install: route UP: %s", r)
 }
 
@@ -125,13 +133,10 @@ func (r *ripRoute) isGarbage(now time.Time) bool {
 	return r.garbageCollection.Before(now)
 }
 
-// garbageCollect(): called from NewRipRouter() goroutine
+// garbageCollect(): called from RipRouter goroutine
 func (r *RipRouter) garbageCollect() {
 
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
-	now := time.Now()
+	now := r.now()
 
 	invalid := 0
 
@@ -141,12 +146,19 @@ func (r *RipRouter) garbageCollect() {
 
 		for _, route := range v.routes {
 			if route.isGarbage(now) {
+				if route.installed {
+					route.uninstall(v) // timeout was missed
+				}
 				continue // drop this route
 			}
 
+			if !route.srcExternal && route.isValid(now) {
+				route.resetTimer(now, r.getTimers()) // local routes do not time out
+			}
+
 			if route.installed && !route.isValid(now) {
 				// remove timedout route from FIB
-				route.disable(now)
+				route.disable(now, v, r.getTimers())
 				invalid++
 			}
 
@@ -162,26 +174,116 @@ func (r *RipRouter) garbageCollect() {
 	}
 
 	log.Printf("RipRouter.garbageCollect(): disabled %d invalid routes", invalid)
+
+	if invalid > 0 {
+		r.trigUpdate(now) // advertise disabled routes
+	}
+}
+
+/*
+ClearRoutes(): flush learned routes from routing table and FIB.
+vrfname: empty string means all VRFs.
+prefix: nil means all prefixes.
+Returns the number of routes flushed.
+*/
+func (r *RipRouter) ClearRoutes(vrfname string, prefix *net.IPNet) (int, error) {
+	req := &ripClearRoutesRequest{vrf: vrfname, prefix: prefix}
+	r.request(req)
+	return req.flushed, req.err
+}
+
+func (r *RipRouter) clearRoutes(vrfname string, prefix *net.IPNet) (int, error) {
+
+	vrfs := r.vrfs
+	if vrfname != "" {
+		_, v := r.vrfGet(vrfname)
+		if v == nil {
+			return 0, fmt.Errorf("ClearRoutes: VRF not found: vrf=[%s]", vrfname)
+		}
+		vrfs = []*ripVrf{v}
+	}
+
+	flushed := 0
+
+	for _, v := range vrfs {
+		routeList := []*ripRoute{}
+		for _, route := range v.routes {
+			if !route.srcExternal || (prefix != nil && !addr.NetEqual(&route.addr, prefix)) {
+				routeList = append(routeList, route) // keep route
+				continue
+			}
+			if route.installed {
+				route.uninstall(v)
+			}
+			flushed++
+		}
+		v.routes = routeList
+	}
+
+	log.Printf("RipRouter.ClearRoutes: vrf=[%s] prefix=%v flushed %d routes", vrfname, prefix, flushed)
+
+	return flushed, nil
+}
+
+/*
+ClearNeighbor(): expire all routes learned from neighbor.
+Expired routes are advertised with metric infinity until garbage collected.
+Returns the number of routes expired.
+*/
+func (r *RipRouter) ClearNeighbor(nbr net.IP) int {
+	req := &ripClearNeighborRequest{nbr: nbr}
+	r.request(req)
+	return req.expired
+}
+
+func (r *RipRouter) clearNeighbor(nbr net.IP) int {
+
+	now := r.now()
+	expired := 0
+
+	for _, v := range r.vrfs {
+		for _, route := range v.routes {
+			if !route.srcExternal || !route.srcRouter.Equal(nbr) || !route.isValid(now) {
+				continue
+			}
+			route.disable(now, v, r.getTimers())
+			expired++
+		}
+	}
+
+	r.peerForget(nbr)
+
+	if expired > 0 {
+		r.trigUpdate(now) // advertise expired routes
+	}
+
+	log.Printf("RipRouter.ClearNeighbor: neighbor=%v expired %d routes", nbr, expired)
+
+	return expired
 }
 
 type ripVrf struct {
-	name   string
-	nets   []*ripNet   // locally configured networks
-	routes []*ripRoute // learnt networks
+	name       string
+	hardware   fwd.Dataplane // FIB
+	nets       []*ripNet     // locally configured networks
+	redistNets []*ripNet     // redistributed networks
+	routes     []*ripRoute   // learnt networks
+
+	learned     map[string]int // installed external routes per prefix (maximum-prefix)
+	peerLearned map[string]int // installed external routes per source router (maximum-prefix)
 }
 
 // Empty: VRF does not contain any data
 func (v *ripVrf) Empty() bool {
-	return len(v.nets) < 1
+	return len(v.nets) < 1 && len(v.redistNets) < 1
 }
 
-// FIXME localRouteAdd(): called indirectly from main goroutine, but calls route.disable()
 func (v *ripVrf) localRouteAdd(n *ripNet, r *RipRouter) {
 	//log.Printf("ripVrf.localRouteAdd: vrf[%s]: %v", v.name, n)
 
 	deleteList := []*ripRoute{}
 
-	now := time.Now()
+	now := r.now()
 
 	for _, route := range v.routes {
 		if !route.isValid(now) {
@@ -209,25 +311,26 @@ func (v *ripVrf) localRouteAdd(n *ripNet, r *RipRouter) {
 
 	// delete existing routes
 	for _, route := range deleteList {
-		route.disable(now)
+		route.disable(now, v, r.getTimers())
 	}
 
 	// add route
 	newRoute := newRipRoute(n.addr, n.nexthop, n.metric, now, r)
+	newRoute.tag = n.tag
 	v.routeAdd(newRoute)
 }
 
 func (v *ripVrf) routeAdd(newRoute *ripRoute) {
-	newRoute.install()
 	v.routes = append(v.routes, newRoute)
+	newRoute.install(v)
 }
 
-func (v *ripVrf) localRouteDel(n *ripNet) {
+func (v *ripVrf) localRouteDel(n *ripNet, r *RipRouter) {
 	log.Printf("ripVrf.localRouteDel: vrf[%s]: %v", v.name, n)
 
 	count := 0
 
-	now := time.Now()
+	now := r.now()
 
 	for _, route := range v.routes {
 		if route.srcExternal {
@@ -246,12 +349,16 @@ func (v *ripVrf) localRouteDel(n *ripNet) {
 			log.Printf("ripVrf.localRouteDel: internal error: wrong metric=%d: vrf=[%s]: %v", route.metric, v.name, route)
 		}
 
-		route.disable(now)
+		route.disable(now, v, r.getTimers())
 		count++
 		if count > 1 {
 			log.Printf("ripVrf.localRouteDel: internal error: removed multiple routes: count=%d: vrf=[%s]: %v", count, v.name, route)
 		}
 	}
+
+	if count > 0 {
+		r.trigUpdate(now) // advertise removed routes
+	}
 }
 
 func (v *ripVrf) nexthopGet(prefix *net.IPNet, nexthop net.IP) (int, *ripNet) {
@@ -297,7 +404,7 @@ func (v *ripVrf) netAdd(prefix *net.IPNet) *ripNet {
 		}
 	*/
 
-	n := &ripNet{addr: *prefix, nexthop: net.IPv4zero, metric: 1}
+	n := &ripNet{addr: *prefix, nexthop: unspecifiedAddr(prefix), metric: 1}
 	v.nets = append(v.nets, n) // add
 	return n
 }
@@ -316,6 +423,22 @@ func (v *ripVrf) netDel(index int) {
 	v.nets = v.nets[:last]       // shrink
 }
 
+// unspecifiedAddr(): 0.0.0.0 or :: according to prefix family
+func unspecifiedAddr(prefix *net.IPNet) net.IP {
+	if prefix.IP.To4() != nil {
+		return net.IPv4zero
+	}
+	return net.IPv6unspecified
+}
+
+func (r *RipRouter) checkFamily(prefix *net.IPNet) error {
+	isIPv4 := prefix.IP.To4() != nil
+	if isIPv4 != (r.family == RIP_FAMILY_INET) {
+		return fmt.Errorf("address family mismatch for %s: addr=[%v]", r.protoName(), prefix)
+	}
+	return nil
+}
+
 func (v *ripVrf) NetAdd(prefix string, r *RipRouter) error {
 	_, ipnet, err := net.ParseCIDR(prefix)
 	if err != nil {
@@ -324,6 +447,9 @@ func (v *ripVrf) NetAdd(prefix string, r *RipRouter) error {
 	if err1 := addr.CheckMask(ipnet); err1 != nil {
 		return fmt.Errorf("ripVrf.NetAdd: bad mask: addr=[%s]: %v", prefix, err1)
 	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetAdd: %v", err2)
+	}
 	_, n := v.netGet(ipnet)
 	if n != nil {
 		return fmt.Errorf("ripVrf.NetAdd: net exists: '%s'", prefix)
@@ -333,7 +459,7 @@ func (v *ripVrf) NetAdd(prefix string, r *RipRouter) error {
 	return nil
 }
 
-func (v *ripVrf) NetDel(prefix string) error {
+func (v *ripVrf) NetDel(prefix string, r *RipRouter) error {
 	_, ipnet, err := net.ParseCIDR(prefix)
 	if err != nil {
 		return fmt.Errorf("ripVrf.NetDel: parse error: addr=[%s]: %v", prefix, err)
@@ -341,12 +467,15 @@ func (v *ripVrf) NetDel(prefix string) error {
 	if err1 := addr.CheckMask(ipnet); err1 != nil {
 		return fmt.Errorf("ripVrf.NetDel: bad mask: addr=[%s]: %v", prefix, err1)
 	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetDel: %v", err2)
+	}
 	i, n := v.netGet(ipnet)
 	if n == nil {
 		return fmt.Errorf("ripVrf.NetNet: not found: '%s'", prefix)
 	}
 	v.netDel(i)
-	v.localRouteDel(n)
+	v.localRouteDel(n, r)
 	return nil
 }
 
@@ -358,13 +487,16 @@ func (v *ripVrf) NetNexthopAdd(prefix string, nexthop net.IP, r *RipRouter) erro
 	if err1 := addr.CheckMask(ipnet); err1 != nil {
 		return fmt.Errorf("ripVrf.NetNexthopAdd: bad mask: addr=[%s]: %v", prefix, err1)
 	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetNexthopAdd: %v", err2)
+	}
 	n := v.netSet(ipnet)
 	n.nexthop = nexthop
 	v.localRouteAdd(n, r)
 	return nil
 }
 
-func (v *ripVrf) NetNexthopDel(prefix string, nexthop net.IP) error {
+func (v *ripVrf) NetNexthopDel(prefix string, nexthop net.IP, r *RipRouter) error {
 	_, ipnet, err := net.ParseCIDR(prefix)
 	if err != nil {
 		return fmt.Errorf("ripVrf.NetNexthopDel: parse error: addr=[%s]: %v", prefix, err)
@@ -372,12 +504,15 @@ func (v *ripVrf) NetNexthopDel(prefix string, nexthop net.IP) error {
 	if err1 := addr.CheckMask(ipnet); err1 != nil {
 		return fmt.Errorf("ripVrf.NetNexthopDel: bad mask: addr=[%s]: %v", prefix, err1)
 	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetNexthopDel: %v", err2)
+	}
 	_, n := v.nexthopGet(ipnet, nexthop)
 	if n == nil {
 		return fmt.Errorf("ripVrf.NetNexthopDel: not found: prefix=%s nexthop=%v", prefix, nexthop)
 	}
-	n.nexthop = net.IPv4zero
-	v.localRouteDel(n)
+	n.nexthop = unspecifiedAddr(ipnet)
+	v.localRouteDel(n, r)
 	return nil
 }
 
@@ -389,13 +524,16 @@ func (v *ripVrf) NetMetricAdd(prefix string, nexthop net.IP, metric int, r *RipR
 	if err1 := addr.CheckMask(ipnet); err1 != nil {
 		return fmt.Errorf("ripVrf.NetMetricAdd: bad mask: addr=[%s]: %v", prefix, err1)
 	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetMetricAdd: %v", err2)
+	}
 	n := v.nexthopSet(ipnet, nexthop)
 	n.metric = metric
 	v.localRouteAdd(n, r)
 	return nil
 }
 
-func (v *ripVrf) NetMetricDel(prefix string, nexthop net.IP, metric int) error {
+func (v *ripVrf) NetMetricDel(prefix string, nexthop net.IP, metric int, r *RipRouter) error {
 	_, ipnet, err := net.ParseCIDR(prefix)
 	if err != nil {
 		return fmt.Errorf("ripVrf.NetMetricDel: parse error: addr=[%s]: %v", prefix, err)
@@ -403,43 +541,149 @@ func (v *ripVrf) NetMetricDel(prefix string, nexthop net.IP, metric int) error {
 	if err1 := addr.CheckMask(ipnet); err1 != nil {
 		return fmt.Errorf("ripVrf.NetMetricDel: bad mask: addr=[%s]: %v", prefix, err1)
 	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetMetricDel: %v", err2)
+	}
 	_, n := v.nexthopGet(ipnet, nexthop)
 	if n == nil {
 		return fmt.Errorf("ripVrf.NetMetricDel: not found: prefix=%s nexthop=%v", prefix, nexthop)
 	}
 	n.metric = 1
-	v.localRouteDel(n)
+	v.localRouteDel(n, r)
+	return nil
+}
+
+func (v *ripVrf) NetTagAdd(prefix string, tag uint16, r *RipRouter) error {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("ripVrf.NetTagAdd: parse error: addr=[%s]: %v", prefix, err)
+	}
+	if err1 := addr.CheckMask(ipnet); err1 != nil {
+		return fmt.Errorf("ripVrf.NetTagAdd: bad mask: addr=[%s]: %v", prefix, err1)
+	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetTagAdd: %v", err2)
+	}
+	_, n := v.netGet(ipnet)
+	if n == nil {
+		n = v.netAdd(ipnet)
+		n.tag = tag
+		v.localRouteAdd(n, r)
+		return nil
+	}
+	n.tag = tag
+	v.localRouteTag(n, r)
 	return nil
 }
 
+func (v *ripVrf) NetTagDel(prefix string, tag uint16, r *RipRouter) error {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("ripVrf.NetTagDel: parse error: addr=[%s]: %v", prefix, err)
+	}
+	if err1 := addr.CheckMask(ipnet); err1 != nil {
+		return fmt.Errorf("ripVrf.NetTagDel: bad mask: addr=[%s]: %v", prefix, err1)
+	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("ripVrf.NetTagDel: %v", err2)
+	}
+	_, n := v.netGet(ipnet)
+	if n == nil {
+		return fmt.Errorf("ripVrf.NetTagDel: not found: prefix=%s tag=%d", prefix, tag)
+	}
+	n.tag = 0
+	v.localRouteTag(n, r)
+	return nil
+}
+
+// localRouteTag(): propagate tag from local network into its route
+func (v *ripVrf) localRouteTag(n *ripNet, r *RipRouter) {
+	now := r.now()
+
+	for _, route := range v.routes {
+		if route.srcExternal || !route.isValid(now) {
+			continue
+		}
+		if !addr.NetEqual(&n.addr, &route.addr) || !n.nexthop.Equal(route.nexthop) {
+			continue
+		}
+		if route.tag != n.tag {
+			route.tag = n.tag
+			route.routeChanged = true
+			r.trigUpdate(now) // advertise new tag
+		}
+	}
+}
+
 type ripInterfaceConfig struct {
-	cost int
+	cost         int
+	splitHorizon int
+	auth         ripAuth
+	passive      bool        // advertise interface networks, but do not send updates on interface
+	summaries    []net.IPNet // summary-address: aggregates advertised on interface
+	sendVersion  int         // RIP_SEND_DEFAULT: follow router version
+	recvVersion  int         // RIP_RECV_DEFAULT: follow router version
 }
 
 type RipRouter struct {
-	done           chan int // write into this channel (do not close) to request end of rip router
+	family         int           // RIP_FAMILY_INET (RIPv2) or RIP_FAMILY_INET6 (RIPng)
+	udpPort        int           // 520 or 521
+	done           chan int      // write into this channel (do not close) to request end of rip router
+	finished       chan struct{} // closed by rip router goroutine on exit
 	input          chan *udpInfo
-	vrfMutex       sync.RWMutex // both main and RipRouter goroutines access the routing table (under member vrfs)
-	vrfs           []*ripVrf
-	ports          []*port // rip interfaces
-	group          net.IP  // 224.0.0.9
+	requests       chan ripPending // main goroutine operations on the routing table
+	vrfs           []*ripVrf       // routing table: owned by RipRouter goroutine
+	ports          []*port         // rip interfaces
+	group          net.IP          // 224.0.0.9 or ff02::9
 	readerDone     chan int
 	readerCount    int
 	hardware       fwd.Dataplane
 	configMutex    sync.RWMutex // both main and RipRouter goroutines access interface config
 	config         map[string]*ripInterfaceConfig
-	updateTicker   *time.Ticker // regular updates
+	keyChains      *ripKeyChains                    // shared with main goroutine
+	authSeqIn      map[string]uint32                // RFC4822 last sequence number received from neighbor
+	neighbors      []net.IP                         // unicast peers (under configMutex)
+	distLists      map[ripFilterKey][]string        // distribute-lists (under configMutex)
+	offsetLists    map[ripFilterKey][]ripOffsetList // offset-lists (under configMutex)
+	policies       map[ripFilterKey][]string        // route-maps applied to received/sent routes (under configMutex)
+	prefixLists    *ripPrefixLists                  // shared with main goroutine
+	routeMaps      *ripRouteMaps                    // shared with main goroutine
+	redist         map[string]ripRedist             // redistribution sources (under configMutex)
+	timers         ripTimers                        // timers basic (under configMutex)
+	maximumPaths   int                              // ECMP limit (under configMutex) -- zero: default
+	version        int                              // RIPv1/RIPv2 (under configMutex) -- zero: default
+	maxPrefix      map[string]ripMaxPrefix          // maximum-prefix per VRF (under configMutex)
+	nbrMaxPrefix   map[string]ripMaxPrefix          // maximum-prefix per neighbor (under configMutex)
+	clock          ripClock                         // time source
+	updateTimer    ripTimer                         // regular updates
 	updateNext     time.Time
-	triggeredTimer *time.Timer // triggered updates
+	triggeredTimer ripTimer // triggered updates
 	triggeredNext  time.Time
 	triggeredLast  time.Time
+	triggeredHold  time.Time            // holddown for next triggered update
+	stats          map[string]*ripStats // per-interface counters (owned by RipRouter goroutine)
+	peers          []*ripPeer           // neighbor table (owned by RipRouter goroutine)
+}
+
+// interfaceConfigSet(): caller must hold configMutex
+func (r *RipRouter) interfaceConfigSet(ifname string) *ripInterfaceConfig {
+	i := r.config[ifname]
+	if i == nil {
+		i = &ripInterfaceConfig{cost: RIP_DEFAULT_IFACE_COST, splitHorizon: RIP_SPLIT_HORIZON}
+		r.config[ifname] = i
+	}
+	return i
 }
 
 func (r *RipRouter) clearInterfaceRipCost(ifname string) {
 	defer r.configMutex.Unlock()
 	r.configMutex.Lock()
 
-	delete(r.config, ifname)
+	i := r.config[ifname]
+	if i == nil {
+		return // not found
+	}
+	i.cost = RIP_DEFAULT_IFACE_COST
 }
 
 func (r *RipRouter) getInterfaceRipCost(ifname string) int {
@@ -457,46 +701,323 @@ func (r *RipRouter) setInterfaceRipCost(ifname string, cost int) {
 	defer r.configMutex.Unlock()
 	r.configMutex.Lock()
 
+	r.interfaceConfigSet(ifname).cost = cost
+}
+
+func (r *RipRouter) clearInterfaceSplitHorizon(ifname string) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
 	i := r.config[ifname]
 	if i == nil {
-		i = &ripInterfaceConfig{}
-		r.config[ifname] = i
+		return // not found
+	}
+	i.splitHorizon = RIP_SPLIT_HORIZON
+}
+
+func (r *RipRouter) getInterfaceSplitHorizon(ifname string) int {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	i := r.config[ifname]
+	if i == nil {
+		return RIP_SPLIT_HORIZON // not found
+	}
+	return i.splitHorizon
+}
+
+func (r *RipRouter) setInterfaceSplitHorizon(ifname string, mode int) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.interfaceConfigSet(ifname).splitHorizon = mode
+}
+
+func (r *RipRouter) getInterfacePassive(ifname string) bool {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	i := r.config[ifname]
+	if i == nil {
+		return false // not found
+	}
+	return i.passive
+}
+
+func (r *RipRouter) setInterfacePassive(ifname string, passive bool) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.interfaceConfigSet(ifname).passive = passive
+}
+
+func (r *RipRouter) getNeighbors() []net.IP {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	return append([]net.IP{}, r.neighbors...) // clone
+}
+
+func (r *RipRouter) isNeighbor(addr net.IP) bool {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	for _, n := range r.neighbors {
+		if n.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RipRouter) NeighborAdd(nbr net.IP) error {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	if (nbr.To4() != nil) != (r.family == RIP_FAMILY_INET) {
+		return fmt.Errorf("address family mismatch for %s: neighbor=[%v]", r.protoName(), nbr)
+	}
+
+	for _, n := range r.neighbors {
+		if n.Equal(nbr) {
+			return nil // already present
+		}
+	}
+	r.neighbors = append(r.neighbors, nbr)
+	return nil
+}
+
+func (r *RipRouter) NeighborDel(nbr net.IP) error {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	for i, n := range r.neighbors {
+		if n.Equal(nbr) {
+			last := len(r.neighbors) - 1
+			r.neighbors[i] = r.neighbors[last]
+			r.neighbors = r.neighbors[:last] // pop
+			return nil
+		}
+	}
+	return fmt.Errorf("NeighborDel: neighbor not found: %v", nbr)
+}
+
+// neighborPort(): find interface directly connected to neighbor
+func (r *RipRouter) neighborPort(nbr net.IP) *port {
+	for _, p := range r.ports {
+		addrs, err := r.hardware.InterfaceAddressGet(p.iface.Name)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a.Contains(nbr) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// requestAccept(): passive interfaces answer requests only from configured neighbors
+func (r *RipRouter) requestAccept(u *udpInfo) bool {
+	if r.getInterfacePassive(u.ifName) && !r.isNeighbor(u.src.IP) {
+		log.Printf("%s: ignoring request on passive interface: src=%v on '%s' ifIndex=%d", r.protoName(), u.src.IP, u.ifName, u.ifIndex)
+		return false
+	}
+	return true
+}
+
+func (r *RipRouter) getMaximumPaths() int {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	if r.maximumPaths < 1 {
+		return RIP_DEFAULT_MAX_PATHS
+	}
+	return r.maximumPaths
+}
+
+// SetMaximumPaths(): set ECMP limit (zero: default), removing excess paths
+func (r *RipRouter) SetMaximumPaths(paths int) {
+	r.request(&ripMaximumPathsRequest{paths: paths})
+}
+
+func (r *RipRouter) setMaximumPaths(paths int) {
+	r.configMutex.Lock()
+	r.maximumPaths = paths
+	r.configMutex.Unlock()
+
+	max := r.getMaximumPaths()
+
+	now := r.now()
+	removed := 0
+
+	for _, v := range r.vrfs {
+		count := map[string]int{} // valid external paths per prefix
+		for _, route := range v.routes {
+			if !route.srcExternal || !route.isValid(now) {
+				continue
+			}
+			prefix := route.addr.String()
+			if count[prefix] >= max {
+				route.disable(now, v, r.getTimers())
+				removed++
+				continue
+			}
+			count[prefix]++
+		}
+	}
+
+	if removed > 0 {
+		r.trigUpdate(now) // advertise removed paths
 	}
-	i.cost = cost
+}
+
+func (r *RipRouter) getInterfaceAuth(ifname string) ripAuth {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	i := r.config[ifname]
+	if i == nil {
+		return ripAuth{} // not found
+	}
+	return i.auth
+}
+
+func (r *RipRouter) setInterfaceAuthMode(ifname string, mode int) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.interfaceConfigSet(ifname).auth.mode = mode
+}
+
+func (r *RipRouter) setInterfaceAuthKeyChain(ifname, keyChain string) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.interfaceConfigSet(ifname).auth.keyChain = keyChain
 }
 
 const (
 	RIP_PORT               = 520
+	RIPNG_PORT             = 521
 	RIP_METRIC_INFINITY    = 16
 	RIP_REQUEST            = 1
 	RIP_RESPONSE           = 2
 	RIP_FAMILY_UNSPEC      = 0  // AF_UNSPEC Unspecified
 	RIP_FAMILY_INET        = 2  // AF_INET   IPv4
 	RIP_FAMILY_INET6       = 10 // AF_INET6  IPv6
+	RIP_V1                 = 1
 	RIP_V2                 = 2
 	RIP_PKT_MAX_ENTRIES    = 25
 	RIP_ENTRY_SIZE         = 20
 	RIP_HEADER_SIZE        = 4
 	RIP_PKT_MAX_SIZE       = RIP_HEADER_SIZE + RIP_ENTRY_SIZE*RIP_PKT_MAX_ENTRIES
 	RIP_DEFAULT_IFACE_COST = 1
-	RIP_ROUTE_TIMEOUT      = 180
-	RIP_ROUTE_GC           = 120
-	RIP_UPDATE_INTERVAL    = 30
+	RIP_DEFAULT_MAX_PATHS  = 4   // ECMP
+	RIP_ROUTE_TIMEOUT      = 180 // default timeout timer (seconds)
+	RIP_ROUTE_GC           = 120 // default garbage-collection timer (seconds)
+	RIP_UPDATE_INTERVAL    = 30  // default regular update interval (seconds)
+	RIP_TRIGGERED_HOLD_MIN = 1   // triggered update holddown (seconds)
+	RIP_TRIGGERED_HOLD_MAX = 5
+)
+
+// ripTimers: timers basic
+type ripTimers struct {
+	update  time.Duration // zero: default
+	timeout time.Duration // zero: default
+	gc      time.Duration // zero: default
+}
+
+func ripDefaultTimers() ripTimers {
+	return ripTimers{
+		update:  RIP_UPDATE_INTERVAL * time.Second,
+		timeout: RIP_ROUTE_TIMEOUT * time.Second,
+		gc:      RIP_ROUTE_GC * time.Second,
+	}
+}
+
+// getTimers(): configured timers, unset timers filled with defaults
+func (r *RipRouter) getTimers() ripTimers {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	timers := r.timers
+	def := ripDefaultTimers()
+	if timers.update == 0 {
+		timers.update = def.update
+	}
+	if timers.timeout == 0 {
+		timers.timeout = def.timeout
+	}
+	if timers.gc == 0 {
+		timers.gc = def.gc
+	}
+	return timers
+}
+
+// SetTimers(): new update interval is used when the update timer is rearmed,
+// new timeout and garbage-collection timers apply when route timers are (re)started.
+func (r *RipRouter) SetTimers(timers ripTimers) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.timers = timers
+}
+
+/*
+RFC2453 3.8 Timers
+
+The 30-second updates are triggered by a clock whose rate is not
+affected by system load or the time required to service the previous
+update timer. [...] the 30-second timer is offset by a small random
+time (+/- 0 to 5 seconds) each time it is set.
+
+The +/-5 seconds jitter is scaled for intervals other than 30 seconds.
+*/
+func ripUpdateJitter(interval time.Duration) time.Duration {
+	jitter := interval / 6
+	if jitter < 1 {
+		return interval
+	}
+	return interval - jitter + time.Duration(rand.Int63n(int64(2*jitter)+1))
+}
+
+/*
+RFC2453 3.10.1 Triggered Updates
+
+After a triggered update is sent, a timer should be set for a random
+interval between 1 and 5 seconds. If other changes that would trigger
+updates occur before the timer expires, a single update is triggered
+when the timer expires.
+*/
+func ripTriggeredHold() time.Duration {
+	min := int64(RIP_TRIGGERED_HOLD_MIN * time.Second)
+	max := int64(RIP_TRIGGERED_HOLD_MAX * time.Second)
+	return time.Duration(min + rand.Int63n(max-min+1))
+}
+
+// split horizon modes
+const (
+	RIP_SPLIT_HORIZON                  = 0 // default: omit routes learned from the interface
+	RIP_SPLIT_HORIZON_POISONED_REVERSE = 1 // advertise routes learned from the interface with metric infinity
+	RIP_SPLIT_HORIZON_DISABLE          = 2 // advertise every route
 )
 
 // rip interface
 type port struct {
-	iface *net.Interface      // interface
-	msock *sock.MulticastSock // listen-only
-	send  *net.UDPConn        // send-only
+	iface     *net.Interface // interface
+	transport ripTransport   // packet I/O
+	authSeq   uint32         // RFC4822 outgoing sequence number
 }
 
 type udpInfo struct {
-	info    []byte
-	src     net.UDPAddr
-	dst     net.UDPAddr
-	ifIndex int
-	ifName  string
+	info     []byte
+	src      net.UDPAddr
+	dst      net.UDPAddr
+	ifIndex  int
+	ifName   string
+	hopLimit int // IPv4 TTL or IPv6 hop limit
 }
 
 type sortByAddr []*ripRoute
@@ -512,26 +1033,36 @@ func (s sortByAddr) Less(i, j int) bool {
 }
 
 func (r *RipRouter) ShowRoutes(c command.LineSender) {
+	r.request(&ripShowRequest{op: ripShowRoutes, c: c})
+}
 
-	defer r.vrfMutex.RUnlock()
-	r.vrfMutex.RLock()
+func (r *RipRouter) showRoutes(c command.LineSender) {
 
-	header := fmt.Sprintf("%-8s %-18s %-15s %-3s", "VRF", "NETWORK", "NEXTHOP", "MET")
-	format := "%-8s %-18v %-15s %3d"
+	header := fmt.Sprintf("%-8s %-18s %-15s %-3s %5s", "VRF", "NETWORK", "NEXTHOP", "MET", "TAG")
+	format := "%-8s %-18v %-15s %3d %5d"
 
-	c.Sendln("RIP local networks:")
+	c.Sendln(fmt.Sprintf("%s local networks:", r.protoName()))
 	c.Sendln(header)
 
 	for _, v := range r.vrfs {
 		for _, n := range v.nets {
-			c.Sendln(fmt.Sprintf(format, v.name, &n.addr, n.nexthop, n.metric))
+			c.Sendln(fmt.Sprintf(format, v.name, &n.addr, n.nexthop, n.metric, n.tag))
+		}
+	}
+
+	c.Sendln(fmt.Sprintf("%s redistributed networks:", r.protoName()))
+	c.Sendln(header)
+
+	for _, v := range r.vrfs {
+		for _, n := range v.redistNets {
+			c.Sendln(fmt.Sprintf(format, v.name, &n.addr, n.nexthop, n.metric, n.tag))
 		}
 	}
 
 	h := fmt.Sprintf("%s %-5s %-6s %-15s %4s %3s %-8s", header, "FLAGS", "INTERF", "NEIGHBOR", "TOUT", "GC", "UPTIME")
 	f := fmt.Sprintf("%s %%-5s %%-6s %%-15s %%4d %%3d %%8s", format)
 
-	c.Sendln("RIP routes:")
+	c.Sendln(fmt.Sprintf("%s routes:", r.protoName()))
 	c.Sendln("Flags: G=Garbage I=Invalid E=External F=FIB")
 	c.Sendln(h)
 
@@ -547,7 +1078,7 @@ func (r *RipRouter) ShowRoutes(c command.LineSender) {
 
 	sort.Sort(sortByAddr(routeList))
 
-	now := time.Now()
+	now := r.now()
 
 	for i, r := range routeList {
 		flags := ""
@@ -579,121 +1110,255 @@ func (r *RipRouter) ShowRoutes(c command.LineSender) {
 		}
 		uptime := now.Sub(r.creation)
 
-		c.Sendln(fmt.Sprintf(f, routeVrf[i], &r.addr, r.nexthop, r.metric, flags, r.srcIfName, srcRouter, timeout, gc, uptime))
+		c.Sendln(fmt.Sprintf(f, routeVrf[i], &r.addr, r.nexthop, r.metric, r.tag, flags, r.srcIfName, srcRouter, timeout, gc, uptime))
 	}
 }
 
 // NewRipRouter(): Spawn new rip router.
-// Write on RipRouter.done channel (do not close it) to request termination of rip router.
-func NewRipRouter(hw fwd.Dataplane /*, ctx command.ConfContext*/) *RipRouter {
+// Call RipRouter.stop() to request termination of rip router.
+func NewRipRouter(hw fwd.Dataplane, keyChains *ripKeyChains, prefixLists *ripPrefixLists, routeMaps *ripRouteMaps) *RipRouter {
 
 	RIP_GROUP := net.IPv4(224, 0, 0, 9)
 
-	r := &RipRouter{done: make(chan int), input: make(chan *udpInfo), group: RIP_GROUP, readerDone: make(chan int), hardware: hw, config: map[string]*ripInterfaceConfig{}}
+	return newRouter(RIP_FAMILY_INET, RIP_PORT, RIP_GROUP, hw, keyChains, prefixLists, routeMaps)
+}
+
+// NewRipngRouter(): Spawn new RIPng (RFC2080) router.
+// RIPng shares timers and garbage collection with RIPv2, only the packet format differs.
+func NewRipngRouter(hw fwd.Dataplane, prefixLists *ripPrefixLists, routeMaps *ripRouteMaps) *RipRouter {
+
+	RIPNG_GROUP := net.ParseIP("ff02::9")
+
+	// RIPng does not carry authentication: it relies on IPsec
+	return newRouter(RIP_FAMILY_INET6, RIPNG_PORT, RIPNG_GROUP, hw, newRipKeyChains(), prefixLists, routeMaps)
+}
+
+func (r *RipRouter) protoName() string {
+	if r.family == RIP_FAMILY_INET6 {
+		return "RIPng"
+	}
+	return "RIP"
+}
+
+func newRouter(family, udpPort int, group net.IP, hw fwd.Dataplane, keyChains *ripKeyChains, prefixLists *ripPrefixLists, routeMaps *ripRouteMaps) *RipRouter {
+
+	r := allocRouter(family, udpPort, group, hw, keyChains, prefixLists, routeMaps, ripSystemClock{})
+
+	r.fibReconcile() // remove routes left behind in FIB by previous instance
 
 	addInterfaces(r)
 
-	go func() {
-		log.Printf("rip router: goroutine started")
+	go r.run()
+
+	return r
+}
+
+// allocRouter(): create router without interfaces or goroutine
+func allocRouter(family, udpPort int, group net.IP, hw fwd.Dataplane, keyChains *ripKeyChains, prefixLists *ripPrefixLists, routeMaps *ripRouteMaps, clock ripClock) *RipRouter {
+	return &RipRouter{family: family, udpPort: udpPort, done: make(chan int), finished: make(chan struct{}), requests: make(chan ripPending), input: make(chan *udpInfo), group: group, readerDone: make(chan int), hardware: hw, config: map[string]*ripInterfaceConfig{},
+		keyChains: keyChains, authSeqIn: map[string]uint32{}, distLists: map[ripFilterKey][]string{}, offsetLists: map[ripFilterKey][]ripOffsetList{}, policies: map[ripFilterKey][]string{}, prefixLists: prefixLists,
+		routeMaps: routeMaps, redist: map[string]ripRedist{}, clock: clock}
+}
+
+// stop(): request end of RipRouter goroutine, unless it has already finished
+func (r *RipRouter) stop() {
+	select {
+	case r.done <- 1:
+	case <-r.finished:
+	}
+}
+
+// run(): RipRouter goroutine -- the single owner of the routing table
+func (r *RipRouter) run() {
+	log.Printf("rip router: goroutine started")
 
-		updateInterval := time.Second * time.Duration(RIP_UPDATE_INTERVAL)
-		r.updateTicker = time.NewTicker(updateInterval)
-		defer r.updateTicker.Stop()
-		r.updateNext = time.Now().Add(updateInterval)
+	updateInterval := ripUpdateJitter(r.getTimers().update)
+	r.updateTimer = r.clock.NewTimer(updateInterval)
+	defer r.updateTimer.Stop()
+	r.updateNext = r.now().Add(updateInterval)
 
-		r.triggeredTimer = time.NewTimer(time.Second * time.Duration(10))
-		defer r.triggeredTimer.Stop()
-		r.triggeredTimer.Stop() // prevent from running now
+	r.triggeredTimer = r.clock.NewTimer(time.Second * time.Duration(10))
+	defer r.triggeredTimer.Stop()
+	r.triggeredTimer.Stop() // prevent from running now
 
-	LOOP:
-		for {
-			select {
-			case <-r.triggeredTimer.C:
-				r.triggeredLast = time.Now()  // keep track of most recent triggered update
+LOOP:
+	for {
+		select {
+		case p := <-r.requests:
+			p.req.serve(r)
+			close(p.done)
+		case <-r.triggeredTimer.C():
+			r.triggeredLast = r.now() // keep track of most recent triggered update
+			r.triggeredHold = r.triggeredLast.Add(ripTriggeredHold())
+			r.triggeredNext = time.Time{} // not running
+			r.sendUpdate(true)
+		case <-r.updateTimer.C():
+			r.redistSync() // pick up changes in redistributed routes
+			r.garbageCollect()
+			if !r.triggeredNext.IsZero() {
+				// regular update supersedes pending triggered update
+				r.triggeredTimer.Stop()
 				r.triggeredNext = time.Time{} // not running
-				log.Printf("rip router: FIXME WRITEME send triggered update")
-			case <-r.updateTicker.C:
-				r.garbageCollect()
-				r.updateNext = time.Now().Add(updateInterval)
-				log.Printf("rip router: FIXME WRITEME send periodic update: nextUpdate=%v", r.updateNext)
-			case <-r.done:
-				// finish requested
-				log.Printf("rip router: finish request received")
-				delInterfaces(r) // break udpReader goroutines
-			case <-r.readerDone:
-				// one udpReader goroutine finished
-				r.readerCount--
-				if r.readerCount < 1 {
-					// all udpReader goroutines finished
-					break LOOP
-				}
-			case u, ok := <-r.input:
-				if !ok {
-					log.Printf("rip router: udpReader channel closed")
-					break LOOP
-				}
-				parseRipPacket(r, u)
 			}
+			updateInterval = ripUpdateJitter(r.getTimers().update)
+			r.updateTimer.Reset(updateInterval)
+			r.updateNext = r.now().Add(updateInterval)
+			r.sendUpdate(false)
+			log.Printf("rip router: periodic update sent: nextUpdate=%v", r.updateNext)
+		case <-r.done:
+			// finish requested
+			log.Printf("rip router: finish request received")
+			delInterfaces(r) // break udpReader goroutines
+			if r.readerCount < 1 {
+				break LOOP // no udpReader goroutine to wait for
+			}
+		case <-r.readerDone:
+			// one udpReader goroutine finished
+			r.readerCount--
+			if r.readerCount < 1 {
+				// all udpReader goroutines finished
+				break LOOP
+			}
+		case u, ok := <-r.input:
+			if !ok {
+				log.Printf("rip router: udpReader channel closed")
+				break LOOP
+			}
+			parseRipPacket(r, u)
 		}
+	}
 
-		log.Printf("rip router: goroutine finished")
-	}()
+	r.fibFlush() // withdraw our routes from FIB
 
-	return r
+	close(r.finished) // release pending calls
+
+	log.Printf("rip router: goroutine finished")
 }
 
 // trigUpdate: schedule triggered update
 func (r *RipRouter) trigUpdate(now time.Time) {
 
-	if r.updateTicker == nil || r.triggeredTimer == nil {
+	if r.updateTimer == nil || r.triggeredTimer == nil {
 		log.Printf("RipRouter.trigUpdate: timers uninitialized")
 		return
 	}
 
-	if !r.triggeredNext.IsZero() {
-		log.Printf("RipRouter.trigUpdate: timer already running: next=%v", r.triggeredNext)
-		return
+	if !r.triggeredNext.IsZero() {
+		log.Printf("RipRouter.trigUpdate: timer already running: next=%v", r.triggeredNext)
+		return
+	}
+
+	if r.updateNext.Sub(now) < time.Second*time.Duration(5) {
+		log.Printf("RipRouter.trigUpdate: too much close to a regular update: regularNext=%v", r.updateNext)
+		return
+	}
+
+	var triggeredInterval time.Duration
+
+	if now.Before(r.triggeredHold) {
+		// we had a recent triggered update
+		// delay update until end of random holddown
+		log.Printf("RipRouter.trigUpdate: delaying triggered update due to recent recurrence: last=%v", r.triggeredLast)
+		triggeredInterval = r.triggeredHold.Sub(now)
+	} else {
+		log.Printf("RipRouter.trigUpdate: scheduling immediate update")
+	}
+
+	r.triggeredNext = now.Add(triggeredInterval)
+	r.triggeredTimer.Reset(triggeredInterval)
+	log.Printf("RipRouter.trigUpdate: triggered update scheduled: %v", r.triggeredNext)
+}
+
+// sendUpdate(): called from RipRouter goroutine
+// Send unsolicited response to RIP group on every RIP interface.
+// triggered=true: send only routes flagged with routeChanged.
+// triggered=false: send full routing table (regular update).
+func (r *RipRouter) sendUpdate(triggered bool) {
+
+	for _, p := range r.ports {
+		ifname := p.iface.Name
+		if r.getInterfacePassive(ifname) {
+			continue // passive interface: do not send updates
+		}
+		vrf, err := r.hardware.InterfaceVrfGet(ifname)
+		if err != nil {
+			log.Printf("RipRouter.sendUpdate: unable to find VRF for interface '%s': %v", ifname, err)
+			continue
+		}
+		dst := &net.UDPAddr{IP: r.group, Port: r.udpPort}
+		if r.family == RIP_FAMILY_INET6 {
+			dst.Zone = ifname // link-local scope
+		} else if r.getInterfaceSendVersion(ifname) != RIP_SEND_V2 {
+			dst.IP = net.IPv4bcast // RIPv1 routers listen to broadcast
+		}
+		r.sendTable(vrf, p, dst, ifname, p.iface.Index, triggered)
+		if triggered {
+			r.statsUpdate(ifname, func(s *ripStats) { s.triggeredUpdates++ })
+		}
+	}
+
+	// unicast updates to neighbors on non-broadcast links (even on passive interfaces)
+	for _, nbr := range r.getNeighbors() {
+		p := r.neighborPort(nbr)
+		if p == nil {
+			log.Printf("RipRouter.sendUpdate: neighbor %v is not directly connected", nbr)
+			continue
+		}
+		ifname := p.iface.Name
+		vrf, err := r.hardware.InterfaceVrfGet(ifname)
+		if err != nil {
+			log.Printf("RipRouter.sendUpdate: unable to find VRF for interface '%s': %v", ifname, err)
+			continue
+		}
+		dst := &net.UDPAddr{IP: nbr, Port: r.udpPort}
+		r.sendTable(vrf, p, dst, ifname, p.iface.Index, triggered)
 	}
 
-	if r.updateNext.Sub(now) < time.Second*time.Duration(5) {
-		log.Printf("RipRouter.trigUpdate: too much close to a regular update: regularNext=%v", r.updateNext)
+	/*
+		RFC2453 3.10.1 Triggered Updates
+		After a triggered update is processed, the route change flags
+		should be cleared. Regular updates carry every route, hence
+		they also clear the flags.
+	*/
+	r.clearRouteChanged()
+}
+
+// sendTable(): send routing table according to protocol packet format
+func (r *RipRouter) sendTable(vrfname string, p *port, dst *net.UDPAddr, ifname string, ifindex int, changedOnly bool) {
+	if r.family == RIP_FAMILY_INET6 {
+		ripngSendTable(r, vrfname, p, dst, ifname, ifindex, changedOnly)
 		return
 	}
+	ripSendTable(r, vrfname, p, dst, ifname, ifindex, changedOnly)
+}
 
-	var triggeredInterval time.Duration
+func (r *RipRouter) clearRouteChanged() {
 
-	if now.Sub(r.triggeredLast) < time.Second*time.Duration(5) {
-		// we had a recent triggered update
-		// delay update for a random interval
-		log.Printf("RipRouter.trigUpdate: delaying triggered update due to recent recurrence: last=%v", r.triggeredLast)
-		interval := 5
-		triggeredInterval = time.Second * time.Duration(interval)
-		log.Printf("RipRouter.trigUpdate: FIXME randomize interval (now using %d seconds)", interval)
-	} else {
-		log.Printf("RipRouter.trigUpdate: scheduling immediate update")
+	for _, v := range r.vrfs {
+		for _, route := range v.routes {
+			route.routeChanged = false
+		}
 	}
-
-	r.triggeredNext = now.Add(triggeredInterval)
-	r.triggeredTimer.Reset(triggeredInterval)
-	log.Printf("RipRouter.trigUpdate: triggered update scheduled: %v", r.triggeredNext)
 }
 
 func parseRipPacket(r *RipRouter, u *udpInfo) {
+
+	if r.family == RIP_FAMILY_INET6 {
+		parseRipngPacket(r, u)
+		return
+	}
+
 	/*
 		log.Printf("parseRipPacket: recv %d bytes from %v to %v on %s ifIndex=%d",
 			len(u.info), &u.src, &u.dst, u.ifName, u.ifIndex)
 	*/
 
-	size := len(u.info)
-	entries := (size - RIP_HEADER_SIZE) / RIP_ENTRY_SIZE
-	if entries < 1 {
+	r.statsUpdate(u.ifName, func(s *ripStats) { s.packetsRecv++ })
+
+	if len(u.info) < ripEntryOffset(1) {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
 		log.Printf("parseRipPacket: short packet size=%d bytes from %v to %v on %s ifIndex=%d",
-			size, &u.src, &u.dst, u.ifName, u.ifIndex)
-		return
-	}
-	if entries > RIP_PKT_MAX_ENTRIES {
-		log.Printf("parseRipPacket: long packet size=%d bytes from %v to %v on %s ifIndex=%d",
-			size, &u.src, &u.dst, u.ifName, u.ifIndex)
+			len(u.info), &u.src, &u.dst, u.ifName, u.ifIndex)
 		return
 	}
 
@@ -705,6 +1370,13 @@ func parseRipPacket(r *RipRouter, u *udpInfo) {
 			entries, cmd, version, size, &u.src, &u.dst, u.ifName, u.ifIndex)
 	*/
 
+	if !ripRecvAccept(r.getInterfaceRecvVersion(u.ifName), version) {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("parseRipPacket: version %d not accepted from %v to %v on %s ifIndex=%d",
+			version, &u.src, &u.dst, u.ifName, u.ifIndex)
+		return
+	}
+
 	vrf, err := r.hardware.InterfaceVrfGet(u.ifName)
 	if err != nil {
 		log.Printf("parseRipPacket: unable to find VRF for interface '%s': %v", u.ifName, err)
@@ -718,12 +1390,59 @@ func parseRipPacket(r *RipRouter, u *udpInfo) {
 		return
 	}
 
+	auth := r.getInterfaceAuth(u.ifName)
+
+	info, seq, errAuth := ripAuthCheck(u.info, version, auth, r.keyChains, r.now())
+	if errAuth != nil {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.authFailures++ })
+		log.Printf("parseRipPacket: authentication failure: %v: from %v to %v on %s ifIndex=%d",
+			errAuth, &u.src, &u.dst, u.ifName, u.ifIndex)
+		return
+	}
+
+	if auth.mode == RIP_AUTH_CRYPTO {
+		/*
+			RFC4822 3.2.2 Receiving
+			Discard packet with sequence number lower than
+			the last one received from the same neighbor.
+		*/
+		neighbor := u.src.IP.String()
+		if last, found := r.authSeqIn[neighbor]; found && seq < last {
+			r.statsUpdate(u.ifName, func(s *ripStats) { s.authFailures++ })
+			log.Printf("parseRipPacket: replayed packet: seq=%d last=%d from %v to %v on %s ifIndex=%d",
+				seq, last, &u.src, &u.dst, u.ifName, u.ifIndex)
+			return
+		}
+		r.authSeqIn[neighbor] = seq
+	}
+
+	u.info = info // authentication removed
+
+	size := len(u.info)
+	entries := (size - RIP_HEADER_SIZE) / RIP_ENTRY_SIZE
+	if entries < 1 {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("parseRipPacket: short packet size=%d bytes from %v to %v on %s ifIndex=%d",
+			size, &u.src, &u.dst, u.ifName, u.ifIndex)
+		return
+	}
+	if entries > RIP_PKT_MAX_ENTRIES {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
+		log.Printf("parseRipPacket: long packet size=%d bytes from %v to %v on %s ifIndex=%d",
+			size, &u.src, &u.dst, u.ifName, u.ifIndex)
+		return
+	}
+
 	switch cmd {
 	case RIP_REQUEST:
+		if !r.requestAccept(u) {
+			return
+		}
 		ripParseRequest(r, u, port, size, version, entries, vrf)
 	case RIP_RESPONSE:
 		ripParseResponse(r, u, port, size, version, entries, vrf)
 	default:
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
 		log.Printf("parseRipPacket: unknown command %d version=%d size=%d from %v to %v on %s ifIndex=%d",
 			cmd, version, size, &u.src, &u.dst, u.ifName, u.ifIndex)
 	}
@@ -749,7 +1468,7 @@ func ripParseRequest(r *RipRouter, u *udpInfo, p *port, size, version, entries i
 		*/
 		family, _, _, _, metric := parseEntry(u.info, 0)
 		if family == 0 && metric == RIP_METRIC_INFINITY {
-			ripSendTable(r, vrf, p, &u.src, u.ifName, u.ifIndex)
+			ripSendTable(r, vrf, p, &u.src, u.ifName, u.ifIndex, false)
 			return
 		}
 	}
@@ -764,14 +1483,25 @@ func ripParseRequest(r *RipRouter, u *udpInfo, p *port, size, version, entries i
 		destination, put infinity in the metric field.  Once all the entries
 		have been filled in, change the command from Request to Response and
 		send the datagram back to the requestor.
+
+		Split horizon is not applied here, since these specific
+		queries are used for diagnostic purposes.
 	*/
 
 	u.info[0] = RIP_RESPONSE // change command to rip response
 
 	// Update metric for every network in the request
 
+	var ifaceAddrs []net.IPNet
+	if version == RIP_V1 {
+		ifaceAddrs, _ = r.hardware.InterfaceAddressGet(u.ifName) // for RIPv1 mask derivation
+	}
+
 	for i := 0; i < entries; i++ {
 		_, _, addr, _, _ := parseEntry(u.info, i)
+		if version == RIP_V1 {
+			addr.Mask = ripV1Mask(addr.IP, ifaceAddrs)
+		}
 		route, _ := r.lookupAddressFirstMatch(vrf, addr)
 		var metric int
 		if route == nil {
@@ -784,15 +1514,26 @@ func ripParseRequest(r *RipRouter, u *udpInfo, p *port, size, version, entries i
 	}
 
 	// Echo request back to source
-	if err := ripSend(p, &u.src, u.info, u.ifName, u.ifIndex); err != nil {
+
+	auth := r.getInterfaceAuth(u.ifName)
+	buf := u.info
+	if auth.enabled() {
+		// reserve first entry for authentication
+		buf = make([]byte, size+RIP_ENTRY_SIZE)
+		copy(buf, u.info[:RIP_HEADER_SIZE])
+		copy(buf[ripEntryOffset(1):], u.info[RIP_HEADER_SIZE:])
+	}
+
+	if err := ripSendAuth(r, p, auth, &u.src, buf, u.ifName, u.ifIndex); err != nil {
 		log.Printf("ripParseRequest: %v", err)
+		return
 	}
+	r.statsSent(u.ifName, entries)
 }
 
-func ripSendTable(r *RipRouter, vrfname string, p *port, dst *net.UDPAddr, ifname string, ifindex int) {
-
-	defer r.vrfMutex.RUnlock()
-	r.vrfMutex.RLock()
+// ripSendTable(): send routing table as RIP responses.
+// changedOnly=true: include only routes flagged with routeChanged (triggered update).
+func ripSendTable(r *RipRouter, vrfname string, p *port, dst *net.UDPAddr, ifname string, ifindex int, changedOnly bool) {
 
 	_, v := r.vrfGet(vrfname)
 	if v == nil {
@@ -800,27 +1541,32 @@ func ripSendTable(r *RipRouter, vrfname string, p *port, dst *net.UDPAddr, ifnam
 		return
 	}
 
-	validRoutes := []*ripRoute{}
+	ifaceAddrs, err1 := r.hardware.InterfaceAddressGet(ifname)
+	if err1 != nil {
+		log.Printf("ripSendTable: unable to find addresses for interface %s: %v", ifname, err1)
+	}
 
-	now := time.Now()
+	validRoutes, validMetrics, validTags := r.advertisedRoutes(v, ifname, ifindex, changedOnly)
 
-	for _, route := range v.routes {
-		if route.isGarbage(now) {
-			/*
-			   Until the garbage-collection timer expires, the route
-			   is included in all updates sent by this router.
-			*/
-			continue
+	auth := r.getInterfaceAuth(ifname)
+
+	version := RIP_V2
+	if r.getInterfaceSendVersion(ifname) == RIP_SEND_V1 {
+		version = RIP_V1
+		if auth.enabled() {
+			log.Printf("ripSendTable: RIPv1 cannot carry authentication on interface '%s'", ifname)
+			return
 		}
-		validRoutes = append(validRoutes, route)
 	}
 
-	entries := len(validRoutes)
-	buf := make([]byte, RIP_PKT_MAX_SIZE) // largest possible buffer
+	// authentication takes the place of the first entry
+	firstEntry := 0
+	if auth.enabled() {
+		firstEntry = 1
+	}
+	maxEntries := RIP_PKT_MAX_ENTRIES - firstEntry
 
-	// packet header
-	buf[0] = RIP_RESPONSE // command response
-	buf[1] = RIP_V2       // version 2
+	entries := len(validRoutes)
 
 	// scan all valid entries
 	for entry := 0; entry < entries; {
@@ -828,58 +1574,208 @@ func ripSendTable(r *RipRouter, vrfname string, p *port, dst *net.UDPAddr, ifnam
 		// send batches of up to 25 entries
 
 		bufEntries := entries - entry
-		if bufEntries > RIP_PKT_MAX_ENTRIES {
-			bufEntries = RIP_PKT_MAX_ENTRIES
+		if bufEntries > maxEntries {
+			bufEntries = maxEntries
 		}
-		batchSize := ripEntryOffset(bufEntries)
-		b := buf[:batchSize]
+		b := make([]byte, ripEntryOffset(firstEntry+bufEntries))
 
-		for i := 0; i < bufEntries; i++ {
+		// packet header
+		b[0] = RIP_RESPONSE // command response
+		b[1] = byte(version)
+
+		for i := firstEntry; i < firstEntry+bufEntries; i++ {
 			route := validRoutes[entry]
-			setEntry(b, i, route.Family(), route.tag, route.addr, route.nexthop, route.metric)
+			if version == RIP_V1 {
+				setEntryV1(b, i, route.Family(), route.addr.IP, validMetrics[entry])
+			} else {
+				nexthop := ripAdvertisedNexthop(route.nexthop, ifaceAddrs)
+				setEntry(b, i, route.Family(), validTags[entry], route.addr, nexthop, validMetrics[entry])
+			}
 			entry++
 		}
 
-		if err := ripSend(p, dst, b, ifname, ifindex); err != nil {
+		if err := ripSendAuth(r, p, auth, dst, b, ifname, ifindex); err != nil {
 			log.Printf("ripSendTable: %v", err)
+			continue
 		}
+		r.statsSent(ifname, bufEntries)
 	}
 }
 
-func ripSend(p *port, dst *net.UDPAddr, buf []byte, ifname string, ifindex int) error {
+// advertisedRoutes(): select routes to be sent on interface, along with their advertised metrics and tags.
+// Runs within RipRouter goroutine.
+func (r *RipRouter) advertisedRoutes(v *ripVrf, ifname string, ifindex int, changedOnly bool) ([]*ripRoute, []int, []uint16) {
+
+	splitHorizon := r.getInterfaceSplitHorizon(ifname)
+
+	validRoutes := []*ripRoute{}
+	validMetrics := []int{}
+	validTags := []uint16{}
+	prefixIndex := map[string]int{} // ECMP: advertise single entry per prefix
+	prefixChanged := map[string]bool{}
+
+	now := r.now()
+
+	for _, route := range v.routes {
+		if route.isGarbage(now) {
+			/*
+			   Until the garbage-collection timer expires, the route
+			   is included in all updates sent by this router.
+			*/
+			continue
+		}
+		prefix := route.addr.String()
+		if route.routeChanged {
+			prefixChanged[prefix] = true
+		}
+		metric, send := ripSplitHorizonMetric(route, ifindex, splitHorizon)
+		if !send {
+			continue
+		}
+		if !r.filterPermit(RIP_FILTER_OUT, ifname, &route.addr) {
+			continue // rejected by distribute-list
+		}
+		permit, attr := r.policyApply(RIP_FILTER_OUT, ifname, &route.addr, ripRouteAttr{metric: metric, tag: route.tag})
+		if !permit {
+			continue // rejected by route-map
+		}
+		if metric < RIP_METRIC_INFINITY {
+			metric = attr.metric // poisoned or withdrawn routes keep metric infinity
+		}
+		metric += r.metricOffset(RIP_FILTER_OUT, ifname, &route.addr)
+		if metric > RIP_METRIC_INFINITY {
+			metric = RIP_METRIC_INFINITY
+		}
+		if i, found := prefixIndex[prefix]; found {
+			// another path for same prefix: keep the best one
+			if metric < validMetrics[i] {
+				validRoutes[i] = route
+				validMetrics[i] = metric
+				validTags[i] = attr.tag
+			}
+			continue
+		}
+		prefixIndex[prefix] = len(validRoutes)
+		validRoutes = append(validRoutes, route)
+		validMetrics = append(validMetrics, metric)
+		validTags = append(validTags, attr.tag)
+	}
 
-	if p.send == nil {
-		log.Printf("ripSend: creating sender socket for interface '%s' ifIndex=%d dst=%v", ifname, ifindex, dst)
-		localAddr := &net.UDPAddr{IP: net.IPv4zero, Port: RIP_PORT}
-		var err error
-		p.send, err = sock.NewUDPConn(localAddr, ifname)
+	validChanged := make([]bool, len(validRoutes))
+	for i, route := range validRoutes {
+		validChanged[i] = prefixChanged[route.addr.String()]
+	}
+
+	if summaries := r.getSummaries(ifname); len(summaries) > 0 {
+		validRoutes, validMetrics, validTags, validChanged = ripSummarize(summaries, validRoutes, validMetrics, validTags, validChanged)
+	}
+
+	if r.family == RIP_FAMILY_INET && r.getInterfaceSendVersion(ifname) == RIP_SEND_V1 {
+		ifaceAddrs, err := r.hardware.InterfaceAddressGet(ifname)
 		if err != nil {
-			return fmt.Errorf("ripSend: error creating sender socket for interface '%s' ifIndex=%d dst=%v: %v", ifname, ifindex, dst, err)
+			log.Printf("RipRouter.advertisedRoutes: unable to find addresses for interface %s: %v", ifname, err)
+		}
+		validRoutes, validMetrics, validTags, validChanged = ripV1Routes(ifaceAddrs, validRoutes, validMetrics, validTags, validChanged)
+	}
+
+	if !changedOnly {
+		return validRoutes, validMetrics, validTags
+	}
+
+	// triggered update: only prefixes with some changed path
+	changedRoutes := []*ripRoute{}
+	changedMetrics := []int{}
+	changedTags := []uint16{}
+	for i, route := range validRoutes {
+		if validChanged[i] {
+			changedRoutes = append(changedRoutes, route)
+			changedMetrics = append(changedMetrics, validMetrics[i])
+			changedTags = append(changedTags, validTags[i])
+		}
+	}
+
+	return changedRoutes, changedMetrics, changedTags
+}
+
+/*
+RFC2453 3.4.3 Split horizon
+
+Simple split horizon omits routes learned from one neighbor in updates
+sent to that neighbor. Split horizon with poisoned reverse includes such
+routes in updates, but sets their metrics to infinity.
+
+ripSplitHorizonMetric() returns the metric to advertise for the route
+on interface ifindex, and whether the route should be sent at all.
+*/
+func ripSplitHorizonMetric(route *ripRoute, ifindex, mode int) (int, bool) {
+	if !route.srcExternal || route.srcIfIndex != ifindex {
+		return route.metric, true // route was not learned from this interface
+	}
+
+	switch mode {
+	case RIP_SPLIT_HORIZON_DISABLE:
+		return route.metric, true
+	case RIP_SPLIT_HORIZON_POISONED_REVERSE:
+		return RIP_METRIC_INFINITY, true
+	}
+
+	return route.metric, false // simple split horizon
+}
+
+/*
+RFC2453 4.4 Next Hop
+
+Specifying a value of 0.0.0.0 in this field indicates that routing
+should be via the originator of the RIP advertisement. An address
+specified as a next hop must, per force, be directly reachable on
+the logical subnet over which the advertisement is made.
+*/
+func ripAdvertisedNexthop(nexthop net.IP, ifaceAddrs []net.IPNet) net.IP {
+	for _, a := range ifaceAddrs {
+		if a.Contains(nexthop) {
+			return nexthop
+		}
+	}
+	return net.IPv4zero
+}
+
+// ripSendAuth(): sign packet according to interface authentication, then send it.
+// When authentication is enabled, the first entry of buf must be reserved for it.
+func ripSendAuth(r *RipRouter, p *port, auth ripAuth, dst *net.UDPAddr, buf []byte, ifname string, ifindex int) error {
+
+	if auth.enabled() {
+		key := r.keyChains.sendKey(auth.keyChain, r.now())
+		if key == nil {
+			return fmt.Errorf("ripSendAuth: no valid send key in chain=[%s] for interface '%s'", auth.keyChain, ifname)
 		}
+		p.authSeq++
+		buf = ripAuthSign(buf, auth, key, p.authSeq)
 	}
 
-	conn := p.send
+	return ripSend(p, dst, buf, ifname, ifindex)
+}
 
-	// Set 500 ms timeout
-	timeout := time.Duration(500) * time.Millisecond
-	deadline := time.Now().Add(timeout)
-	conn.SetWriteDeadline(deadline)
+func ripSend(p *port, dst *net.UDPAddr, buf []byte, ifname string, ifindex int) error {
 
 	size := len(buf)
 
-	n, err := conn.WriteToUDP(buf, dst)
-	if err != nil {
+	if err := p.transport.send(dst, buf); err != nil {
 		return fmt.Errorf("ripSend: error writing size=%d to %v on %s ifIndex=%d: %v", size, dst, ifname, ifindex, err)
 	}
-	if n != size {
-		return fmt.Errorf("ripSend: partial %d/%d write to %v on %s ifIndex=%d", n, size, dst, ifname, ifindex)
-	}
 
 	log.Printf("ripSend: wrote size=%d to %v on %s ifIndex=%d", size, dst, ifname, ifindex)
 
 	return nil
 }
 
+// ripSendOptions(): prepare listening socket for sending updates
+func ripSendOptions(p *ipv4.PacketConn, ifname string) {
+	// do not receive our own multicast updates
+	if err := p.SetMulticastLoopback(false); err != nil {
+		log.Printf("ripSendOptions: could not disable multicast loopback for interface '%s': %v", ifname, err)
+	}
+}
+
 func ripEntryOffset(entry int) int {
 	return RIP_HEADER_SIZE + RIP_ENTRY_SIZE*entry
 }
@@ -923,6 +1819,7 @@ func ripParseResponse(r *RipRouter, u *udpInfo, p *port, size, version, entries
 		The Response must be ignored if it is not from the RIP port.
 	*/
 	if u.src.Port != RIP_PORT {
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
 		log.Printf("ripParseResponse: not from RIP port (520): vrf=[%s] src=%v on '%s' ifIndex=%d", vrf, u.src.IP, u.ifName, u.ifIndex)
 		return
 	}
@@ -945,13 +1842,18 @@ func ripParseResponse(r *RipRouter, u *udpInfo, p *port, size, version, entries
 
 	found := false
 	for _, a := range ifaceAddrs {
+		if a.IP.Equal(u.src.IP) {
+			return // ignore our own packet
+		}
 		found = a.Contains(u.src.IP)
 		//log.Printf("ripParseResponse: if=%s addr=%v src=%v found=%v", u.ifName, a, u.src.IP, found)
 		if found {
 			break
 		}
 	}
-	if !found {
+	if !found && !r.isNeighbor(u.src.IP) {
+		// configured neighbors are accepted on unnumbered/point-to-point links
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.badPackets++ })
 		log.Printf("ripParseResponse: not directly connected response: vrf=[%s] src=%v on '%s' ifIndex=%d", vrf, u.src.IP, u.ifName, u.ifIndex)
 		return // ignore response from non-directly-connected address
 	}
@@ -977,6 +1879,13 @@ func ripParseResponse(r *RipRouter, u *udpInfo, p *port, size, version, entries
 	log.Printf("ripParseResponse: VALID RESPONSE entries=%d version=%d size=%d from %v to %v on %s ifIndex=%d",
 		entries, version, size, &u.src, &u.dst, u.ifName, u.ifIndex)
 
+	r.peerHeard(u.src.IP, u.ifName, version, r.now())
+
+	if r.peerSuspended(u.src.IP, u.ifName) {
+		log.Printf("ripParseResponse: learning suspended by maximum-prefix: vrf=[%s] src=%v on '%s' ifIndex=%d", vrf, u.src.IP, u.ifName, u.ifIndex)
+		return
+	}
+
 	for i := 0; i < entries; i++ {
 		family, tag, netaddr, nexthop, metric := parseEntry(u.info, i)
 
@@ -988,31 +1897,73 @@ func ripParseResponse(r *RipRouter, u *udpInfo, p *port, size, version, entries
 		if metric < 1 || metric > RIP_METRIC_INFINITY {
 			log.Printf("ripParseResponse: bad metric entry=%d/%d family=%d tag=%d net=%v nexthop=%v metric=%d from %v to %v on %s ifIndex=%d",
 				i, entries, family, tag, &netaddr, nexthop, metric, &u.src, &u.dst, u.ifName, u.ifIndex)
+			r.statsUpdate(u.ifName, func(s *ripStats) { s.badRoutes++ })
 			continue // ignore entry with bad metric
 		}
 
-		newMetric := metric + r.getInterfaceRipCost(u.ifName)
+		if version == RIP_V1 {
+			// RIPv1 entry carries neither mask, nexthop nor tag
+			if ones, _ := netaddr.Mask.Size(); ones != 0 || tag != 0 || !nexthop.Equal(net.IPv4zero) {
+				log.Printf("ripParseResponse: nonzero must-be-zero field in RIPv1 entry=%d/%d net=%v from %v to %v on %s ifIndex=%d",
+					i, entries, &netaddr, &u.src, &u.dst, u.ifName, u.ifIndex)
+				r.statsUpdate(u.ifName, func(s *ripStats) { s.badRoutes++ })
+				continue
+			}
+			netaddr.Mask = ripV1Mask(netaddr.IP, ifaceAddrs)
+		}
+
+		r.statsUpdate(u.ifName, func(s *ripStats) { s.routesRecv++ })
+
+		if !r.filterPermit(RIP_FILTER_IN, u.ifName, &netaddr) {
+			continue // rejected by distribute-list
+		}
+
+		permit, attr := r.policyApply(RIP_FILTER_IN, u.ifName, &netaddr, ripRouteAttr{metric: metric, tag: tag})
+		if !permit {
+			continue // rejected by route-map
+		}
+		if metric < RIP_METRIC_INFINITY {
+			metric = attr.metric
+		}
+		tag = attr.tag
+
+		newMetric := metric + r.getInterfaceRipCost(u.ifName) + r.metricOffset(RIP_FILTER_IN, u.ifName, &netaddr)
 		if newMetric > RIP_METRIC_INFINITY {
 			newMetric = RIP_METRIC_INFINITY
 		}
 
-		r.extRouteAdd(vrf, tag, netaddr, nexthop, newMetric, u.ifIndex, u.ifName, u.src.IP)
+		/*
+			Set the next hop address to be the address of the router
+			from which the datagram came
+		*/
+		r.extRouteAdd(vrf, tag, netaddr, u.src.IP, newMetric, u.ifIndex, u.ifName, u.src.IP)
 	}
 
 }
 
 func (r *RipRouter) extRouteAdd(vrfname string, tag uint16, netaddr net.IPNet, nexthop net.IP, metric, ifindex int, ifname string, router net.IP) {
 
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
 	_, v := r.vrfGet(vrfname)
 	if v == nil {
 		log.Printf("RipRouter.routeAdd: VRF not found: vrf=[%s]", vrfname)
 		return
 	}
 
-	now := time.Now()
+	now := r.now()
+	timers := r.getTimers()
+
+	// worse routes are removed only after the new one is installed:
+	// then the FIB sees a replace, not a withdraw
+	deleteList := []*ripRoute{}
+	defer func() {
+		for _, route := range deleteList {
+			route.disable(now, v, timers)
+		}
+	}()
+
+	var same *ripRoute          // existing route from same nexthop
+	others := []*ripRoute{}     // existing routes from other nexthops
+	best := RIP_METRIC_INFINITY // best metric among others
 
 	for _, route := range v.routes {
 		if !route.isValid(now) {
@@ -1021,7 +1972,17 @@ func (r *RipRouter) extRouteAdd(vrfname string, tag uint16, netaddr net.IPNet, n
 		if !addr.NetEqual(&netaddr, &route.addr) {
 			continue // ignore routes for other prefixes
 		}
+		if route.nexthop.Equal(nexthop) {
+			same = route
+			continue
+		}
+		others = append(others, route)
+		if route.metric < best {
+			best = route.metric
+		}
+	}
 
+	if same != nil {
 		/*
 			If there is an existing route, compare the next hop
 			address to the address of the router from which the
@@ -1029,51 +1990,64 @@ func (r *RipRouter) extRouteAdd(vrfname string, tag uint16, netaddr net.IPNet, n
 			router as the existing route, reinitialize the
 			timeout.
 		*/
-		sameNexthop := route.nexthop.Equal(router)
-		if sameNexthop {
-			route.resetTimer(now)
-		}
+		same.resetTimer(now, timers)
 
-		if metric < route.metric {
-			// new route will be better, remove the old (current) one
-			route.disable(now)
-			continue
+		if tag != same.tag {
+			same.tag = tag
+			same.routeChanged = true
+			r.trigUpdate(now) // propagate new tag
 		}
 
-		if sameNexthop {
-
-			// same prefix/nexthop
-
-			if metric != route.metric {
-				// only update metric
-				route.metric = metric
-				route.routeChanged = true
-				r.trigUpdate(now) // schedule triggered update
-			} // else: exact same prefix/nexthop/metric: do nothing (timer was reset above)
+		if metric == same.metric {
+			return // exact same prefix/nexthop/metric: do nothing (timer was reset above)
+		}
 
-			return // do not add route below
+		if metric >= RIP_METRIC_INFINITY || metric > best {
+			// path became unreachable, or worse than other paths: leave ECMP set
+			deleteList = append(deleteList, same)
+			r.trigUpdate(now) // schedule triggered update
+			return
 		}
 
-		// distinct nexthop
+		// only update metric
+		same.metric = metric
+		same.routeChanged = true
 
-		if metric > route.metric {
-			return // new nexthop with worse metric: do not add route below
+		if metric < best {
+			// path became better than other paths: remove them
+			deleteList = append(deleteList, others...)
 		}
 
-		// distinc nexthop with same metric: could add route below as ECMP
+		v.fibSync(&same.addr) // replace metric in FIB
+		r.trigUpdate(now)     // schedule triggered update
+		return
 	}
 
-	// add new external route
+	// distinct nexthop
 
-	if metric == RIP_METRIC_INFINITY {
+	if metric >= RIP_METRIC_INFINITY {
 		return // refuse to add new route with metric infinity
 	}
 
-	// Set the next hop address to be the address of the router
-	// from which the datagram came
-	newNexthop := router
+	if metric > best {
+		return // new nexthop with worse metric: do not add route
+	}
+
+	if metric < best {
+		// new route will be better, remove the old (current) ones
+		deleteList = append(deleteList, others...)
+	} else if len(others) >= r.getMaximumPaths() {
+		return // distinct nexthop with same metric, but ECMP set is full
+	}
+
+	if !r.prefixLimitAccept(v, &netaddr, router, ifname, len(others) == 0) {
+		return // route beyond maximum-prefix
+	}
+
+	// add new external route
 
-	newRoute := newRipRoute(netaddr, newNexthop, metric, now, r)
+	newRoute := newRipRoute(netaddr, nexthop, metric, now, r)
+	newRoute.tag = tag
 	newRoute.srcExternal = true
 	newRoute.srcIfIndex = ifindex
 	newRoute.srcIfName = ifname
@@ -1083,15 +2057,12 @@ func (r *RipRouter) extRouteAdd(vrfname string, tag uint16, netaddr net.IPNet, n
 
 func (r *RipRouter) lookupAddressFirstMatch(vrfname string, netaddr net.IPNet) (*ripRoute, error) {
 
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
 	_, v := r.vrfGet(vrfname)
 	if v == nil {
 		return nil, fmt.Errorf("lookupAddressFirstMatch: VRF not found: vrf=[%s]", vrfname)
 	}
 
-	now := time.Now()
+	now := r.now()
 
 	for _, route := range v.routes {
 		if !route.isValid(now) {
@@ -1130,7 +2101,7 @@ func (r *RipRouter) vrfGet(vrf string) (int, *ripVrf) {
 func (r *RipRouter) vrfAdd(vrf string) *ripVrf {
 	//log.Printf("vrfAdd: %s size=%d", vrf, len(r.vrfs))
 
-	v := &ripVrf{name: vrf}
+	v := &ripVrf{name: vrf, hardware: r.hardware}
 	r.vrfs = append(r.vrfs, v)
 	return v
 }
@@ -1145,82 +2116,51 @@ func (r *RipRouter) vrfDel(index int) {
 }
 
 func (r *RipRouter) NetAdd(vrf, netAddr string) error {
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
-	v := r.vrfSet(vrf)
-	err := v.NetAdd(netAddr, r)
-
-	//log.Printf("RipRouter.NetAdd(%s,%s) after:", vrf, netAddr)
-	//r.dump(&ripDumper{})
-
-	return err
+	req := &ripNetRequest{op: ripNetAdd, vrf: vrf, netAddr: netAddr}
+	r.request(req)
+	return req.err
 }
 
 func (r *RipRouter) NetDel(vrf, netAddr string) error {
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
-	i, v := r.vrfGet(vrf)
-	if v == nil {
-		return fmt.Errorf("RipRouter.NetDel: vrf not found: vrf=[%s] addr=[%s]", vrf, netAddr)
-	}
-	err := v.NetDel(netAddr) // remove net from VRF
-	if v.Empty() {
-		r.vrfDel(i)
-	}
-	return err
+	req := &ripNetRequest{op: ripNetDel, vrf: vrf, netAddr: netAddr}
+	r.request(req)
+	return req.err
 }
 
 func (r *RipRouter) NetNexthopAdd(vrf, netAddr string, nexthop net.IP) error {
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
-	v := r.vrfSet(vrf)
-	return v.NetNexthopAdd(netAddr, nexthop, r)
+	req := &ripNetRequest{op: ripNetNexthopAdd, vrf: vrf, netAddr: netAddr, nexthop: nexthop}
+	r.request(req)
+	return req.err
 }
 
 func (r *RipRouter) NetNexthopDel(vrf, netAddr string, nexthop net.IP) error {
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
-	i, v := r.vrfGet(vrf)
-	if v == nil {
-		return fmt.Errorf("RipRouter.NetNexthopDel: vrf not found: vrf=[%s] addr=[%s]", vrf, netAddr)
-	}
-	err := v.NetNexthopDel(netAddr, nexthop)
-	if v.Empty() {
-		r.vrfDel(i)
-	}
-	return err
+	req := &ripNetRequest{op: ripNetNexthopDel, vrf: vrf, netAddr: netAddr, nexthop: nexthop}
+	r.request(req)
+	return req.err
 }
 
 func (r *RipRouter) NetMetricAdd(vrf, netAddr string, nexthop net.IP, metric int) error {
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
-
-	v := r.vrfSet(vrf)
-	err := v.NetMetricAdd(netAddr, nexthop, metric, r)
-
-	//log.Printf("RipRouter.NetMetricAdd(%s,%s,%v,%d) after:", vrf, netAddr, nexthop, metric)
-	//r.dump(&ripDumper{})
-
-	return err
+	req := &ripNetRequest{op: ripNetMetricAdd, vrf: vrf, netAddr: netAddr, nexthop: nexthop, metric: metric}
+	r.request(req)
+	return req.err
 }
 
 func (r *RipRouter) NetMetricDel(vrf, netAddr string, nexthop net.IP, metric int) error {
-	defer r.vrfMutex.Unlock()
-	r.vrfMutex.Lock()
+	req := &ripNetRequest{op: ripNetMetricDel, vrf: vrf, netAddr: netAddr, nexthop: nexthop, metric: metric}
+	r.request(req)
+	return req.err
+}
 
-	i, v := r.vrfGet(vrf)
-	if v == nil {
-		return fmt.Errorf("RipRouter.NetMetricDel: vrf not found: vrf=[%s] addr=[%s]", vrf, netAddr)
-	}
-	err := v.NetMetricDel(netAddr, nexthop, metric)
-	if v.Empty() {
-		r.vrfDel(i)
-	}
-	return err
+func (r *RipRouter) NetTagAdd(vrf, netAddr string, tag uint16) error {
+	req := &ripNetRequest{op: ripNetTagAdd, vrf: vrf, netAddr: netAddr, tag: tag}
+	r.request(req)
+	return req.err
+}
+
+func (r *RipRouter) NetTagDel(vrf, netAddr string, tag uint16) error {
+	req := &ripNetRequest{op: ripNetTagDel, vrf: vrf, netAddr: netAddr, tag: tag}
+	r.request(req)
+	return req.err
 }
 
 func addInterfaces(r *RipRouter) {
@@ -1264,27 +2204,27 @@ func (r *RipRouter) getInterfaceByIndex(ifIndex int) *port {
 
 func (r *RipRouter) Join(ifi *net.Interface) error {
 
-	ripPort := RIP_PORT
-
-	m, err1 := sock.MulticastListener(ripPort, ifi.Name)
-	if err1 != nil {
-		return fmt.Errorf("RipRouter.Join: open: %v", err1)
+	t, err := newRipUDPTransport(r.family, r.udpPort, r.group, ifi)
+	if err != nil {
+		return fmt.Errorf("RipRouter.Join: %v", err)
 	}
 
-	if err := sock.Join(m, r.group, ifi.Name); err != nil {
-		sock.Close(m)
-		return fmt.Errorf("RipRouter.Join: join: %v", err)
-	}
+	r.portAdd(ifi, t)
+
+	return nil
+}
+
+// portAdd(): attach transport as rip interface, then start receiving from it
+func (r *RipRouter) portAdd(ifi *net.Interface, t ripTransport) {
 
-	newPort := &port{iface: ifi, msock: m}
+	// start sequence number from clock, so it keeps increasing across restarts
+	newPort := &port{iface: ifi, transport: t, authSeq: uint32(r.now().Unix())}
 
 	r.ports = append(r.ports, newPort)
 
-	go udpReader(m.P, r.input, ifi.Name, r.readerDone, ripPort)
+	t.start(r.input, r.readerDone)
 
 	r.readerCount++
-
-	return nil
 }
 
 func delInterfaces(r *RipRouter) {
@@ -1294,7 +2234,37 @@ func delInterfaces(r *RipRouter) {
 	r.ports = nil // cleanup
 }
 
-func udpReader(c *ipv4.PacketConn, input chan<- *udpInfo, ifname string, readerDone chan<- int, listenPort int) {
+// packetReader: hide differences between ipv4 and ipv6 packet connections
+type packetReader interface {
+	readFrom(buf []byte) (n int, src net.Addr, dst net.IP, ifIndex, hopLimit int, err error)
+	Close() error
+}
+
+type ipv4Reader struct {
+	*ipv4.PacketConn
+}
+
+func (c ipv4Reader) readFrom(buf []byte) (int, net.Addr, net.IP, int, int, error) {
+	n, cm, src, err := c.ReadFrom(buf)
+	if cm == nil {
+		return n, src, nil, 0, 0, err
+	}
+	return n, src, cm.Dst, cm.IfIndex, cm.TTL, err
+}
+
+type ipv6Reader struct {
+	*ipv6.PacketConn
+}
+
+func (c ipv6Reader) readFrom(buf []byte) (int, net.Addr, net.IP, int, int, error) {
+	n, cm, src, err := c.ReadFrom(buf)
+	if cm == nil {
+		return n, src, nil, 0, 0, err
+	}
+	return n, src, cm.Dst, cm.IfIndex, cm.HopLimit, err
+}
+
+func udpReader(c packetReader, input chan<- *udpInfo, ifname string, readerDone chan<- int, listenPort int) {
 
 	log.Printf("udpReader: reading from '%s'", ifname)
 
@@ -1304,7 +2274,7 @@ func udpReader(c *ipv4.PacketConn, input chan<- *udpInfo, ifname string, readerD
 
 LOOP:
 	for {
-		n, cm, srcAddr, err1 := c.ReadFrom(buf)
+		n, srcAddr, dstAddr, ifIndex, hopLimit, err1 := c.readFrom(buf)
 		if err1 != nil {
 			log.Printf("udpReader: ReadFrom: error %v", err1)
 			break LOOP
@@ -1322,10 +2292,10 @@ LOOP:
 		var ifi *net.Interface
 		var err2 error
 
-		if cm != nil {
-			ifi, err2 = net.InterfaceByIndex(cm.IfIndex)
+		if ifIndex != 0 {
+			ifi, err2 = net.InterfaceByIndex(ifIndex)
 			if err2 != nil {
-				log.Printf("udpReader: unable to solve ifIndex=%d: error: %v", cm.IfIndex, err2)
+				log.Printf("udpReader: unable to solve ifIndex=%d: error: %v", ifIndex, err2)
 			}
 		}
 
@@ -1335,16 +2305,16 @@ LOOP:
 			name = ifi.Name
 		}
 
-		udpDst := net.UDPAddr{IP: cm.Dst, Port: listenPort}
+		udpDst := net.UDPAddr{IP: dstAddr, Port: listenPort}
 
-		//log.Printf("udpReader: recv %d bytes from %v to %v on %s ifIndex=%d", n, udpSrc, &udpDst, name, cm.IfIndex)
+		//log.Printf("udpReader: recv %d bytes from %v to %v on %s ifIndex=%d", n, udpSrc, &udpDst, name, ifIndex)
 
 		// make a copy because we will overwrite buf
 		b := make([]byte, n)
 		copy(b, buf)
 
 		// deliver udp packet to main rip goroutine
-		input <- &udpInfo{info: b, src: *udpSrc, dst: udpDst, ifIndex: cm.IfIndex, ifName: name}
+		input <- &udpInfo{info: b, src: *udpSrc, dst: udpDst, ifIndex: ifIndex, ifName: name, hopLimit: hopLimit}
 	}
 
 	log.Printf("udpReader: exiting '%s' -- trying", ifname)
@@ -1372,12 +2342,7 @@ func (r *RipRouter) ifClose(i int) {
 
 	log.Printf("RipRouter.ifDel: %s", p.iface.Name)
 
-	if err := sock.Leave(p.msock, r.group, p.iface); err != nil {
-		// warning only
-		log.Printf("RipRouter.ifClose: leave group error: %v", err)
-	}
-
-	sock.Close(p.msock) // break reader goroutine
+	p.transport.close() // break reader goroutine
 }
 
 func (r *RipRouter) ifDel(i int) {
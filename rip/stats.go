@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/udhos/nexthop/command"
+)
+
+// ripStats: per-interface protocol counters
+type ripStats struct {
+	packetsSent      int
+	packetsRecv      int
+	routesSent       int
+	routesRecv       int
+	badPackets       int // packets discarded as malformed or from invalid source
+	badRoutes        int // entries discarded as malformed
+	authFailures     int // packets discarded due to authentication
+	triggeredUpdates int
+}
+
+// ripPeer: neighbor table entry, one per source router
+type ripPeer struct {
+	addr      net.IP
+	ifname    string
+	version   int
+	lastHeard time.Time
+	suspended bool // learning suspended by maximum-prefix
+}
+
+// statsUpdate(): apply update to counters of interface ifname
+func (r *RipRouter) statsUpdate(ifname string, update func(s *ripStats)) {
+	if r.stats == nil {
+		r.stats = map[string]*ripStats{}
+	}
+	s := r.stats[ifname]
+	if s == nil {
+		s = &ripStats{}
+		r.stats[ifname] = s
+	}
+	update(s)
+}
+
+func (r *RipRouter) getStats(ifname string) ripStats {
+	if s := r.stats[ifname]; s != nil {
+		return *s // clone
+	}
+	return ripStats{}
+}
+
+// statsSent(): account for packet successfully sent on interface
+func (r *RipRouter) statsSent(ifname string, routes int) {
+	r.statsUpdate(ifname, func(s *ripStats) {
+		s.packetsSent++
+		s.routesSent += routes
+	})
+}
+
+// peerHeard(): record valid response from source router
+func (r *RipRouter) peerHeard(src net.IP, ifname string, version int, now time.Time) {
+	for _, p := range r.peers {
+		if p.addr.Equal(src) && p.ifname == ifname {
+			p.version = version
+			p.lastHeard = now
+			return
+		}
+	}
+	r.peers = append(r.peers, &ripPeer{addr: src, ifname: ifname, version: version, lastHeard: now})
+}
+
+// peerForget(): remove source router from neighbor table
+func (r *RipRouter) peerForget(src net.IP) {
+	peers := []*ripPeer{}
+	for _, p := range r.peers {
+		if !p.addr.Equal(src) {
+			peers = append(peers, p)
+		}
+	}
+	r.peers = peers
+}
+
+// peerSuspend(): stop learning routes from source router
+func (r *RipRouter) peerSuspend(src net.IP, ifname string) {
+	for _, p := range r.peers {
+		if p.addr.Equal(src) && p.ifname == ifname {
+			p.suspended = true
+			return
+		}
+	}
+}
+
+func (r *RipRouter) peerSuspended(src net.IP, ifname string) bool {
+	for _, p := range r.peers {
+		if p.addr.Equal(src) && p.ifname == ifname {
+			return p.suspended
+		}
+	}
+	return false
+}
+
+// peersResume(): learn again from every suspended source router
+func (r *RipRouter) peersResume() {
+	for _, p := range r.peers {
+		p.suspended = false
+	}
+}
+
+// ClearStatistics(): reset all interface counters
+func (r *RipRouter) ClearStatistics() {
+	r.request(&ripClearStatisticsRequest{})
+}
+
+// peerRoutes(): number of routes currently learned from source router.
+// Runs within RipRouter goroutine.
+func (r *RipRouter) peerRoutes(p *ripPeer) int {
+	count := 0
+	for _, v := range r.vrfs {
+		for _, route := range v.routes {
+			if route.srcExternal && route.srcIfName == p.ifname && route.srcRouter.Equal(p.addr) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (r *RipRouter) ShowInterfaces(c command.LineSender) {
+	r.request(&ripShowRequest{op: ripShowInterfaces, c: c})
+}
+
+func (r *RipRouter) showInterfaces(c command.LineSender) {
+
+	var ifnames []string
+	for ifname := range r.stats {
+		ifnames = append(ifnames, ifname)
+	}
+	sort.Strings(ifnames)
+
+	c.Sendln(fmt.Sprintf("%s interface statistics:", r.protoName()))
+	c.Sendln(fmt.Sprintf("%-8s %8s %8s %8s %8s %7s %7s %7s %7s", "INTERF", "PKT-SENT", "PKT-RECV", "RT-SENT", "RT-RECV", "BAD-PKT", "BAD-RT", "AUTH", "TRIG"))
+
+	for _, ifname := range ifnames {
+		s := r.stats[ifname]
+		c.Sendln(fmt.Sprintf("%-8s %8d %8d %8d %8d %7d %7d %7d %7d", ifname, s.packetsSent, s.packetsRecv, s.routesSent, s.routesRecv,
+			s.badPackets, s.badRoutes, s.authFailures, s.triggeredUpdates))
+	}
+}
+
+func (r *RipRouter) ShowNeighbors(c command.LineSender) {
+	r.request(&ripShowRequest{op: ripShowNeighbors, c: c})
+}
+
+func (r *RipRouter) showNeighbors(c command.LineSender) {
+
+	c.Sendln(fmt.Sprintf("%s neighbors:", r.protoName()))
+	c.Sendln(fmt.Sprintf("%-25s %-8s %3s %6s %-9s %-8s", "NEIGHBOR", "INTERF", "VER", "ROUTES", "STATE", "LAST-HEARD"))
+
+	now := r.now()
+
+	for _, p := range r.peers {
+		lastHeard := now.Sub(p.lastHeard)
+		state := "active"
+		if p.suspended {
+			state = "suspended" // maximum-prefix
+		}
+		c.Sendln(fmt.Sprintf("%-25v %-8s %3d %6d %-9s %8s", p.addr, p.ifname, p.version, r.peerRoutes(p), state, lastHeard))
+	}
+
+	for _, p := range r.peers {
+		max, found := r.getNeighborMaximumPrefix(p.addr)
+		if !found {
+			continue
+		}
+		learned := 0
+		for _, v := range r.vrfs {
+			learned += v.peerPrefixes(p.addr, p.ifname)
+		}
+		c.Sendln(fmt.Sprintf("neighbor=%v on '%s' maximum-prefix: learned=%d limit=%d%s", p.addr, p.ifname, learned, max.limit, maxPrefixMode(max)))
+	}
+
+	for _, v := range r.vrfs {
+		max, found := r.getMaximumPrefix(v.name)
+		if !found {
+			continue
+		}
+		c.Sendln(fmt.Sprintf("vrf=[%s] maximum-prefix: learned=%d limit=%d%s", v.name, v.learnedPrefixes(), max.limit, maxPrefixMode(max)))
+	}
+}
+
+func maxPrefixMode(max ripMaxPrefix) string {
+	if max.warningOnly {
+		return " warning-only"
+	}
+	return ""
+}
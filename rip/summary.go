@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/udhos/nexthop/addr"
+)
+
+func (r *RipRouter) getSummaries(ifname string) []net.IPNet {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	i := r.config[ifname]
+	if i == nil {
+		return nil // not found
+	}
+	return append([]net.IPNet{}, i.summaries...) // clone
+}
+
+func (r *RipRouter) SummaryAddressAdd(ifname, prefix string) error {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("SummaryAddressAdd: parse error: addr=[%s]: %v", prefix, err)
+	}
+	if err1 := addr.CheckMask(ipnet); err1 != nil {
+		return fmt.Errorf("SummaryAddressAdd: bad mask: addr=[%s]: %v", prefix, err1)
+	}
+	if err2 := r.checkFamily(ipnet); err2 != nil {
+		return fmt.Errorf("SummaryAddressAdd: %v", err2)
+	}
+
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	i := r.interfaceConfigSet(ifname)
+	for _, s := range i.summaries {
+		if addr.NetEqual(&s, ipnet) {
+			return nil // already present
+		}
+	}
+	i.summaries = append(i.summaries, *ipnet)
+	return nil
+}
+
+func (r *RipRouter) SummaryAddressDel(ifname, prefix string) error {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("SummaryAddressDel: parse error: addr=[%s]: %v", prefix, err)
+	}
+
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	i := r.config[ifname]
+	if i != nil {
+		for j, s := range i.summaries {
+			if addr.NetEqual(&s, ipnet) {
+				i.summaries = append(i.summaries[:j], i.summaries[j+1:]...) // keep order
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("SummaryAddressDel: summary-address not found: %s interface=[%s]", prefix, ifname)
+}
+
+// summaryContains(): prefix is equal to or more specific than summary
+func summaryContains(summary, prefix *net.IPNet) bool {
+	summaryLen, bits := summary.Mask.Size()
+	prefixLen, prefixBits := prefix.Mask.Size()
+	if bits != prefixBits || prefixLen < summaryLen {
+		return false
+	}
+	return summary.Contains(prefix.IP)
+}
+
+/*
+ripSummarize(): replace components of every summary with a single aggregate entry.
+The aggregate is placed at the position of its first component and carries the
+lowest component metric. While no component is valid, the aggregate is advertised
+with metric infinity, so that neighbors can drop it.
+The aggregate is flagged as changed when any of its components changed.
+*/
+func ripSummarize(summaries []net.IPNet, routes []*ripRoute, metrics []int, tags []uint16, changed []bool) ([]*ripRoute, []int, []uint16, []bool) {
+
+	sumRoutes := []*ripRoute{}
+	sumMetrics := []int{}
+	sumTags := []uint16{}
+	sumChanged := []bool{}
+	sumIndex := map[int]int{} // summary => position of aggregate
+
+LOOP:
+	for i, route := range routes {
+		for j := range summaries {
+			s := &summaries[j]
+			if !summaryContains(s, &route.addr) {
+				continue
+			}
+			k, found := sumIndex[j]
+			if !found {
+				// first component: create aggregate
+				sumIndex[j] = len(sumRoutes)
+				aggregate := &ripRoute{addr: *s, nexthop: unspecifiedAddr(s), metric: metrics[i]}
+				sumRoutes = append(sumRoutes, aggregate)
+				sumMetrics = append(sumMetrics, metrics[i])
+				sumTags = append(sumTags, 0)
+				sumChanged = append(sumChanged, changed[i])
+				continue LOOP
+			}
+			// further component: update aggregate
+			if metrics[i] < sumMetrics[k] {
+				sumMetrics[k] = metrics[i]
+				sumRoutes[k].metric = metrics[i]
+			}
+			sumChanged[k] = sumChanged[k] || changed[i]
+			continue LOOP
+		}
+
+		// not covered by any summary
+		sumRoutes = append(sumRoutes, route)
+		sumMetrics = append(sumMetrics, metrics[i])
+		sumTags = append(sumTags, tags[i])
+		sumChanged = append(sumChanged, changed[i])
+	}
+
+	return sumRoutes, sumMetrics, sumTags, sumChanged
+}
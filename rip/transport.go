@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/udhos/nexthop/sock"
+)
+
+// ripTransport: packet I/O on one RIP interface.
+// UDP sockets are used by the daemon; tests plug in an in-memory network.
+type ripTransport interface {
+	start(input chan<- *udpInfo, readerDone chan<- int) // spawn goroutine delivering received packets into input
+	send(dst *net.UDPAddr, buf []byte) error
+	close() // leave group and break receiving goroutine
+}
+
+/*
+ripUDPTransport: one multicast listener socket per interface, used both
+for receiving and for sending.
+
+Sending must not use a second socket bound to the RIP port: with
+SO_REUSEADDR, Linux delivers unicast to the socket bound last, hence
+unicast requests and neighbor updates would be lost on a socket nobody
+reads.
+*/
+type ripUDPTransport struct {
+	iface  *net.Interface
+	group  net.IP
+	port   int
+	msock  *sock.MulticastSock  // RIPv2
+	msock6 *sock.MulticastSock6 // RIPng
+}
+
+func newRipUDPTransport(family, udpPort int, group net.IP, ifi *net.Interface) (*ripUDPTransport, error) {
+
+	t := &ripUDPTransport{iface: ifi, group: group, port: udpPort}
+
+	if family == RIP_FAMILY_INET6 {
+		m, err1 := sock.MulticastListener6(udpPort, ifi.Name)
+		if err1 != nil {
+			return nil, fmt.Errorf("open: %v", err1)
+		}
+		if err := sock.Join6(m, group, ifi.Name); err != nil {
+			sock.Close6(m)
+			return nil, fmt.Errorf("join: %v", err)
+		}
+		ripngSendOptions(m.P, ifi.Name)
+		t.msock6 = m
+		return t, nil
+	}
+
+	m, err1 := sock.MulticastListener(udpPort, ifi.Name)
+	if err1 != nil {
+		return nil, fmt.Errorf("open: %v", err1)
+	}
+	if err := sock.Join(m, group, ifi.Name); err != nil {
+		sock.Close(m)
+		return nil, fmt.Errorf("join: %v", err)
+	}
+	ripSendOptions(m.P, ifi.Name)
+	t.msock = m
+	return t, nil
+}
+
+func (t *ripUDPTransport) start(input chan<- *udpInfo, readerDone chan<- int) {
+	if t.msock6 != nil {
+		go udpReader(ipv6Reader{t.msock6.P}, input, t.iface.Name, readerDone, t.port)
+		return
+	}
+	go udpReader(ipv4Reader{t.msock.P}, input, t.iface.Name, readerDone, t.port)
+}
+
+func (t *ripUDPTransport) send(dst *net.UDPAddr, buf []byte) error {
+
+	var conn *net.UDPConn
+	if t.msock6 != nil {
+		conn = t.msock6.U
+	} else {
+		conn = t.msock.U
+	}
+
+	// Set 500 ms timeout
+	timeout := time.Duration(500) * time.Millisecond
+	deadline := time.Now().Add(timeout)
+	conn.SetWriteDeadline(deadline)
+
+	size := len(buf)
+
+	n, err := conn.WriteToUDP(buf, dst)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("partial %d/%d write", n, size)
+	}
+
+	return nil
+}
+
+func (t *ripUDPTransport) close() {
+
+	if t.msock6 != nil {
+		if err := sock.Leave6(t.msock6, t.group, t.iface); err != nil {
+			// warning only
+			log.Printf("ripUDPTransport.close: leave group error: %v", err)
+		}
+
+		sock.Close6(t.msock6) // break reader goroutine
+		return
+	}
+
+	if err := sock.Leave(t.msock, t.group, t.iface); err != nil {
+		// warning only
+		log.Printf("ripUDPTransport.close: leave group error: %v", err)
+	}
+
+	sock.Close(t.msock) // break reader goroutine
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"net"
+
+	"github.com/udhos/nexthop/addr"
+	"github.com/udhos/nexthop/netorder"
+)
+
+/*
+RFC2453 5.1 Compatibility Switch
+
+The compatibility switch selects, per interface, which versions are sent
+and which versions are accepted. The router version provides the
+defaults for interfaces without explicit settings.
+*/
+
+// send version modes
+const (
+	RIP_SEND_DEFAULT    = 0 // follow router version
+	RIP_SEND_V1         = 1 // RIPv1 broadcast
+	RIP_SEND_V2         = 2 // RIPv2 multicast
+	RIP_SEND_COMPATIBLE = 3 // RIPv2 broadcast, so that RIPv1 routers can listen to it
+)
+
+// receive version modes: bitmask of accepted versions
+const (
+	RIP_RECV_DEFAULT = 0 // follow router version
+	RIP_RECV_V1      = 1
+	RIP_RECV_V2      = 2
+	RIP_RECV_BOTH    = RIP_RECV_V1 | RIP_RECV_V2
+)
+
+// SetVersion(): router version -- zero: default (send RIPv2, receive both)
+func (r *RipRouter) SetVersion(version int) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.version = version
+}
+
+func (r *RipRouter) setInterfaceSendVersion(ifname string, mode int) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.interfaceConfigSet(ifname).sendVersion = mode
+}
+
+func (r *RipRouter) setInterfaceRecvVersion(ifname string, mode int) {
+	defer r.configMutex.Unlock()
+	r.configMutex.Lock()
+
+	r.interfaceConfigSet(ifname).recvVersion = mode
+}
+
+// getInterfaceSendVersion(): effective send mode for interface
+func (r *RipRouter) getInterfaceSendVersion(ifname string) int {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	if i := r.config[ifname]; i != nil && i.sendVersion != RIP_SEND_DEFAULT {
+		return i.sendVersion
+	}
+	if r.version == RIP_V1 {
+		return RIP_SEND_V1
+	}
+	return RIP_SEND_V2
+}
+
+// getInterfaceRecvVersion(): effective receive mode for interface
+func (r *RipRouter) getInterfaceRecvVersion(ifname string) int {
+	defer r.configMutex.RUnlock()
+	r.configMutex.RLock()
+
+	if i := r.config[ifname]; i != nil && i.recvVersion != RIP_RECV_DEFAULT {
+		return i.recvVersion
+	}
+	switch r.version {
+	case RIP_V1:
+		return RIP_RECV_V1
+	case RIP_V2:
+		return RIP_RECV_V2
+	}
+	return RIP_RECV_BOTH
+}
+
+// ripRecvAccept(): receive mode accepts packet version.
+// Versions above 2 are handled as RIPv2 (RFC2453 4 Protocol Extensions).
+func ripRecvAccept(mode, version int) bool {
+	switch {
+	case version < RIP_V1:
+		return false // version 0 must be discarded
+	case version == RIP_V1:
+		return mode&RIP_RECV_V1 != 0
+	}
+	return mode&RIP_RECV_V2 != 0
+}
+
+// ripClassfulMask(): natural mask for address class
+func ripClassfulMask(ip net.IP) net.IPMask {
+	ip4 := ip.To4()
+	switch {
+	case ip4 == nil:
+		return nil
+	case ip4[0] < 128:
+		return net.CIDRMask(8, 32) // class A
+	case ip4[0] < 192:
+		return net.CIDRMask(16, 32) // class B
+	case ip4[0] < 224:
+		return net.CIDRMask(24, 32) // class C
+	}
+	return net.CIDRMask(32, 32) // class D/E
+}
+
+// ripInterfaceSubnet(): mask of interface address within classful network, if any
+func ripInterfaceSubnet(major *net.IPNet, ifaceAddrs []net.IPNet) net.IPMask {
+	classOnes, _ := major.Mask.Size()
+	for _, a := range ifaceAddrs {
+		if a.IP.To4() == nil {
+			continue // not ipv4
+		}
+		mask := a.Mask
+		if len(mask) == net.IPv6len {
+			mask = mask[net.IPv6len-net.IPv4len:] // ipv4 mask in 16-byte form
+		}
+		ones, _ := mask.Size()
+		if ones > classOnes && major.Contains(a.IP) {
+			return mask
+		}
+	}
+	return nil
+}
+
+/*
+ripV1Mask(): derive mask for RIPv1 entry, which carries no mask.
+
+RFC1058 3.2 Addressing considerations
+An address within a directly-connected network takes the subnet mask of
+the interface. Other addresses take the natural mask of their class.
+An address with host bits set beyond that mask is a host route.
+*/
+func ripV1Mask(ip net.IP, ifaceAddrs []net.IPNet) net.IPMask {
+	if ip.Equal(net.IPv4zero) {
+		return net.CIDRMask(0, 32) // default route
+	}
+
+	mask := ripClassfulMask(ip)
+	major := net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	if subnet := ripInterfaceSubnet(&major, ifaceAddrs); subnet != nil {
+		mask = subnet
+	}
+
+	if !ip.Mask(mask).Equal(ip) {
+		return net.CIDRMask(32, 32) // host route
+	}
+
+	return mask
+}
+
+/*
+ripV1Routes(): adapt routes to be advertised as RIPv1, which carries no mask.
+Routes within the classful network of the interface are sent only when
+their mask matches the interface subnet (or are host routes), since
+receivers apply the interface mask. Routes from other classful networks
+are summarized into their natural network.
+*/
+func ripV1Routes(ifaceAddrs []net.IPNet, routes []*ripRoute, metrics []int, tags []uint16, changed []bool) ([]*ripRoute, []int, []uint16, []bool) {
+
+	v1Routes := []*ripRoute{}
+	v1Metrics := []int{}
+	v1Tags := []uint16{}
+	v1Changed := []bool{}
+	majors := []net.IPNet{}
+
+	for i, route := range routes {
+		ones, _ := route.addr.Mask.Size()
+		if ones > 0 {
+			mask := ripClassfulMask(route.addr.IP)
+			major := net.IPNet{IP: route.addr.IP.Mask(mask), Mask: mask}
+			if subnet := ripInterfaceSubnet(&major, ifaceAddrs); subnet != nil {
+				subnetOnes, _ := subnet.Size()
+				if ones != subnetOnes && ones != 32 {
+					continue // mask not representable on this subnet
+				}
+			} else {
+				found := false
+				for _, m := range majors {
+					if addr.NetEqual(&m, &major) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					majors = append(majors, major)
+				}
+			}
+		}
+		v1Routes = append(v1Routes, route)
+		v1Metrics = append(v1Metrics, metrics[i])
+		v1Tags = append(v1Tags, 0) // RIPv1 carries no tag
+		v1Changed = append(v1Changed, changed[i])
+	}
+
+	if len(majors) > 0 {
+		return ripSummarize(majors, v1Routes, v1Metrics, v1Tags, v1Changed)
+	}
+
+	return v1Routes, v1Metrics, v1Tags, v1Changed
+}
+
+// setEntryV1(): RIPv1 entry: must-be-zero fields are left untouched
+func setEntryV1(buf []byte, entry int, family int, netaddr net.IP, metric int) {
+	offset := ripEntryOffset(entry)
+
+	netorder.WriteUint16(buf, offset, uint16(family))
+	addr.WriteIPv4(buf, offset+4, netaddr)
+	netorder.WriteUint32(buf, offset+16, uint32(metric))
+}
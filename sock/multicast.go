@@ -85,6 +85,12 @@ func udpConn(laddr *net.UDPAddr, ifname string) (net.PacketConn, error) {
 		}
 	}
 
+	// allow sending to broadcast address (RIPv1)
+	if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); err != nil {
+		syscall.Close(s)
+		return nil, fmt.Errorf("MulticastListener: could not set broadcast socket(laddr=%v,ifname=%s): %v", laddr, ifname, err)
+	}
+
 	lsa := syscall.SockaddrInet4{Port: laddr.Port}
 	copy(lsa.Addr[:], laddr.IP.To4())
 
@@ -0,0 +1,114 @@
+package sock
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/ipv6"
+)
+
+type MulticastSock6 struct {
+	P *ipv6.PacketConn
+	U *net.UDPConn
+}
+
+func NewUDPConn6(laddr *net.UDPAddr, ifname string) (*net.UDPConn, error) {
+
+	c, err := udpConn6(laddr, ifname)
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.(*net.UDPConn)
+
+	return u, nil
+}
+
+func udpConn6(laddr *net.UDPAddr, ifname string) (net.PacketConn, error) {
+	if laddr == nil {
+		laddr = &net.UDPAddr{IP: net.IPv6unspecified, Port: 0}
+	}
+
+	s, err1 := syscall.Socket(syscall.AF_INET6, syscall.SOCK_DGRAM, syscall.IPPROTO_UDP)
+	if err1 != nil {
+		return nil, fmt.Errorf("MulticastListener6: could not create socket(laddr=%v,ifname=%s): %v", laddr, ifname, err1)
+	}
+	if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		syscall.Close(s)
+		return nil, fmt.Errorf("MulticastListener6: could not set reuse addr socket(laddr=%v,ifname=%s): %v", laddr, ifname, err)
+	}
+	if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 1); err != nil {
+		syscall.Close(s)
+		return nil, fmt.Errorf("MulticastListener6: could not set ipv6-only socket(laddr=%v,ifname=%s): %v", laddr, ifname, err)
+	}
+	if ifname != "" {
+		if err := syscall.SetsockoptString(s, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, ifname); err != nil {
+			syscall.Close(s)
+			return nil, fmt.Errorf("MulticastListener6: could not bind to device socket(laddr=%v, ifname=%s): %v", laddr, ifname, err)
+		}
+	}
+
+	lsa := syscall.SockaddrInet6{Port: laddr.Port}
+	copy(lsa.Addr[:], laddr.IP.To16())
+
+	if err := syscall.Bind(s, &lsa); err != nil {
+		syscall.Close(s)
+		return nil, fmt.Errorf("MulticastListener6: could not bind socket to address %v: %v", laddr, err)
+	}
+	f := os.NewFile(uintptr(s), "")
+	c, err2 := net.FilePacketConn(f)
+	f.Close()
+	if err2 != nil {
+		syscall.Close(s)
+		return nil, fmt.Errorf("MulticastListener6: could not get packet connection for socket(laddr=%v,ifname=%s): %v", laddr, ifname, err2)
+	}
+
+	return c, nil
+}
+
+func MulticastListener6(port int, ifname string) (*MulticastSock6, error) {
+
+	c, err := udpConn6(&net.UDPAddr{IP: net.IPv6unspecified, Port: port}, ifname)
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.(*net.UDPConn)
+	p := ipv6.NewPacketConn(c)
+
+	if err := p.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
+		return nil, fmt.Errorf("MulticastListener6: could not set control message flags: %v", err)
+	}
+
+	return &MulticastSock6{P: p, U: u}, nil
+}
+
+func Join6(sock *MulticastSock6, group net.IP, ifname string) error {
+	ifi, err1 := net.InterfaceByName(ifname)
+	if err1 != nil {
+		return fmt.Errorf("Join6: could not find interface %s: %v", ifname, err1)
+	}
+
+	if err := sock.P.JoinGroup(ifi, &net.UDPAddr{IP: group}); err != nil {
+		return fmt.Errorf("Join6: could not join group %v on interface %s: %v", group, ifname, err)
+	}
+
+	return nil
+}
+
+func Leave6(sock *MulticastSock6, group net.IP, ifi *net.Interface) error {
+	if err := sock.P.LeaveGroup(ifi, &net.UDPAddr{IP: group}); err != nil {
+		return fmt.Errorf("Leave6: could not leave group %v on interface %s: %v", group, ifi.Name, err)
+	}
+
+	return nil
+}
+
+func Close6(sock *MulticastSock6) {
+	sock.P.Close()
+	sock.U.Close()
+	sock.P = nil
+	sock.U = nil
+}
@@ -1,35 +1,153 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/udhos/nexthop/addr"
 	"github.com/udhos/nexthop/netorder"
+	"github.com/udhos/nexthop/sock"
+	"golang.org/x/net/ipv4"
 )
 
+const (
+	ripRequest     = 1
+	ripResponse    = 2
+	ripHeaderSize  = 4
+	ripEntrySize   = 20
+	ripFamilyAuth  = 0xFFFF
+	ripGroup       = "224.0.0.9:520"
+	ripMaxDatagram = 512
+)
+
+// ripEntry: decoded RTE
+type ripEntry struct {
+	Family  int    `json:"family"`
+	Tag     int    `json:"tag"`
+	Prefix  string `json:"prefix"`
+	Nexthop string `json:"nexthop"`
+	Metric  int    `json:"metric"`
+}
+
+// ripAnswer: entries received from one responding router
+type ripAnswer struct {
+	Source  string     `json:"source"`
+	Version int        `json:"version"`
+	Entries []ripEntry `json:"entries"`
+}
+
 func main() {
 
-	if len(os.Args) < 3 {
-		fmt.Printf("usage:   rip-query host:port     net1 [ net2  ... netN ]\n")
-		fmt.Printf("example: rip-query 224.0.0.9:520 1.0.0.0/24       2.0.0.0/24\n")
-		fmt.Printf("example: rip-query 224.0.0.9:520 0.0.0.0/0,0\n")
+	var all, jsonOutput bool
+	var ifname string
+	var timeout time.Duration
+
+	flag.BoolVar(&all, "all", false, "query every neighbor on multicast group "+ripGroup+" (host:port argument is omitted)")
+	flag.StringVar(&ifname, "interface", "", "send query through interface (required for -all on multi-homed hosts)")
+	flag.BoolVar(&jsonOutput, "json", false, "print responses as JSON")
+	flag.DurationVar(&timeout, "timeout", 2*time.Second, "wait for responses during this period")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	hostPort := ripGroup
+	if !all {
+		if len(args) < 1 {
+			usage()
+			return
+		}
+		hostPort = args[0]
+		args = args[1:]
+	}
+	if len(args) < 1 {
+		usage()
 		return
 	}
 
-	query(os.Args[1], os.Args[2:])
+	if err := query(hostPort, args, all, ifname, timeout, jsonOutput); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Printf("usage:   rip-query [options]      host:port     net1 [ net2  ... netN ]\n")
+	fmt.Printf("         rip-query [options] -all               net1 [ net2  ... netN ]\n")
+	fmt.Printf("example: rip-query 10.0.0.1:520 1.0.0.0/24       2.0.0.0/24\n")
+	fmt.Printf("example: rip-query -json 10.0.0.1:520 0.0.0.0/0,0\n")
+	fmt.Printf("example: rip-query -all -interface eth0 0.0.0.0/0,0\n")
+	fmt.Printf("options:\n")
+	flag.PrintDefaults()
+}
+
+func query(hostPort string, nets []string, all bool, ifname string, timeout time.Duration, jsonOutput bool) error {
+
+	buf, errReq := buildRequest(nets)
+	if errReq != nil {
+		return errReq
+	}
+
+	proto := "udp"
+
+	raddr, err := net.ResolveUDPAddr(proto, hostPort)
+	if err != nil {
+		return fmt.Errorf("could not solve udp endpoint: '%s': %v", hostPort, err)
+	}
+
+	// unconnected socket on ephemeral port: responses from group members come from their unicast addresses
+	conn, err := sock.NewUDPConn(&net.UDPAddr{IP: net.IPv4zero, Port: 0}, ifname)
+	if err != nil {
+		return fmt.Errorf("could not create socket: %v", err)
+	}
+	defer conn.Close()
+
+	if ifname != "" && raddr.IP.IsMulticast() {
+		ifi, errIf := net.InterfaceByName(ifname)
+		if errIf != nil {
+			return fmt.Errorf("could not find interface: '%s': %v", ifname, errIf)
+		}
+		if errMcast := ipv4.NewPacketConn(conn).SetMulticastInterface(ifi); errMcast != nil {
+			return fmt.Errorf("could not set multicast interface: '%s': %v", ifname, errMcast)
+		}
+	}
+
+	n, err := conn.WriteToUDP(buf, raddr)
+	if err != nil {
+		return fmt.Errorf("could not send rip dgram: size=%d to %v: %v", len(buf), raddr, err)
+	}
+	if n != len(buf) {
+		return fmt.Errorf("partial write rip dgram: sent=%d size=%d to %v", n, len(buf), raddr)
+	}
+
+	if !jsonOutput {
+		fmt.Printf("sent rip dgram: size=%d to %v from %v\n", len(buf), raddr, conn.LocalAddr())
+	}
+
+	answers := receive(conn, raddr, all, timeout)
+
+	if jsonOutput {
+		return printJSON(answers)
+	}
+
+	printTable(answers)
+
+	return nil
 }
 
-func query(hostPort string, nets []string) {
+// buildRequest(): encode RIPv2 request for networks "prefix[,family]"
+func buildRequest(nets []string) ([]byte, error) {
 
 	entries := len(nets)
-	bufSize := 4 + 20*entries
-	buf := make([]byte, bufSize, bufSize)
+	bufSize := ripHeaderSize + ripEntrySize*entries
+	buf := make([]byte, bufSize)
 
-	buf[0] = 1 // rip request
+	buf[0] = ripRequest
 	buf[1] = 2 // rip version
 
 	for i, n := range nets {
@@ -37,22 +155,19 @@ func query(hostPort string, nets []string) {
 		f := strings.Split(n, ",")
 		if len(f) > 1 {
 			af, err := strconv.Atoi(f[1])
-			if err == nil {
-				family = uint16(af)
-				n = f[0]
-			} else {
-				fmt.Printf("could not solve address family: '%s': %v\n", n, err)
-				return
+			if err != nil {
+				return nil, fmt.Errorf("could not solve address family: '%s': %v", n, err)
 			}
+			family = uint16(af)
+			n = f[0]
 		}
 
 		_, netaddr, err := net.ParseCIDR(n)
 		if err != nil {
-			fmt.Printf("could not solve network: '%s': %v\n", n, err)
-			return
+			return nil, fmt.Errorf("could not solve network: '%s': %v", n, err)
 		}
 
-		offset := 4 + 20*i
+		offset := ripHeaderSize + ripEntrySize*i
 		netorder.WriteUint16(buf, offset, family)
 		netorder.WriteUint16(buf, offset+2, 0) // route tag
 		addr.WriteIPv4(buf, offset+4, netaddr.IP)
@@ -61,29 +176,117 @@ func query(hostPort string, nets []string) {
 		netorder.WriteUint32(buf, offset+16, 16) // metric
 	}
 
-	proto := "udp"
+	return buf, nil
+}
 
-	raddr, err := net.ResolveUDPAddr(proto, hostPort)
-	if err != nil {
-		fmt.Printf("could not solve udp endpoint: '%s': %v\n", hostPort, err)
-		return
+// receive(): collect responses until timeout.
+// Without all, only responses from the queried router are accepted.
+func receive(conn *net.UDPConn, raddr *net.UDPAddr, all bool, timeout time.Duration) []*ripAnswer {
+
+	answers := []*ripAnswer{}
+	buf := make([]byte, ripMaxDatagram)
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+				fmt.Fprintf(os.Stderr, "read error: %v\n", err)
+			}
+			break
+		}
+
+		if !all && !src.IP.Equal(raddr.IP) {
+			fmt.Fprintf(os.Stderr, "ignoring dgram from unexpected source: %v\n", src)
+			continue
+		}
+
+		version, entries, errDecode := decodeResponse(buf[:n])
+		if errDecode != nil {
+			fmt.Fprintf(os.Stderr, "bad dgram from %v: %v\n", src, errDecode)
+			continue
+		}
+
+		// large tables span multiple datagrams: merge per source
+		source := src.String()
+		var answer *ripAnswer
+		for _, a := range answers {
+			if a.Source == source {
+				answer = a
+				break
+			}
+		}
+		if answer == nil {
+			answer = &ripAnswer{Source: source, Version: version, Entries: []ripEntry{}}
+			answers = append(answers, answer)
+		}
+		answer.Entries = append(answer.Entries, entries...)
 	}
 
-	conn, err := net.DialUDP(proto, nil, raddr)
-	if err != nil {
-		fmt.Printf("could not create connection for remote endpoint: %v: %v\n", raddr, err)
-		return
+	return answers
+}
+
+// decodeResponse(): RTEs from RIP response, skipping authentication entry
+func decodeResponse(buf []byte) (int, []ripEntry, error) {
+
+	size := len(buf)
+	if size < ripHeaderSize {
+		return 0, nil, fmt.Errorf("short dgram: size=%d", size)
+	}
+	if (size-ripHeaderSize)%ripEntrySize != 0 {
+		return 0, nil, fmt.Errorf("bad dgram size=%d", size)
 	}
 
-	n, err := conn.Write(buf)
-	if err != nil {
-		fmt.Printf("could not send rip dgram: size=%d to %v: %v\n", len(buf), raddr, err)
-		return
+	command := int(buf[0])
+	if command != ripResponse {
+		return 0, nil, fmt.Errorf("not a response: command=%d", command)
 	}
-	if n != len(buf) {
-		fmt.Printf("partil write rip dgram: sent=%d size=%d to %v: %v\n", n, len(buf), raddr, err)
+	version := int(buf[1])
+
+	entries := []ripEntry{}
+	for offset := ripHeaderSize; offset < size; offset += ripEntrySize {
+		family := int(netorder.ReadUint16(buf, offset))
+		if family == ripFamilyAuth {
+			continue
+		}
+		ip := addr.ReadIPv4(buf, offset+4)
+		prefix := ip.String() // RIPv1 carries no mask: show plain address
+		if version > 1 {
+			mask := addr.ReadIPv4Mask(buf, offset+8)
+			prefix = (&net.IPNet{IP: ip, Mask: mask}).String()
+		}
+		entries = append(entries, ripEntry{
+			Family:  family,
+			Tag:     int(netorder.ReadUint16(buf, offset+2)),
+			Prefix:  prefix,
+			Nexthop: addr.ReadIPv4(buf, offset+12).String(),
+			Metric:  int(netorder.ReadUint32(buf, offset+16)),
+		})
+	}
+
+	return version, entries, nil
+}
+
+func printTable(answers []*ripAnswer) {
+	if len(answers) == 0 {
+		fmt.Printf("no response\n")
 		return
 	}
+	for _, a := range answers {
+		fmt.Printf("response from %s version=%d entries=%d\n", a.Source, a.Version, len(a.Entries))
+		fmt.Printf("%-6s %-5s %-18s %-15s %6s\n", "FAMILY", "TAG", "PREFIX", "NEXTHOP", "METRIC")
+		for _, e := range a.Entries {
+			fmt.Printf("%-6d %-5d %-18s %-15s %6d\n", e.Family, e.Tag, e.Prefix, e.Nexthop, e.Metric)
+		}
+	}
+}
 
-	fmt.Printf("sent rip dgram: size=%d to %v\n", len(buf), raddr)
+func printJSON(answers []*ripAnswer) error {
+	buf, err := json.MarshalIndent(answers, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json encoding error: %v", err)
+	}
+	fmt.Printf("%s\n", buf)
+	return nil
 }